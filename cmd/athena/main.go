@@ -11,15 +11,22 @@ import (
 
 func main() {
 	var configPath string
+	var initConfig bool
 	flag.StringVar(&configPath, "c", "", "Path to the configuration file (shorthand)")
+	flag.BoolVar(&initConfig, "init-config", false, "Write commented default config files to ~/.config/athena and exit")
 
 	flag.Usage = func() {
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-c config_path] <filename>\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-c config_path] <filename>\n       %s --init-config\n", os.Args[0], os.Args[0])
 		flag.PrintDefaults()
 	}
 
 	flag.Parse()
 
+	if initConfig {
+		runInitConfig()
+		return
+	}
+
 	args := flag.Args()
 
 	// Check if the filename is provided
@@ -32,18 +39,18 @@ func main() {
 
 	// Load the configuration
 	cfg, errors := config.LoadConfig(&configPath)
-	if len(errors) > 0 {
-		for _, errMsg := range errors {
-			fmt.Println("Config error:", errMsg)
-		}
-		os.Exit(1)
-	}
+	reportConfigErrors(errors)
+
+	// Load per-language settings from the default location
+	langs, langErrors := config.LoadLanguagesConfig(nil)
+	reportConfigErrors(langErrors)
 
-	a, err := athena.NewAthena(cfg, filePath)
+	a, err := athena.NewAthena(cfg, langs, filePath)
 	if err != nil {
 		fmt.Printf("Error initializing Athena: %v\n", err)
 		os.Exit(1)
 	}
+	a.LogConfigErrors(append(errors, langErrors...))
 
 	if err := a.Run(); err != nil {
 		fmt.Printf("Error running editor: %v\n", err)
@@ -51,6 +58,37 @@ func main() {
 	}
 }
 
+// runInitConfig writes the default config files, reporting what it wrote.
+func runInitConfig() {
+	dir, err := config.Dir()
+	if err != nil {
+		fmt.Printf("Error finding config directory: %v\n", err)
+		os.Exit(1)
+	}
+	written, err := config.InitConfig(dir)
+	for _, path := range written {
+		fmt.Printf("Wrote %s\n", path)
+	}
+	if err != nil {
+		fmt.Printf("Error writing config: %v\n", err)
+		os.Exit(1)
+	}
+	if len(written) == 0 {
+		fmt.Printf("Config files already exist in %s\n", dir)
+	}
+}
+
+// reportConfigErrors prints config errors and exits when any of them is fatal;
+// warnings alone still launch the editor with defaults for the bad values.
+func reportConfigErrors(errors []config.ConfigError) {
+	for _, err := range errors {
+		fmt.Printf("Config %s: %s\n", err.Severity, err)
+	}
+	if config.HasFatal(errors) {
+		os.Exit(1)
+	}
+}
+
 func printUsage() {
 
 }
@@ -2,10 +2,12 @@ package athena
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/lg2m/athena/internal/athena/config"
 	"github.com/lg2m/athena/internal/editor"
+	"github.com/lg2m/athena/internal/editor/buffer"
 	"github.com/lg2m/athena/internal/ui"
 )
 
@@ -15,15 +17,19 @@ type Athena struct {
 	cfg    *config.Config
 	editor *editor.Editor
 	views  struct {
-		gutters   *ui.GuttersView
-		document  *ui.DocumentView
-		statusBar *ui.StatusBarView
+		gutters     *ui.GuttersView
+		document    *ui.DocumentView
+		statusBar   *ui.StatusBarView
+		commandLine *ui.CommandLineView
+		messages    *ui.MessagesView
 	}
-	viewport *ui.Viewport // Shared viewport for synchronized scrolling
+	viewport       *ui.Viewport // Shared viewport for synchronized scrolling
+	gutterWidth    int          // width the views were last laid out with
+	messagesHeight int          // height of the message log panel the views were laid out with, 0 when closed
 }
 
 // NewAthena creates an instance of the athena text-editor.
-func NewAthena(cfg *config.Config, filePath string) (*Athena, error) {
+func NewAthena(cfg *config.Config, langs *config.LanguagesConfig, filePath string) (*Athena, error) {
 	screen, err := tcell.NewScreen()
 	if err != nil {
 		return nil, err
@@ -33,6 +39,10 @@ func NewAthena(cfg *config.Config, filePath string) (*Athena, error) {
 		return nil, fmt.Errorf("failed to initialize screen: %w", err)
 	}
 
+	if cfg.Editor.Mouse {
+		screen.EnableMouse()
+	}
+
 	a := &Athena{
 		screen:   screen,
 		cfg:      cfg,
@@ -40,11 +50,36 @@ func NewAthena(cfg *config.Config, filePath string) (*Athena, error) {
 		viewport: ui.NewViewport(cfg.Editor.ScrollPadding),
 	}
 
+	a.editor.SetLargeFileThreshold(cfg.Editor.LargeFile)
+	a.editor.SetFixEOLOnSave(cfg.Editor.FixEOLOnSave)
+	a.editor.SetMaxUndo(cfg.Editor.MaxUndo)
+	a.editor.SetIndentationResolver(func(fileName string) buffer.Indentation {
+		style, width := langs.ResolveIndent(cfg.Editor, fileName)
+		return buffer.Indentation{UseTabs: style == config.IndentStyleTab, TabWidth: width}
+	})
+	a.editor.SetSyntaxResolver(func(fileName string) bool {
+		return langs.ResolveSyntax(cfg.Editor, fileName)
+	})
+	a.editor.SetCommentResolver(func(fileName string) buffer.CommentTokens {
+		line, block := langs.ResolveComments(fileName)
+		return buffer.CommentTokens{Line: line, BlockStart: block.Start, BlockEnd: block.End}
+	})
+	_ = a.editor.Commands().Register("config", a.configCommand)
 	if err := a.editor.OpenFile(filePath); err != nil {
 		return nil, fmt.Errorf("failed to load file: %w", err)
 	}
 
 	a.initializeViews()
+	a.checkIndentation()
+	if a.editor.IsChunked() {
+		a.editor.SetMessage("Large file: opened read-only, syntax highlighting and search disabled")
+	}
+	if a.editor.IsLossyDecoded() {
+		a.editor.SetMessage("File is not valid UTF-8: invalid bytes are shown as U+FFFD")
+	}
+	if encoding, _ := a.editor.Encoding(); encoding == buffer.EncodingLatin1 {
+		a.editor.SetMessage("File is not valid UTF-8: opened as latin1")
+	}
 
 	return a, nil
 }
@@ -53,7 +88,7 @@ func NewAthena(cfg *config.Config, filePath string) (*Athena, error) {
 func (a *Athena) Run() error {
 	defer a.screen.Fini()
 
-	for {
+	for !a.editor.QuitRequested() {
 		a.draw()
 		a.screen.Show()
 
@@ -61,39 +96,154 @@ func (a *Athena) Run() error {
 
 		switch ev := ev.(type) {
 		case *tcell.EventKey:
-			if ev.Key() == tcell.KeyCtrlC {
+			// with gui-clipboard on, <c-c> copies an active mouse selection instead of quitting
+			if ev.Key() == tcell.KeyCtrlC && !(a.cfg.Editor.GuiClipboard && a.views.document.HasMouseSelection()) {
 				return nil
 			}
+			a.editor.SetMessage("")
 		case *tcell.EventResize:
 			a.screen.Sync()
 			a.resizeViews()
+		case *tcell.EventMouse:
+			if a.messagesHeight > 0 && a.views.messages.HandleEvent(ev) {
+				a.resizeViews()
+				continue
+			}
+			if a.views.gutters.HandleEvent(ev) {
+				continue
+			}
+			// the command line covers the status bar while it's open
+			if !a.views.commandLine.Open() && a.views.statusBar.HandleEvent(ev) {
+				continue
+			}
+		}
+
+		if a.views.commandLine.Open() {
+			a.views.commandLine.HandleEvent(ev)
+			continue
 		}
 
 		if a.views.document.HandleEvent(ev) {
 			continue
 		}
 	}
+	return nil
+}
+
+// LogConfigErrors records config errors in the message log, where they can be
+// reviewed with :messages after the editor has started.
+func (a *Athena) LogConfigErrors(errors []config.ConfigError) {
+	for _, err := range errors {
+		a.editor.LogMessage(fmt.Sprintf("Config %s: %s", err.Severity, err))
+	}
+	if len(errors) > 0 {
+		a.editor.SetMessage(fmt.Sprintf("%d config errors, see :messages", len(errors)))
+	}
+}
+
+// configCommand implements :config init, which writes the default config files into
+// the config directory without touching existing ones.
+func (a *Athena) configCommand(args []string) error {
+	switch {
+	case len(args) == 0:
+		return fmt.Errorf("Argument required")
+	case args[0] != "init" || len(args) > 1:
+		return fmt.Errorf("Unknown config command: %s", strings.Join(args, " "))
+	}
+	dir, err := config.Dir()
+	if err != nil {
+		return err
+	}
+	written, err := config.InitConfig(dir)
+	if err != nil {
+		return err
+	}
+	if len(written) == 0 {
+		a.editor.SetMessage(fmt.Sprintf("Config files already exist in %s", dir))
+		return nil
+	}
+	a.editor.SetMessage(fmt.Sprintf("Wrote %s", strings.Join(written, ", ")))
+	return nil
+}
+
+// checkIndentation warns when the current buffer mixes tabs and spaces
+// or is indented differently than the configured indent-style.
+func (a *Athena) checkIndentation() {
+	tabs, spaces, err := a.editor.IndentStats()
+	if err != nil {
+		return
+	}
+	indentation, err := a.editor.Indentation()
+	if err != nil {
+		return
+	}
+
+	switch {
+	case tabs > 0 && spaces > 0:
+		a.editor.SetMessage(fmt.Sprintf("Mixed indentation: %d tab, %d space indented lines", tabs, spaces))
+	case tabs > 0 && !indentation.UseTabs:
+		a.editor.SetMessage("Indentation uses tabs but indent-style is space")
+	case spaces > 0 && indentation.UseTabs:
+		a.editor.SetMessage("Indentation uses spaces but indent-style is tab")
+	}
 }
 
 func (a *Athena) initializeViews() {
 	a.views.gutters = ui.NewGuttersView(a.editor, a.cfg, a.viewport)
 	a.views.document = ui.NewDocumentView(a.editor, a.cfg, a.viewport)
+	redraw := func() {
+		// an interrupt wakes PollEvent so the next loop iteration draws
+		_ = a.screen.PostEvent(tcell.NewEventInterrupt(nil))
+	}
+	a.views.document.SetRedraw(redraw)
+	a.editor.SetRedraw(redraw)
 	a.views.statusBar = ui.NewStatusBarView(a.editor, &a.cfg.Editor)
+	a.views.commandLine = ui.NewCommandLineView(a.editor)
+	a.views.messages = ui.NewMessagesView(a.editor)
 	a.resizeViews()
 }
 
 func (a *Athena) draw() {
 	a.screen.Clear()
 
-	a.views.gutters.Draw(a.screen)
+	// the gutter widens as the line count gains digits, and the message log
+	// panel takes rows from the document while it's open
+	if a.views.gutters.Width() != a.gutterWidth || a.messagesPanelHeight() != a.messagesHeight {
+		a.resizeViews()
+	}
+
+	// the document scrolls the shared viewport, so it's drawn before the gutters
 	a.views.document.Draw(a.screen)
-	a.views.statusBar.Draw(a.screen)
+	a.views.gutters.Draw(a.screen)
+	if a.messagesHeight > 0 {
+		a.views.messages.Draw(a.screen)
+	}
+
+	if a.views.commandLine.Open() {
+		a.views.commandLine.Draw(a.screen)
+	} else {
+		a.views.statusBar.Draw(a.screen)
+	}
 }
 
 func (a *Athena) resizeViews() {
 	width, height := a.screen.Size()
 
-	a.views.gutters.Resize(0, 0, 6, height-1)
-	a.views.document.Resize(6, 0, width-6, height-1)
+	a.gutterWidth = a.views.gutters.Width()
+	a.messagesHeight = a.messagesPanelHeight()
+	docHeight := height - 1 - a.messagesHeight
+	a.views.gutters.Resize(0, 0, a.gutterWidth, docHeight)
+	a.views.document.Resize(a.gutterWidth, 0, width-a.gutterWidth, docHeight)
+	a.views.messages.Resize(0, docHeight, width, a.messagesHeight)
 	a.views.statusBar.Resize(0, height-1, width, 1)
+	a.views.commandLine.Resize(0, height-1, width, 1)
+}
+
+// messagesPanelHeight returns the height the message log panel should have, 0 when closed.
+func (a *Athena) messagesPanelHeight() int {
+	if !a.editor.MessagesVisible() {
+		return 0
+	}
+	_, height := a.screen.Size()
+	return a.views.messages.Height(height - 1)
 }
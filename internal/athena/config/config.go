@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 
 	"github.com/BurntSushi/toml"
+	"github.com/gdamore/tcell/v2"
 )
 
 // Config represents the entire app config.
@@ -14,70 +15,93 @@ type Config struct {
 	Keymap KeymapConfig `toml:"keys"`
 }
 
-// LoadConfig loads the configuration from default path or arg.
-func LoadConfig(filePath *string) (*Config, []string) {
+// LoadConfig loads the configuration from default path or arg. Invalid values are
+// reported as warnings and replaced by defaults; a file that can't be decoded is fatal.
+func LoadConfig(filePath *string) (*Config, []ConfigError) {
 	defaultCfg := defaultConfig()
-	var errors []string
+	var errors []ConfigError
 
 	// Load from file and merge
-	fileCfg, fileErrors := loadConfigFile(filePath)
+	fileCfg, path, fileErrors := loadConfigFile(filePath)
 	errors = append(errors, fileErrors...)
 	mergeConfig(defaultCfg, fileCfg)
 
 	validateErrors := validateAndFixConfig(defaultCfg)
-	errors = append(errors, validateErrors...)
+	errors = append(errors, warnings(path, validateErrors)...)
 
 	return defaultCfg, errors
 }
 
 // defaultConfig provides a default configuration
 func defaultConfig() *Config {
+	bufferLine, contextAware, autoIndent := true, true, true
 	return &Config{
 		Editor: EditorConfig{
 			ScrollPadding: 5,
+			ScrollLines:   3,
+			ScrollColumns: 6,
 			LineNumber:    LineNumberRelative,
+			NumberAlign:   LineNumberAlignRight,
+			NumberWidth:   4,
+			IndentStyle:   IndentStyleTab,
+			TabWidth:      4,
+			MatchBrackets: MatchBracketsCursor,
+			LargeFile:     DefaultLargeFileThreshold,
+			MaxUndo:       DefaultMaxUndo,
 			CursorShape: CursorShapeConfig{
-				Insert: CursorBar,
-				Normal: CursorBlock,
+				Insert:  CursorBar,
+				Normal:  CursorBlock,
+				Visual:  CursorBlock,
+				Replace: CursorUnder,
 			},
-			BufferLine: true,
-			Gutters:    []GutterOption{GutterSpacer, GutterLineNumbers, GutterSpacer},
+			BufferLine:            &bufferLine,
+			AutoPairsContextAware: &contextAware,
+			AutoIndent:            &autoIndent,
+			Gutters:               []GutterOption{GutterSpacer, GutterLineNumbers, GutterSpacer},
 			StatusBar: StatusBarConfig{
 				Left:   []StatusBarOption{SectionMode},
-				Center: []StatusBarOption{SectionFileName, SectionVersionControl},
-				Right:  []StatusBarOption{SectionCursorPercentage, SectionCursorPos, SectionLineCount, SectionFileType},
+				Center: []StatusBarOption{SectionFileName, SectionFileModified, SectionVersionControl},
+				Right:  []StatusBarOption{SectionSelectionInfo, SectionCursorPercentage, SectionCursorPos, SectionLineCount, SectionFileType},
 				Mode: StatusBarModeConfig{
-					Normal: "NOR",
-					Insert: "INS",
+					Normal:  "NOR",
+					Insert:  "INS",
+					Replace: "REP",
 				},
 			},
+			EOFMarker: EOFMarkerConfig{
+				Gutter: "~",
+				Color:  "purple",
+			},
 		},
 		Keymap: defaultKeymap(),
 	}
 }
 
-func loadConfigFile(filePath *string) (*Config, []string) {
-	var errors []string
+// loadConfigFile decodes the config file, returning nil when there is none,
+// along with the path it was looked up at.
+func loadConfigFile(filePath *string) (*Config, string, []ConfigError) {
+	var errors []ConfigError
 	if filePath == nil || *filePath == "" {
-		homeDir, err := os.UserHomeDir()
+		dir, err := Dir()
 		if err != nil {
-			errors = append(errors, fmt.Sprintf("Error finding home directory: %v", err))
-			return nil, errors
+			errors = append(errors, ConfigError{Severity: SeverityWarning, Message: fmt.Sprintf("Error finding home directory: %v", err)})
+			return nil, "", errors
 		}
-		cfgPath := filepath.Join(homeDir, ".config", "athena", "config.toml")
+		cfgPath := filepath.Join(dir, "config.toml")
 		filePath = &cfgPath
 	}
 
 	if _, err := os.Stat(*filePath); os.IsNotExist(err) {
-		return nil, errors // No file, no problem
+		return nil, *filePath, errors // No file, no problem
 	}
 
 	cfg := &Config{}
 	if _, err := toml.DecodeFile(*filePath, cfg); err != nil {
-		errors = append(errors, fmt.Sprintf("Error decoding file: %v", err))
+		// a partially decoded file isn't used
+		return nil, *filePath, append(errors, decodeError(*filePath, err))
 	}
 
-	return cfg, errors
+	return cfg, *filePath, errors
 }
 
 func mergeConfig(dst *Config, src *Config) {
@@ -90,13 +114,73 @@ func mergeConfig(dst *Config, src *Config) {
 	if src.Editor.LineNumber != "" {
 		dst.Editor.LineNumber = src.Editor.LineNumber
 	}
+	if src.Editor.NumberAlign != "" {
+		dst.Editor.NumberAlign = src.Editor.NumberAlign
+	}
+	if src.Editor.ScrollLines != 0 {
+		dst.Editor.ScrollLines = src.Editor.ScrollLines
+	}
+	if src.Editor.ScrollColumns != 0 {
+		dst.Editor.ScrollColumns = src.Editor.ScrollColumns
+	}
+	if src.Editor.NumberWidth != 0 {
+		dst.Editor.NumberWidth = src.Editor.NumberWidth
+	}
+	if src.Editor.IndentStyle != "" {
+		dst.Editor.IndentStyle = src.Editor.IndentStyle
+	}
+	if src.Editor.TabWidth != 0 {
+		dst.Editor.TabWidth = src.Editor.TabWidth
+	}
+	if src.Editor.MatchBrackets != "" {
+		dst.Editor.MatchBrackets = src.Editor.MatchBrackets
+	}
+	if src.Editor.LargeFile != 0 {
+		dst.Editor.LargeFile = src.Editor.LargeFile
+	}
+	if src.Editor.SoftTabStop != 0 {
+		dst.Editor.SoftTabStop = src.Editor.SoftTabStop
+	}
+	if src.Editor.UnsavedWarning != 0 {
+		dst.Editor.UnsavedWarning = src.Editor.UnsavedWarning
+	}
+	if src.Editor.MaxUndo != 0 {
+		dst.Editor.MaxUndo = src.Editor.MaxUndo
+	}
+	if src.Editor.WhichKeyDelay != 0 {
+		dst.Editor.WhichKeyDelay = src.Editor.WhichKeyDelay
+	}
 	if src.Editor.CursorShape.Insert != "" {
 		dst.Editor.CursorShape.Insert = src.Editor.CursorShape.Insert
 	}
 	if src.Editor.CursorShape.Normal != "" {
 		dst.Editor.CursorShape.Normal = src.Editor.CursorShape.Normal
 	}
-	dst.Editor.BufferLine = src.Editor.BufferLine
+	if src.Editor.CursorShape.Visual != "" {
+		dst.Editor.CursorShape.Visual = src.Editor.CursorShape.Visual
+	}
+	if src.Editor.CursorShape.Replace != "" {
+		dst.Editor.CursorShape.Replace = src.Editor.CursorShape.Replace
+	}
+	dst.Editor.CursorBlink = src.Editor.CursorBlink
+	if src.Editor.BufferLine != nil {
+		dst.Editor.BufferLine = src.Editor.BufferLine
+	}
+	dst.Editor.Mouse = src.Editor.Mouse
+	dst.Editor.GuiClipboard = src.Editor.GuiClipboard
+	dst.Editor.CursorLine = src.Editor.CursorLine
+	dst.Editor.AutoPairs = src.Editor.AutoPairs
+	if src.Editor.AutoPairsContextAware != nil {
+		dst.Editor.AutoPairsContextAware = src.Editor.AutoPairsContextAware
+	}
+	if src.Editor.AutoIndent != nil {
+		dst.Editor.AutoIndent = src.Editor.AutoIndent
+	}
+	dst.Editor.SoftWrap = src.Editor.SoftWrap
+	dst.Editor.FixEOLOnSave = src.Editor.FixEOLOnSave
+	if src.Editor.Syntax != nil {
+		dst.Editor.Syntax = src.Editor.Syntax
+	}
 	if len(src.Editor.Gutters) > 0 {
 		dst.Editor.Gutters = src.Editor.Gutters
 	}
@@ -115,12 +199,27 @@ func mergeConfig(dst *Config, src *Config) {
 	if src.Editor.StatusBar.Mode.Insert != "" {
 		dst.Editor.StatusBar.Mode.Insert = src.Editor.StatusBar.Mode.Insert
 	}
+	if src.Editor.StatusBar.Mode.Replace != "" {
+		dst.Editor.StatusBar.Mode.Replace = src.Editor.StatusBar.Mode.Replace
+	}
+	if src.Editor.EOFMarker.Gutter != "" {
+		dst.Editor.EOFMarker.Gutter = src.Editor.EOFMarker.Gutter
+	}
+	if src.Editor.EOFMarker.Document != "" {
+		dst.Editor.EOFMarker.Document = src.Editor.EOFMarker.Document
+	}
+	if src.Editor.EOFMarker.Color != "" {
+		dst.Editor.EOFMarker.Color = src.Editor.EOFMarker.Color
+	}
 	for key, action := range src.Keymap.Normal {
 		dst.Keymap.Normal[key] = action
 	}
 	for key, action := range src.Keymap.Insert {
 		dst.Keymap.Insert[key] = action
 	}
+	for key, action := range src.Keymap.Visual {
+		dst.Keymap.Visual[key] = action
+	}
 }
 
 // validateAndFixConfig validates and ensures the values are in a usable state.
@@ -136,6 +235,76 @@ func validateAndFixConfig(cfg *Config) []string {
 		editor.LineNumber = LineNumberRelative // Reset to default
 	}
 
+	// Validate NumberAlign
+	if !editor.NumberAlign.IsValid() {
+		errors = append(errors, fmt.Sprintf("Invalid line-number-align option: %s", editor.NumberAlign))
+		editor.NumberAlign = LineNumberAlignRight
+	}
+
+	// Validate ScrollLines and ScrollColumns
+	if editor.ScrollLines < 1 {
+		errors = append(errors, fmt.Sprintf("Invalid scroll-lines option: %d", editor.ScrollLines))
+		editor.ScrollLines = 3
+	}
+	if editor.ScrollColumns < 1 {
+		errors = append(errors, fmt.Sprintf("Invalid scroll-columns option: %d", editor.ScrollColumns))
+		editor.ScrollColumns = 6
+	}
+
+	// Validate NumberWidth
+	if editor.NumberWidth < 1 {
+		errors = append(errors, fmt.Sprintf("Invalid line-number-min-width option: %d", editor.NumberWidth))
+		editor.NumberWidth = 4
+	}
+
+	// Validate IndentStyle
+	if !editor.IndentStyle.IsValid() {
+		errors = append(errors, fmt.Sprintf("Invalid indent-style option: %s", editor.IndentStyle))
+		editor.IndentStyle = IndentStyleTab
+	}
+
+	// Validate TabWidth
+	if editor.TabWidth < 1 {
+		errors = append(errors, fmt.Sprintf("Invalid tab-width option: %d", editor.TabWidth))
+		editor.TabWidth = 4
+	}
+
+	// Validate MatchBrackets
+	if !editor.MatchBrackets.IsValid() {
+		errors = append(errors, fmt.Sprintf("Invalid match-brackets-mode option: %s", editor.MatchBrackets))
+		editor.MatchBrackets = MatchBracketsCursor
+	}
+
+	// Validate LargeFile
+	if editor.LargeFile < MinLargeFileThreshold {
+		errors = append(errors, fmt.Sprintf("Invalid large-file-threshold option: %d (minimum %d)", editor.LargeFile, MinLargeFileThreshold))
+		editor.LargeFile = DefaultLargeFileThreshold
+	}
+
+	// Validate SoftTabStop
+	if editor.SoftTabStop < 0 {
+		errors = append(errors, fmt.Sprintf("Invalid soft-tab-stop option: %d", editor.SoftTabStop))
+		editor.SoftTabStop = 0
+	}
+
+	// Validate UnsavedWarning
+	if editor.UnsavedWarning < 0 {
+		errors = append(errors, fmt.Sprintf("Invalid unsaved-warning option: %d", editor.UnsavedWarning))
+		editor.UnsavedWarning = 0
+	}
+
+	// Validate MaxUndo
+	if editor.MaxUndo < 1 {
+		errors = append(errors, fmt.Sprintf("Invalid max-undo option: %d", editor.MaxUndo))
+		editor.MaxUndo = DefaultMaxUndo
+	}
+
+	// Validate WhichKeyDelay
+	if editor.WhichKeyDelay < 0 {
+		errors = append(errors, fmt.Sprintf("Invalid which-key-delay option: %d", editor.WhichKeyDelay))
+		editor.WhichKeyDelay = 0
+	}
+
 	// Validate CursorShape
 	if !editor.CursorShape.Insert.IsValid() {
 		errors = append(errors, fmt.Sprintf("Invalid cursor-shape insert option: %s", editor.CursorShape.Insert))
@@ -145,6 +314,14 @@ func validateAndFixConfig(cfg *Config) []string {
 		errors = append(errors, fmt.Sprintf("Invalid cursor-shape normal option: %s", editor.CursorShape.Normal))
 		editor.CursorShape.Normal = CursorBlock
 	}
+	if !editor.CursorShape.Visual.IsValid() {
+		errors = append(errors, fmt.Sprintf("Invalid cursor-shape visual option: %s", editor.CursorShape.Visual))
+		editor.CursorShape.Visual = CursorBlock
+	}
+	if !editor.CursorShape.Replace.IsValid() {
+		errors = append(errors, fmt.Sprintf("Invalid cursor-shape replace option: %s", editor.CursorShape.Replace))
+		editor.CursorShape.Replace = CursorUnder
+	}
 
 	// Validate Gutters
 	editor.Gutters = filterValidGutters(editor.Gutters, &errors)
@@ -152,8 +329,10 @@ func validateAndFixConfig(cfg *Config) []string {
 	// Validate StatusBar
 	validateStatusBarConfig(&editor.StatusBar, &errors)
 
-	for i := 0; i < len(errors); i++ {
-		fmt.Printf("%s\n", errors[i])
+	// Validate EOFMarker
+	if tcell.GetColor(editor.EOFMarker.Color) == tcell.ColorDefault {
+		errors = append(errors, fmt.Sprintf("Invalid eof-marker color option: %s", editor.EOFMarker.Color))
+		editor.EOFMarker.Color = "purple"
 	}
 
 	return errors
@@ -0,0 +1,271 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		warnings int
+		fatal    bool
+		line     int
+	}{
+		{
+			name:    "valid",
+			content: "[editor]\nscroll-padding = 3\n",
+		},
+		{
+			name:     "invalid values are warnings",
+			content:  "[editor]\nline-number = \"bogus\"\ntab-width = -1\n",
+			warnings: 2,
+		},
+		{
+			name:     "scroll steps below one are warnings",
+			content:  "[editor]\nscroll-lines = -2\nscroll-columns = -1\n",
+			warnings: 2,
+		},
+		{
+			name:     "negative unsaved warning is a warning",
+			content:  "[editor]\nunsaved-warning = -5\n",
+			warnings: 1,
+		},
+		{
+			name:     "negative max undo is a warning",
+			content:  "[editor]\nmax-undo = -1\n",
+			warnings: 1,
+		},
+		{
+			name:     "negative which-key delay is a warning",
+			content:  "[editor]\nwhich-key-delay = -100\n",
+			warnings: 1,
+		},
+		{
+			name:    "syntax error is fatal",
+			content: "[editor]\nscroll-padding = 3\nline-number = = \"absolute\"\n",
+			fatal:   true,
+			line:    3,
+		},
+		{
+			name:    "type mismatch is fatal without a line",
+			content: "[editor]\n\nscroll-padding = \"five\"\n",
+			fatal:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("failed to write config: %v", err)
+			}
+
+			cfg, errs := LoadConfig(&path)
+			if cfg == nil {
+				t.Fatalf("expected a config even with errors")
+			}
+			if got := HasFatal(errs); got != tt.fatal {
+				t.Errorf("expected fatal %v, got %v (%v)", tt.fatal, got, errs)
+			}
+
+			warnings := 0
+			for _, err := range errs {
+				if err.Path != path {
+					t.Errorf("expected path %q, got %q", path, err.Path)
+				}
+				switch err.Severity {
+				case SeverityWarning:
+					warnings++
+				case SeverityFatal:
+					if err.Line != tt.line {
+						t.Errorf("expected fatal error on line %d, got %d", tt.line, err.Line)
+					}
+				}
+			}
+			if warnings != tt.warnings {
+				t.Errorf("expected %d warnings, got %d (%v)", tt.warnings, warnings, errs)
+			}
+
+			// bad values and unusable files fall back to the defaults
+			if tt.warnings > 0 || tt.fatal {
+				if cfg.Editor.LineNumber != LineNumberRelative || cfg.Editor.TabWidth != 4 {
+					t.Errorf("expected defaults, got %s/%d", cfg.Editor.LineNumber, cfg.Editor.TabWidth)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigBufferLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected bool
+	}{
+		{"omitted keeps the default", "[editor]\nscroll-padding = 3\n", true},
+		{"explicit true", "[editor]\nbuffer-line = true\n", true},
+		{"explicit false", "[editor]\nbuffer-line = false\n", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("failed to write config: %v", err)
+			}
+
+			cfg, errs := LoadConfig(&path)
+			if len(errs) > 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+			if got := cfg.Editor.BufferLineEnabled(); got != tt.expected {
+				t.Errorf("expected buffer line %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoadConfigAutoPairsContextAware(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected bool
+	}{
+		{"omitted keeps the default", "[editor]\nauto-pairs = true\n", true},
+		{"explicit true", "[editor]\nauto-pairs-context-aware = true\n", true},
+		{"explicit false", "[editor]\nauto-pairs-context-aware = false\n", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("failed to write config: %v", err)
+			}
+
+			cfg, errs := LoadConfig(&path)
+			if len(errs) > 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+			if got := cfg.Editor.AutoPairsContextAwareEnabled(); got != tt.expected {
+				t.Errorf("expected context-aware auto-pairs %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestLoadConfigAutoIndent(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected bool
+	}{
+		{"omitted keeps the default", "[editor]\nauto-pairs = true\n", true},
+		{"explicit true", "[editor]\nauto-indent = true\n", true},
+		{"explicit false", "[editor]\nauto-indent = false\n", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("failed to write config: %v", err)
+			}
+
+			cfg, errs := LoadConfig(&path)
+			if len(errs) > 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+			if got := cfg.Editor.AutoIndentEnabled(); got != tt.expected {
+				t.Errorf("expected auto-indent %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestConfigErrorString(t *testing.T) {
+	tests := []struct {
+		err      ConfigError
+		expected string
+	}{
+		{ConfigError{Message: "oops"}, "oops"},
+		{ConfigError{Path: "config.toml", Message: "oops"}, "config.toml: oops"},
+		{ConfigError{Path: "config.toml", Line: 7, Message: "oops"}, "config.toml:7: oops"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.err.String(); got != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, got)
+		}
+	}
+}
+
+func TestResolveComments(t *testing.T) {
+	langs := &LanguagesConfig{Languages: map[string]LanguageConfig{
+		"css":    {FileTypes: []string{"css"}, BlockCommentTokens: []CommentToken{{Start: "/*", End: "*/"}}},
+		"python": {FileTypes: []string{"py"}, LineCommentTokens: []string{"#"}},
+	}}
+
+	tests := []struct {
+		fileName string
+		line     string
+		block    CommentToken
+	}{
+		{"style.css", "", CommentToken{Start: "/*", End: "*/"}},
+		{"main.py", "#", CommentToken{}},
+		{"main.go", "//", CommentToken{Start: "/*", End: "*/"}},
+		{"notes.txt", "", CommentToken{}},
+	}
+
+	for _, tt := range tests {
+		line, block := langs.ResolveComments(tt.fileName)
+		if line != tt.line || block != tt.block {
+			t.Errorf("%s: expected %q %v, got %q %v", tt.fileName, tt.line, tt.block, line, block)
+		}
+	}
+}
+
+func TestInitConfig(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "home", ".config", "athena")
+
+	written, err := InitConfig(dir)
+	if err != nil {
+		t.Fatalf("InitConfig failed: %v", err)
+	}
+	if len(written) != 2 {
+		t.Fatalf("expected both files to be written, got %v", written)
+	}
+
+	// the written config loads cleanly and holds exactly the defaults
+	cfgPath := filepath.Join(dir, "config.toml")
+	cfg, errs := LoadConfig(&cfgPath)
+	if len(errs) > 0 {
+		t.Fatalf("expected the written config to load cleanly, got %v", errs)
+	}
+	expected := defaultConfig()
+	validateAndFixConfig(expected)
+	if !reflect.DeepEqual(cfg, expected) {
+		t.Errorf("expected the written config to hold the defaults\ngot  %+v\nwant %+v", cfg.Editor, expected.Editor)
+	}
+
+	langPath := filepath.Join(dir, "languages.toml")
+	if _, errs := LoadLanguagesConfig(&langPath); len(errs) > 0 {
+		t.Errorf("expected the written languages config to load cleanly, got %v", errs)
+	}
+
+	// existing files are kept
+	if err := os.WriteFile(cfgPath, []byte("[editor]\ntab-width = 8\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	written, err = InitConfig(dir)
+	if err != nil || len(written) != 0 {
+		t.Fatalf("expected nothing to be written again, got %v, %v", written, err)
+	}
+	if data, _ := os.ReadFile(cfgPath); string(data) != "[editor]\ntab-width = 8\n" {
+		t.Errorf("expected the existing config to be kept, got %q", data)
+	}
+}
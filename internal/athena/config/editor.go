@@ -6,17 +6,78 @@ type LineNumberOption string
 const (
 	LineNumberAbsolute LineNumberOption = "absolute"
 	LineNumberRelative LineNumberOption = "relative"
+	LineNumberHybrid   LineNumberOption = "hybrid" // relative in normal mode, absolute while editing
 )
 
 func (o LineNumberOption) IsValid() bool {
 	switch o {
-	case LineNumberAbsolute, LineNumberRelative:
+	case LineNumberAbsolute, LineNumberRelative, LineNumberHybrid:
 		return true
 	default:
 		return false
 	}
 }
 
+// LineNumberAlignOption represents which side of the gutter line numbers align to.
+type LineNumberAlignOption string
+
+const (
+	LineNumberAlignRight LineNumberAlignOption = "right"
+	LineNumberAlignLeft  LineNumberAlignOption = "left"
+)
+
+func (o LineNumberAlignOption) IsValid() bool {
+	switch o {
+	case LineNumberAlignRight, LineNumberAlignLeft:
+		return true
+	default:
+		return false
+	}
+}
+
+// IndentStyleOption represents the preferred indentation character.
+type IndentStyleOption string
+
+const (
+	IndentStyleTab   IndentStyleOption = "tab"
+	IndentStyleSpace IndentStyleOption = "space"
+)
+
+func (o IndentStyleOption) IsValid() bool {
+	switch o {
+	case IndentStyleTab, IndentStyleSpace:
+		return true
+	default:
+		return false
+	}
+}
+
+// MatchBracketsOption controls when the matching bracket is highlighted.
+type MatchBracketsOption string
+
+const (
+	MatchBracketsAlways MatchBracketsOption = "always" // cursor on or just after a bracket
+	MatchBracketsCursor MatchBracketsOption = "cursor" // cursor exactly on a bracket
+)
+
+func (o MatchBracketsOption) IsValid() bool {
+	switch o {
+	case MatchBracketsAlways, MatchBracketsCursor:
+		return true
+	default:
+		return false
+	}
+}
+
+// Limits for the large-file-threshold option, in bytes.
+const (
+	DefaultLargeFileThreshold int64 = 64 << 20
+	MinLargeFileThreshold     int64 = 1 << 20
+)
+
+// DefaultMaxUndo is the number of undo steps kept per buffer by default.
+const DefaultMaxUndo = 1000
+
 // CursorShape defines cursor style options.
 type CursorShape string
 
@@ -36,10 +97,36 @@ func (cs CursorShape) IsValid() bool {
 	}
 }
 
+// SyntaxEnabled reports whether syntax highlighting is on; it is unless the syntax
+// option is set to false.
+func (c EditorConfig) SyntaxEnabled() bool {
+	return c.Syntax == nil || *c.Syntax
+}
+
+// BufferLineEnabled reports whether the buffer line is rendered; it is unless the
+// buffer-line option is set to false.
+func (c EditorConfig) BufferLineEnabled() bool {
+	return c.BufferLine == nil || *c.BufferLine
+}
+
+// AutoPairsContextAwareEnabled reports whether auto-pairs are skipped inside strings
+// and comments; they are unless the auto-pairs-context-aware option is set to false.
+func (c EditorConfig) AutoPairsContextAwareEnabled() bool {
+	return c.AutoPairsContextAware == nil || *c.AutoPairsContextAware
+}
+
+// AutoIndentEnabled reports whether a new line starts with the indentation of the
+// line broken; it does unless the auto-indent option is set to false.
+func (c EditorConfig) AutoIndentEnabled() bool {
+	return c.AutoIndent == nil || *c.AutoIndent
+}
+
 // CursorShapeConfig holds cursor shape settings.
 type CursorShapeConfig struct {
-	Insert CursorShape `toml:"insert"`
-	Normal CursorShape `toml:"normal"`
+	Insert  CursorShape `toml:"insert"`
+	Normal  CursorShape `toml:"normal"`
+	Visual  CursorShape `toml:"visual"`
+	Replace CursorShape `toml:"replace"`
 }
 
 // GutterLayoutOption defines layout parts for gutters.
@@ -72,8 +159,10 @@ const (
 	SectionFileType         StatusBarOption = "file-type"
 	SectionVersionControl   StatusBarOption = "version-control"
 	SectionCursorPos        StatusBarOption = "cursor-position"
+	SectionVirtualColumn    StatusBarOption = "virtual-column"
 	SectionLineCount        StatusBarOption = "line-count"
 	SectionCursorPercentage StatusBarOption = "cursor-percentage"
+	SectionSelectionInfo    StatusBarOption = "selection-info"
 	SectionSpacer           StatusBarOption = "spacer"
 )
 
@@ -81,7 +170,7 @@ func (o StatusBarOption) IsValid() bool {
 	switch o {
 	case SectionMode, SectionFileName, SectionFileAbsPath, SectionFileModified,
 		SectionFileEncoding, SectionFileType, SectionVersionControl,
-		SectionCursorPos, SectionLineCount, SectionCursorPercentage, SectionSpacer:
+		SectionCursorPos, SectionVirtualColumn, SectionLineCount, SectionCursorPercentage, SectionSelectionInfo, SectionSpacer:
 		return true
 	default:
 		return false
@@ -90,8 +179,9 @@ func (o StatusBarOption) IsValid() bool {
 
 // StatusBarModeConfig represents the mode names.
 type StatusBarModeConfig struct {
-	Normal string `toml:"normal"`
-	Insert string `toml:"insert"`
+	Normal  string `toml:"normal"`
+	Insert  string `toml:"insert"`
+	Replace string `toml:"replace"`
 }
 
 // StatusBarConfig represents status bar configurations.
@@ -102,12 +192,42 @@ type StatusBarConfig struct {
 	Mode   StatusBarModeConfig `toml:"mode"`
 }
 
+// EOFMarkerConfig represents the markers drawn for rows past the end of the buffer.
+type EOFMarkerConfig struct {
+	Gutter   string `toml:"gutter"`   // glyph in the gutter of every row past the end
+	Document string `toml:"document"` // glyph repeated across the first row past the end, empty to disable
+	Color    string `toml:"color"`    // color name or #rrggbb hex
+}
+
 // EditorConfig represents editor-specific configurations
 type EditorConfig struct {
-	ScrollPadding int               `toml:"scroll-padding"` // padding around edge of screen
-	LineNumber    LineNumberOption  `toml:"line-number"`    // absolute or relative
-	CursorShape   CursorShapeConfig `toml:"cursor-shape"`
-	BufferLine    bool              `toml:"buffer-line"` // whether to render buffer line
-	Gutters       []GutterOption    `toml:"gutters"`
-	StatusBar     StatusBarConfig   `toml:"status-bar"`
+	ScrollPadding         int                   `toml:"scroll-padding"`        // padding around edge of screen
+	ScrollLines           int                   `toml:"scroll-lines"`          // lines scrolled per mouse wheel or scroll step
+	ScrollColumns         int                   `toml:"scroll-columns"`        // columns scrolled per horizontal scroll step
+	LineNumber            LineNumberOption      `toml:"line-number"`           // absolute, relative or hybrid
+	NumberAlign           LineNumberAlignOption `toml:"line-number-align"`     // right or left
+	NumberWidth           int                   `toml:"line-number-min-width"` // minimum columns for line numbers
+	IndentStyle           IndentStyleOption     `toml:"indent-style"`          // tab or space
+	TabWidth              int                   `toml:"tab-width"`             // columns per indentation level
+	MatchBrackets         MatchBracketsOption   `toml:"match-brackets-mode"`   // always or cursor
+	LargeFile             int64                 `toml:"large-file-threshold"`  // bytes above which files open in chunked mode
+	SoftTabStop           int                   `toml:"soft-tab-stop"`         // spaces removed by backspace in indentation, 0 to disable
+	UnsavedWarning        int                   `toml:"unsaved-warning"`       // minutes of unsaved changes before the status bar warns, 0 to disable
+	MaxUndo               int                   `toml:"max-undo"`              // undo steps kept per buffer, the oldest dropped first
+	WhichKeyDelay         int                   `toml:"which-key-delay"`       // milliseconds a key prefix is pending before its menu shows
+	CursorShape           CursorShapeConfig     `toml:"cursor-shape"`
+	CursorBlink           bool                  `toml:"cursor-blink"`             // whether the terminal cursor blinks
+	BufferLine            *bool                 `toml:"buffer-line"`              // whether to render buffer line, on unless set to false
+	Mouse                 bool                  `toml:"mouse"`                    // whether to handle mouse events
+	GuiClipboard          bool                  `toml:"gui-clipboard"`            // <c-c> copies a mouse selection and <c-v> pastes
+	CursorLine            bool                  `toml:"cursor-line"`              // whether to highlight the cursor's line
+	AutoPairs             bool                  `toml:"auto-pairs"`               // whether typing an opening bracket or quote inserts its closer
+	AutoPairsContextAware *bool                 `toml:"auto-pairs-context-aware"` // skip auto-pairs inside strings and comments, on unless set to false
+	AutoIndent            *bool                 `toml:"auto-indent"`              // whether a new line starts with the indentation of the line broken, on unless set to false
+	SoftWrap              bool                  `toml:"soft-wrap"`                // whether to wrap long lines at the view width
+	FixEOLOnSave          bool                  `toml:"fix-eol-on-save"`          // end files with exactly one newline when saving
+	Syntax                *bool                 `toml:"syntax"`                   // syntax highlighting, on unless set to false
+	Gutters               []GutterOption        `toml:"gutters"`
+	StatusBar             StatusBarConfig       `toml:"status-bar"`
+	EOFMarker             EOFMarkerConfig       `toml:"eof-marker"`
 }
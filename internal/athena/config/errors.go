@@ -0,0 +1,78 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Severity tells whether the editor can still start after a config error.
+type Severity int
+
+const (
+	SeverityWarning Severity = iota // the offending value was replaced by its default
+	SeverityFatal                   // the file couldn't be used at all
+)
+
+func (s Severity) String() string {
+	if s == SeverityFatal {
+		return "fatal"
+	}
+	return "warning"
+}
+
+// ConfigError is a problem found while loading a config file.
+type ConfigError struct {
+	Severity Severity
+	Path     string // file the error came from, empty when no file was involved
+	Line     int    // TOML line number, 0 when unknown
+	Message  string
+}
+
+// String formats the error as path:line: message, leaving out what's unknown.
+func (e ConfigError) String() string {
+	switch {
+	case e.Path != "" && e.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", e.Path, e.Line, e.Message)
+	case e.Path != "":
+		return fmt.Sprintf("%s: %s", e.Path, e.Message)
+	default:
+		return e.Message
+	}
+}
+
+func (e ConfigError) Error() string {
+	return e.String()
+}
+
+// HasFatal reports whether any of the errors should stop the editor from starting.
+func HasFatal(errs []ConfigError) bool {
+	for _, err := range errs {
+		if err.Severity == SeverityFatal {
+			return true
+		}
+	}
+	return false
+}
+
+// warnings wraps validation messages for a file as warnings.
+func warnings(path string, messages []string) []ConfigError {
+	var errs []ConfigError
+	for _, msg := range messages {
+		errs = append(errs, ConfigError{Severity: SeverityWarning, Path: path, Message: msg})
+	}
+	return errs
+}
+
+// decodeError converts a TOML decoding error into a fatal error, keeping its line number.
+func decodeError(path string, err error) ConfigError {
+	cfgErr := ConfigError{Severity: SeverityFatal, Path: path, Message: fmt.Sprintf("Error decoding file: %v", err)}
+
+	var parseErr toml.ParseError
+	if errors.As(err, &parseErr) {
+		cfgErr.Line = parseErr.Position.Line
+		cfgErr.Message = fmt.Sprintf("Error decoding file: %s", parseErr.Message)
+	}
+	return cfgErr
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+//go:embed templates/*.toml
+var templates embed.FS
+
+// configFiles are the files InitConfig writes, named as in the templates directory.
+var configFiles = []string{"config.toml", "languages.toml"}
+
+// Dir returns the directory the config files are read from by default,
+// ~/.config/athena.
+func Dir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".config", "athena"), nil
+}
+
+// InitConfig creates dir and writes a commented config.toml and languages.toml
+// holding the defaults into it. Files that already exist are left alone. It
+// returns the paths of the files it wrote.
+func InitConfig(dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	var written []string
+	for _, name := range configFiles {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return written, err
+		}
+
+		content, err := templates.ReadFile("templates/" + name)
+		if err != nil {
+			return written, err
+		}
+		// O_EXCL keeps a file created since the check
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return written, err
+		}
+		if _, err := file.Write(content); err != nil {
+			file.Close()
+			return written, fmt.Errorf("write %s: %w", path, err)
+		}
+		if err := file.Close(); err != nil {
+			return written, err
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
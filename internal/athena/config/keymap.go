@@ -9,34 +9,171 @@ type KeyMap map[string]KeyAction
 type KeymapConfig struct {
 	Normal KeyMap `toml:"normal"`
 	Insert KeyMap `toml:"insert"`
+	Visual KeyMap `toml:"visual"`
 }
 
 func defaultKeymap() KeymapConfig {
 	return KeymapConfig{
 		Normal: map[string]KeyAction{
 			"i": "enter_insert_mode",
+			"a": "append",
+			"A": "append_to_line_end",
+			"o": "open_line_below",
+			"O": "open_line_above",
+			".": "repeat_last_change",
+			"r": "replace_char",
+			"R": "enter_replace_mode",
+			"C": "add_cursor_below",
+			"J": "join_lines",
+			"~": "toggle_case",
+			"m": "set_mark",
+			"`": "goto_mark",
+			"v": "enter_visual_mode",
+			"u": "undo",
+			"U": "redo",
+			":": "enter_command_mode",
 			"j": "move_down",
 			"k": "move_up",
 			"h": "move_left",
 			"l": "move_right",
 			"w": "move_next_word",
 			"b": "move_prev_word",
+			"e": "move_word_end",
+			"W": "move_next_big_word",
+			"B": "move_prev_big_word",
+			"E": "move_big_word_end",
+			"^": "move_to_first_non_blank",
+			"$": "move_to_line_end",
+			"f": "find_char_forward",
+			"F": "find_char_backward",
+			"t": "till_char_forward",
+			"T": "till_char_backward",
+			";": "repeat_find",
+			",": "repeat_find_reverse",
+			"*": "search_word_forward",
+			"#": "search_word_backward",
+
+			"p":  "paste_after",
+			"P":  "paste_before",
+			"\"": "select_register",
+			"/":  "search_forward",
+			"?":  "search_backward",
+			"n":  "search_next",
+			"N":  "search_prev",
+			"%":  "match_bracket",
 			"g": map[string]string{
 				"g": "go_to_top",
 				"e": "go_to_bottom",
 				"h": "go_to_line_start",
 				"l": "go_to_line_end",
+				"_": "move_to_last_non_blank",
+				"j": "move_visual_down",
+				"k": "move_visual_up",
+				"c": "toggle_comment",
+				"C": "toggle_block_comment",
+				"u": "lowercase",
+				"U": "uppercase",
+				"v": "reselect_visual",
+				"-": "undo_tree_left",
+				"+": "undo_tree_right",
+			},
+			"z": map[string]string{
+				"h": "scroll_left",
+				"l": "scroll_right",
+			},
+			"d": map[string]string{
+				"d": "delete_line",
+				"i": "delete_inside",
+				"a": "delete_around",
+			},
+			"y": map[string]string{
+				"y": "yank_line",
+			},
+			">": map[string]string{
+				">": "indent_line",
+			},
+			"<": map[string]string{
+				"<": "dedent_line",
+			},
+			"]": map[string]string{
+				"d": "next_diagnostic",
+				"p": "next_same_indent",
+			},
+			"[": map[string]string{
+				"d": "prev_diagnostic",
+				"p": "prev_same_indent",
 			},
-			"<left>":  "move_left",
-			"<right>": "move_right",
-			"<up>":    "move_up",
-			"<down>":  "move_down",
+			"<left>":     "move_left",
+			"<right>":    "move_right",
+			"<up>":       "move_up",
+			"<down>":     "move_down",
+			"<c-d>":      "half_page_down",
+			"<c-u>":      "half_page_up",
+			"<c-f>":      "page_down",
+			"<c-b>":      "page_up",
+			"<pagedown>": "page_down",
+			"<pageup>":   "page_up",
+			"<c-l>":      "clear_search_highlight",
+			"<c-r>":      "redo",
+			"<c-o>":      "jump_back",
+			"<tab>":      "jump_forward",
+			"<esc>":      "keep_primary_cursor",
+			"<cr>":       "open_entry",
 		},
 		Insert: map[string]KeyAction{
 			"<esc>": "enter_normal_mode",
 			"<cr>":  "new_line",
 			"<bs>":  "delete_backwards",
 			"<del>": "delete_forward",
+			"<tab>": "insert_indent",
+			"<c-v>": "insert_literal",
+		},
+		Visual: map[string]KeyAction{
+			"<esc>": "enter_normal_mode",
+			"v":     "enter_normal_mode",
+			"j":     "move_down",
+			"k":     "move_up",
+			"h":     "move_left",
+			"l":     "move_right",
+			"w":     "move_next_word",
+			"b":     "move_prev_word",
+			"e":     "move_word_end",
+			"W":     "move_next_big_word",
+			"B":     "move_prev_big_word",
+			"E":     "move_big_word_end",
+			"^":     "move_to_first_non_blank",
+			"$":     "move_to_line_end",
+			"y":     "yank",
+			"\"":    "select_register",
+			"%":     "match_bracket",
+			"~":     "toggle_case",
+			"g": map[string]string{
+				"g": "go_to_top",
+				"e": "go_to_bottom",
+				"_": "move_to_last_non_blank",
+				"j": "move_visual_down",
+				"k": "move_visual_up",
+				"c": "toggle_comment",
+				"C": "toggle_block_comment",
+				"u": "lowercase",
+				"U": "uppercase",
+			},
+			"]": map[string]string{
+				"p": "next_same_indent",
+			},
+			"[": map[string]string{
+				"p": "prev_same_indent",
+			},
+			"<left>":     "move_left",
+			"<right>":    "move_right",
+			"<up>":       "move_up",
+			"<down>":     "move_down",
+			"<c-d>":      "half_page_down",
+			"<c-u>":      "half_page_up",
+			"<c-f>":      "page_down",
+			"<c-b>":      "page_up",
+			"<pagedown>": "page_down",
+			"<pageup>":   "page_up",
 		},
 	}
 }
@@ -4,12 +4,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 )
 
 type LanguagesConfig struct {
-	Languages map[string]LanguageConfig `toml:"langauges"`
+	Languages map[string]LanguageConfig `toml:"languages"`
 }
 
 type LanguageConfig struct {
@@ -21,6 +23,9 @@ type LanguageConfig struct {
 	BlockCommentTokens []CommentToken    `toml:"block_comment_tokens"`
 	AutoPairs          []AutoPair        `toml:"auto_pairs"`
 	Grammar            GrammarDefinition `toml:"grammar"`
+	IndentStyle        IndentStyleOption `toml:"indent_style"` // overrides editor.indent-style when set
+	TabWidth           int               `toml:"tab_width"`    // overrides editor.tab-width when set
+	Syntax             *bool             `toml:"syntax"`       // overrides editor.syntax when set
 }
 
 type CommentToken struct {
@@ -47,39 +52,129 @@ type InstallOptions struct {
 }
 
 // LoadLanguagesConfig loads the configuration from default path or arg.
-func LoadLanguagesConfig(filePath *string) (*LanguagesConfig, []string) {
-	var errors []string
+func LoadLanguagesConfig(filePath *string) (*LanguagesConfig, []ConfigError) {
+	var errors []ConfigError
 
 	// Load from file and merge
-	fileCfg, fileErrors := loadLanguagesConfigFile(filePath)
+	fileCfg, path, fileErrors := loadLanguagesConfigFile(filePath)
 	errors = append(errors, fileErrors...)
 
-	// validateErrors := validateAndFixConfig(defaultCfg)
-	// errors = append(errors, validateErrors...)
+	if fileCfg != nil {
+		errors = append(errors, warnings(path, validateLanguagesConfig(fileCfg))...)
+	}
 
 	return fileCfg, errors
 }
 
-func loadLanguagesConfigFile(filePath *string) (*LanguagesConfig, []string) {
+// validateLanguagesConfig resets invalid language overrides so the editor defaults apply.
+func validateLanguagesConfig(cfg *LanguagesConfig) []string {
 	var errors []string
+	for name, lang := range cfg.Languages {
+		if lang.IndentStyle != "" && !lang.IndentStyle.IsValid() {
+			errors = append(errors, fmt.Sprintf("Invalid indent_style option for %s: %s", name, lang.IndentStyle))
+			lang.IndentStyle = ""
+		}
+		if lang.TabWidth < 0 {
+			errors = append(errors, fmt.Sprintf("Invalid tab_width option for %s: %d", name, lang.TabWidth))
+			lang.TabWidth = 0
+		}
+		cfg.Languages[name] = lang
+	}
+	return errors
+}
+
+// ForFile returns the language matching fileName by exact file name or extension.
+func (c *LanguagesConfig) ForFile(fileName string) (LanguageConfig, bool) {
+	if c == nil {
+		return LanguageConfig{}, false
+	}
+
+	base := filepath.Base(fileName)
+	ext := strings.TrimPrefix(filepath.Ext(base), ".")
+	for _, lang := range c.Languages {
+		if slices.Contains(lang.Files, base) || (ext != "" && slices.Contains(lang.FileTypes, ext)) {
+			return lang, true
+		}
+	}
+	return LanguageConfig{}, false
+}
+
+// ResolveIndent returns the indent style and tab width for fileName: the editor
+// defaults with any overrides from the file's language applied.
+func (c *LanguagesConfig) ResolveIndent(editor EditorConfig, fileName string) (IndentStyleOption, int) {
+	style, width := editor.IndentStyle, editor.TabWidth
+	if lang, ok := c.ForFile(fileName); ok {
+		if lang.IndentStyle != "" {
+			style = lang.IndentStyle
+		}
+		if lang.TabWidth > 0 {
+			width = lang.TabWidth
+		}
+	}
+	return style, width
+}
+
+// ResolveSyntax reports whether fileName gets syntax highlighting: the editor's
+// syntax option unless the file's language overrides it.
+func (c *LanguagesConfig) ResolveSyntax(editor EditorConfig, fileName string) bool {
+	if lang, ok := c.ForFile(fileName); ok && lang.Syntax != nil {
+		return *lang.Syntax
+	}
+	return editor.SyntaxEnabled()
+}
+
+// defaultCommentTokens are the comment tokens of the languages athena highlights,
+// used when languages.toml doesn't configure them.
+var defaultCommentTokens = map[string]struct {
+	line  string
+	block CommentToken
+}{
+	"go": {"//", CommentToken{Start: "/*", End: "*/"}},
+	"rs": {"//", CommentToken{Start: "/*", End: "*/"}},
+}
+
+// ResolveComments returns the line comment token and the block comment tokens for
+// fileName, the first of each configured for its language. Either is empty when
+// the language has none.
+func (c *LanguagesConfig) ResolveComments(fileName string) (string, CommentToken) {
+	lang, ok := c.ForFile(fileName)
+	if !ok || len(lang.LineCommentTokens) == 0 && len(lang.BlockCommentTokens) == 0 {
+		defaults := defaultCommentTokens[strings.TrimPrefix(filepath.Ext(fileName), ".")]
+		return defaults.line, defaults.block
+	}
+
+	var line string
+	var block CommentToken
+	if len(lang.LineCommentTokens) > 0 {
+		line = lang.LineCommentTokens[0]
+	}
+	if len(lang.BlockCommentTokens) > 0 {
+		block = lang.BlockCommentTokens[0]
+	}
+	return line, block
+}
+
+func loadLanguagesConfigFile(filePath *string) (*LanguagesConfig, string, []ConfigError) {
+	var errors []ConfigError
 	if filePath == nil || *filePath == "" {
-		homeDir, err := os.UserHomeDir()
+		dir, err := Dir()
 		if err != nil {
-			errors = append(errors, fmt.Sprintf("Error finding home directory: %v", err))
-			return nil, errors
+			errors = append(errors, ConfigError{Severity: SeverityWarning, Message: fmt.Sprintf("Error finding home directory: %v", err)})
+			return nil, "", errors
 		}
-		cfgPath := filepath.Join(homeDir, ".config", "athena", "languages.toml")
+		cfgPath := filepath.Join(dir, "languages.toml")
 		filePath = &cfgPath
 	}
 
 	if _, err := os.Stat(*filePath); os.IsNotExist(err) {
-		return nil, errors // No file, no problem
+		return nil, *filePath, errors // No file, no problem
 	}
 
 	cfg := &LanguagesConfig{}
 	if _, err := toml.DecodeFile(*filePath, cfg); err != nil {
-		errors = append(errors, fmt.Sprintf("Error decoding file: %v", err))
+		// a partially decoded file isn't used
+		return nil, *filePath, append(errors, decodeError(*filePath, err))
 	}
 
-	return cfg, errors
+	return cfg, *filePath, errors
 }
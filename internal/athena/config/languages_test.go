@@ -0,0 +1,93 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveIndent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "languages.toml")
+	content := `
+[languages.go]
+file_types = ["go"]
+indent_style = "tab"
+
+[languages.python]
+file_types = ["py"]
+indent_style = "space"
+tab_width = 4
+
+[languages.make]
+files = ["Makefile"]
+indent_style = "bogus"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write languages config: %v", err)
+	}
+
+	langs, errs := LoadLanguagesConfig(&path)
+	if len(errs) != 1 {
+		t.Errorf("expected one error for the invalid indent_style, got %v", errs)
+	}
+
+	editor := defaultConfig().Editor
+	editor.IndentStyle = IndentStyleSpace
+	editor.TabWidth = 2
+
+	tests := []struct {
+		fileName string
+		style    IndentStyleOption
+		width    int
+	}{
+		{"/src/main.go", IndentStyleTab, 2},
+		{"/src/main.py", IndentStyleSpace, 4},
+		{"/src/Makefile", IndentStyleSpace, 2},
+		{"/src/notes.txt", IndentStyleSpace, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			style, width := langs.ResolveIndent(editor, tt.fileName)
+			if style != tt.style || width != tt.width {
+				t.Errorf("expected %s/%d, got %s/%d", tt.style, tt.width, style, width)
+			}
+		})
+	}
+
+	// without a languages file the editor defaults apply
+	var none *LanguagesConfig
+	if style, width := none.ResolveIndent(editor, "main.py"); style != IndentStyleSpace || width != 2 {
+		t.Errorf("expected editor defaults, got %s/%d", style, width)
+	}
+}
+
+func TestResolveSyntax(t *testing.T) {
+	off, on := false, true
+	langs := &LanguagesConfig{Languages: map[string]LanguageConfig{
+		"go":   {FileTypes: []string{"go"}, Syntax: &off},
+		"rust": {FileTypes: []string{"rs"}, Syntax: &on},
+		"toml": {FileTypes: []string{"toml"}},
+	}}
+
+	tests := []struct {
+		name     string
+		editor   *bool
+		fileName string
+		expected bool
+	}{
+		{"on by default", nil, "notes.txt", true},
+		{"off globally", &off, "notes.txt", false},
+		{"language without an override follows the editor", &off, "config.toml", false},
+		{"language turns it off", nil, "main.go", false},
+		{"language turns it on", &off, "main.rs", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := langs.ResolveSyntax(EditorConfig{Syntax: tt.editor}, tt.fileName); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
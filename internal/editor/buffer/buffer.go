@@ -2,9 +2,12 @@ package buffer
 
 import (
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,19 +24,68 @@ var (
 	ErrInvalidPosition  = errors.New("buffer: position exceeds document boundaries")
 	ErrInvalidLineCol   = errors.New("buffer: line/column position out of bounds")
 	ErrInvalidSelection = errors.New("buffer: selection boundaries are invalid")
+	ErrReadOnly         = errors.New("buffer: buffer is read-only")
+	ErrNoFile           = errors.New("buffer: buffer is not backed by a file")
+	ErrExternalChange   = errors.New("buffer: file changed on disk since it was read")
 )
 
+// Indentation describes how new indentation is inserted into a buffer.
+type Indentation struct {
+	UseTabs  bool
+	TabWidth int
+}
+
+// DefaultIndentation indents with tabs displayed four columns wide.
+var DefaultIndentation = Indentation{UseTabs: true, TabWidth: 4}
+
+// Unit returns the text inserted for one level of indentation.
+func (i Indentation) Unit() string {
+	if i.UseTabs {
+		return "\t"
+	}
+	return strings.Repeat(" ", i.TabWidth)
+}
+
 // Buffer represents a text buffer with support for syntax highlighting and concurrent access.
 type Buffer struct {
-	document      *rope.Rope
-	selection     state.Selection
-	filePath      string
-	lastSavePoint time.Time
-	file          *os.File
-	size          int64
-	lineCache     []int
-	highlighter   *treesitter.Highlighter
-	dirty         bool
+	document       *rope.Rope
+	selections     []state.Selection // never empty; normalized by multi-cursor operations
+	primary        int               // index of the selection single-cursor operations use
+	filePath       string
+	lastSavePoint  time.Time
+	modTime        time.Time // modification time of the file as last loaded or saved
+	diskSize       int64     // size of the file as last loaded or saved
+	modifiedAt     time.Time // first edit since the last save or load; zero while clean
+	file           *os.File
+	size           int64
+	lineCache      []int
+	indentTabs     int // lines indented with tabs, computed with the line cache
+	indentSpaces   int // lines indented with spaces, computed with the line cache
+	highlighter    *treesitter.Highlighter
+	lineHighlights map[int][]treesitter.Highlight // highlights by row; nil until (re)computed
+	dirty          bool
+	saved          *rope.Rope   // snapshot of the document as last loaded or saved
+	lineChanges    []LineChange // lines changed since saved, as of the last diff
+	diffVersion    int          // bumped by every edit, to drop diffs of older documents
+	diffTimer      *time.Timer  // runs the diff once edits stop for DiffDelay
+	onDiff         func()       // called after a diff run by diffTimer, nil for none
+	name           string       // synthetic name for buffers not backed by a file
+	readOnly       bool
+	chunked        bool        // loaded through a ChunkManager; expensive features are disabled
+	source         *os.File    // the file a chunked buffer reads its chunks from
+	folds          map[int]int // closed folds: start line -> last folded line
+	indentation    Indentation
+	comments       CommentTokens
+	options        map[string]bool  // buffer-local overrides of editor options
+	lossy          bool             // invalid UTF-8 was replaced with U+FFFD on load
+	encoding       string           // encoding the file is written in
+	format         string           // line endings the file is written with
+	savedEncoding  string           // encoding of the file as last loaded or saved
+	savedFormat    string           // line endings of the file as last loaded or saved
+	history        *undoTree        // nil for chunked buffers
+	lastVisual     *state.Selection // last visual selection, shifted along with edits
+	marks          map[rune]int     // positions of named marks, shifted along with edits
+	diagnostics    []Diagnostic     // ordered by position
 
 	FileUtil *util.FileUtil
 
@@ -42,15 +94,43 @@ type Buffer struct {
 }
 
 // NewBuffer creates a new Buffer with optional initial content.
-func NewBuffer(filePath string) (*Buffer, error) {
+// A path that does not exist yet yields an empty buffer; the file is created on save.
+// Files larger than largeFileThreshold bytes are read through a ChunkManager and
+// opened read-only without syntax highlighting, keeping only the chunks last read
+// in memory; a threshold of 0 disables chunked mode.
+// Without syntax, or for a file no known language claims, no highlighter is created
+// and the file opens as plain text.
+func NewBuffer(filePath string, largeFileThreshold int64, syntax bool) (*Buffer, error) {
 	file, err := os.OpenFile(filePath, os.O_RDWR, 0644)
-	if err != nil {
+	if err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
 
-	document, err := io.ReadAll(file)
+	var info os.FileInfo
+	if file != nil {
+		if info, err = file.Stat(); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	if info != nil && largeFileThreshold > 0 && info.Size() > largeFileThreshold {
+		return newChunkedBuffer(filePath, file, info.ModTime())
+	}
+
+	var content []byte
+	if file != nil {
+		content, err = io.ReadAll(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	document, encoding, format, lossy, err := decodeFile(content)
 	if err != nil {
-		file.Close()
+		if file != nil {
+			file.Close()
+		}
 		return nil, err
 	}
 
@@ -60,79 +140,227 @@ func NewBuffer(filePath string) (*Buffer, error) {
 		return nil, err
 	}
 
-	// Setup registry
-	registry := treesitter.NewRegistry()
+	var highlighter *treesitter.Highlighter
+	if syntax {
+		highlighter, err = newHighlighter(filepath.Base(filePath))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	b := &Buffer{
+		document:      rope.NewRope(document),
+		selections:    []state.Selection{{}},
+		filePath:      fp,
+		lastSavePoint: time.Now(),
+		file:          file,
+		size:          int64(len(content)),
+		lossy:         lossy,
+		encoding:      encoding,
+		format:        format,
+		savedEncoding: encoding,
+		savedFormat:   format,
+		highlighter:   highlighter,
+		indentation:   DefaultIndentation,
+		history:       newUndoTree(),
+		FileUtil:      util.NewFileUtil(nil),
+	}
+	if info != nil {
+		b.modTime, b.diskSize = info.ModTime(), info.Size()
+	}
 
-	// Register langauges
+	b.saved = b.document.Snapshot()
+	b.resetDiff()
+	b.updateLineCache()
+
+	return b, nil
+}
+
+// newHighlighter creates the highlighter for the language of the named file, or
+// returns nil when no known language claims it.
+func newHighlighter(fileName string) (*treesitter.Highlighter, error) {
+	registry := treesitter.NewRegistry()
 	_ = registry.RegisterLanguage(&languages.RustProvider{})
 	_ = registry.RegisterLanguage(&languages.GoProvider{})
 
-	// Create highlighter
-	highlighter, err := treesitter.NewHighlighter(registry, filepath.Base(filePath))
+	highlighter, err := treesitter.NewHighlighter(registry, fileName)
+	if errors.Is(err, treesitter.ErrUnsupportedExtension) {
+		return nil, nil
+	}
+	return highlighter, err
+}
+
+// newChunkedBuffer opens file read-only without a highlighter. Its chunks are only
+// scanned up front and read back as they're needed, keeping ChunkCacheSize of them
+// in memory, so the whole file never is.
+func newChunkedBuffer(filePath string, file *os.File, modTime time.Time) (*Buffer, error) {
+	fp, err := filepath.Abs(filePath)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	chunks := NewChunkManager(file)
+	pieces, size, err := chunks.Pieces()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	// saving replaces the file and its handle, so chunks are read through their own
+	source, err := os.Open(filePath)
 	if err != nil {
 		file.Close()
 		return nil, err
 	}
 
 	b := &Buffer{
-		document:      rope.NewRope(string(document)),
-		selection:     state.Selection{Start: 0, End: 0},
+		document:      rope.NewLazyRope(pieces, readPiece(source), ChunkCacheSize),
+		selections:    []state.Selection{{}},
 		filePath:      fp,
 		lastSavePoint: time.Now(),
+		modTime:       modTime,
+		diskSize:      size,
 		file:          file,
-		size:          int64(len(document)),
-		highlighter:   highlighter,
+		size:          size,
+		lossy:         chunks.Lossy(),
+		encoding:      EncodingUTF8,
+		format:        FormatUnix,
+		savedEncoding: EncodingUTF8,
+		savedFormat:   FormatUnix,
+		chunked:       true,
+		readOnly:      true,
+		source:        source,
+		indentation:   DefaultIndentation,
 		FileUtil:      util.NewFileUtil(nil),
 	}
 
+	b.saved = b.document.Snapshot()
 	b.updateLineCache()
 
 	return b, nil
 }
 
-// Insert inserts text at the cursor's current position.
+// NewScratchBuffer creates a read-only buffer that is not backed by a file.
+func NewScratchBuffer(name string, content string) *Buffer {
+	b := &Buffer{
+		document:      rope.NewRope(content),
+		selections:    []state.Selection{{}},
+		size:          int64(len(content)),
+		name:          name,
+		readOnly:      true,
+		indentation:   DefaultIndentation,
+		history:       newUndoTree(),
+		encoding:      EncodingUTF8,
+		format:        FormatUnix,
+		savedEncoding: EncodingUTF8,
+		savedFormat:   FormatUnix,
+		FileUtil:      util.NewFileUtil(nil),
+	}
+
+	b.saved = b.document.Snapshot()
+	b.updateLineCache()
+
+	return b
+}
+
+// Insert replaces every selection with text, leaving a cursor after each insertion.
+// With several selections, the insertions are undone together.
 func (b *Buffer) Insert(s string) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	// replace selection with new text
-	if b.selection.Start != b.selection.End {
-		if err := b.document.Delete(b.selection.Start, b.selection.End); err != nil {
-			return err
-		}
-		b.size -= int64(b.selection.End - b.selection.Start)
+	if b.readOnly {
+		return ErrReadOnly
 	}
 
-	// insert new text at selection start
-	if err := b.document.Insert(b.selection.Start, s); err != nil {
+	b.normalizeSelections()
+	ranges := make([]state.Selection, len(b.selections))
+	for i, selection := range b.selections {
+		ranges[i] = state.Selection{Start: min(selection.Start, selection.End), End: max(selection.Start, selection.End)}
+	}
+	return b.editSelections(ranges, slices.Repeat([]string{s}, len(ranges)))
+}
+
+// Overwrite replaces the grapheme under the cursor with s as a single undo step and
+// moves the cursor past it. At the end of a line, where there's nothing to overwrite,
+// s is inserted instead.
+func (b *Buffer) Overwrite(s string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+
+	pos := b.selections[b.primary].End
+	end := pos
+	if grapheme, err := b.document.GraphemeAt(pos); err == nil && grapheme != "\n" {
+		end++
+	}
+	if err := b.replace(pos, end, s); err != nil {
 		return err
 	}
 
-	// update selection to new position
-	graphemeCount := countGraphemes(s)
-	newEnd := b.selection.Start + graphemeCount
-	b.selection = state.Selection{Start: newEnd, End: newEnd}
+	newEnd := pos + countGraphemes(s)
+	b.selections[b.primary] = state.Selection{Start: newEnd, End: newEnd}
 
-	b.size += int64(len(s))
-	b.dirty = true
+	b.markDirty()
 	b.updateLineCache()
 	return nil
 }
 
+// InsertNewlineWithIndent breaks the line like Insert("\n"), starting the new line
+// with the spaces and tabs the broken one begins with, copied verbatim. Only the
+// indentation before the insertion point is copied, so breaking a line within its
+// indentation leaves the rest of it to the text moving down. With several
+// selections, each breaks its own line, and the breaks are undone together.
+func (b *Buffer) InsertNewlineWithIndent() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+
+	b.normalizeSelections()
+	ranges := make([]state.Selection, len(b.selections))
+	texts := make([]string, len(b.selections))
+	for i, selection := range b.selections {
+		ranges[i] = state.Selection{Start: min(selection.Start, selection.End), End: max(selection.Start, selection.End)}
+
+		b.lineCacheMu.RLock()
+		line, _ := b.lineColAt(ranges[i].Start)
+		lineStart := b.lineCache[line]
+		b.lineCacheMu.RUnlock()
+
+		before, err := b.document.Substring(lineStart, ranges[i].Start)
+		if err != nil {
+			return err
+		}
+		texts[i] = "\n" + before[:len(before)-len(strings.TrimLeft(before, " \t"))]
+	}
+	return b.editSelections(ranges, texts)
+}
+
 // Delete deletes text from the cursor position to position + length.
 func (b *Buffer) Delete(start, end int) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if err := b.document.Delete(start, end); err != nil {
+	if b.readOnly {
+		return ErrReadOnly
+	}
+
+	if err := b.replace(start, end, ""); err != nil {
 		return err
 	}
 
-	if b.selection.Start > start {
-		b.selection = state.Selection{Start: start, End: start}
+	if b.selections[b.primary].Start > start {
+		b.selections[b.primary] = state.Selection{Start: start, End: start}
 	}
 
-	b.size -= int64(end - start)
+	b.markDirty()
 	b.updateLineCache()
 	return nil
 }
@@ -142,60 +370,622 @@ func (b *Buffer) DeleteSelection() error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	start, end := b.selection.Start, b.selection.End
-	if err := b.document.Delete(start, end); err != nil {
+	if b.readOnly {
+		return ErrReadOnly
+	}
+
+	start, end := b.selections[b.primary].Start, b.selections[b.primary].End
+	if err := b.replace(start, end, ""); err != nil {
 		return err
 	}
 
-	b.selection = state.Selection{Start: start, End: start}
-	b.size -= int64(end - start)
+	b.selections[b.primary] = state.Selection{Start: start, End: start}
+	b.markDirty()
+	b.updateLineCache()
+	return nil
+}
+
+// Clear empties the document for the buffer to be filled anew, as when a generated
+// view is refreshed. The undo history, diagnostics, folds, last visual selection and
+// marks belong to the old content and are dropped with it. Scratch buffers can be
+// cleared even though they are read-only, and are left unmodified; a cleared file
+// buffer is modified until saved.
+func (b *Buffer) Clear() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	scratch := b.filePath == ""
+	if b.readOnly && !scratch {
+		return ErrReadOnly
+	}
+
+	b.document = rope.NewRope("")
+	if scratch {
+		b.saved = b.document.Snapshot()
+		b.resetDiff()
+	} else {
+		b.invalidateDiff()
+	}
+	b.setSelection(state.Selection{})
+	b.size = 0
+	if b.history != nil {
+		limit := b.history.limit
+		b.history = newUndoTree()
+		b.history.limit = limit
+	}
+	b.diagnostics = nil
+	b.lastVisual = nil
+	b.marks = nil
+	b.folds = nil
+	b.lossy = false
+	b.markDirty()
 	b.updateLineCache()
 	return nil
 }
 
-// GetSelectedText returns the text within the current selections.
+// splitEOL splits text into its content without trailing newlines and the single
+// newline it should end with, empty for empty content.
+func splitEOL(text string) (string, string) {
+	trimmed, eol := text, "\n"
+	for {
+		if strings.HasSuffix(trimmed, "\r\n") {
+			trimmed, eol = trimmed[:len(trimmed)-2], "\r\n"
+		} else if strings.HasSuffix(trimmed, "\n") {
+			trimmed, eol = trimmed[:len(trimmed)-1], "\n"
+		} else {
+			break
+		}
+	}
+	if trimmed == "" {
+		eol = ""
+	}
+	return trimmed, eol
+}
+
+// FixEOL makes the document end with exactly one newline, collapsing trailing
+// blank lines in a single edit. Empty documents are left alone. It reports
+// whether the document changed.
+func (b *Buffer) FixEOL() (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return false, ErrReadOnly
+	}
+
+	text := b.document.String()
+	trimmed, eol := splitEOL(text)
+	if trimmed+eol == text {
+		return false, nil
+	}
+
+	start := countGraphemes(trimmed)
+	if err := b.replace(start, b.document.TotalGraphemes(), eol); err != nil {
+		return false, err
+	}
+
+	// pull the cursor out of the trimmed lines
+	total := b.document.TotalGraphemes()
+	b.selections[b.primary].Start = min(b.selections[b.primary].Start, total)
+	b.selections[b.primary].End = min(b.selections[b.primary].End, total)
+
+	b.size = int64(len(trimmed) + len(eol))
+	b.markDirty()
+	b.updateLineCache()
+	return true, nil
+}
+
+// ReadBelow inserts the text streamed from r as lines below the given line, a chunk at
+// a time, and leaves the cursor at the start of the inserted block. The insert is
+// undone as a single step. It returns the number of bytes read.
+func (b *Buffer) ReadBelow(line int, r io.Reader) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return 0, ErrReadOnly
+	}
+	if line < 0 || line >= len(b.lineCache) {
+		return 0, ErrInvalidLineCol
+	}
+
+	if b.history != nil && b.history.group == nil {
+		b.history.group = &UndoNode{selection: b.selections[b.primary]}
+		defer func() { b.history.group = nil }()
+	}
+
+	// below the last line, the block needs a newline of its own to start on
+	atEnd := line == len(b.lineCache)-1
+	pos := b.document.TotalGraphemes()
+	if !atEnd {
+		b.lineCacheMu.RLock()
+		pos, _ = b.lineBounds(line + 1)
+		b.lineCacheMu.RUnlock()
+	}
+	start, endsWithNewline := pos, true
+
+	// whatever was inserted before an error stays, like a partial read
+	defer func() {
+		b.markDirty()
+		b.updateLineCache()
+	}()
+
+	chunks := NewChunkManager(r)
+	for {
+		chunk, err := chunks.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return chunks.offset, err
+		}
+		if atEnd && pos == start {
+			chunk = "\n" + chunk
+			start++
+		}
+		if err := b.replace(pos, pos, chunk); err != nil {
+			return chunks.offset, err
+		}
+		pos += countGraphemes(chunk)
+		endsWithNewline = strings.HasSuffix(chunk, "\n")
+	}
+
+	switch {
+	case pos == start:
+		return chunks.offset, nil
+	case atEnd && endsWithNewline:
+		// the block ends the document, its last newline would add an empty line
+		if err := b.replace(pos-1, pos, ""); err != nil {
+			return chunks.offset, err
+		}
+	case !atEnd && !endsWithNewline:
+		if err := b.replace(pos, pos, "\n"); err != nil {
+			return chunks.offset, err
+		}
+	}
+
+	b.selections[b.primary] = state.Selection{Start: start, End: start}
+	return chunks.offset, nil
+}
+
+// GetSelectedText returns the text within the primary selection, whichever way it
+// was made. A selection reaching past the document returns ErrInvalidSelection.
 func (b *Buffer) GetSelectedText() (string, error) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
-	return b.document.Substring(b.selection.Start, b.selection.End)
+	selection := b.selections[b.primary]
+	start, end := min(selection.Start, selection.End), max(selection.Start, selection.End)
+	if start < 0 || end > b.document.TotalGraphemes() {
+		return "", ErrInvalidSelection
+	}
+	return b.document.Substring(start, end)
+}
+
+// Substring returns the text between two positions.
+func (b *Buffer) Substring(start, end int) (string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.document.Substring(start, end)
+}
+
+// GraphemeRange returns the graphemes from start to end (exclusive), clamped to the
+// document, fetched in a single traversal of the rope.
+func (b *Buffer) GraphemeRange(start, end int) (string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.graphemeRange(start, end)
+}
+
+// graphemeRange returns the clamped range of graphemes; the caller must hold the lock.
+func (b *Buffer) graphemeRange(start, end int) (string, error) {
+	total := b.document.TotalGraphemes()
+	return b.document.Substring(util.Clamp(start, 0, total), util.Clamp(end, 0, total))
 }
 
-// Save writes buffer content to disk.
+// Save writes buffer content to disk. It returns ErrExternalChange instead when the
+// file was changed by another program since the buffer read or wrote it.
 func (b *Buffer) Save() error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if err := b.file.Truncate(0); err != nil {
+	return b.checkedSave()
+}
+
+// checkedSave writes buffer content to disk unless another program changed the file
+// since the buffer read or wrote it; the caller must hold the lock.
+func (b *Buffer) checkedSave() error {
+	if changed, err := b.hasExternalChanges(); err != nil {
 		return err
+	} else if changed {
+		return ErrExternalChange
 	}
+	return b.save()
+}
 
-	if _, err := b.file.Seek(0, 0); err != nil {
+// ForceSave writes buffer content to disk like Save, even over changes made to the
+// file by another program.
+func (b *Buffer) ForceSave() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.save()
+}
+
+// HasExternalChanges reports whether the file was changed by another program since
+// the buffer read or wrote it, going by its modification time and size. A file that
+// was removed doesn't count, since saving writes it again.
+func (b *Buffer) HasExternalChanges() (bool, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.hasExternalChanges()
+}
+
+// hasExternalChanges implements HasExternalChanges; the caller must hold the lock.
+func (b *Buffer) hasExternalChanges() (bool, error) {
+	if b.filePath == "" {
+		return false, ErrNoFile
+	}
+
+	info, err := os.Stat(b.filePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !info.ModTime().Equal(b.modTime) || info.Size() != b.diskSize, nil
+}
+
+// SaveAs writes the buffer's content to the given path and binds the buffer to it
+// once written; a failed write leaves the buffer on its old file.
+func (b *Buffer) SaveAs(filePath string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	fp, err := filepath.Abs(filePath)
+	if err != nil {
+		return err
+	}
+
+	if err := b.saveTo(fp); err != nil {
 		return err
 	}
+	b.filePath = fp
+	b.name = ""
+	return nil
+}
 
-	_, err := b.file.WriteString(b.document.String())
+// SaveCopy writes the buffer's content to the file at path in its encoding and line
+// format, leaving the buffer on its own file and its modified state alone. With
+// fixEOL the copy ends with exactly one newline, as FixEOL would leave the document.
+func (b *Buffer) SaveCopy(path string, fixEOL bool) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	text := b.document.String()
+	if fixEOL {
+		trimmed, eol := splitEOL(text)
+		text = trimmed + eol
+	}
+	data, err := encodeText(text, b.encoding, b.format)
 	if err != nil {
 		return err
 	}
+	return util.WriteFileAtomic(path, data, 0644)
+}
+
+// save writes buffer content to disk; the caller must hold the lock.
+func (b *Buffer) save() error {
+	// Never-persisted buffers need a path before they can be written
+	if b.filePath == "" {
+		return ErrNoFile
+	}
+	return b.saveTo(b.filePath)
+}
+
+// saveTo writes buffer content to the file at path, which becomes the one the buffer
+// is compared against; the caller must hold the lock.
+func (b *Buffer) saveTo(path string) error {
+	data, err := encodeText(b.document.String(), b.encoding, b.format)
+	if err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomic(path, data, 0644); err != nil {
+		return err
+	}
+
+	// the old handle still refers to the file that was replaced
+	file, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	if b.file != nil {
+		b.file.Close()
+	}
+	b.file = file
 
 	b.lastSavePoint = time.Now()
+	b.size = int64(len(data))
+	if info, err := b.file.Stat(); err == nil {
+		b.modTime, b.diskSize = info.ModTime(), info.Size()
+	}
+	b.savedEncoding, b.savedFormat = b.encoding, b.format
 	b.dirty = false
+	b.modifiedAt = time.Time{}
+	b.lossy = false // the file now holds the replacement characters
+	b.saved = b.document.Snapshot()
+	b.resetDiff()
 	return nil
 }
 
-// Close properly closes the buffer and its resources
-func (b *Buffer) Close() error {
+// maxReloadEdits is the number of diff hunks beyond which Reload replaces the whole document.
+const maxReloadEdits = 256
+
+// maxReloadLines is the number of inserted or deleted lines beyond which Reload stops
+// diffing and replaces the whole document.
+const maxReloadLines = 1000
+
+// Reload re-reads the file from disk, applying only the changed lines so the
+// cursor keeps its position relative to the surrounding content.
+func (b *Buffer) Reload() error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	// Save remaining dirty content
-	if b.dirty {
-		if err := b.Save(); err != nil {
+	if b.filePath == "" {
+		return ErrNoFile
+	}
+
+	info, err := os.Stat(b.filePath)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(b.filePath)
+	if err != nil {
+		return err
+	}
+	text, encoding, format, lossy, err := decodeFile(content)
+	if err != nil {
+		return err
+	}
+
+	disk := rope.NewRope(text)
+	edits, ok := b.document.DiffWithin(disk, maxReloadLines)
+
+	// the reload is undone as a single step
+	if b.history != nil {
+		b.history.group = &UndoNode{selection: b.selections[b.primary]}
+		defer func() { b.history.group = nil }()
+	}
+
+	b.lineCacheMu.RLock()
+	line, col := b.lineColAt(b.selections[b.primary].End)
+	b.lineCacheMu.RUnlock()
+	if !ok || len(edits) > maxReloadEdits {
+		if err := b.replace(0, b.document.TotalGraphemes(), text); err != nil {
+			return err
+		}
+	} else {
+		if err := b.applyLineEdits(edits); err != nil {
+			return err
+		}
+		line = shiftLineForEdits(line, edits)
+	}
+
+	b.size = int64(len(content))
+	b.modTime, b.diskSize = info.ModTime(), info.Size()
+	b.lossy = lossy
+	b.encoding, b.format = encoding, format
+	b.savedEncoding, b.savedFormat = encoding, format
+	b.dirty = false
+	b.modifiedAt = time.Time{}
+	b.saved = b.document.Snapshot()
+	b.resetDiff()
+	b.lastSavePoint = time.Now()
+	b.updateLineCache()
+
+	pos := b.clampLineCol(line, col)
+	b.setSelection(state.Selection{Start: pos, End: pos})
+	return nil
+}
+
+// applyLineEdits applies line edits computed against the current document as
+// one batch; the line cache must reflect the document before the edits.
+func (b *Buffer) applyLineEdits(edits []rope.Edit) error {
+	b.lineCacheMu.RLock()
+	defer b.lineCacheMu.RUnlock()
+
+	lineCount := len(b.lineCache)
+	total := b.document.TotalGraphemes()
+	lineStart := func(line int) int {
+		if line >= lineCount {
+			return total + 1 // virtual start past the final line
+		}
+		return b.lineCache[line]
+	}
+
+	// apply back to front so earlier line offsets stay valid
+	for i := len(edits) - 1; i >= 0; i-- {
+		edit := edits[i]
+		text := strings.Join(edit.Lines, "\n")
+
+		var start, end int
+		switch {
+		case edit.EndLine < lineCount:
+			start, end = lineStart(edit.StartLine), lineStart(edit.EndLine)
+			if len(edit.Lines) > 0 {
+				text += "\n"
+			}
+		case edit.StartLine > 0:
+			// edit reaches the end; take the newline preceding it instead
+			start, end = lineStart(edit.StartLine)-1, total
+			if len(edit.Lines) > 0 {
+				text = "\n" + text
+			}
+		default:
+			start, end = 0, total
+		}
+
+		if err := b.replace(start, end, text); err != nil {
 			return err
 		}
 	}
-	return b.file.Close()
+	return nil
+}
+
+// shiftLineForEdits maps a line in the original document to its line after the edits.
+func shiftLineForEdits(line int, edits []rope.Edit) int {
+	shift := 0
+	for _, edit := range edits {
+		if edit.EndLine <= line {
+			shift += len(edit.Lines) - (edit.EndLine - edit.StartLine)
+			continue
+		}
+		if edit.StartLine <= line {
+			// the line itself changed; stay within the replacement
+			offset := min(line-edit.StartLine, max(len(edit.Lines)-1, 0))
+			return edit.StartLine + shift + offset
+		}
+		break
+	}
+	return line + shift
+}
+
+// clampLineCol converts a line and column into a position, clamping both to the document.
+func (b *Buffer) clampLineCol(line, col int) int {
+	b.lineCacheMu.RLock()
+	defer b.lineCacheMu.RUnlock()
+
+	line = util.Clamp(line, 0, len(b.lineCache)-1)
+	lineStart := b.lineCache[line]
+	lineEnd := b.document.TotalGraphemes()
+	if line+1 < len(b.lineCache) {
+		lineEnd = b.lineCache[line+1] - 1
+	}
+	return lineStart + util.Clamp(col, 0, lineEnd-lineStart)
+}
+
+// Flush saves the buffer like Save if it has unsaved changes, returning
+// ErrExternalChange when another program changed the file; scratch buffers have
+// nowhere to write.
+func (b *Buffer) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.dirty || b.filePath == "" {
+		return nil
+	}
+	return b.checkedSave()
+}
+
+// Close releases the buffer's resources without saving; call Flush first to keep changes.
+func (b *Buffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.source != nil {
+		b.source.Close()
+		b.source = nil
+	}
+	if b.highlighter != nil {
+		b.highlighter.Close()
+		b.highlighter = nil
+	}
+	if b.diffTimer != nil {
+		b.diffTimer.Stop()
+		b.diffTimer = nil
+	}
+	if b.file == nil {
+		return nil
+	}
+	err := b.file.Close()
+	b.file = nil
+	return err
+}
+
+// IsScratch reports whether the buffer is not backed by a file.
+func (b *Buffer) IsScratch() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.filePath == ""
+}
+
+// markDirty flags unsaved changes after an edit, unless the edit brought the
+// document, encoding and line endings back to those saved, and notes when the
+// changes began; the caller must hold the lock.
+func (b *Buffer) markDirty() {
+	b.dirty = !b.document.EqualTo(b.saved) || b.encoding != b.savedEncoding || b.format != b.savedFormat
+	switch {
+	case !b.dirty:
+		b.modifiedAt = time.Time{}
+	case b.modifiedAt.IsZero():
+		b.modifiedAt = time.Now()
+	}
+}
+
+// IsDirty reports whether the buffer has unsaved changes.
+func (b *Buffer) IsDirty() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.dirty
+}
+
+// ModifiedDuration returns how long the buffer has had unsaved changes, counted
+// from the first edit after it was loaded or saved, or 0 when it has none.
+func (b *Buffer) ModifiedDuration() time.Duration {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if !b.dirty {
+		return 0
+	}
+	return time.Since(b.modifiedAt)
+}
+
+// IsReadOnly reports whether the buffer rejects edits.
+func (b *Buffer) IsReadOnly() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.readOnly
+}
+
+// IsChunked reports whether the buffer was opened in chunked mode because the
+// file exceeded the large file threshold.
+func (b *Buffer) IsChunked() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.chunked
+}
+
+// Indentation returns how the buffer inserts indentation.
+func (b *Buffer) Indentation() Indentation {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.indentation
+}
+
+// SetIndentation sets how the buffer inserts indentation.
+func (b *Buffer) SetIndentation(indentation Indentation) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.indentation = indentation
+}
+
+// SetReadOnly toggles whether the buffer rejects edits.
+func (b *Buffer) SetReadOnly(readOnly bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.readOnly = readOnly
 }
 
 // CollapseSelectionsToCursor collapses all selections to their end positions.
@@ -203,16 +993,45 @@ func (b *Buffer) CollapseSelectionsToCursor() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	pos := b.selection.End
-	b.selection = state.Selection{Start: pos, End: pos}
+	for i, selection := range b.selections {
+		b.selections[i] = state.Selection{Start: selection.End, End: selection.End}
+	}
+	b.normalizeSelections()
+}
+
+// SaveVisualSelection remembers the current selection as the last visual one, for
+// LastVisualSelection to return after it was collapsed.
+func (b *Buffer) SaveVisualSelection() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	selection := b.selections[b.primary]
+	b.lastVisual = &selection
+}
+
+// LastVisualSelection returns the selection saved by SaveVisualSelection, moved along
+// with the edits made since and clamped to the document. It reports false when no
+// selection was saved.
+func (b *Buffer) LastVisualSelection() (state.Selection, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.lastVisual == nil {
+		return state.Selection{}, false
+	}
+	total := b.document.TotalGraphemes()
+	return state.Selection{
+		Start: min(b.lastVisual.Start, total),
+		End:   min(b.lastVisual.End, total),
+	}, true
 }
 
-// Selections returns the current selections.
+// Selection returns the primary selection.
 func (b *Buffer) Selection() state.Selection {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
-	return b.selection
+	return b.selections[b.primary]
 }
 
 // TotalGraphemes returns the total number of graphemes in the document.
@@ -223,6 +1042,14 @@ func (b *Buffer) TotalGraphemes() int {
 	return b.document.TotalGraphemes()
 }
 
+// GraphemeAt returns the grapheme at pos.
+func (b *Buffer) GraphemeAt(pos int) (string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.document.GraphemeAt(pos)
+}
+
 // PositionToLineCol converts a buffer position to line and column numbers
 func (b *Buffer) PositionToLineCol(pos int) (int, int, error) {
 	b.mu.RLock()
@@ -235,23 +1062,28 @@ func (b *Buffer) PositionToLineCol(pos int) (int, int, error) {
 	b.lineCacheMu.RLock()
 	defer b.lineCacheMu.RUnlock()
 
-	// search lineCache to find the line
-	left, right := 0, len(b.lineCache)-1
-	var line int
-	for left <= right {
-		mid := (left + right) / 2
-		if b.lineCache[mid] <= pos {
-			line = mid
-			left = mid + 1
-		} else {
-			right = mid - 1
-		}
-	}
-
-	column := pos - b.lineCache[line]
+	line, column := b.lineColAt(pos)
 	return line, column, nil
 }
 
+// Text returns the whole document.
+func (b *Buffer) Text() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.document.String()
+}
+
+// ContentHash returns a hash of the document's text as a hex string. Equal text
+// always hashes the same, so it can key data stored for a file's content, such as
+// undo history or recovery files, and tell whether an edit changed anything.
+func (b *Buffer) ContentHash() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return fmt.Sprintf("%016x", b.document.Hash())
+}
+
 // GetLine returns the content of a specific line
 func (b *Buffer) GetLine(lineNum int) (string, error) {
 	b.mu.RLock()
@@ -275,11 +1107,209 @@ func (b *Buffer) GetLine(lineNum int) (string, error) {
 	return b.document.Substring(start, end)
 }
 
+// GetLineWithNewline returns a line followed by its newline, which the final line of
+// the document gets when it has none, as a line yanked into a register is kept.
+func (b *Buffer) GetLineWithNewline(lineNum int) (string, error) {
+	return b.LineRange(lineNum, lineNum)
+}
+
+// DeleteLine deletes a line along with its newline, leaving the cursor at the start
+// of the line that takes its place. The last line takes the newline before it
+// instead, so no empty line is left behind, and the cursor moves to the new last
+// line. Deleting the only line empties the buffer.
+func (b *Buffer) DeleteLine(lineNum int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+	if lineNum < 0 || lineNum >= len(b.lineCache) {
+		return ErrInvalidLineCol
+	}
+
+	b.lineCacheMu.RLock()
+	start, end := b.lineBounds(lineNum)
+	last := lineNum == len(b.lineCache)-1
+	b.lineCacheMu.RUnlock()
+	switch {
+	case !last:
+		end++
+	case lineNum > 0:
+		start--
+	}
+	if err := b.replace(start, end, ""); err != nil {
+		return err
+	}
+
+	b.markDirty()
+	b.updateLineCache()
+	if last {
+		start = b.lineCache[len(b.lineCache)-1]
+	}
+	b.selections[b.primary] = state.Selection{Start: start, End: start}
+	return nil
+}
+
+// JoinLines joins lineNum with the line below it, replacing the newline between them
+// and the next line's leading spaces and tabs with a single space. No space is added
+// when the next line is blank, or when lineNum is empty or already ends in a blank.
+// The cursor is left at the join point. Joining the last line does nothing.
+func (b *Buffer) JoinLines(lineNum int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+	if lineNum < 0 || lineNum >= len(b.lineCache) {
+		return ErrInvalidLineCol
+	}
+	if lineNum == len(b.lineCache)-1 {
+		return nil
+	}
+
+	b.lineCacheMu.RLock()
+	start, end := b.lineBounds(lineNum)
+	nextStart, nextEnd := b.lineBounds(lineNum + 1)
+	b.lineCacheMu.RUnlock()
+	next, err := b.document.Substring(nextStart, nextEnd)
+	if err != nil {
+		return err
+	}
+	trimmed := strings.TrimLeft(next, " \t")
+
+	separator := " "
+	if last, err := b.document.GraphemeAt(end - 1); trimmed == "" || end == start || err == nil && (last == " " || last == "\t") {
+		separator = ""
+	}
+	// blanks are ASCII, so the leading ones are as many graphemes as bytes
+	if err := b.replace(end, nextStart+len(next)-len(trimmed), separator); err != nil {
+		return err
+	}
+
+	b.markDirty()
+	b.updateLineCache()
+	b.selections[b.primary] = state.Selection{Start: end, End: end}
+	return nil
+}
+
+// LineRange returns the lines from start to end inclusive in a single substring of
+// the document, each ending with its newline. The final line of the document gets
+// one when it has none.
+func (b *Buffer) LineRange(start, end int) (string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	b.lineCacheMu.RLock()
+	defer b.lineCacheMu.RUnlock()
+
+	if start < 0 || end >= len(b.lineCache) || start > end {
+		return "", ErrInvalidLineCol
+	}
+
+	last := b.document.TotalGraphemes()
+	if end+1 < len(b.lineCache) {
+		last = b.lineCache[end+1]
+	}
+	text, err := b.document.Substring(b.lineCache[start], last)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasSuffix(text, "\n") {
+		text += "\n"
+	}
+	return text, nil
+}
+
+// LineLength returns the number of graphemes on a line, excluding the newline.
+func (b *Buffer) LineLength(lineNum int) (int, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	b.lineCacheMu.RLock()
+	defer b.lineCacheMu.RUnlock()
+
+	if lineNum < 0 || lineNum >= len(b.lineCache) {
+		return 0, ErrInvalidLineCol
+	}
+
+	start, end := b.lineBounds(lineNum)
+	return end - start, nil
+}
+
+// HasHighlighting reports whether the buffer has a syntax highlighter. Chunked
+// buffers and buffers opened with syntax off have none.
+func (b *Buffer) HasHighlighting() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.highlighter != nil
+}
+
+// SetSyntax creates the highlighter for the language of the buffer's file when
+// enabled and removes it otherwise. Chunked buffers never get one.
+func (b *Buffer) SetSyntax(enabled bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.highlighter != nil {
+		b.highlighter.Close()
+	}
+	var highlighter *treesitter.Highlighter
+	if enabled && !b.chunked {
+		var err error
+		if highlighter, err = newHighlighter(filepath.Base(b.filePath)); err != nil {
+			return err
+		}
+	}
+	b.highlighter = highlighter
+	b.lineHighlights = nil
+	return nil
+}
+
 func (b *Buffer) GetHighlights() ([]treesitter.Highlight, error) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
-	return b.highlighter.GetHighlights([]byte(b.document.String()))
+	if b.highlighter == nil {
+		return nil, nil
+	}
+
+	return b.highlighter.GetHighlights(b.syntaxSource)
+}
+
+// syntaxSource returns the document's text for the highlighter to parse; the caller
+// must hold the lock.
+func (b *Buffer) syntaxSource() []byte {
+	return []byte(b.document.String())
+}
+
+// HighlightsByLine returns the highlights indexed by every row they span.
+// The index is built once per document change and reused until the next edit.
+func (b *Buffer) HighlightsByLine() (map[int][]treesitter.Highlight, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.lineHighlights != nil {
+		return b.lineHighlights, nil
+	}
+
+	byLine := make(map[int][]treesitter.Highlight)
+	if b.highlighter != nil {
+		highlights, err := b.highlighter.GetHighlights(b.syntaxSource)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range highlights {
+			for row := int(h.Start.Row); row <= int(h.End.Row); row++ {
+				byLine[row] = append(byLine[row], h)
+			}
+		}
+	}
+
+	b.lineHighlights = byLine
+	return byLine, nil
 }
 
 // LineCount returns the total number of lines in the buffer
@@ -298,6 +1328,9 @@ func (b *Buffer) FileName() string {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
+	if b.name != "" {
+		return b.name
+	}
 	return b.FileUtil.GetFileName(b.filePath, true)
 }
 
@@ -317,22 +1350,145 @@ func (b *Buffer) FilePath() string {
 	return b.filePath
 }
 
-// updateLineCache rebuilds the cache of line start positions.
+// IndentStats returns the number of lines indented with tabs and with spaces.
+// A line whose leading whitespace mixes both is counted in each.
+func (b *Buffer) IndentStats() (tabs, spaces int) {
+	b.lineCacheMu.RLock()
+	defer b.lineCacheMu.RUnlock()
+
+	return b.indentTabs, b.indentSpaces
+}
+
+// updateLineCache rebuilds the cache of line start positions and indentation stats.
 func (b *Buffer) updateLineCache() {
 	b.lineCacheMu.Lock()
 	defer b.lineCacheMu.Unlock()
 
+	// the document changed, so highlights must be recomputed
+	b.lineHighlights = nil
+	if b.highlighter != nil {
+		b.highlighter.Invalidate()
+	}
+
 	b.lineCache = []int{0}
+	b.indentTabs, b.indentSpaces = 0, 0
+
+	// leading tracks whether we're still in the line's leading whitespace
+	leading, hasTab, hasSpace := true, false, false
+
 	iter := b.document.NewIterator()
 	var pos int
 	for grapheme, ok := iter.Next(); ok; grapheme, ok = iter.Next() {
-		if grapheme == "\n" {
+		switch {
+		case grapheme == "\n":
 			b.lineCache = append(b.lineCache, pos+1)
+			leading, hasTab, hasSpace = true, false, false
+		case !leading:
+		case grapheme == "\t":
+			hasTab = true
+		case grapheme == " ":
+			hasSpace = true
+		default:
+			// only count indentation that precedes content
+			leading = false
+			if hasTab {
+				b.indentTabs++
+			}
+			if hasSpace {
+				b.indentSpaces++
+			}
 		}
 		pos++
 	}
 }
 
+// VirtualColumn returns the screen column pos is displayed at on its line, counting
+// tabs up to the next multiple of the tab width and wide characters as two columns.
+func (b *Buffer) VirtualColumn(pos int) (int, error) {
+	line, _, err := b.PositionToLineCol(pos)
+	if err != nil {
+		return 0, err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	b.lineCacheMu.RLock()
+	start := b.lineCache[line]
+	b.lineCacheMu.RUnlock()
+
+	text, err := b.document.Substring(start, pos)
+	if err != nil {
+		return 0, err
+	}
+	return displayWidth(text, b.indentation.TabWidth), nil
+}
+
+// displayWidth returns the number of screen columns text takes up when it starts at
+// the beginning of a line.
+func displayWidth(text string, tabWidth int) int {
+	width := 0
+	gr := uniseg.NewGraphemes(text)
+	for gr.Next() {
+		width = AdvanceColumn(width, gr.Str(), tabWidth)
+	}
+	return width
+}
+
+// AdvanceColumn returns the screen column after a grapheme cluster drawn at col: tabs
+// advance to the next tab stop, and wide characters take two columns. Every view that
+// turns text into columns goes through it so they agree on where text lands.
+func AdvanceColumn(col int, cluster string, tabWidth int) int {
+	if cluster == "\t" {
+		return NextTabStop(col, tabWidth)
+	}
+	return col + uniseg.StringWidth(cluster)
+}
+
+// NextTabStop returns the screen column a tab starting at col advances to.
+func NextTabStop(col, tabWidth int) int {
+	tabWidth = max(tabWidth, 1)
+	return col + tabWidth - col%tabWidth
+}
+
+// lineColAt returns the line and column of pos; the caller must hold lineCacheMu
+// and pass a position within the document.
+func (b *Buffer) lineColAt(pos int) (int, int) {
+	// search lineCache for the last line starting at or before pos
+	left, right := 0, len(b.lineCache)-1
+	var line int
+	for left <= right {
+		mid := (left + right) / 2
+		if b.lineCache[mid] <= pos {
+			line = mid
+			left = mid + 1
+		} else {
+			right = mid - 1
+		}
+	}
+	return line, pos - b.lineCache[line]
+}
+
+// lineBounds returns the start and end (excluding the newline) of a line;
+// the caller must hold lineCacheMu and pass a valid line.
+func (b *Buffer) lineBounds(line int) (int, int) {
+	start := b.lineCache[line]
+	if line+1 < len(b.lineCache) {
+		return start, b.lineCache[line+1] - 1
+	}
+	return start, b.document.TotalGraphemes()
+}
+
+// splitGraphemes splits a string into its grapheme clusters.
+func splitGraphemes(s string) []string {
+	var graphemes []string
+	gr := uniseg.NewGraphemes(s)
+	for gr.Next() {
+		graphemes = append(graphemes, gr.Str())
+	}
+	return graphemes
+}
+
 // countGraphemes counts the grapheme clusters in a string.
 func countGraphemes(s string) int {
 	gr := uniseg.NewGraphemes(s)
@@ -0,0 +1,2335 @@
+package buffer
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lg2m/athena/internal/editor/state"
+)
+
+func TestSaveNeverPersistedBuffer(t *testing.T) {
+	t.Run("new file is created on save", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "new.go")
+		b, err := NewBuffer(path, 0, true)
+		if err != nil {
+			t.Fatalf("NewBuffer on missing file failed: %v", err)
+		}
+		if err := b.Insert("package main\n"); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+		if err := b.Save(); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("expected file to exist after save: %v", err)
+		}
+		if string(got) != "package main\n" {
+			t.Errorf("expected %q on disk, got %q", "package main\n", string(got))
+		}
+		if err := b.Close(); err != nil {
+			t.Errorf("Close failed: %v", err)
+		}
+	})
+
+	t.Run("scratch buffer requires SaveAs", func(t *testing.T) {
+		b := NewScratchBuffer("*scratch*", "hello")
+		if err := b.Save(); !errors.Is(err, ErrNoFile) {
+			t.Errorf("expected ErrNoFile, got %v", err)
+		}
+
+		// a failed write leaves the buffer unbound
+		if err := b.SaveAs(filepath.Join(t.TempDir(), "missing", "out.txt")); err == nil {
+			t.Fatalf("expected SaveAs into a missing directory to fail")
+		}
+		if b.FilePath() != "" || b.FileName() != "*scratch*" {
+			t.Errorf("expected the buffer to stay unbound, got %q (%q)", b.FilePath(), b.FileName())
+		}
+
+		path := filepath.Join(t.TempDir(), "out.txt")
+		if err := b.SaveAs(path); err != nil {
+			t.Fatalf("SaveAs failed: %v", err)
+		}
+		if b.FilePath() != path || b.FileName() != "out.txt" {
+			t.Errorf("expected buffer bound to %q, got %q (%q)", path, b.FilePath(), b.FileName())
+		}
+
+		got, _ := os.ReadFile(path)
+		if string(got) != "hello" {
+			t.Errorf("expected %q on disk, got %q", "hello", string(got))
+		}
+		if err := b.Close(); err != nil {
+			t.Errorf("Close failed: %v", err)
+		}
+	})
+
+	t.Run("close without file does not panic", func(t *testing.T) {
+		b := NewScratchBuffer("*scratch*", "")
+		if err := b.Close(); err != nil {
+			t.Errorf("expected nil closing scratch buffer, got %v", err)
+		}
+	})
+}
+
+func TestIndentStats(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		wantTabs   int
+		wantSpaces int
+	}{
+		{"no indentation", "a\nb\n", 0, 0},
+		{"tabs only", "a\n\tb\n\t\tc\n", 2, 0},
+		{"spaces only", "a\n  b\n    c\n", 0, 2},
+		{"mixed lines", "a\n\tb\n    c\n\td\n", 2, 1},
+		{"mixed within a line", "\t  a\n", 1, 1},
+		{"whitespace-only lines ignored", "a\n\t\n    \nb", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", tt.content)
+			tabs, spaces := b.IndentStats()
+			if tabs != tt.wantTabs || spaces != tt.wantSpaces {
+				t.Errorf("IndentStats() = (%d, %d), want (%d, %d)", tabs, spaces, tt.wantTabs, tt.wantSpaces)
+			}
+		})
+	}
+}
+
+func TestReloadKeepsCursorRelativePosition(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reload.go")
+	if err := os.WriteFile(path, []byte("package main\n\nfunc main() {\n\tprintln()\n}\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	b, err := NewBuffer(path, 0, true)
+	if err != nil {
+		t.Fatalf("NewBuffer failed: %v", err)
+	}
+	defer b.Close()
+
+	// place the cursor on "println" (line 3, column 1)
+	if err := b.MoveSelectionToLineCol(3, 1, false); err != nil {
+		t.Fatalf("MoveSelectionToLineCol failed: %v", err)
+	}
+
+	// an external tool inserts an import above the cursor and edits a line below it
+	updated := "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tprintln()\n} // end\n"
+	if err := os.WriteFile(path, []byte(updated), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	if err := b.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+
+	if b.document.String() != updated {
+		t.Errorf("expected reloaded content %q, got %q", updated, b.document.String())
+	}
+	line, col, _ := b.PositionToLineCol(b.Selection().End)
+	if line != 5 || col != 1 {
+		t.Errorf("expected cursor at 5:1 after reload, got %d:%d", line, col)
+	}
+	if b.IsDirty() {
+		t.Errorf("expected buffer to be clean after reload")
+	}
+}
+
+func TestReloadEdgeCases(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		after  string
+	}{
+		{"add trailing newline", "a", "a\n"},
+		{"remove last line", "a\nb", "a"},
+		{"replace everything", "x\ny", "1\n2\n3"},
+		{"to empty", "a\nb\n", ""},
+		{"from empty", "", "a\nb\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "edge.go")
+			if err := os.WriteFile(path, []byte(tt.before), 0644); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+			b, err := NewBuffer(path, 0, true)
+			if err != nil {
+				t.Fatalf("NewBuffer failed: %v", err)
+			}
+			defer b.Close()
+
+			if err := os.WriteFile(path, []byte(tt.after), 0644); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+			if err := b.Reload(); err != nil {
+				t.Fatalf("Reload failed: %v", err)
+			}
+			if b.document.String() != tt.after {
+				t.Errorf("expected %q, got %q", tt.after, b.document.String())
+			}
+		})
+	}
+}
+
+func TestToggleFold(t *testing.T) {
+	content := "func a() {\n\tif x {\n\t\ty()\n\n\t}\n}\nfunc b() {}"
+	b := NewScratchBuffer("*test*", content)
+
+	if err := b.ToggleFold(1); err != nil {
+		t.Fatalf("ToggleFold(1) failed: %v", err)
+	}
+	if end, ok := b.FoldAt(1); !ok || end != 2 {
+		t.Errorf("expected fold 1..2, got %d (%v)", end, ok)
+	}
+
+	if err := b.ToggleFold(0); err != nil {
+		t.Fatalf("ToggleFold(0) failed: %v", err)
+	}
+	if end, ok := b.FoldAt(0); !ok || end != 4 {
+		t.Errorf("expected fold 0..4, got %d (%v)", end, ok)
+	}
+
+	if err := b.ToggleFold(6); !errors.Is(err, ErrNoFold) {
+		t.Errorf("expected ErrNoFold for a single-line block, got %v", err)
+	}
+
+	// toggling again opens the fold
+	if err := b.ToggleFold(1); err != nil {
+		t.Fatalf("ToggleFold(1) failed: %v", err)
+	}
+	if _, ok := b.FoldAt(1); ok {
+		t.Errorf("expected fold at 1 to be open")
+	}
+}
+
+func TestFoldsFollowEdits(t *testing.T) {
+	content := "a\nb {\n\tc\n\td\n}\ne"
+	tests := []struct {
+		name     string
+		start    int
+		end      int
+		text     string
+		expected map[int]int // closed folds after the edit
+		undone   bool        // whether undoing the edit brings the fold back
+	}{
+		{"line added above", 0, 0, "x\n", map[int]int{2: 4}, true},
+		{"line added before the first line", 2, 2, "x\n", map[int]int{2: 4}, true},
+		{"line removed above", 0, 2, "", map[int]int{0: 2}, true},
+		{"line added below", 14, 14, "\nx", map[int]int{1: 3}, true},
+		{"first line edited", 2, 2, "x", map[int]int{1: 3}, true},
+		{"first line joined with the one above", 1, 2, "", map[int]int{0: 2}, false},
+		{"hidden line edited", 7, 8, "C", map[int]int{}, false},
+		{"line break in the first line", 3, 3, "\n", map[int]int{}, false},
+		{"hidden lines joined with the first", 5, 7, "", map[int]int{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", content)
+			b.SetReadOnly(false)
+			if err := b.ToggleFold(1); err != nil {
+				t.Fatalf("ToggleFold failed: %v", err)
+			}
+
+			b.mu.Lock()
+			err := b.replace(tt.start, tt.end, tt.text)
+			b.updateLineCache()
+			b.mu.Unlock()
+			if err != nil {
+				t.Fatalf("replace failed: %v", err)
+			}
+			if !maps.Equal(b.folds, tt.expected) {
+				t.Errorf("expected folds %v, got %v", tt.expected, b.folds)
+			}
+
+			if _, err := b.Undo(); err != nil {
+				t.Fatalf("Undo failed: %v", err)
+			}
+			if end, ok := b.FoldAt(1); tt.undone && (!ok || end != 3) {
+				t.Errorf("expected fold 1..3 after undo, got %v", b.folds)
+			}
+		})
+	}
+}
+
+func TestLargeFileOpensChunked(t *testing.T) {
+	// Spans several chunks so line alignment across reads is exercised
+	content := strings.Repeat("2024-01-01 12:00:00 INFO request served\n", 3*ChunkSize/40) + "tail"
+	path := filepath.Join(t.TempDir(), "big.log")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	b, err := NewBuffer(path, int64(len(content)-1), true)
+	if err != nil {
+		t.Fatalf("NewBuffer failed: %v", err)
+	}
+	defer b.Close()
+
+	if !b.IsChunked() {
+		t.Fatalf("expected buffer over the threshold to be chunked")
+	}
+	if b.document.String() != content {
+		t.Errorf("chunked document does not match file content")
+	}
+	if highlights, err := b.GetHighlights(); err != nil || highlights != nil {
+		t.Errorf("expected no highlights in chunked mode, got %d (%v)", len(highlights), err)
+	}
+	if line, err := b.GetLine(b.LineCount() - 1); err != nil || line != "tail" {
+		t.Errorf("expected the last line to be read back, got %q (%v)", line, err)
+	}
+	if err := b.Insert("x"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected chunked buffers to be read-only, got %v", err)
+	}
+
+	// saving replaces the file, while chunks are still read from the one opened
+	if err := b.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if b.document.String() != content {
+		t.Errorf("chunked document changed after saving")
+	}
+}
+
+func TestChunkPiecesRoundTrip(t *testing.T) {
+	// multi-byte lines that don't divide ChunkSize evenly, so chunks start mid-buffer
+	content := strings.Repeat("héllo wörld 👋🏽 日本語\n", 3*ChunkSize/30) + "ünfinished"
+	r := strings.NewReader(content)
+
+	pieces, size, err := NewChunkManager(r).Pieces()
+	if err != nil {
+		t.Fatalf("Pieces failed: %v", err)
+	}
+	if size != int64(len(content)) {
+		t.Errorf("expected %d bytes read, got %d", len(content), size)
+	}
+	if len(pieces) < 2 {
+		t.Fatalf("expected several pieces, got %d", len(pieces))
+	}
+
+	load := readPiece(r)
+	var sb strings.Builder
+	next := int64(0)
+	for _, piece := range pieces {
+		if piece.Offset != next {
+			t.Fatalf("expected a piece at byte %d, got one at %d", next, piece.Offset)
+		}
+		next += int64(piece.Size)
+
+		text, err := load(piece.Offset, piece.Size)
+		if err != nil {
+			t.Fatalf("reading back the piece at %d failed: %v", piece.Offset, err)
+		}
+		if got := countGraphemes(text); got != piece.Graphemes {
+			t.Errorf("expected %d graphemes in the piece at %d, got %d", piece.Graphemes, piece.Offset, got)
+		}
+		sb.WriteString(text)
+	}
+	if sb.String() != content {
+		t.Errorf("pieces read back do not match the content")
+	}
+}
+
+func TestSyntaxDisabled(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(path, []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	b, err := NewBuffer(path, 0, true)
+	if err != nil {
+		t.Fatalf("NewBuffer failed: %v", err)
+	}
+	if !b.HasHighlighting() {
+		t.Fatalf("expected a highlighter with syntax on")
+	}
+	b.Close()
+
+	b, err = NewBuffer(path, 0, false)
+	if err != nil {
+		t.Fatalf("NewBuffer failed: %v", err)
+	}
+	defer b.Close()
+	if b.HasHighlighting() || b.highlighter != nil {
+		t.Errorf("expected no highlighter with syntax off")
+	}
+	if highlights, err := b.GetHighlights(); err != nil || highlights != nil {
+		t.Errorf("expected no highlights, got %d (%v)", len(highlights), err)
+	}
+	if byLine, err := b.HighlightsByLine(); err != nil || len(byLine) != 0 {
+		t.Errorf("expected no highlights by line, got %d (%v)", len(byLine), err)
+	}
+
+	// without a highlighter, files of types it doesn't know open too
+	other := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(other, []byte("notes\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	nb, err := NewBuffer(other, 0, false)
+	if err != nil {
+		t.Fatalf("expected a .txt file to open without syntax, got %v", err)
+	}
+	nb.Close()
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name        string
+		highlighted bool
+	}{
+		{"main.go", true},
+		{"lib.rs", true},
+		{"notes.txt", false},
+		{"Makefile", false},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := os.WriteFile(path, []byte("text\n"), 0644); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+
+			// files of unknown types open as plain text, with syntax on
+			b, err := NewBuffer(path, 0, true)
+			if err != nil {
+				t.Fatalf("NewBuffer failed: %v", err)
+			}
+			defer b.Close()
+			if got := b.HasHighlighting(); got != tt.highlighted {
+				t.Errorf("expected highlighting %v, got %v", tt.highlighted, got)
+			}
+			if got := b.Text(); got != "text\n" {
+				t.Errorf("expected the content to load, got %q", got)
+			}
+		})
+	}
+}
+
+func TestEncodingOnLoad(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   []byte
+		threshold int64
+		expected  string
+		encoding  string
+		lossy     bool
+		saved     string
+		err       error
+	}{
+		{"valid text", []byte("héllo\n"), 0, "héllo\n", EncodingUTF8, false, "héllo\n", nil},
+		{"stray continuation byte", []byte("a\x80b\n"), 0, "a\u0080b\n", EncodingLatin1, false, "a\x80b\n", nil},
+		{"truncated sequence", []byte("caf\xc3\n"), 0, "caf\u00c3\n", EncodingLatin1, false, "caf\xc3\n", nil},
+		{"overlong encoding", []byte("\xc0\xafx"), 0, "\u00c0\u00afx", EncodingLatin1, false, "\xc0\xafx", nil},
+		{"byte order mark", []byte("\xef\xbb\xbfhi\n"), 0, "hi\n", EncodingUTF8BOM, false, "\xef\xbb\xbfhi\n", nil},
+		{"invalid after a byte order mark", []byte("\xef\xbb\xbfa\xffb"), 0, "a\uFFFDb", EncodingUTF8BOM, true, "\xef\xbb\xbfa\uFFFDb", nil},
+		{"chunked", []byte("ok\n\xff\xfe line\n"), 1, "ok\n\uFFFD line\n", EncodingUTF8, true, "ok\n\uFFFD line\n", nil},
+		{"binary", []byte("\x7fELF\x02\x01\x00\x00"), 0, "", "", false, "", ErrBinaryFile},
+		{"binary chunked", []byte("a\x00b\n"), 1, "", "", false, "", ErrBinaryFile},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "file.rs")
+			if err := os.WriteFile(path, tt.content, 0644); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+
+			b, err := NewBuffer(path, tt.threshold, true)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			defer b.Close()
+
+			if got := b.document.String(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if got := b.FileEncoding(); got != tt.encoding {
+				t.Errorf("expected encoding %s, got %s", tt.encoding, got)
+			}
+			if b.IsLossyDecoded() != tt.lossy {
+				t.Errorf("expected lossy %v, got %v", tt.lossy, b.IsLossyDecoded())
+			}
+			if b.size != int64(len(tt.content)) {
+				t.Errorf("expected size %d, got %d", len(tt.content), b.size)
+			}
+
+			// saving writes any replacement characters, after which the file is valid
+			if err := b.Save(); err != nil {
+				t.Fatalf("Save failed: %v", err)
+			}
+			if saved, _ := os.ReadFile(path); string(saved) != tt.saved || b.IsLossyDecoded() {
+				t.Errorf("expected %q saved and lossy cleared, got %q (%v)", tt.saved, saved, b.IsLossyDecoded())
+			}
+		})
+	}
+}
+
+func TestHighlightsByLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hl.rs")
+	if err := os.WriteFile(path, []byte("fn main() {}\n\n/* a\nb */\nstruct S;\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	b, err := NewBuffer(path, 0, true)
+	if err != nil {
+		t.Fatalf("NewBuffer failed: %v", err)
+	}
+
+	byLine, err := b.HighlightsByLine()
+	if err != nil {
+		t.Fatalf("HighlightsByLine failed: %v", err)
+	}
+
+	for row, spans := range byLine {
+		for _, h := range spans {
+			if int(h.Start.Row) > row || int(h.End.Row) < row {
+				t.Errorf("span %v..%v indexed under row %d", h.Start, h.End, row)
+			}
+		}
+	}
+	for _, row := range []int{0, 2, 3, 4} {
+		if len(byLine[row]) == 0 {
+			t.Errorf("expected highlights on row %d", row)
+		}
+	}
+	if len(byLine[1]) != 0 {
+		t.Errorf("expected no highlights on empty row 1, got %d", len(byLine[1]))
+	}
+
+	// edits invalidate the index
+	if err := b.Insert("\n"); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	byLine, err = b.HighlightsByLine()
+	if err != nil {
+		t.Fatalf("HighlightsByLine failed: %v", err)
+	}
+	if len(byLine[0]) != 0 || len(byLine[1]) == 0 {
+		t.Errorf("expected highlights to move down a row after inserting a newline")
+	}
+}
+
+func TestFixEOL(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		cursor   int
+		expected string
+		changed  bool
+		after    int
+	}{
+		{"no trailing newline", "a\nb", 1, "a\nb\n", true, 1},
+		{"one trailing newline", "a\nb\n", 3, "a\nb\n", false, 3},
+		{"several trailing newlines", "a\nb\n\n\n", 6, "a\nb\n", true, 4},
+		{"trailing blank lines with cursor before them", "a\nb\n\n\n", 2, "a\nb\n", true, 2},
+		{"crlf line endings", "a\r\nb\r\n\r\n", 4, "a\r\nb\r\n", true, 4},
+		{"empty document", "", 0, "", false, 0},
+		{"only newlines", "\n\n", 1, "", true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", tt.content)
+			b.SetReadOnly(false)
+			if err := b.MoveSelectionTo(tt.cursor, false); err != nil {
+				t.Fatalf("MoveSelectionTo failed: %v", err)
+			}
+
+			changed, err := b.FixEOL()
+			if err != nil {
+				t.Fatalf("FixEOL failed: %v", err)
+			}
+			if changed != tt.changed {
+				t.Errorf("expected changed %v, got %v", tt.changed, changed)
+			}
+			if got := b.Text(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if got := b.Selection().End; got != tt.after {
+				t.Errorf("expected cursor at %d, got %d", tt.after, got)
+			}
+			// the line cache only splits on "\n" graphemes, so "\r\n" is left out
+			if got := b.LineCount(); !strings.Contains(tt.expected, "\r") && got != strings.Count(tt.expected, "\n")+1 {
+				t.Errorf("expected line cache to be rebuilt, got %d lines", got)
+			}
+		})
+	}
+}
+
+func TestPairRange(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		cursor   int
+		pair     string
+		inner    bool
+		expected string
+		err      error
+	}{
+		{"inside nested parens", "f(a, g(b), c)", 7, "(", true, "b", nil},
+		{"around nested parens", "f(a, g(b), c)", 7, ")", false, "(b)", nil},
+		{"inside outer parens", "f(a, g(b), c)", 3, "(", true, "a, g(b), c", nil},
+		{"cursor on opening paren", "f(a, g(b), c)", 1, "(", true, "a, g(b), c", nil},
+		{"cursor on closing paren", "f(a, g(b), c)", 12, "(", true, "a, g(b), c", nil},
+		{"braces across lines", "{\n\tx\n}", 3, "{", true, "\n\tx\n", nil},
+		{"no enclosing paren", "a (b) c", 6, "(", true, "", ErrNoPair},
+		{"inside quotes", `say "hi there" now`, 7, `"`, true, "hi there", nil},
+		{"around quotes", `say "hi there" now`, 7, `"`, false, `"hi there"`, nil},
+		{"next quotes on line", `x = 'a' + 'b'`, 0, "'", true, "a", nil},
+		{"quotes after the last pair", `'a' b`, 4, "'", true, "", ErrNoPair},
+		{"inside tag", "<ul><li>one</li></ul>", 9, "t", true, "one", nil},
+		{"around tag", "<ul><li>one</li></ul>", 9, "t", false, "<li>one</li>", nil},
+		{"outer tag", "<ul><li>one</li></ul>", 2, "t", true, "<li>one</li>", nil},
+		{"tag with attributes", `<a href="x">link<br/></a>`, 13, "t", true, "link<br/>", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", tt.content)
+
+			start, end, err := b.PairRange(tt.cursor, tt.pair, tt.inner)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if got := b.Text()[start:end]; got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMoveSelectionToLineEnd(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		line     int
+		expected int
+		err      error
+	}{
+		{"short line", "ab\ncdef\n", 0, 2, nil},
+		{"empty line", "ab\n\ncd", 1, 3, nil},
+		{"last line without newline", "ab\ncd", 1, 5, nil},
+		{"empty last line", "ab\n", 1, 3, nil},
+		{"line out of range", "ab", 1, 0, ErrInvalidLineCol},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", tt.content)
+
+			err := b.MoveSelectionToLineEnd(tt.line, false)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if got := b.Selection().End; got != tt.expected {
+				t.Errorf("expected cursor at %d, got %d", tt.expected, got)
+			}
+			if line, _, _ := b.PositionToLineCol(b.Selection().End); line != tt.line {
+				t.Errorf("expected cursor to stay on line %d, got %d", tt.line, line)
+			}
+		})
+	}
+}
+
+func TestFlushAndClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flush.go")
+	if err := os.WriteFile(path, []byte("package a\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	b, err := NewBuffer(path, 0, true)
+	if err != nil {
+		t.Fatalf("NewBuffer failed: %v", err)
+	}
+	if err := b.Insert("// x\n"); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "package a\n" {
+		t.Errorf("expected Close not to save, file has %q", got)
+	}
+
+	if err := b.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "// x\npackage a\n" {
+		t.Errorf("expected Flush to save, file has %q", got)
+	}
+	if b.IsDirty() {
+		t.Errorf("expected buffer to be clean after Flush")
+	}
+
+	// a file another program changed isn't overwritten
+	if err := b.Insert("// y\n"); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("package b\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := b.Flush(); !errors.Is(err, ErrExternalChange) {
+		t.Errorf("expected ErrExternalChange, got %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "package b\n" {
+		t.Errorf("expected the other program's change kept, file has %q", got)
+	}
+	_ = b.Close()
+}
+
+func TestDirtyTracksSavedContent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dirty.go")
+	if err := os.WriteFile(path, []byte("package a\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	b, err := NewBuffer(path, 0, true)
+	if err != nil {
+		t.Fatalf("NewBuffer failed: %v", err)
+	}
+	defer b.Close()
+
+	steps := []struct {
+		name  string
+		edit  func() error
+		dirty bool
+	}{
+		{"type", func() error { return b.Insert("x") }, true},
+		{"backspace", func() error { return b.Delete(0, 1) }, false},
+		{"replace with the same text", func() error {
+			_ = b.MoveSelectionTo(0, false)
+			_ = b.MoveSelectionTo(7, true)
+			return b.Insert("package")
+		}, false},
+		{"real change", func() error { return b.Insert("!") }, true},
+		{"save", b.Save, false},
+		{"undo the change by hand", func() error { return b.Delete(7, 8) }, true},
+	}
+
+	for _, step := range steps {
+		if err := step.edit(); err != nil {
+			t.Fatalf("%s failed: %v", step.name, err)
+		}
+		if got := b.IsDirty(); got != step.dirty {
+			t.Errorf("after %s: expected dirty %v, got %v", step.name, step.dirty, got)
+		}
+	}
+}
+
+func TestModifiedDuration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "modified.go")
+	if err := os.WriteFile(path, []byte("package a\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	b, err := NewBuffer(path, 0, true)
+	if err != nil {
+		t.Fatalf("NewBuffer failed: %v", err)
+	}
+	defer b.Close()
+
+	if d := b.ModifiedDuration(); d != 0 {
+		t.Fatalf("expected a freshly loaded buffer to report 0, got %v", d)
+	}
+
+	_ = b.Insert("x")
+	first := b.ModifiedDuration()
+	if first <= 0 {
+		t.Fatalf("expected a positive duration after an edit, got %v", first)
+	}
+
+	// later edits keep counting from the first one
+	time.Sleep(5 * time.Millisecond)
+	_ = b.Insert("y")
+	if d := b.ModifiedDuration(); d < first+5*time.Millisecond {
+		t.Errorf("expected the first edit to stay the start, got %v after %v", d, first)
+	}
+
+	// reverting to the saved content clears it, and the next edit starts anew
+	_ = b.Delete(0, 2)
+	if d := b.ModifiedDuration(); d != 0 {
+		t.Errorf("expected 0 once the edits are reverted, got %v", d)
+	}
+	time.Sleep(50 * time.Millisecond)
+	_ = b.Insert("z")
+	if d := b.ModifiedDuration(); d <= 0 || d >= 50*time.Millisecond {
+		t.Errorf("expected the count to restart with the next edit, got %v", d)
+	}
+
+	if err := b.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if d := b.ModifiedDuration(); d != 0 {
+		t.Errorf("expected 0 after saving, got %v", d)
+	}
+}
+
+func TestWordBoundaryAcrossChunks(t *testing.T) {
+	long := strings.Repeat("a", wordScanChunk+10)
+	content := "x " + long + " y"
+
+	tests := []struct {
+		name      string
+		pos       int
+		direction int
+		expected  int
+	}{
+		{"forward past a chunk", 2, 1, len(long) + 2},
+		{"backward past a chunk", len(long) + 1, -1, 2},
+		{"forward to the end", len(content) - 1, 1, len(content)},
+		{"backward to the start", 0, -1, 0},
+		{"forward from whitespace", 1, 1, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", content)
+			if got := b.findNextWordBoundary(tt.pos, tt.direction, SmallWord); got != tt.expected {
+				t.Errorf("expected boundary at %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFindWordEnd(t *testing.T) {
+	long := strings.Repeat("a", wordScanChunk+10)
+
+	tests := []struct {
+		name     string
+		content  string
+		pos      int
+		expected int
+	}{
+		{"inside a word", "foo bar", 0, 2},
+		{"at a word end", "foo bar", 2, 6},
+		{"from whitespace", "foo   bar", 3, 8},
+		{"symbols end a word", "foo.bar", 0, 2},
+		{"run of symbols", "a ->b", 0, 3},
+		{"across lines", "foo\n\n  bar", 2, 9},
+		{"multi-byte graphemes", "héllo 👍🏽👍🏽 x", 0, 4},
+		{"emoji run", "héllo 👍🏽👍🏽 x", 4, 7},
+		{"trailing whitespace", "foo  ", 2, 4},
+		{"at the last grapheme", "foo", 2, 2},
+		{"past a chunk", "x " + long + " y", 0, len(long) + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", tt.content)
+			if got := b.findWordEnd(tt.pos, SmallWord); got != tt.expected {
+				t.Errorf("expected word end at %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestWordKinds(t *testing.T) {
+	content := "x = foo.bar()   baz,qux"
+
+	tests := []struct {
+		name    string
+		motion  func(b *Buffer, kind WordKind, extend bool) error
+		pos     int
+		word    int // where the motion over small words ends
+		bigWord int // where the motion over big words ends
+	}{
+		{"next word over punctuation", (*Buffer).MoveToNextWord, 4, 7, 13},
+		{"next word from spaces", (*Buffer).MoveToNextWord, 13, 16, 16},
+		{"next word inside punctuation", (*Buffer).MoveToNextWord, 19, 20, 23},
+		{"previous word", (*Buffer).MoveToPrevWord, 13, 11, 4},
+		{"previous word inside punctuation", (*Buffer).MoveToPrevWord, 20, 19, 16},
+		{"word end", (*Buffer).MoveToWordEnd, 4, 6, 12},
+		{"word end over spaces", (*Buffer).MoveToWordEnd, 12, 18, 22},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for kind, expected := range map[WordKind]int{SmallWord: tt.word, BigWord: tt.bigWord} {
+				b := NewScratchBuffer("*test*", content)
+				_ = b.MoveSelectionTo(tt.pos, false)
+				if err := tt.motion(b, kind, false); err != nil {
+					t.Fatalf("motion failed: %v", err)
+				}
+				if got := b.Selection().End; got != expected {
+					t.Errorf("kind %d: expected cursor at %d, got %d", kind, expected, got)
+				}
+			}
+		})
+	}
+}
+
+func TestGraphemeRange(t *testing.T) {
+	b := NewScratchBuffer("*test*", "héllo 👍🏽!")
+
+	tests := []struct {
+		start, end int
+		expected   string
+	}{
+		{0, 5, "héllo"},
+		{6, 7, "👍🏽"},
+		{-3, 2, "hé"},
+		{6, 100, "👍🏽!"},
+	}
+	for _, tt := range tests {
+		got, err := b.GraphemeRange(tt.start, tt.end)
+		if err != nil {
+			t.Fatalf("GraphemeRange(%d, %d) failed: %v", tt.start, tt.end, err)
+		}
+		if got != tt.expected {
+			t.Errorf("GraphemeRange(%d, %d): expected %q, got %q", tt.start, tt.end, tt.expected, got)
+		}
+	}
+}
+
+func BenchmarkWordMotion(b *testing.B) {
+	// a single word across a long line, so each motion scans all of it
+	line := strings.Repeat("word", 4096)
+	buf := NewScratchBuffer("*bench*", line)
+
+	b.Run("forward", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			buf.findNextWordBoundary(0, 1, SmallWord)
+		}
+	})
+
+	b.Run("backward", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			buf.findNextWordBoundary(len(line)-1, -1, SmallWord)
+		}
+	})
+}
+
+func TestUndoTreeBranches(t *testing.T) {
+	b := NewScratchBuffer("*test*", "x")
+	b.SetReadOnly(false)
+	_ = b.MoveSelectionTo(1, false)
+
+	expectText := func(expected string) {
+		t.Helper()
+		if got := b.Text(); got != expected {
+			t.Fatalf("expected %q, got %q", expected, got)
+		}
+	}
+	mustMove := func(moved bool, err error) {
+		t.Helper()
+		if err != nil || !moved {
+			t.Fatalf("expected to move through the history, got %v, %v", moved, err)
+		}
+	}
+
+	_ = b.Insert("a")
+	mustMove(b.Undo())
+	expectText("x")
+
+	// typing after the undo starts a second branch instead of dropping "a"
+	_ = b.Insert("b")
+	expectText("xb")
+	root, current := b.UndoTree()
+	if len(root.Children()) != 2 || current != root.Children()[1] {
+		t.Fatalf("expected the new change on a second branch of the root")
+	}
+
+	mustMove(b.UndoBranch(-1))
+	expectText("xa")
+	if moved, _ := b.UndoBranch(-1); moved {
+		t.Errorf("expected no branch before the first one")
+	}
+	mustMove(b.UndoBranch(1))
+	expectText("xb")
+
+	// redo follows the branch visited last
+	mustMove(b.UndoBranch(-1))
+	mustMove(b.Undo())
+	expectText("x")
+	if moved, _ := b.Undo(); moved {
+		t.Errorf("expected undo to stop at the oldest state")
+	}
+	mustMove(b.Redo())
+	expectText("xa")
+	if moved, _ := b.Redo(); moved {
+		t.Errorf("expected redo to stop at the newest state")
+	}
+}
+
+func TestUndoGroup(t *testing.T) {
+	b := NewScratchBuffer("*test*", "")
+	b.SetReadOnly(false)
+
+	b.BeginUndoGroup()
+	_ = b.Insert("ab")
+	_ = b.Delete(0, 1)
+	_ = b.Insert("c")
+	b.EndUndoGroup()
+	_ = b.Insert("d")
+
+	if _, err := b.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if got := b.Text(); got != "cb" {
+		t.Fatalf("expected %q after undoing the last insert, got %q", "cb", got)
+	}
+	if _, err := b.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if got := b.Text(); got != "" {
+		t.Errorf("expected the group to be undone at once, got %q", got)
+	}
+	if b.IsDirty() {
+		t.Errorf("expected undoing every change to leave the buffer clean")
+	}
+}
+
+func TestUndoMergedCluster(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		edit     func(b *Buffer) error
+		expected string
+		cursor   int
+	}{
+		{"combining mark joins the cluster before", "ex", func(b *Buffer) error {
+			_ = b.MoveSelectionTo(1, false)
+			return b.Insert("\u0301")
+		}, "e\u0301x", 1},
+		{"deleting between flag halves pairs them", "🇺x🇳", func(b *Buffer) error {
+			return b.Delete(1, 2)
+		}, "🇺🇳", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", tt.content)
+			b.SetReadOnly(false)
+
+			if err := tt.edit(b); err != nil {
+				t.Fatalf("edit failed: %v", err)
+			}
+			if got := b.Text(); got != tt.expected {
+				t.Fatalf("expected %q, got %q", tt.expected, got)
+			}
+			if selections, primary := b.Selections(); selections[primary].End != tt.cursor {
+				t.Errorf("expected the cursor at %d, got %d", tt.cursor, selections[primary].End)
+			}
+			if moved, err := b.Undo(); err != nil || !moved {
+				t.Fatalf("expected to undo, got %v, %v", moved, err)
+			}
+			if got := b.Text(); got != tt.content {
+				t.Errorf("expected undo to restore %q, got %q", tt.content, got)
+			}
+			if moved, err := b.Redo(); err != nil || !moved {
+				t.Fatalf("expected to redo, got %v, %v", moved, err)
+			}
+			if got := b.Text(); got != tt.expected {
+				t.Errorf("expected redo to give %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestInsertNewlineWithIndent(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		cursor   int
+		expected string
+		moved    int
+	}{
+		{"spaces", "    foo", 7, "    foo\n    ", 12},
+		{"tabs and spaces verbatim", "\t  foo", 6, "\t  foo\n\t  ", 10},
+		{"middle of the line", "  foo bar", 5, "  foo\n   bar", 8},
+		{"within the indentation", "    foo", 2, "  \n    foo", 5},
+		{"whitespace-only line", "\t\t", 2, "\t\t\n\t\t", 5},
+		{"no indentation", "foo", 3, "foo\n", 4},
+		{"second line", "a\n\tb", 4, "a\n\tb\n\t", 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", tt.content)
+			b.SetReadOnly(false)
+			_ = b.MoveSelectionTo(tt.cursor, false)
+
+			if err := b.InsertNewlineWithIndent(); err != nil {
+				t.Fatalf("InsertNewlineWithIndent failed: %v", err)
+			}
+			if got := b.Text(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if got := b.Selection().End; got != tt.moved {
+				t.Errorf("expected cursor at %d, got %d", tt.moved, got)
+			}
+		})
+	}
+
+	// every cursor breaks its own line with its own indentation, undone at once
+	b := NewScratchBuffer("*test*", "  a\n\tb")
+	b.SetReadOnly(false)
+	_ = b.MoveSelectionTo(3, false)
+	_ = b.AddSelectionBelow()
+	if err := b.InsertNewlineWithIndent(); err != nil {
+		t.Fatalf("InsertNewlineWithIndent failed: %v", err)
+	}
+	if got, expected := b.Text(), "  a\n  \n\tb\n\t"; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if selections, _ := b.Selections(); len(selections) != 2 || selections[0].End != 6 || selections[1].End != 11 {
+		t.Errorf("expected cursors at 6 and 11, got %v", selections)
+	}
+	_, _ = b.Undo()
+	if got := b.Text(); got != "  a\n\tb" {
+		t.Errorf("expected one undo to restore both lines, got %q", got)
+	}
+}
+
+func TestOverwrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		cursor   int
+		text     string
+		expected string
+		moved    int
+	}{
+		{"middle of the line", "abc", 1, "X", "aXc", 2},
+		{"end of a line inserts", "ab\ncd", 2, "X", "abX\ncd", 3},
+		{"end of the buffer inserts", "ab", 2, "X", "abX", 3},
+		{"whole grapheme cluster", "e\u0301x", 0, "a", "ax", 1},
+		{"one grapheme for longer text", "abc", 0, "XY", "XYbc", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", tt.content)
+			b.SetReadOnly(false)
+			_ = b.MoveSelectionTo(tt.cursor, false)
+
+			if err := b.Overwrite(tt.text); err != nil {
+				t.Fatalf("Overwrite failed: %v", err)
+			}
+			if got := b.Text(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if got := b.Selection().End; got != tt.moved {
+				t.Errorf("expected cursor at %d, got %d", tt.moved, got)
+			}
+
+			// a single undo brings the overwritten grapheme back
+			if _, err := b.Undo(); err != nil {
+				t.Fatalf("Undo failed: %v", err)
+			}
+			if got := b.Text(); got != tt.content {
+				t.Errorf("expected %q after undo, got %q", tt.content, got)
+			}
+		})
+	}
+
+	if err := NewScratchBuffer("*test*", "a").Overwrite("b"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly, got %v", err)
+	}
+}
+
+func TestMultipleSelections(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		cursor   int
+		below    int
+		edit     func(b *Buffer) error
+		expected string
+		cursors  []int
+	}{
+		{"insert at every cursor", "ab\ncd\nef", 1, 2, func(b *Buffer) error { return b.Insert("X") }, "aXb\ncXd\neXf", []int{2, 6, 10}},
+		{"shorter line clamps the column", "abc\nd\nefg", 2, 2, func(b *Buffer) error { return b.Insert("X") }, "abXc\ndX\neXfg", []int{3, 7, 10}},
+		{"delete backwards", "ab\ncd", 1, 1, func(b *Buffer) error { return b.DeleteAtSelections(-1) }, "b\nd", []int{0, 2}},
+		{"delete forwards", "ab\ncd", 0, 1, func(b *Buffer) error { return b.DeleteAtSelections(1) }, "b\nd", []int{0, 2}},
+		{"delete at the start of the buffer", "ab\ncd", 0, 1, func(b *Buffer) error { return b.DeleteAtSelections(-1) }, "abcd", []int{0, 2}},
+		{"move right", "ab\ncd", 0, 1, func(b *Buffer) error { return b.MoveSelections(1, false) }, "ab\ncd", []int{1, 4}},
+		{"move down", "ab\ncd\nef", 1, 1, func(b *Buffer) error { return b.MoveSelectionsByLines(1, false) }, "ab\ncd\nef", []int{4, 7}},
+		{"cursors meeting are merged", "ab\ncd\nef", 1, 1, func(b *Buffer) error { return b.MoveSelectionsByLines(5, false) }, "ab\ncd\nef", []int{7}},
+		{"edit at the primary shifts the others", "ab\ncd\nef", 1, 2, func(b *Buffer) error {
+			if err := b.MoveSelectionTo(0, false); err != nil {
+				return err
+			}
+			return b.Delete(0, 1)
+		}, "b\ncd\nef", []int{0, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", tt.content)
+			b.SetReadOnly(false)
+			_ = b.MoveSelectionTo(tt.cursor, false)
+			for range tt.below {
+				if err := b.AddSelectionBelow(); err != nil {
+					t.Fatalf("AddSelectionBelow failed: %v", err)
+				}
+			}
+
+			if err := tt.edit(b); err != nil {
+				t.Fatalf("edit failed: %v", err)
+			}
+			if got := b.Text(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			selections, _ := b.Selections()
+			var cursors []int
+			for _, selection := range selections {
+				cursors = append(cursors, selection.End)
+			}
+			if !slices.Equal(cursors, tt.cursors) {
+				t.Errorf("expected cursors %v, got %v", tt.cursors, cursors)
+			}
+
+			// the edits at every cursor are undone at once
+			if tt.expected != tt.content {
+				if _, err := b.Undo(); err != nil {
+					t.Fatalf("Undo failed: %v", err)
+				}
+				if got := b.Text(); got != tt.content {
+					t.Errorf("expected %q after undo, got %q", tt.content, got)
+				}
+			}
+		})
+	}
+
+	b := NewScratchBuffer("*test*", "ab\ncd")
+	if err := b.MoveSelectionTo(4, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddSelectionBelow(); !errors.Is(err, ErrInvalidLineCol) {
+		t.Errorf("expected ErrInvalidLineCol on the last line, got %v", err)
+	}
+	_ = b.MoveSelectionTo(1, false)
+	_ = b.AddSelectionBelow()
+	if _, primary := b.Selections(); primary != 1 {
+		t.Errorf("expected the added cursor to be primary, got %d", primary)
+	}
+	b.KeepPrimarySelection()
+	if selections, _ := b.Selections(); len(selections) != 1 || selections[0].End != 4 {
+		t.Errorf("expected only the cursor at 4 to be kept, got %v", selections)
+	}
+}
+
+func TestMarks(t *testing.T) {
+	tests := []struct {
+		name     string
+		mark     int
+		edit     func(b *Buffer) error
+		expected int
+	}{
+		{"no edit", 4, func(b *Buffer) error { return nil }, 4},
+		{"insert before", 4, func(b *Buffer) error { return b.Insert("xy") }, 6},
+		{"insert after", 1, func(b *Buffer) error {
+			_ = b.MoveSelectionTo(3, false)
+			return b.Insert("xy")
+		}, 1},
+		{"delete before", 4, func(b *Buffer) error { return b.Delete(0, 2) }, 2},
+		{"delete around", 4, func(b *Buffer) error { return b.Delete(3, 6) }, 3},
+		{"undo of an insert before", 4, func(b *Buffer) error {
+			if err := b.Insert("xy"); err != nil {
+				return err
+			}
+			_, err := b.Undo()
+			return err
+		}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", "one\ntwo\nthree")
+			b.SetReadOnly(false)
+			_ = b.MoveSelectionTo(tt.mark, false)
+			b.SetMark('a')
+			_ = b.MoveSelectionTo(0, false)
+
+			if err := tt.edit(b); err != nil {
+				t.Fatalf("edit failed: %v", err)
+			}
+			if err := b.GotoMark('a'); err != nil {
+				t.Fatalf("GotoMark failed: %v", err)
+			}
+			if got := b.Selection().End; got != tt.expected {
+				t.Errorf("expected the mark at %d, got %d", tt.expected, got)
+			}
+		})
+	}
+
+	b := NewScratchBuffer("*test*", "one")
+	if err := b.GotoMark('z'); !errors.Is(err, ErrMarkNotSet) {
+		t.Errorf("expected ErrMarkNotSet, got %v", err)
+	}
+}
+
+func TestDeleteLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		line     int
+		expected string
+		cursor   int
+	}{
+		{"first line", "one\ntwo\nthree", 0, "two\nthree", 0},
+		{"middle line", "one\ntwo\nthree", 1, "one\nthree", 4},
+		{"last line", "one\ntwo\nthree", 2, "one\ntwo", 4},
+		{"empty last line", "one\ntwo\n", 2, "one\ntwo", 4},
+		{"multi-byte line", "é👍🏽\nß\nx", 1, "é👍🏽\nx", 3},
+		{"only line", "one", 0, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", tt.content)
+			b.SetReadOnly(false)
+
+			if err := b.DeleteLine(tt.line); err != nil {
+				t.Fatalf("DeleteLine failed: %v", err)
+			}
+			if got := b.Text(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if got := b.Selection(); got.Start != tt.cursor || got.End != tt.cursor {
+				t.Errorf("expected cursor at %d, got %+v", tt.cursor, got)
+			}
+		})
+	}
+
+	b := NewScratchBuffer("*test*", "one")
+	b.SetReadOnly(false)
+	if err := b.DeleteLine(1); !errors.Is(err, ErrInvalidLineCol) {
+		t.Errorf("expected ErrInvalidLineCol, got %v", err)
+	}
+}
+
+func TestGetSelectedText(t *testing.T) {
+	tests := []struct {
+		name      string
+		selection state.Selection
+		expected  string
+		err       error
+	}{
+		{"empty selection", state.Selection{Start: 2, End: 2}, "", nil},
+		{"range", state.Selection{Start: 1, End: 4}, "éll", nil},
+		{"backward range", state.Selection{Start: 4, End: 1}, "éll", nil},
+		{"whole document", state.Selection{Start: 0, End: 6}, "héllo👋", nil},
+		{"past the end", state.Selection{Start: 3, End: 7}, "", ErrInvalidSelection},
+		{"before the start", state.Selection{Start: -1, End: 2}, "", ErrInvalidSelection},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", "héllo👋")
+			b.selections[b.primary] = tt.selection
+
+			got, err := b.GetSelectedText()
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestJoinLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		line     int
+		expected string
+		cursor   int
+	}{
+		{"indentation collapses to a space", "foo\n\t  bar\nbaz", 0, "foo bar\nbaz", 3},
+		{"empty next line", "foo\n\nbar", 0, "foo\nbar", 3},
+		{"blank next line", "foo\n  \nbar", 0, "foo\nbar", 3},
+		{"empty line", "\nfoo", 0, "foo", 0},
+		{"line ending in a blank", "foo \nbar", 0, "foo bar", 4},
+		{"middle line", "a\nb\nc", 1, "a\nb c", 3},
+		{"last line", "foo\nbar", 1, "foo\nbar", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", tt.content)
+			b.SetReadOnly(false)
+
+			if err := b.JoinLines(tt.line); err != nil {
+				t.Fatalf("JoinLines failed: %v", err)
+			}
+			if got := b.Text(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if got := b.Selection().End; got != tt.cursor {
+				t.Errorf("expected cursor at %d, got %d", tt.cursor, got)
+			}
+		})
+	}
+
+	if err := NewScratchBuffer("*test*", "a\nb").JoinLines(0); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly, got %v", err)
+	}
+}
+
+func TestIndentLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		useTabs  bool
+		dedent   bool
+		expected string
+		cursor   int
+	}{
+		{"indent with a tab", "foo", true, false, "\tfoo", 1},
+		{"indent with spaces", "foo", false, false, "  foo", 2},
+		{"indent skips an empty line", "", false, false, "", 0},
+		{"dedent a tab", "\t\tfoo", true, true, "\tfoo", 0},
+		{"dedent up to width spaces", "     foo", false, true, "   foo", 0},
+		{"dedent fewer spaces", " foo", false, true, "foo", 0},
+		{"dedent without indentation", "foo", false, true, "foo", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", tt.content)
+			b.SetReadOnly(false)
+			b.SetIndentation(Indentation{UseTabs: tt.useTabs, TabWidth: 4})
+
+			var err error
+			if tt.dedent {
+				err = b.DedentLine(0, 2)
+			} else {
+				err = b.IndentLine(0, 2)
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := b.Text(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if got := b.Selection().End; got != tt.cursor {
+				t.Errorf("expected cursor at %d, got %d", tt.cursor, got)
+			}
+		})
+	}
+
+	b := NewScratchBuffer("*test*", "foo")
+	if err := b.IndentLine(0, 4); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly, got %v", err)
+	}
+	b.SetReadOnly(false)
+	if err := b.DedentLine(1, 4); !errors.Is(err, ErrInvalidLineCol) {
+		t.Errorf("expected ErrInvalidLineCol, got %v", err)
+	}
+}
+
+func TestCaseSelection(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		start    int
+		end      int
+		apply    func(b *Buffer) error
+		expected string
+	}{
+		{"toggle the selection", "Hello World", 0, 5, (*Buffer).ToggleCaseSelection, "hELLO World"},
+		{"toggle under the cursor", "abc", 1, 1, (*Buffer).ToggleCaseSelection, "aBc"},
+		{"toggle at the end", "abc", 3, 3, (*Buffer).ToggleCaseSelection, "abc"},
+		{"toggle multi-byte letters", "éЖß", 0, 3, (*Buffer).ToggleCaseSelection, "Éжß"},
+		{"lowercase a backward selection", "ÀBC DEF", 5, 0, (*Buffer).LowercaseSelection, "àbc dEF"},
+		{"lowercase without a selection", "ABC", 1, 1, (*Buffer).LowercaseSelection, "ABC"},
+		{"uppercase", "straße 1", 0, 8, (*Buffer).UppercaseSelection, "STRAßE 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", tt.content)
+			b.SetReadOnly(false)
+			_ = b.MoveSelectionTo(tt.start, false)
+			_ = b.MoveSelectionTo(tt.end, true)
+
+			if err := tt.apply(b); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := b.Text(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if got := b.Selection(); got.Start != tt.start || got.End != tt.end {
+				t.Errorf("expected selection %d-%d, got %d-%d", tt.start, tt.end, got.Start, got.End)
+			}
+			if tt.expected != tt.content {
+				if _, err := b.Undo(); err != nil {
+					t.Fatalf("Undo failed: %v", err)
+				}
+				if got := b.Text(); got != tt.content {
+					t.Errorf("expected %q after undo, got %q", tt.content, got)
+				}
+			}
+		})
+	}
+
+	if err := NewScratchBuffer("*test*", "abc").ToggleCaseSelection(); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly, got %v", err)
+	}
+}
+
+func TestGetLineWithNewline(t *testing.T) {
+	b := NewScratchBuffer("*test*", "one\ntwö")
+
+	for line, expected := range []string{"one\n", "twö\n"} {
+		got, err := b.GetLineWithNewline(line)
+		if err != nil {
+			t.Fatalf("GetLineWithNewline(%d) failed: %v", line, err)
+		}
+		if got != expected {
+			t.Errorf("GetLineWithNewline(%d): expected %q, got %q", line, expected, got)
+		}
+	}
+	if _, err := b.GetLineWithNewline(2); !errors.Is(err, ErrInvalidLineCol) {
+		t.Errorf("expected ErrInvalidLineCol, got %v", err)
+	}
+}
+
+func TestClear(t *testing.T) {
+	b := NewScratchBuffer("*results*", "one\n  two\nthree")
+	_ = b.MoveSelectionTo(9, false)
+	b.SetDiagnostics([]Diagnostic{{Line: 2, Message: "stale"}})
+	if err := b.ToggleFold(0); err != nil {
+		t.Fatalf("ToggleFold failed: %v", err)
+	}
+
+	// scratch buffers are read-only but still cleared for refreshing
+	if err := b.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if got := b.Text(); got != "" {
+		t.Errorf("expected an empty document, got %q", got)
+	}
+	if got := b.LineCount(); got != 1 {
+		t.Errorf("expected 1 line, got %d", got)
+	}
+	if got := b.Selection(); got.Start != 0 || got.End != 0 {
+		t.Errorf("expected the cursor at the start, got %+v", got)
+	}
+	if b.IsDirty() {
+		t.Errorf("expected a cleared scratch buffer to be unmodified")
+	}
+	if len(b.Diagnostics()) != 0 {
+		t.Errorf("expected the diagnostics to be dropped")
+	}
+	if _, ok := b.FoldAt(0); ok {
+		t.Errorf("expected the folds to be dropped")
+	}
+	if moved, _ := b.Undo(); moved {
+		t.Errorf("expected no history to undo into")
+	}
+
+	// the refilled buffer has its own lines and positions
+	b.SetReadOnly(false)
+	if err := b.Insert("alpha\nbeta"); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if got := b.LineCount(); got != 2 {
+		t.Errorf("expected 2 lines, got %d", got)
+	}
+	line, col, err := b.PositionToLineCol(b.Selection().End)
+	if err != nil || line != 1 || col != 4 {
+		t.Errorf("expected the cursor at 1:4, got %d:%d (%v)", line, col, err)
+	}
+	if got, err := b.GetLine(1); err != nil || got != "beta" {
+		t.Errorf("expected line 1 to be %q, got %q (%v)", "beta", got, err)
+	}
+
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "file.txt")
+		if err := os.WriteFile(path, []byte("one\xff\ntwo\n"), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		b, err := NewBuffer(path, 0, false)
+		if err != nil {
+			t.Fatalf("NewBuffer failed: %v", err)
+		}
+		defer b.Close()
+
+		if err := b.Clear(); err != nil {
+			t.Fatalf("Clear failed: %v", err)
+		}
+		if !b.IsDirty() {
+			t.Errorf("expected clearing a file buffer to mark it dirty")
+		}
+		if b.IsLossyDecoded() {
+			t.Errorf("expected the replaced characters to go with the content")
+		}
+
+		b.SetReadOnly(true)
+		if err := b.Clear(); !errors.Is(err, ErrReadOnly) {
+			t.Errorf("expected ErrReadOnly, got %v", err)
+		}
+	})
+}
+
+func TestUndoRestoresSelection(t *testing.T) {
+	b := NewScratchBuffer("*test*", "hello world")
+	b.SetReadOnly(false)
+
+	// replacing a selection brings the selection back
+	_ = b.MoveSelectionTo(6, false)
+	_ = b.MoveSelectionTo(11, true)
+	_ = b.Insert("there")
+	if _, err := b.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if got := b.Text(); got != "hello world" {
+		t.Fatalf("expected %q, got %q", "hello world", got)
+	}
+	if got := b.Selection(); got.Start != 6 || got.End != 11 {
+		t.Errorf("expected the replaced selection back, got %+v", got)
+	}
+
+	// a group restores the selection from when it began, not from its first change
+	_ = b.MoveSelectionTo(2, false)
+	b.BeginUndoGroup()
+	_ = b.MoveSelectionTo(11, false)
+	_ = b.Insert("!")
+	_ = b.MoveSelectionTo(0, false)
+	_ = b.Insert(">")
+	b.EndUndoGroup()
+	if _, err := b.Undo(); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if got := b.Selection(); got.Start != 2 || got.End != 2 {
+		t.Errorf("expected the cursor back where the group began, got %+v", got)
+	}
+
+	// redo still leaves the cursor where the changes start
+	if _, err := b.Redo(); err != nil {
+		t.Fatalf("redo failed: %v", err)
+	}
+	if got := b.Selection(); got.Start != 0 || got.End != 0 {
+		t.Errorf("expected the cursor at the first change, got %+v", got)
+	}
+}
+
+func TestVirtualColumn(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		pos      int
+		expected int
+	}{
+		{"plain text", "hello", 3, 3},
+		{"leading tab", "\tx", 1, 4},
+		{"two leading tabs", "\t\tx", 2, 8},
+		{"tab after text stops at the next tab stop", "ab\tc", 3, 4},
+		{"tab right at a tab stop", "abcd\tx", 5, 8},
+		{"wide characters", "日本語", 2, 4},
+		{"wide characters after a tab", "\t日x", 2, 6},
+		{"second line", "\tx\n\t\ty", 5, 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", tt.content)
+			b.SetIndentation(Indentation{UseTabs: true, TabWidth: 4})
+
+			col, err := b.VirtualColumn(tt.pos)
+			if err != nil {
+				t.Fatalf("VirtualColumn failed: %v", err)
+			}
+			if col != tt.expected {
+				t.Errorf("expected column %d, got %d", tt.expected, col)
+			}
+		})
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	a := NewScratchBuffer("*a*", "hello\nworld")
+	b := NewScratchBuffer("*b*", "hello\nworld")
+	if a.ContentHash() != b.ContentHash() {
+		t.Fatalf("expected equal content to hash the same")
+	}
+
+	b.SetReadOnly(false)
+	_ = b.MoveSelectionTo(0, false)
+	_ = b.Insert("x")
+	if a.ContentHash() == b.ContentHash() {
+		t.Errorf("expected a single character change to change the hash")
+	}
+
+	_, _ = b.Undo()
+	if a.ContentHash() != b.ContentHash() {
+		t.Errorf("expected undoing the change to restore the hash")
+	}
+}
+
+func TestMaxUndo(t *testing.T) {
+	b := NewScratchBuffer("*test*", "")
+	b.SetReadOnly(false)
+	b.SetMaxUndo(3)
+
+	for _, text := range []string{"a", "b", "c", "d", "e"} {
+		_ = b.Insert(text)
+	}
+
+	// only the three newest changes can be undone
+	for range 3 {
+		if moved, err := b.Undo(); err != nil || !moved {
+			t.Fatalf("expected to undo, got %v, %v", moved, err)
+		}
+	}
+	if moved, _ := b.Undo(); moved {
+		t.Errorf("expected the oldest changes to be dropped")
+	}
+	if got := b.Text(); got != "ab" {
+		t.Errorf("expected %q, got %q", "ab", got)
+	}
+
+	// the newest change stays reachable
+	for range 3 {
+		_, _ = b.Redo()
+	}
+	if got := b.Text(); got != "abcde" {
+		t.Errorf("expected %q, got %q", "abcde", got)
+	}
+
+	// branches that split off before the new oldest change are dropped with it
+	_, _ = b.Undo()
+	_ = b.Insert("x")
+	_ = b.Insert("y")
+	_ = b.Insert("z")
+	root, _ := b.UndoTree()
+	if got := len(root.Children()); got != 1 {
+		t.Errorf("expected a single branch below the root, got %d", got)
+	}
+}
+
+func TestMaxUndoBranches(t *testing.T) {
+	b := NewScratchBuffer("*test*", "")
+	b.SetReadOnly(false)
+	b.SetMaxUndo(3)
+
+	for _, text := range []string{"a", "b", "c"} {
+		_ = b.Insert(text)
+	}
+	for range 3 {
+		_, _ = b.Undo()
+	}
+
+	// dropping the undone branch is enough to stay within the limit, so the new
+	// change can still be undone
+	_ = b.Insert("d")
+	if moved, err := b.Undo(); err != nil || !moved {
+		t.Fatalf("expected to undo, got %v, %v", moved, err)
+	}
+	if got := b.Text(); got != "" {
+		t.Errorf("expected %q, got %q", "", got)
+	}
+	root, _ := b.UndoTree()
+	if got := len(root.Children()); got != 1 {
+		t.Errorf("expected the undone branch to be dropped, got %d branches", got)
+	}
+}
+
+func TestReadBelow(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		line     int
+		input    string
+		expected string
+		cursor   int
+	}{
+		{"between lines", "a\nb\n", 0, "x\ny\n", "a\nx\ny\nb\n", 2},
+		{"missing final newline", "a\nb", 0, "x", "a\nx\nb", 2},
+		{"below the last line", "a\nb", 1, "x\ny\n", "a\nb\nx\ny", 4},
+		{"below the empty last line", "a\n", 1, "x\n", "a\n\nx", 3},
+		{"empty buffer", "", 0, "x", "\nx", 1},
+		{"empty input", "a\nb", 0, "", "a\nb", 0},
+		{"chunks longer than a read", "a\nb", 0, strings.Repeat("0123456789\n", ChunkSize/8), "a\n" + strings.Repeat("0123456789\n", ChunkSize/8) + "b", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", tt.content)
+			b.SetReadOnly(false)
+
+			n, err := b.ReadBelow(tt.line, strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("ReadBelow failed: %v", err)
+			}
+			if n != int64(len(tt.input)) {
+				t.Errorf("expected %d bytes read, got %d", len(tt.input), n)
+			}
+			if got := b.Text(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if got := b.Selection().End; got != tt.cursor {
+				t.Errorf("expected cursor at %d, got %d", tt.cursor, got)
+			}
+
+			// the whole read is a single undo step
+			if _, err := b.Undo(); err != nil {
+				t.Fatalf("undo failed: %v", err)
+			}
+			if got := b.Text(); got != tt.content {
+				t.Errorf("expected undo to restore %q, got %q", tt.content, got)
+			}
+		})
+	}
+}
+
+func TestSaveWithEncodingAndFormat(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  []byte
+		encoding string
+		format   string
+		lines    int
+		expected []byte
+		err      error
+	}{
+		{"unchanged unix", []byte("a\nb\n"), "", "", 3, []byte("a\nb\n"), nil},
+		{"unix to dos", []byte("a\nb\n"), "", FormatDOS, 3, []byte("a\r\nb\r\n"), nil},
+		{"dos keeps its line endings", []byte("a\r\nb\r\n"), "", "", 3, []byte("a\r\nb\r\n"), nil},
+		{"dos to unix", []byte("a\r\nb\r\n"), "", FormatUnix, 3, []byte("a\nb\n"), nil},
+		{"mac", []byte("a\rb\r"), "", "", 3, []byte("a\rb\r"), nil},
+		{"stray carriage returns are kept", []byte("a\rb\n"), "", FormatUnix, 2, []byte("a\rb\n"), nil},
+		{"mixed endings follow the majority", []byte("a\r\nb\nc\r\n"), "", "", 4, []byte("a\r\nb\r\nc\r\n"), nil},
+		{"minority crlf is normalized", []byte("a\r\nb\nc\n"), "", "", 4, []byte("a\nb\nc\n"), nil},
+		{"stray carriage return in a dos file", []byte("a\rb\r\nc\r\n"), "", "", 3, []byte("a\rb\r\nc\r\n"), nil},
+		{"utf-16 big endian", []byte("hé\n"), EncodingUTF16, "", 2, []byte{0xfe, 0xff, 0, 'h', 0, 0xe9, 0, '\n'}, nil},
+		{"utf-16 little endian with dos", []byte("a\n"), EncodingUTF16LE, FormatDOS, 2, []byte{0xff, 0xfe, 'a', 0, '\r', 0, '\n', 0}, nil},
+		{"utf-16 read back", []byte{0xff, 0xfe, 'a', 0, '\r', 0, '\n', 0, 'b', 0}, "", "", 2, []byte{0xff, 0xfe, 'a', 0, '\r', 0, '\n', 0, 'b', 0}, nil},
+		{"utf-16 to utf-8", []byte{0xfe, 0xff, 0, 'h', 0, 0xe9}, EncodingUTF8, "", 1, []byte("hé"), nil},
+		{"latin1", []byte("hé\n"), EncodingLatin1, "", 2, []byte{'h', 0xe9, '\n'}, nil},
+		{"utf-8 to utf-8 with a byte order mark", []byte("a\n"), EncodingUTF8BOM, "", 2, []byte("\xef\xbb\xbfa\n"), nil},
+		{"byte order mark kept", []byte("\xef\xbb\xbfa\n"), "", "", 2, []byte("\xef\xbb\xbfa\n"), nil},
+		{"latin1 can't hold every rune", []byte("h€\n"), EncodingLatin1, "", 2, []byte("h€\n"), ErrUnencodable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "encoded.go")
+			if err := os.WriteFile(path, tt.content, 0644); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+
+			b, err := NewBuffer(path, 0, true)
+			if err != nil {
+				t.Fatalf("NewBuffer failed: %v", err)
+			}
+			defer b.Close()
+
+			if got := b.LineCount(); got != tt.lines {
+				t.Errorf("expected %d lines, got %d", tt.lines, got)
+			}
+			if tt.encoding != "" {
+				if err := b.SetFileEncoding(tt.encoding); err != nil {
+					t.Fatalf("SetFileEncoding failed: %v", err)
+				}
+			}
+			if tt.format != "" {
+				if err := b.SetFileFormat(tt.format); err != nil {
+					t.Fatalf("SetFileFormat failed: %v", err)
+				}
+			}
+
+			if err := b.Save(); !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read file: %v", err)
+			}
+			if string(content) != string(tt.expected) {
+				t.Errorf("expected %q on disk, got %q", tt.expected, content)
+			}
+		})
+	}
+}
+
+func TestSetFileFormatMarksDirty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "format.go")
+	if err := os.WriteFile(path, []byte("a\r\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	b, err := NewBuffer(path, 0, true)
+	if err != nil {
+		t.Fatalf("NewBuffer failed: %v", err)
+	}
+	defer b.Close()
+
+	if b.FileFormat() != FormatDOS || b.FileEncoding() != EncodingUTF8 {
+		t.Fatalf("expected utf-8 dos, got %s %s", b.FileEncoding(), b.FileFormat())
+	}
+	if err := b.SetFileFormat("amiga"); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("expected ErrUnsupportedFormat, got %v", err)
+	}
+	if err := b.SetFileEncoding("ebcdic"); !errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("expected ErrUnsupportedEncoding, got %v", err)
+	}
+
+	_ = b.SetFileFormat(FormatUnix)
+	if !b.IsDirty() {
+		t.Errorf("expected a new file format to mark the buffer dirty")
+	}
+	_ = b.SetFileFormat(FormatDOS)
+	if b.IsDirty() {
+		t.Errorf("expected restoring the file format to leave the buffer clean")
+	}
+}
+
+func TestToggleLineComments(t *testing.T) {
+	tests := []struct {
+		name        string
+		content     string
+		first, last int
+		expected    string
+	}{
+		{"single line", "a := 1", 0, 0, "// a := 1"},
+		{"shallowest indentation", "\tif x {\n\t\ty()\n\t}", 0, 2, "\t// if x {\n\t// \ty()\n\t// }"},
+		{"blank lines are skipped", "a\n\nb", 0, 2, "// a\n\n// b"},
+		{"uncomment", "\t// a\n\t//b", 0, 1, "\ta\n\tb"},
+		{"partly commented lines get commented", "// a\nb", 0, 1, "// // a\n// b"},
+		{"only blank lines", "\n  \n", 0, 1, "\n  \n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", tt.content)
+			b.SetReadOnly(false)
+			b.SetCommentTokens(CommentTokens{Line: "//"})
+
+			if err := b.ToggleLineComments(tt.first, tt.last); err != nil {
+				t.Fatalf("ToggleLineComments failed: %v", err)
+			}
+			if got := b.Text(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	b := NewScratchBuffer("*test*", "a")
+	b.SetReadOnly(false)
+	b.SetCommentTokens(CommentTokens{BlockStart: "/*", BlockEnd: "*/"})
+	if err := b.ToggleLineComments(0, 0); !errors.Is(err, ErrNoCommentTokens) {
+		t.Errorf("expected ErrNoCommentTokens without a line token, got %v", err)
+	}
+}
+
+func TestToggleBlockComment(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		start, end int
+		expected   string
+	}{
+		{"wrap part of a line", "f(a, b)", 2, 3, "f(/* a */, b)"},
+		{"surrounding whitespace stays outside", "x = 1 ", 0, 6, "/* x = 1 */ "},
+		{"multiple lines", "a\nb\n", 0, 4, "/* a\nb */\n"},
+		{"unwrap", "f(/* a */, b)", 2, 9, "f(a, b)"},
+		{"unwrap without spaces", "/*a*/", 0, 5, "a"},
+		{"unwrap an empty comment", "/**/", 0, 4, ""},
+		{"whitespace only", "a  b", 1, 3, "a  b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", tt.content)
+			b.SetReadOnly(false)
+			b.SetCommentTokens(CommentTokens{BlockStart: "/*", BlockEnd: "*/"})
+
+			if err := b.ToggleBlockComment(tt.start, tt.end); err != nil {
+				t.Fatalf("ToggleBlockComment failed: %v", err)
+			}
+			if got := b.Text(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+
+			// toggling is undone in one step
+			_, _ = b.Undo()
+			if got := b.Text(); got != tt.content {
+				t.Errorf("expected undo to restore %q, got %q", tt.content, got)
+			}
+		})
+	}
+}
+
+func TestReplaceAll(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		pattern  string
+		repl     string
+		cursor   int
+		expected string
+		count    int
+		moved    int
+	}{
+		{"multi-byte pattern", "héllo wörld", `ö`, "oe", 8, "héllo woerld", 1, 9},
+		{"multi-byte replacement", "a-b-c", `-`, "→", 4, "a→b→c", 2, 4},
+		{"combining mark in pattern", "cafe\u0301 bar", `e\x{301}`, "\u00e9", 5, "caf\u00e9 bar", 1, 5},
+		{"groups", "x 日本@語 y", `(\p{Han}+)@(\p{Han}+)`, "${2}・${1}", 7, "x 語・日本 y", 1, 7},
+		{"cursor inside a match", "x 日本@語 y", `\p{Han}+@\p{Han}+`, "z", 4, "x z y", 1, 2},
+		{"match inside a grapheme", "e\u0301x e\u0301", `\x{301}`, "", 1, "ex e", 2, 1},
+		{"no match", "héllo", `x`, "y", 2, "héllo", 0, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", tt.content)
+			b.SetReadOnly(false)
+			_ = b.MoveSelectionTo(tt.cursor, false)
+
+			count, err := b.ReplaceAll(regexp.MustCompile(tt.pattern), tt.repl)
+			if err != nil {
+				t.Fatalf("ReplaceAll failed: %v", err)
+			}
+			if count != tt.count {
+				t.Errorf("expected %d replacements, got %d", tt.count, count)
+			}
+			if got := b.Text(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if got := b.Selection().End; got != tt.moved {
+				t.Errorf("expected cursor at %d, got %d", tt.moved, got)
+			}
+
+			// the replacements are undone in one step
+			_, _ = b.Undo()
+			if got := b.Text(); got != tt.content {
+				t.Errorf("expected undo to restore %q, got %q", tt.content, got)
+			}
+		})
+	}
+}
+
+func TestReplaceInLines(t *testing.T) {
+	tests := []struct {
+		name        string
+		first, last int
+		global      bool
+		expected    string
+		count       int
+	}{
+		{"first match on each line", 0, 2, false, "ö-a-a\nö-a\nö", 3},
+		{"every match", 0, 2, true, "ö-ö-ö\nö-ö\nö", 6},
+		{"range", 1, 1, true, "a-a-a\nö-ö\na", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", "a-a-a\na-a\na")
+			b.SetReadOnly(false)
+
+			count, err := b.ReplaceInLines(regexp.MustCompile(`a`), "ö", tt.first, tt.last, tt.global)
+			if err != nil {
+				t.Fatalf("ReplaceInLines failed: %v", err)
+			}
+			if count != tt.count {
+				t.Errorf("expected %d replacements, got %d", tt.count, count)
+			}
+			if got := b.Text(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	b := NewScratchBuffer("*test*", "a")
+	if _, err := b.ReplaceAll(regexp.MustCompile(`a`), "b"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly, got %v", err)
+	}
+}
+
+func TestFindCharInLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		cursor   int
+		ch       string
+		forward  bool
+		till     bool
+		count    int
+		expected int
+		err      error
+	}{
+		{"forward", 0, "é", true, false, 1, 2, nil},
+		{"till forward", 0, "é", true, true, 1, 1, nil},
+		{"count", 0, "é", true, false, 2, 5, nil},
+		{"count past the last match", 0, "é", true, false, 5, 5, nil},
+		{"backward", 5, "é", false, false, 1, 2, nil},
+		{"till backward", 5, "é", false, true, 1, 3, nil},
+		{"emoji", 0, "👍🏽", true, false, 1, 8, nil},
+		{"not on the line", 0, "z", true, false, 1, 0, ErrCharNotFound},
+		{"only on the next line", 0, "q", true, false, 1, 0, ErrCharNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewScratchBuffer("*test*", "abé déf 👍🏽\nq")
+			_ = b.MoveSelectionTo(tt.cursor, false)
+
+			got, err := b.FindCharInLine(tt.ch, tt.forward, tt.till, tt.count)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if got != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDiffAgainstDisk(t *testing.T) {
+	tests := []struct {
+		name     string
+		edited   string
+		expected []LineChange
+	}{
+		{"unchanged", "a\nb\nc\nd\n", []LineChange{}},
+		{"modified", "a\nB\nc\nd\n", []LineChange{{1, LineModified}}},
+		{"added", "a\nb\nx\nc\nd\n", []LineChange{{2, LineAdded}}},
+		{"deleted", "a\nc\nd\n", []LineChange{{1, LineDeleted}}},
+		{"deleted at the end", "a\nb\nc\n", []LineChange{{3, LineDeleted}}},
+		{"modified then added", "a\nB\nX\nc\nd\n", []LineChange{{1, LineModified}, {2, LineAdded}}},
+		{"hunks after an insertion", "x\na\nb\nC\nd\n", []LineChange{{0, LineAdded}, {3, LineModified}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "diff.txt")
+			if err := os.WriteFile(path, []byte("a\nb\nc\nd\n"), 0644); err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+
+			b, err := NewBuffer(path, 0, false)
+			if err != nil {
+				t.Fatalf("NewBuffer failed: %v", err)
+			}
+			defer b.Close()
+
+			if err := b.Delete(0, b.TotalGraphemes()); err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+			if err := b.Insert(tt.edited); err != nil {
+				t.Fatalf("Insert failed: %v", err)
+			}
+			b.refreshDiff()
+
+			changes, err := b.DiffAgainstDisk()
+			if err != nil {
+				t.Fatalf("DiffAgainstDisk failed: %v", err)
+			}
+			if !slices.Equal(changes, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, changes)
+			}
+
+			if err := b.Save(); err != nil {
+				t.Fatalf("Save failed: %v", err)
+			}
+			if changes, _ := b.DiffAgainstDisk(); len(changes) != 0 {
+				t.Errorf("expected no changes after saving, got %v", changes)
+			}
+		})
+	}
+
+	t.Run("new file", func(t *testing.T) {
+		b, err := NewBuffer(filepath.Join(t.TempDir(), "new.txt"), 0, false)
+		if err != nil {
+			t.Fatalf("NewBuffer failed: %v", err)
+		}
+		defer b.Close()
+
+		_ = b.Insert("a\nb")
+		if changes, err := b.DiffAgainstDisk(); err != nil || changes != nil {
+			t.Errorf("expected no changes for a file not written yet, got %v (%v)", changes, err)
+		}
+	})
+
+	t.Run("scratch", func(t *testing.T) {
+		b := NewScratchBuffer("*test*", "a")
+		if _, err := b.DiffAgainstDisk(); !errors.Is(err, ErrNoFile) {
+			t.Errorf("expected ErrNoFile, got %v", err)
+		}
+	})
+
+	t.Run("too far from disk", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "far.txt")
+		if err := os.WriteFile(path, []byte(strings.Repeat("a\n", maxDiffChanges)), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		b, err := NewBuffer(path, 0, false)
+		if err != nil {
+			t.Fatalf("NewBuffer failed: %v", err)
+		}
+		defer b.Close()
+
+		_ = b.Delete(0, b.TotalGraphemes())
+		_ = b.Insert(strings.Repeat("b\n", maxDiffChanges))
+		b.refreshDiff()
+		if changes, _ := b.DiffAgainstDisk(); len(changes) != 0 {
+			t.Errorf("expected no changes past the diff limit, got %d", len(changes))
+		}
+	})
+}
+
+func TestDiffAfterEdits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("a\nb\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	b, err := NewBuffer(path, 0, false)
+	if err != nil {
+		t.Fatalf("NewBuffer failed: %v", err)
+	}
+	defer b.Close()
+
+	diffed := make(chan struct{}, 1)
+	b.SetOnDiff(func() { diffed <- struct{}{} })
+
+	if err := b.Insert("x"); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if changes, _ := b.DiffAgainstDisk(); len(changes) != 0 {
+		t.Errorf("expected the edit not to be diffed yet, got %v", changes)
+	}
+
+	select {
+	case <-diffed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the diff")
+	}
+	expected := []LineChange{{0, LineModified}}
+	if changes, _ := b.DiffAgainstDisk(); !slices.Equal(changes, expected) {
+		t.Errorf("expected %v, got %v", expected, changes)
+	}
+}
+
+func TestHasExternalChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("text\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	b, err := NewBuffer(path, 0, false)
+	if err != nil {
+		t.Fatalf("NewBuffer failed: %v", err)
+	}
+	defer b.Close()
+
+	expect := func(expected bool) {
+		t.Helper()
+		if changed, err := b.HasExternalChanges(); err != nil || changed != expected {
+			t.Errorf("expected external changes %v, got %v (%v)", expected, changed, err)
+		}
+	}
+
+	expect(false)
+	if err := b.Insert("x"); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	expect(false)
+
+	// same size, only the modification time differs
+	later := time.Now().Add(time.Hour)
+	if err := os.WriteFile(path, []byte("TEXT\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("Chtimes failed: %v", err)
+	}
+	expect(true)
+	if err := b.Save(); !errors.Is(err, ErrExternalChange) {
+		t.Fatalf("expected ErrExternalChange, got %v", err)
+	}
+
+	if err := b.ForceSave(); err != nil {
+		t.Fatalf("ForceSave failed: %v", err)
+	}
+	expect(false)
+
+	if err := os.WriteFile(path, []byte("from elsewhere\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	expect(true)
+	if err := b.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	expect(false)
+
+	// a removed file is written again on save
+	if err := os.Remove(path); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	expect(false)
+
+	if _, err := NewScratchBuffer("*test*", "").HasExternalChanges(); !errors.Is(err, ErrNoFile) {
+		t.Errorf("expected ErrNoFile for a scratch buffer, got %v", err)
+	}
+}
+
+func TestAtomicSave(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(path, []byte("original\n"), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	link := filepath.Join(dir, "link.toml")
+	if err := os.Symlink(path, link); err != nil {
+		t.Fatalf("Symlink failed: %v", err)
+	}
+
+	b, err := NewBuffer(link, 0, false)
+	if err != nil {
+		t.Fatalf("NewBuffer failed: %v", err)
+	}
+	defer b.Close()
+	if err := b.Insert("edited "); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	if err := b.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "edited original\n" {
+		t.Errorf("expected the file saved through the symlink, got %q", data)
+	}
+	if info, _ := os.Lstat(link); info.Mode()&os.ModeSymlink == 0 {
+		t.Error("expected the symlink kept")
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600 kept, got %v", info.Mode().Perm())
+	}
+
+	// the reopened handle follows the new file
+	if changed, _ := b.HasExternalChanges(); changed {
+		t.Error("expected no external changes after saving")
+	}
+	if err := b.Save(); err != nil {
+		t.Fatalf("second Save failed: %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package buffer
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/lg2m/athena/internal/editor/state"
+)
+
+// ToggleCaseSelection swaps the case of the letters in the selection, or of the
+// grapheme under the cursor without one. The selection is kept as it was.
+func (b *Buffer) ToggleCaseSelection() error {
+	return b.mapSelection(toggleCase, true)
+}
+
+// LowercaseSelection lowercases the letters in the selection, which is kept as it was.
+func (b *Buffer) LowercaseSelection() error {
+	return b.mapSelection(unicode.ToLower, false)
+}
+
+// UppercaseSelection uppercases the letters in the selection, which is kept as it was.
+func (b *Buffer) UppercaseSelection() error {
+	return b.mapSelection(unicode.ToUpper, false)
+}
+
+// toggleCase returns r lowercased when it's an uppercase or title case letter, and
+// uppercased otherwise.
+func toggleCase(r rune) rune {
+	if unicode.IsUpper(r) || unicode.IsTitle(r) {
+		return unicode.ToLower(r)
+	}
+	return unicode.ToUpper(r)
+}
+
+// mapSelection replaces the selection's text with its runes mapped through mapping,
+// or the grapheme under the cursor when there's no selection and cursor is set. Case
+// mappings keep one rune for one, so the selection still spans the same graphemes.
+func (b *Buffer) mapSelection(mapping func(rune) rune, cursor bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+
+	selection := b.selections[b.primary]
+	start, end := min(selection.Start, selection.End), max(selection.Start, selection.End)
+	if start == end {
+		if !cursor || start >= b.document.TotalGraphemes() {
+			return nil
+		}
+		end = start + 1
+	}
+
+	text, err := b.document.Substring(start, end)
+	if err != nil {
+		return err
+	}
+	mapped := strings.Map(mapping, text)
+	if mapped == text {
+		return nil
+	}
+	if err := b.replace(start, end, mapped); err != nil {
+		return err
+	}
+
+	b.selections[b.primary] = state.Selection{Start: selection.Start, End: selection.End}
+	b.markDirty()
+	b.updateLineCache()
+	return nil
+}
@@ -0,0 +1,116 @@
+package buffer
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/lg2m/athena/internal/rope"
+	"github.com/rivo/uniseg"
+)
+
+// ChunkSize is the number of bytes the ChunkManager reads at a time.
+const ChunkSize = 1 << 20
+
+// ChunkCacheSize is the number of chunks of a large file kept in memory at a time.
+const ChunkCacheSize = 16
+
+// ChunkManager reads a large file, or any other stream, in line-aligned chunks so
+// it never has to hold the whole content as a single byte slice and string.
+type ChunkManager struct {
+	r      io.Reader
+	offset int64  // bytes read so far
+	carry  []byte // partial line left over from the previous read
+	buf    []byte
+	lossy  bool // some chunk held invalid UTF-8
+}
+
+// NewChunkManager creates a ChunkManager reading r from its current position.
+func NewChunkManager(r io.Reader) *ChunkManager {
+	return &ChunkManager{
+		r:   r,
+		buf: make([]byte, ChunkSize),
+	}
+}
+
+// Next returns the next chunk of the file. Chunks end on a line boundary
+// (except the final one), so they never split a grapheme cluster. Invalid UTF-8
+// is replaced with U+FFFD, see Lossy. It returns io.EOF once the whole file has
+// been read, and ErrBinaryFile for content that looks binary.
+func (c *ChunkManager) Next() (string, error) {
+	data, err := c.next()
+	if err != nil {
+		return "", err
+	}
+	text, lossy, err := decodeText(data)
+	c.lossy = c.lossy || lossy
+	return text, err
+}
+
+// Lossy reports whether any chunk read so far held invalid UTF-8.
+func (c *ChunkManager) Lossy() bool {
+	return c.lossy
+}
+
+// next reads the raw bytes of the next chunk.
+func (c *ChunkManager) next() ([]byte, error) {
+	for {
+		n, err := c.r.Read(c.buf)
+		c.offset += int64(n)
+		data := append(c.carry, c.buf[:n]...)
+		c.carry = nil
+
+		if err == io.EOF {
+			if len(data) == 0 {
+				return nil, io.EOF
+			}
+			return data, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Hold back the trailing partial line for the next chunk
+		if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+			c.carry = append([]byte(nil), data[i+1:]...)
+			return data[:i+1], nil
+		}
+		c.carry = data
+	}
+}
+
+// Pieces reads the remaining chunks, keeping only where each one lies and how many
+// grapheme clusters it holds, for a lazy rope to read them back with readPiece.
+// Offsets count from where the ChunkManager started reading. It also returns the
+// number of bytes read.
+func (c *ChunkManager) Pieces() ([]rope.Piece, int64, error) {
+	var pieces []rope.Piece
+	for {
+		// the carry is the start of the next chunk
+		offset := c.offset - int64(len(c.carry))
+		data, err := c.next()
+		if err == io.EOF {
+			return pieces, c.offset, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		text, lossy, err := decodeText(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		c.lossy = c.lossy || lossy
+		pieces = append(pieces, rope.Piece{Offset: offset, Size: len(data), Graphemes: uniseg.GraphemeClusterCount(text)})
+	}
+}
+
+// readPiece returns a loader reading back the pieces of r found by Pieces.
+func readPiece(r io.ReaderAt) rope.Loader {
+	return func(offset int64, size int) (string, error) {
+		data := make([]byte, size)
+		if _, err := r.ReadAt(data, offset); err != nil {
+			return "", err
+		}
+		text, _, err := decodeText(data)
+		return text, err
+	}
+}
@@ -0,0 +1,216 @@
+package buffer
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/lg2m/athena/internal/editor/state"
+)
+
+var ErrNoCommentTokens = errors.New("buffer: no comment tokens for this language")
+
+// CommentTokens are the comment delimiters of a buffer's language. Empty tokens
+// mean the language has no comments of that kind.
+type CommentTokens struct {
+	Line       string // starts a comment running to the end of the line, e.g. //
+	BlockStart string // opens a block comment, e.g. /*
+	BlockEnd   string // closes a block comment, e.g. */
+}
+
+// HasLine reports whether the language has line comments.
+func (c CommentTokens) HasLine() bool {
+	return c.Line != ""
+}
+
+// HasBlock reports whether the language has block comments.
+func (c CommentTokens) HasBlock() bool {
+	return c.BlockStart != "" && c.BlockEnd != ""
+}
+
+// textEdit is an edit in the coordinates of the document before a batch of edits.
+type textEdit struct {
+	pos     int
+	removed int // graphemes removed at pos
+	text    string
+}
+
+// CommentTokens returns the comment delimiters the buffer toggles comments with.
+func (b *Buffer) CommentTokens() CommentTokens {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.comments
+}
+
+// SetCommentTokens sets the comment delimiters the buffer toggles comments with.
+func (b *Buffer) SetCommentTokens(tokens CommentTokens) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.comments = tokens
+}
+
+// ToggleLineComments comments out the lines from first to last inclusive with the
+// line comment token, placed at the shallowest indentation among them, or removes
+// the tokens when every non-blank line is already commented. Blank lines are left
+// alone. The toggle is undone as a single step.
+func (b *Buffer) ToggleLineComments(first, last int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+	if !b.comments.HasLine() {
+		return ErrNoCommentTokens
+	}
+	if first < 0 || last >= len(b.lineCache) || first > last {
+		return ErrInvalidLineCol
+	}
+
+	type commentLine struct {
+		start  int    // position of the line's first grapheme
+		indent int    // leading whitespace in graphemes
+		rest   string // the line after its indentation
+	}
+
+	token := b.comments.Line
+	var lines []commentLine
+	commented, minIndent := true, -1
+	for line := first; line <= last; line++ {
+		b.lineCacheMu.RLock()
+		start, end := b.lineBounds(line)
+		b.lineCacheMu.RUnlock()
+		text, err := b.document.Substring(start, end)
+		if err != nil {
+			return err
+		}
+		rest := strings.TrimLeft(text, " \t")
+		if rest == "" {
+			continue
+		}
+
+		// whitespace is ASCII, so its bytes are graphemes
+		indent := len(text) - len(rest)
+		lines = append(lines, commentLine{start: start, indent: indent, rest: rest})
+		commented = commented && strings.HasPrefix(rest, token)
+		if minIndent == -1 || indent < minIndent {
+			minIndent = indent
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	edits := make([]textEdit, 0, len(lines))
+	for _, line := range lines {
+		if !commented {
+			edits = append(edits, textEdit{pos: line.start + minIndent, text: token + " "})
+			continue
+		}
+		removed := countGraphemes(token)
+		if strings.HasPrefix(line.rest[len(token):], " ") {
+			removed++
+		}
+		edits = append(edits, textEdit{pos: line.start + line.indent, removed: removed})
+	}
+	return b.applyEdits(edits)
+}
+
+// ToggleBlockComment wraps the text from start to end in the block comment tokens,
+// or unwraps it when it already starts and ends with them, surrounding whitespace
+// aside. The toggle is undone as a single step.
+func (b *Buffer) ToggleBlockComment(start, end int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+	if !b.comments.HasBlock() {
+		return ErrNoCommentTokens
+	}
+
+	text, err := b.document.Substring(start, end)
+	if err != nil {
+		return err
+	}
+
+	// leave the whitespace around the text outside the comment
+	trimmed := strings.TrimLeft(text, " \t\n")
+	start += len(text) - len(trimmed)
+	inner := strings.TrimRight(trimmed, " \t\n")
+	end = start + countGraphemes(inner)
+
+	open, close := b.comments.BlockStart, b.comments.BlockEnd
+	if len(inner) < len(open)+len(close) || !strings.HasPrefix(inner, open) || !strings.HasSuffix(inner, close) {
+		if inner == "" {
+			return nil
+		}
+		return b.applyEdits([]textEdit{
+			{pos: start, text: open + " "},
+			{pos: end, text: " " + close},
+		})
+	}
+
+	body := inner[len(open) : len(inner)-len(close)]
+	openLen, closeLen := countGraphemes(open), countGraphemes(close)
+	if strings.HasPrefix(body, " ") {
+		openLen++
+		body = body[1:]
+	}
+	if strings.HasSuffix(body, " ") {
+		closeLen++
+	}
+	return b.applyEdits([]textEdit{
+		{pos: start, removed: openLen},
+		{pos: end - closeLen, removed: closeLen},
+	})
+}
+
+// applyEdits applies edits given in ascending order of position as a single undo
+// step, moving the selection along with the text; the caller must hold the lock.
+func (b *Buffer) applyEdits(edits []textEdit) error {
+	if b.history != nil && b.history.group == nil {
+		b.history.group = &UndoNode{selection: b.selections[b.primary]}
+		defer func() { b.history.group = nil }()
+	}
+	defer func() {
+		b.markDirty()
+		b.updateLineCache()
+	}()
+
+	// back to front, so the positions of the edits before stay valid
+	for i := len(edits) - 1; i >= 0; i-- {
+		edit := edits[i]
+		if err := b.replace(edit.pos, edit.pos+edit.removed, edit.text); err != nil {
+			return err
+		}
+	}
+
+	// text inserted at the selection's edges ends up inside it, and after a cursor
+	start, end := min(b.selections[b.primary].Start, b.selections[b.primary].End), max(b.selections[b.primary].Start, b.selections[b.primary].End)
+	start, end = shiftForEdits(start, edits, start == end), shiftForEdits(end, edits, true)
+	if b.selections[b.primary].Start > b.selections[b.primary].End {
+		start, end = end, start
+	}
+	b.selections[b.primary] = state.Selection{Start: start, End: end}
+	return nil
+}
+
+// shiftForEdits maps a position from before a batch of edits to after it. Positions
+// inside removed text move to where it was removed, and text inserted right at pos
+// ends up before it when after is set.
+func shiftForEdits(pos int, edits []textEdit, after bool) int {
+	shift := 0
+	for _, edit := range edits {
+		switch {
+		case edit.pos > pos, edit.pos == pos && !after:
+			return pos + shift
+		case edit.pos+edit.removed > pos:
+			return edit.pos + shift
+		}
+		shift += countGraphemes(edit.text) - edit.removed
+	}
+	return pos + shift
+}
@@ -0,0 +1,57 @@
+package buffer
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Severity is how serious a diagnostic is.
+type Severity uint8
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityInfo
+	SeverityHint
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "info"
+	default:
+		return "hint"
+	}
+}
+
+// Diagnostic is a problem reported for a location in the buffer, e.g. by a compiler
+// or linter. Line and Col are 0-based, Col counting graphemes.
+type Diagnostic struct {
+	Line     int
+	Col      int
+	Severity Severity
+	Message  string
+}
+
+// SetDiagnostics replaces the buffer's diagnostics, keeping them ordered by position.
+func (b *Buffer) SetDiagnostics(diagnostics []Diagnostic) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.diagnostics = slices.Clone(diagnostics)
+	slices.SortStableFunc(b.diagnostics, func(x, y Diagnostic) int {
+		return cmp.Or(cmp.Compare(x.Line, y.Line), cmp.Compare(x.Col, y.Col))
+	})
+}
+
+// Diagnostics returns the buffer's diagnostics ordered by position.
+func (b *Buffer) Diagnostics() []Diagnostic {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return slices.Clone(b.diagnostics)
+}
@@ -0,0 +1,150 @@
+package buffer
+
+import (
+	"slices"
+	"time"
+
+	"github.com/lg2m/athena/internal/rope"
+)
+
+// ChangeKind is how a line differs from the file on disk.
+type ChangeKind uint8
+
+const (
+	LineAdded ChangeKind = iota
+	LineModified
+	LineDeleted
+)
+
+// DiffDelay is how long after the last edit a buffer is diffed against the file on
+// disk, so a burst of typing is diffed once, in the background.
+const DiffDelay = 250 * time.Millisecond
+
+const (
+	maxDiffLines   = 100000 // documents with more lines aren't diffed
+	maxDiffChanges = 1000   // diffing gives up past this many inserted or deleted lines
+)
+
+// LineChange marks a line of the buffer that differs from the file as last loaded
+// or saved. Lines deleted from the file are marked on the line that follows them,
+// or on the last line when they were at the end.
+type LineChange struct {
+	Line int
+	Kind ChangeKind
+}
+
+// DiffAgainstDisk returns the lines changed since the buffer was last loaded or
+// saved, ordered by line. The diff runs DiffDelay after the last edit, so until then
+// the changes are those of the last diff. Files not written yet and chunked buffers
+// report no changes, and so do documents too large or too far from the file to diff.
+func (b *Buffer) DiffAgainstDisk() ([]LineChange, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.filePath == "" {
+		return nil, ErrNoFile
+	}
+	if b.file == nil || b.chunked {
+		return nil, nil
+	}
+	return slices.Clone(b.lineChanges), nil
+}
+
+// SetOnDiff sets the function called when a diff run after an edit finishes, for
+// the changed lines to be drawn.
+func (b *Buffer) SetOnDiff(onDiff func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.onDiff = onDiff
+}
+
+// invalidateDiff schedules a diff DiffDelay after an edit, restarting the delay when
+// one is already scheduled; the caller must hold the lock.
+func (b *Buffer) invalidateDiff() {
+	b.diffVersion++
+	if b.diffTimer != nil {
+		b.diffTimer.Stop()
+	}
+	b.diffTimer = nil
+	if b.filePath != "" && b.file != nil && !b.chunked {
+		b.diffTimer = time.AfterFunc(DiffDelay, b.refreshDiff)
+	}
+}
+
+// resetDiff records that the document matches the file, as after a load or save,
+// cancelling a scheduled diff; the caller must hold the lock.
+func (b *Buffer) resetDiff() {
+	b.diffVersion++
+	if b.diffTimer != nil {
+		b.diffTimer.Stop()
+		b.diffTimer = nil
+	}
+	b.lineChanges = []LineChange{}
+}
+
+// refreshDiff diffs snapshots of the document and the file without holding the
+// lock, keeping the result unless the document was edited again in the meantime.
+func (b *Buffer) refreshDiff() {
+	b.mu.RLock()
+	version, document, saved, onDiff := b.diffVersion, b.document.Snapshot(), b.saved, b.onDiff
+	b.lineCacheMu.RLock()
+	lines := len(b.lineCache)
+	b.lineCacheMu.RUnlock()
+	b.mu.RUnlock()
+
+	changes := diffLines(saved, document, lines)
+
+	b.mu.Lock()
+	current := b.diffVersion == version
+	if current {
+		b.lineChanges = changes
+		b.diffTimer = nil
+	}
+	b.mu.Unlock()
+
+	if current && onDiff != nil {
+		onDiff()
+	}
+}
+
+// diffLines compares document, lines long, with the saved snapshot line by line. The
+// result is never nil so it can be cached.
+func diffLines(saved, document *rope.Rope, lines int) []LineChange {
+	changes := []LineChange{}
+	if lines > maxDiffLines || document.EqualTo(saved) {
+		return changes
+	}
+	edits, ok := saved.DiffWithin(document, maxDiffChanges)
+	if !ok {
+		return changes
+	}
+
+	lastLine := max(0, lines-1)
+	mark := func(line int, kind ChangeKind) {
+		line = min(line, lastLine)
+		if n := len(changes); n > 0 && changes[n-1].Line >= line {
+			return
+		}
+		changes = append(changes, LineChange{Line: line, Kind: kind})
+	}
+
+	// edits refer to lines of the snapshot, so track how far earlier ones moved the rest
+	shift := 0
+	for _, edit := range edits {
+		start := edit.StartLine + shift
+		removed, added := edit.EndLine-edit.StartLine, len(edit.Lines)
+		for i := range added {
+			if i < removed {
+				mark(start+i, LineModified)
+			} else {
+				mark(start+i, LineAdded)
+			}
+		}
+		if removed > added {
+			mark(start+added, LineDeleted)
+		}
+		shift += added - removed
+	}
+	return changes
+}
@@ -0,0 +1,275 @@
+package buffer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var (
+	ErrBinaryFile          = errors.New("buffer: file appears to be binary")
+	ErrUnsupportedEncoding = errors.New("buffer: unsupported encoding")
+	ErrUnsupportedFormat   = errors.New("buffer: unsupported file format")
+	ErrUnencodable         = errors.New("buffer: text can't be written in the file encoding")
+)
+
+// Encodings a buffer can be written in.
+const (
+	EncodingUTF8    = "utf-8"
+	EncodingUTF8BOM = "utf-8-bom" // UTF-8 starting with a byte order mark
+	EncodingUTF16   = "utf-16"    // big endian, with a byte order mark
+	EncodingUTF16LE = "utf-16le"  // little endian, with a byte order mark
+	EncodingLatin1  = "latin1"    // also the fallback for files that aren't valid UTF-8
+)
+
+// utf8BOM is the byte order mark some editors write at the start of UTF-8 files.
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// File formats, the line endings a buffer is written with. The document itself
+// always separates lines with \n.
+const (
+	FormatUnix = "unix" // \n
+	FormatDOS  = "dos"  // \r\n
+	FormatMac  = "mac"  // \r
+)
+
+// IsEncoding reports whether name is an encoding buffers can be written in.
+func IsEncoding(name string) bool {
+	switch name {
+	case EncodingUTF8, EncodingUTF8BOM, EncodingUTF16, EncodingUTF16LE, EncodingLatin1:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsFormat reports whether name is a file format.
+func IsFormat(name string) bool {
+	switch name {
+	case FormatUnix, FormatDOS, FormatMac:
+		return true
+	default:
+		return false
+	}
+}
+
+// binarySniffLen is how many leading bytes are checked for NUL bytes, which text
+// files don't contain.
+const binarySniffLen = 8000
+
+// decodeText validates content as UTF-8, replacing each invalid sequence with
+// U+FFFD so the rope only ever holds valid text, and reports whether anything was
+// replaced. Content that looks binary is rejected instead.
+func decodeText(content []byte) (string, bool, error) {
+	if isBinary(content) {
+		return "", false, ErrBinaryFile
+	}
+	if utf8.Valid(content) {
+		return string(content), false, nil
+	}
+	return strings.ToValidUTF8(string(content), string(utf8.RuneError)), true, nil
+}
+
+// isBinary reports whether content looks like a binary file rather than text.
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), binarySniffLen)], 0) >= 0
+}
+
+// decodeFile decodes the content of a file into the document's text: UTF-16 and
+// UTF-8 with a byte order mark are recognized by the mark, which is left out of the
+// text, other valid UTF-8 is taken as is and anything else is read as Latin-1 so
+// no byte is lost. Line endings are turned into \n. It returns the encoding and file
+// format found so saving can write them back.
+func decodeFile(content []byte) (text, encoding, format string, lossy bool, err error) {
+	switch {
+	case bytes.HasPrefix(content, utf8BOM):
+		text, lossy, err = decodeText(content[len(utf8BOM):])
+		if err != nil {
+			return "", "", "", false, err
+		}
+		encoding = EncodingUTF8BOM
+	case bytes.HasPrefix(content, []byte{0xfe, 0xff}):
+		text, encoding = decodeUTF16(content[2:], binary.BigEndian), EncodingUTF16
+	case bytes.HasPrefix(content, []byte{0xff, 0xfe}):
+		text, encoding = decodeUTF16(content[2:], binary.LittleEndian), EncodingUTF16LE
+	case isBinary(content):
+		return "", "", "", false, ErrBinaryFile
+	case utf8.Valid(content):
+		text, encoding = string(content), EncodingUTF8
+	default:
+		text, encoding = decodeLatin1(content), EncodingLatin1
+	}
+
+	// line endings other than the majority's are normalized along with it, except
+	// for lone \r outside mac files, which is kept as text
+	format = detectFormat(text)
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if format == FormatMac {
+		text = strings.ReplaceAll(text, "\r", "\n")
+	}
+	return text, encoding, format, lossy, nil
+}
+
+// decodeUTF16 decodes UTF-16 without its byte order mark; unpaired surrogates and
+// a trailing odd byte become U+FFFD.
+func decodeUTF16(content []byte, order binary.ByteOrder) string {
+	units := make([]uint16, len(content)/2)
+	for i := range units {
+		units[i] = order.Uint16(content[2*i:])
+	}
+	text := string(utf16.Decode(units))
+	if len(content)%2 != 0 {
+		text += string(utf8.RuneError)
+	}
+	return text
+}
+
+// decodeLatin1 decodes Latin-1, where every byte is the code point of the same value.
+func decodeLatin1(content []byte) string {
+	runes := make([]rune, len(content))
+	for i, c := range content {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// detectFormat returns the file format of text from the line endings most of its
+// lines use: dos for \r\n, mac for a lone \r and unix for \n, which also wins ties.
+func detectFormat(text string) string {
+	crlf := strings.Count(text, "\r\n")
+	lf := strings.Count(text, "\n") - crlf
+	cr := strings.Count(text, "\r") - crlf
+	switch {
+	case crlf > lf && crlf >= cr:
+		return FormatDOS
+	case cr > lf && cr > crlf:
+		return FormatMac
+	default:
+		return FormatUnix
+	}
+}
+
+// encodeText converts the document's text to the bytes written for a file in the
+// given encoding and format.
+func encodeText(text, encoding, format string) ([]byte, error) {
+	switch format {
+	case FormatDOS:
+		text = strings.ReplaceAll(text, "\n", "\r\n")
+	case FormatMac:
+		text = strings.ReplaceAll(text, "\n", "\r")
+	}
+
+	switch encoding {
+	case EncodingUTF16, EncodingUTF16LE:
+		var order binary.ByteOrder = binary.BigEndian
+		if encoding == EncodingUTF16LE {
+			order = binary.LittleEndian
+		}
+		units := utf16.Encode([]rune(text))
+		data := make([]byte, 2+2*len(units))
+		order.PutUint16(data, 0xfeff)
+		for i, unit := range units {
+			order.PutUint16(data[2+2*i:], unit)
+		}
+		return data, nil
+	case EncodingLatin1:
+		data := make([]byte, 0, len(text))
+		for _, r := range text {
+			if r > 0xff {
+				return nil, fmt.Errorf("%w: %q in %s", ErrUnencodable, r, encoding)
+			}
+			data = append(data, byte(r))
+		}
+		return data, nil
+	case EncodingUTF8BOM:
+		return append(slices.Clip(utf8BOM), text...), nil
+	default:
+		return []byte(text), nil
+	}
+}
+
+// EncodeText encodes text the way saving writes the buffer, in its encoding and line
+// format. Without bom, the byte order mark of the encodings that start with one is
+// left out, as when appending to a file that already has it.
+func (b *Buffer) EncodeText(text string, bom bool) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	data, err := encodeText(text, b.encoding, b.format)
+	if err != nil || bom {
+		return data, err
+	}
+	switch b.encoding {
+	case EncodingUTF8BOM:
+		return data[len(utf8BOM):], nil
+	case EncodingUTF16, EncodingUTF16LE:
+		return data[2:], nil
+	}
+	return data, nil
+}
+
+// FileEncoding returns the encoding the buffer is written in.
+func (b *Buffer) FileEncoding() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.encoding
+}
+
+// SetFileEncoding changes the encoding the buffer is written in on the next save.
+// The buffer counts as modified until then.
+func (b *Buffer) SetFileEncoding(encoding string) error {
+	if !IsEncoding(encoding) {
+		return ErrUnsupportedEncoding
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+	b.encoding = encoding
+	b.markDirty()
+	return nil
+}
+
+// FileFormat returns the line endings the buffer is written with.
+func (b *Buffer) FileFormat() string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.format
+}
+
+// SetFileFormat changes the line endings the buffer is written with on the next
+// save. The buffer counts as modified until then.
+func (b *Buffer) SetFileFormat(format string) error {
+	if !IsFormat(format) {
+		return ErrUnsupportedFormat
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+	b.format = format
+	b.markDirty()
+	return nil
+}
+
+// IsLossyDecoded reports whether the file held invalid UTF-8 that was replaced with
+// U+FFFD on load, so saving it won't write back the original bytes.
+func (b *Buffer) IsLossyDecoded() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.lossy
+}
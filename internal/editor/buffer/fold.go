@@ -0,0 +1,142 @@
+package buffer
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/lg2m/athena/internal/rope"
+)
+
+var ErrNoFold = errors.New("buffer: no foldable block at line")
+
+// ToggleFold opens the closed fold starting at line, or closes the indentation
+// block starting there. The block covers the following lines indented deeper
+// than line, including blank lines between them.
+func (b *Buffer) ToggleFold(line int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.folds[line]; ok {
+		delete(b.folds, line)
+		return nil
+	}
+
+	end, err := b.foldRange(line)
+	if err != nil {
+		return err
+	}
+
+	if b.folds == nil {
+		b.folds = make(map[int]int)
+	}
+	b.folds[line] = end
+
+	// keep the cursor out of the hidden lines
+	b.lineCacheMu.RLock()
+	cursorLine, _ := b.lineColAt(b.selections[b.primary].End)
+	b.lineCacheMu.RUnlock()
+	if cursorLine > line && cursorLine <= end {
+		b.lineCacheMu.RLock()
+		start, _ := b.lineBounds(line)
+		b.lineCacheMu.RUnlock()
+		b.selections[b.primary].Start, b.selections[b.primary].End = start, start
+	}
+	return nil
+}
+
+// FoldAt returns the last line hidden by a closed fold starting at line.
+func (b *Buffer) FoldAt(line int) (int, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	end, ok := b.folds[line]
+	return end, ok
+}
+
+// FoldContaining returns the closed fold hiding line, if any.
+func (b *Buffer) FoldContaining(line int) (start, end int, ok bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for start, end := range b.folds {
+		if line > start && line <= end {
+			return start, end, true
+		}
+	}
+	return 0, 0, false
+}
+
+// foldRange computes the indentation block starting at line; the caller must hold the lock.
+func (b *Buffer) foldRange(line int) (int, error) {
+	b.lineCacheMu.RLock()
+	defer b.lineCacheMu.RUnlock()
+
+	if line < 0 || line >= len(b.lineCache) {
+		return 0, ErrInvalidLineCol
+	}
+
+	indentOf := func(l int) (int, bool) {
+		start, end := b.lineBounds(l)
+		text, err := b.document.Substring(start, end)
+		if err != nil || strings.TrimSpace(text) == "" {
+			return 0, false
+		}
+		return len(text) - len(strings.TrimLeft(text, " \t")), true
+	}
+
+	base, ok := indentOf(line)
+	if !ok {
+		return 0, ErrNoFold
+	}
+
+	end := line
+	for l := line + 1; l < len(b.lineCache); l++ {
+		indent, ok := indentOf(l)
+		if !ok {
+			continue // blank lines don't end a block
+		}
+		if indent <= base {
+			break
+		}
+		end = l
+	}
+
+	if end == line {
+		return 0, ErrNoFold
+	}
+	return end, nil
+}
+
+// shiftFolds moves the closed folds along with the graphemes of before from start to
+// end being replaced by inserted graphemes. Folds whose hidden lines the edit touches,
+// or whose first line it splits, are dropped; the caller must hold the lock.
+func (b *Buffer) shiftFolds(before *rope.Rope, start, end, inserted int) {
+	if len(b.folds) == 0 {
+		return
+	}
+	leading, errLeading := before.Substring(0, start)
+	removed, errRemoved := before.Substring(start, end)
+	added, errAdded := b.document.Substring(start, start+inserted)
+	if errLeading != nil || errRemoved != nil || errAdded != nil {
+		b.folds = nil
+		return
+	}
+
+	// the edit spans lines first to last of before
+	first := strings.Count(leading, "\n")
+	last := first + strings.Count(removed, "\n")
+	delta := strings.Count(added, "\n") - strings.Count(removed, "\n")
+	// lines added before the first line of a fold push it down whole
+	lineStart := leading == "" || strings.HasSuffix(leading, "\n")
+
+	folds := make(map[int]int, len(b.folds))
+	for foldStart, foldEnd := range b.folds {
+		switch {
+		case foldEnd < first:
+			folds[foldStart] = foldEnd
+		case foldStart > last, foldStart == last && (first < last || delta == 0 || lineStart):
+			folds[foldStart+delta] = foldEnd + delta
+		}
+	}
+	b.folds = folds
+}
@@ -0,0 +1,64 @@
+package buffer
+
+import "strings"
+
+// IndentLine adds one level of indentation to the start of a line: a tab when the
+// buffer indents with tabs, width spaces otherwise. Empty lines are left alone.
+func (b *Buffer) IndentLine(lineNum, width int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+	if lineNum < 0 || lineNum >= len(b.lineCache) {
+		return ErrInvalidLineCol
+	}
+
+	b.lineCacheMu.RLock()
+	start, end := b.lineBounds(lineNum)
+	b.lineCacheMu.RUnlock()
+	if start == end {
+		return nil
+	}
+	unit := "\t"
+	if !b.indentation.UseTabs {
+		unit = strings.Repeat(" ", max(width, 1))
+	}
+	return b.applyEdits([]textEdit{{pos: start, text: unit}})
+}
+
+// DedentLine removes one level of indentation from the start of a line: a leading
+// tab, or up to width leading spaces. A line without leading whitespace is left
+// alone.
+func (b *Buffer) DedentLine(lineNum, width int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+	if lineNum < 0 || lineNum >= len(b.lineCache) {
+		return ErrInvalidLineCol
+	}
+
+	b.lineCacheMu.RLock()
+	start, end := b.lineBounds(lineNum)
+	b.lineCacheMu.RUnlock()
+	text, err := b.document.Substring(start, end)
+	if err != nil {
+		return err
+	}
+	removed := 0
+	if strings.HasPrefix(text, "\t") {
+		removed = 1
+	} else {
+		for removed < min(max(width, 1), len(text)) && text[removed] == ' ' {
+			removed++
+		}
+	}
+	if removed == 0 {
+		return nil
+	}
+	return b.applyEdits([]textEdit{{pos: start, removed: removed}})
+}
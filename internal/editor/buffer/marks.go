@@ -0,0 +1,38 @@
+package buffer
+
+import "errors"
+
+var ErrMarkNotSet = errors.New("buffer: mark not set")
+
+// SetMark records the cursor's position as the mark named r, replacing the mark
+// set under that name before.
+func (b *Buffer) SetMark(r rune) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.marks == nil {
+		b.marks = make(map[rune]int)
+	}
+	b.marks[r] = b.selections[b.primary].End
+}
+
+// GotoMark moves the cursor to the mark named r, clamped to the document.
+func (b *Buffer) GotoMark(r rune) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	pos, ok := b.marks[r]
+	if !ok {
+		return ErrMarkNotSet
+	}
+	b.moveSelectionTo(min(pos, b.document.TotalGraphemes()), false)
+	return nil
+}
+
+// shiftMarks moves the marks along with the graphemes from start to end being
+// replaced by inserted graphemes; the caller must hold the lock.
+func (b *Buffer) shiftMarks(start, end, inserted int) {
+	for r, pos := range b.marks {
+		b.marks[r] = shiftPosition(pos, start, end, inserted)
+	}
+}
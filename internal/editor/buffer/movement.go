@@ -1,32 +1,104 @@
 package buffer
 
 import (
+	"errors"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 
 	"github.com/lg2m/athena/internal/editor/state"
 	"github.com/lg2m/athena/internal/util"
+	"github.com/rivo/uniseg"
 )
 
+var ErrCharNotFound = errors.New("buffer: character not found on line")
+
 // MoveSelections moves the selections by the specified offset.
 // If `extend` is true, it extends the selection; otherwise, it moves the cursor.
 func (b *Buffer) MoveSelections(offset int, extend bool) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	newPos := b.selection.End + offset
-	newPos = util.Clamp(newPos, 0, b.document.TotalGraphemes())
+	for i, selection := range b.selections {
+		newPos := util.Clamp(selection.End+offset, 0, b.document.TotalGraphemes())
+		if extend {
+			// extend the selection end
+			b.selections[i].End = newPos
+		} else {
+			// move both start and end (cursor movement)
+			b.selections[i] = state.Selection{Start: newPos, End: newPos}
+		}
+	}
+	b.normalizeSelections()
+
+	return nil
+}
+
+// MoveSelectionTo moves the selection end to an absolute position.
+func (b *Buffer) MoveSelectionTo(pos int, extend bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if pos < 0 || pos > b.document.TotalGraphemes() {
+		return ErrInvalidPosition
+	}
+
 	if extend {
-		// extend the selection end
-		b.selection.End = newPos
+		b.selections[b.primary].End = pos
 	} else {
-		// move both start and end (cursor movement)
-		b.selection = state.Selection{Start: newPos, End: newPos}
+		b.selections[b.primary] = state.Selection{Start: pos, End: pos}
 	}
 
 	return nil
 }
 
+// FindCharInLine returns the position of the count-th occurrence of ch from the cursor,
+// searching only within the cursor's line. With till, the position stops one grapheme short.
+// If the line has fewer than count occurrences, the last one found is used.
+func (b *Buffer) FindCharInLine(ch string, forward bool, till bool, count int) (int, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	b.lineCacheMu.RLock()
+	defer b.lineCacheMu.RUnlock()
+
+	pos := b.selections[b.primary].End
+	line, _ := b.lineColAt(pos)
+	lineStart, lineEnd := b.lineBounds(line)
+
+	text, err := b.document.Substring(lineStart, lineEnd)
+	if err != nil {
+		return pos, err
+	}
+
+	// collect positions of ch on the line
+	var matches []int
+	gr := uniseg.NewGraphemes(text)
+	for i := lineStart; gr.Next(); i++ {
+		if gr.Str() == ch && ((forward && i > pos) || (!forward && i < pos)) {
+			matches = append(matches, i)
+		}
+	}
+	if len(matches) == 0 {
+		return pos, ErrCharNotFound
+	}
+
+	count = util.Clamp(count, 1, len(matches))
+	var target int
+	if forward {
+		target = matches[count-1]
+		if till {
+			target--
+		}
+	} else {
+		target = matches[len(matches)-count]
+		if till {
+			target++
+		}
+	}
+	return target, nil
+}
+
 // MoveSelectionToLineCol moves the selection to a specific line and column.
 func (b *Buffer) MoveSelectionToLineCol(line, col int, extend bool) error {
 	b.mu.Lock()
@@ -39,73 +111,146 @@ func (b *Buffer) MoveSelectionToLineCol(line, col int, extend bool) error {
 		return ErrInvalidLineCol
 	}
 
-	lineStart := b.lineCache[line]
-	var lineEnd int
-	if line+1 < len(b.lineCache) {
-		lineEnd = b.lineCache[line+1] - 1 // -1 to exclude newline
-	} else {
-		lineEnd = b.document.TotalGraphemes()
+	lineStart, lineEnd := b.lineBounds(line)
+	b.moveSelectionTo(lineStart+min(col, lineEnd-lineStart), extend)
+	return nil
+}
+
+// MoveSelectionToLineEnd moves the selection to the virtual column after the last
+// grapheme of a line, where appended text goes. It never moves past the line's
+// newline, so an empty line keeps the cursor at its start.
+func (b *Buffer) MoveSelectionToLineEnd(line int, extend bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lineCacheMu.RLock()
+	defer b.lineCacheMu.RUnlock()
+
+	if line < 0 || line >= len(b.lineCache) {
+		return ErrInvalidLineCol
 	}
 
-	actualCol := col
-	lineLen := lineEnd - lineStart
-	if actualCol > lineLen {
-		actualCol = lineLen
+	_, lineEnd := b.lineBounds(line)
+	b.moveSelectionTo(lineEnd, extend)
+	return nil
+}
+
+// LineExtent holds the columns intra-line motions move to on a line. They are all 0
+// on an empty line, and the non-blank ones are the last grapheme's on a blank line.
+type LineExtent struct {
+	FirstNonBlank int
+	LastNonBlank  int
+	Last          int
+}
+
+// LineExtent returns the columns of a line's first and last non-blank graphemes and
+// of its last grapheme. Blanks are spaces and tabs.
+func (b *Buffer) LineExtent(line int) (LineExtent, error) {
+	text, err := b.GetLine(line)
+	if err != nil {
+		return LineExtent{}, err
 	}
 
-	targetPos := lineStart + actualCol
+	last := max(countGraphemes(text)-1, 0)
+	trimmed := strings.TrimLeft(text, " \t")
+	if trimmed == "" {
+		return LineExtent{FirstNonBlank: last, LastNonBlank: last, Last: last}, nil
+	}
+	// blanks are ASCII, so the leading ones are as many graphemes as bytes
+	first := len(text) - len(trimmed)
+	return LineExtent{
+		FirstNonBlank: first,
+		LastNonBlank:  first + countGraphemes(strings.TrimRight(trimmed, " \t")) - 1,
+		Last:          last,
+	}, nil
+}
 
+// IndentWidth returns the number of screen columns a line's leading blanks take up,
+// and whether the line is blank throughout.
+func (b *Buffer) IndentWidth(line int) (width int, blank bool, err error) {
+	text, err := b.GetLine(line)
+	if err != nil {
+		return 0, false, err
+	}
+	trimmed := strings.TrimLeft(text, " \t")
+	if trimmed == "" {
+		return 0, true, nil
+	}
+
+	b.mu.RLock()
+	tabWidth := b.indentation.TabWidth
+	b.mu.RUnlock()
+	return displayWidth(text[:len(text)-len(trimmed)], tabWidth), false, nil
+}
+
+// moveSelectionTo moves the cursor to pos, extending the selection if requested;
+// the caller must hold the lock.
+func (b *Buffer) moveSelectionTo(pos int, extend bool) {
 	if extend {
-		b.selection.End = targetPos
+		b.selections[b.primary].End = pos
 	} else {
-		b.selection = state.Selection{Start: targetPos, End: targetPos}
+		b.selections[b.primary] = state.Selection{Start: pos, End: pos}
 	}
-
-	return nil
 }
 
 // MoveToNextWord moves the cursor to the next word boundary.
-func (b *Buffer) MoveToNextWord(extend bool) error {
+func (b *Buffer) MoveToNextWord(kind WordKind, extend bool) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	newPos := b.findNextWordBoundary(b.selection.End, 1)
+	newPos := b.findNextWordBoundary(b.selections[b.primary].End, 1, kind)
 
 	if extend {
 		// Extend selection to include the word
-		b.selection.End = newPos
+		b.selections[b.primary].End = newPos
 	} else {
 		// Move cursor to new position (collapse selection)
-		b.selection = state.Selection{Start: newPos, End: newPos}
+		b.selections[b.primary] = state.Selection{Start: newPos, End: newPos}
 	}
 
 	return nil
 }
 
 // MoveToPrevWord moves the cursor to the previous word boundary
-func (b *Buffer) MoveToPrevWord(extend bool) error {
+func (b *Buffer) MoveToPrevWord(kind WordKind, extend bool) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	newPos := b.findNextWordBoundary(b.selection.Start-1, -1)
+	newPos := b.findNextWordBoundary(b.selections[b.primary].Start-1, -1, kind)
 
 	if extend {
-		if b.selection.End == b.selection.Start {
-			b.selection.End = b.selection.Start
-			b.selection.Start = newPos
+		if b.selections[b.primary].End == b.selections[b.primary].Start {
+			b.selections[b.primary].End = b.selections[b.primary].Start
+			b.selections[b.primary].Start = newPos
 		} else {
-			b.selection.Start = newPos
+			b.selections[b.primary].Start = newPos
 		}
 	} else {
-		b.selection = state.Selection{Start: newPos, End: newPos}
+		b.selections[b.primary] = state.Selection{Start: newPos, End: newPos}
 	}
 
 	return nil
 }
 
+// MoveToWordEnd moves the cursor to the last grapheme of the word it's on, or of the
+// next word when it's already there, skipping whitespace in between.
+func (b *Buffer) MoveToWordEnd(kind WordKind, extend bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.moveSelectionTo(b.findWordEnd(b.selections[b.primary].End, kind), extend)
+	return nil
+}
+
+// wordScanChunk is the number of graphemes word motions fetch from the document at a time.
+const wordScanChunk = 256
+
 // findNextWordBoundary finds the next word boundary position from the given position.
 // direction: 1 for forward, -1 for backward TODO make constants
-func (b *Buffer) findNextWordBoundary(pos int, direction int) int {
+// The document is scanned a chunk at a time, so a motion across N graphemes takes
+// O(N) rather than a lookup from the root for each grapheme. kind decides which
+// graphemes make up a word.
+func (b *Buffer) findNextWordBoundary(pos int, direction int, kind WordKind) int {
 	totalLen := b.document.TotalGraphemes()
 	if pos >= totalLen {
 		return totalLen
@@ -114,34 +259,124 @@ func (b *Buffer) findNextWordBoundary(pos int, direction int) int {
 		return 0
 	}
 
-	// Get current grapheme to determine if we're in a word
-	curr, err := b.document.Substring(pos, pos+1)
-	if err != nil {
-		return pos
+	// the type of the grapheme at pos decides what ends the word
+	currType := None
+
+	if direction > 0 {
+		for start := pos; start < totalLen; start += wordScanChunk {
+			text, err := b.graphemeRange(start, start+wordScanChunk)
+			if err != nil {
+				return start
+			}
+			gr := uniseg.NewGraphemes(text)
+			for i := start; gr.Next(); i++ {
+				if nextType := kind.wordType(gr.Str()); i == pos {
+					currType = nextType
+				} else if nextType != currType {
+					return i
+				}
+			}
+		}
+		return totalLen
 	}
-	currType := getWordType(curr)
 
-	nextPos := pos
-	for {
-		nextPos += direction
-		if nextPos >= totalLen || nextPos < 0 {
-			return util.Clamp(nextPos, 0, totalLen)
+	for end := pos + 1; end > 0; end -= wordScanChunk {
+		text, err := b.graphemeRange(end-wordScanChunk, end)
+		if err != nil {
+			return end
 		}
+		graphemes := splitGraphemes(text)
+		start := end - len(graphemes)
+		for i := len(graphemes) - 1; i >= 0; i-- {
+			if prevType := kind.wordType(graphemes[i]); start+i == pos {
+				currType = prevType
+			} else if prevType != currType {
+				return start + i + 1
+			}
+		}
+	}
+	return 0
+}
+
+// findWordEnd finds the last grapheme of the run of graphemes of the same type
+// after pos, skipping whitespace before it, or the last grapheme of the document
+// when only whitespace follows. Like findNextWordBoundary, it scans a chunk at a time.
+func (b *Buffer) findWordEnd(pos int, kind WordKind) int {
+	totalLen := b.document.TotalGraphemes()
+	if pos+1 >= totalLen {
+		return max(pos, 0)
+	}
 
-		nextGrapheme, err := b.document.Substring(nextPos, nextPos+1)
+	runType := None
+	for start := pos + 1; start < totalLen; start += wordScanChunk {
+		text, err := b.graphemeRange(start, start+wordScanChunk)
 		if err != nil {
-			return nextPos
+			return start
 		}
-		nextType := getWordType(nextGrapheme)
+		gr := uniseg.NewGraphemes(text)
+		for i := start; gr.Next(); i++ {
+			nextType := kind.wordType(gr.Str())
+			switch {
+			case runType == None && nextType != Whitespace:
+				runType = nextType
+			case runType != None && nextType != runType:
+				return i - 1
+			}
+		}
+	}
+	return totalLen - 1
+}
+
+// bracketPairs maps each bracket to its counterpart.
+var bracketPairs = map[string]string{
+	"(": ")", ")": "(",
+	"[": "]", "]": "[",
+	"{": "}", "}": "{",
+}
+
+// MatchingBracket returns the position of the bracket matching the one at pos, respecting nesting.
+func (b *Buffer) MatchingBracket(pos int) (int, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.matchingBracket(pos)
+}
+
+// matchingBracket finds the matching bracket; the caller must hold the lock.
+func (b *Buffer) matchingBracket(pos int) (int, bool) {
+	start, err := b.document.GraphemeAt(pos)
+	if err != nil {
+		return pos, false
+	}
+	target, ok := bracketPairs[start]
+	if !ok {
+		return pos, false
+	}
 
-		if nextType != currType {
-			if direction > 0 {
-				return nextPos
-			} else {
-				return nextPos + 1
+	// opening brackets scan forward, closing brackets scan backward
+	direction := 1
+	if start == ")" || start == "]" || start == "}" {
+		direction = -1
+	}
+
+	totalLen := b.document.TotalGraphemes()
+	depth := 0
+	for i := pos; i >= 0 && i < totalLen; i += direction {
+		g, err := b.document.GraphemeAt(i)
+		if err != nil {
+			return pos, false
+		}
+		switch g {
+		case start:
+			depth++
+		case target:
+			depth--
+			if depth == 0 {
+				return i, true
 			}
 		}
 	}
+	return pos, false
 }
 
 type WordType uint8
@@ -153,6 +388,24 @@ const (
 	Symbol                     // symbols, operators, punctuation
 )
 
+// WordKind chooses what word motions treat as a word.
+type WordKind uint8
+
+const (
+	SmallWord WordKind = iota // a run of letters or a run of symbols, as w moves over
+	BigWord                   // a run of anything but whitespace, as W moves over
+)
+
+// wordType returns the type of the grapheme cluster for motions over words of kind
+// k, where symbols are part of big words.
+func (k WordKind) wordType(s string) WordType {
+	t := getWordType(s)
+	if k == BigWord && t == Symbol {
+		return Letter
+	}
+	return t
+}
+
 // getWordType returns the type of the grapheme cluster.
 func getWordType(s string) WordType {
 	if s == "" {
@@ -0,0 +1,47 @@
+package buffer
+
+import "errors"
+
+var ErrUnknownOption = errors.New("buffer: unknown option")
+
+// Buffer-local options that override the editor config for a single buffer.
+const (
+	OptionWrap       = "wrap"       // soft-wrap long lines
+	OptionNumber     = "number"     // show line numbers in the gutter
+	OptionCursorLine = "cursorline" // highlight the line the cursor is on
+)
+
+// IsOption reports whether name is a buffer-local option.
+func IsOption(name string) bool {
+	switch name {
+	case OptionWrap, OptionNumber, OptionCursorLine:
+		return true
+	default:
+		return false
+	}
+}
+
+// Option returns the buffer's value for an option and whether it was set locally.
+func (b *Buffer) Option(name string) (bool, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	value, ok := b.options[name]
+	return value, ok
+}
+
+// SetOption overrides an option for this buffer only.
+func (b *Buffer) SetOption(name string, value bool) error {
+	if !IsOption(name) {
+		return ErrUnknownOption
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.options == nil {
+		b.options = make(map[string]bool)
+	}
+	b.options[name] = value
+	return nil
+}
@@ -0,0 +1,224 @@
+package buffer
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/rivo/uniseg"
+)
+
+var ErrNoPair = errors.New("buffer: no enclosing pair found")
+
+// quoteChars are the quotes PairRange pairs up within a line.
+var quoteChars = map[string]bool{`"`: true, "'": true, "`": true}
+
+// tagPattern matches opening, closing and self-closing markup tags.
+var tagPattern = regexp.MustCompile(`<(/?)([A-Za-z][\w:.-]*)[^<>]*?(/?)>`)
+
+// PairRange returns the range around pos enclosed by pair: a bracket such as "(" or ")",
+// a quote character, or "t" for a markup tag. With inner the delimiters are excluded.
+func (b *Buffer) PairRange(pos int, pair string, inner bool) (int, int, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var start, end int
+	var err error
+	switch {
+	case pair == "t":
+		start, end, err = b.tagRange(pos, inner)
+	case quoteChars[pair]:
+		start, end, err = b.quoteRange(pos, pair)
+	default:
+		start, end, err = b.bracketRange(pos, pair)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// tagRange already accounts for inner; brackets and quotes are one grapheme wide
+	if inner && pair != "t" {
+		return start + 1, end - 1, nil
+	}
+	return start, end, nil
+}
+
+// bracketRange returns the range from the opening bracket enclosing pos through its
+// closing bracket; the caller must hold the lock.
+func (b *Buffer) bracketRange(pos int, pair string) (int, int, error) {
+	open, ok := bracketPairs[pair]
+	if !ok {
+		return 0, 0, ErrNoPair
+	}
+	if pair == "(" || pair == "[" || pair == "{" {
+		open = pair
+	}
+	closing := bracketPairs[open]
+
+	// scan backwards for the opening bracket that isn't closed before pos
+	depth := 0
+	for i := min(pos, b.document.TotalGraphemes()-1); i >= 0; i-- {
+		g, err := b.document.GraphemeAt(i)
+		if err != nil {
+			return 0, 0, err
+		}
+		switch {
+		case g == closing && i != pos:
+			depth++
+		case g == open && depth > 0:
+			depth--
+		case g == open:
+			match, ok := b.matchingBracket(i)
+			if !ok {
+				return 0, 0, ErrNoPair
+			}
+			return i, match + 1, nil
+		}
+	}
+	return 0, 0, ErrNoPair
+}
+
+// quoteRange returns the range of the quoted string on pos's line that contains pos,
+// or else the next one after it; the caller must hold the lock.
+func (b *Buffer) quoteRange(pos int, quote string) (int, int, error) {
+	b.lineCacheMu.RLock()
+	defer b.lineCacheMu.RUnlock()
+
+	line, _ := b.lineColAt(pos)
+	lineStart, lineEnd := b.lineBounds(line)
+
+	text, err := b.graphemeRange(lineStart, lineEnd)
+	if err != nil {
+		return 0, 0, err
+	}
+	var quotes []int
+	gr := uniseg.NewGraphemes(text)
+	for i := lineStart; gr.Next(); i++ {
+		if gr.Str() == quote {
+			quotes = append(quotes, i)
+		}
+	}
+
+	for i := 0; i+1 < len(quotes); i += 2 {
+		if pos <= quotes[i+1] {
+			return quotes[i], quotes[i+1] + 1, nil
+		}
+	}
+	return 0, 0, ErrNoPair
+}
+
+// tagRange returns the range of the innermost markup element containing pos;
+// the caller must hold the lock.
+func (b *Buffer) tagRange(pos int, inner bool) (int, int, error) {
+	text := b.document.String()
+	offset := byteOffset(text, pos)
+
+	type openTag struct {
+		name       string
+		start, end int
+	}
+	var stack []openTag
+	var best *openTag
+	bestEnd := -1
+
+	for _, m := range tagPattern.FindAllStringSubmatchIndex(text, -1) {
+		closing := m[3] > m[2]
+		selfClosing := m[7] > m[6]
+		name := text[m[4]:m[5]]
+
+		switch {
+		case selfClosing:
+			continue
+		case !closing:
+			stack = append(stack, openTag{name: name, start: m[0], end: m[1]})
+			continue
+		}
+
+		// pop to the matching opening tag, discarding unclosed ones
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].name != name {
+				continue
+			}
+			open := stack[i]
+			stack = stack[:i]
+			if open.start <= offset && offset < m[1] && (best == nil || open.start > best.start) {
+				best = &open
+				bestEnd = m[1]
+				if inner {
+					bestEnd = m[0]
+				}
+			}
+			break
+		}
+	}
+
+	if best == nil {
+		return 0, 0, ErrNoPair
+	}
+	bestStart := best.start
+	if inner {
+		bestStart = best.end
+	}
+	start := countGraphemes(text[:bestStart])
+	return start, start + countGraphemes(text[bestStart:bestEnd]), nil
+}
+
+// byteOffset returns the byte offset of the grapheme at index pos in text.
+func byteOffset(text string, pos int) int {
+	offset := 0
+	gr := uniseg.NewGraphemes(text)
+	for i := 0; i < pos && gr.Next(); i++ {
+		_, offset = gr.Positions()
+	}
+	return offset
+}
+
+// InStringOrComment reports whether pos lies inside a string literal or a comment,
+// using the syntax tree when the buffer has one and a scan of the line otherwise. The
+// tree is the one highlighting uses, parsed once per change.
+func (b *Buffer) InStringOrComment(pos int) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.highlighter != nil {
+		before, err := b.document.Substring(0, pos)
+		if err != nil {
+			return false
+		}
+		return b.highlighter.InStringOrComment(b.syntaxSource, uint(len(before)))
+	}
+
+	b.lineCacheMu.RLock()
+	defer b.lineCacheMu.RUnlock()
+
+	line, _ := b.lineColAt(pos)
+	lineStart, _ := b.lineBounds(line)
+	prefix, err := b.document.Substring(lineStart, pos)
+	if err != nil {
+		return false
+	}
+	return inStringOrComment(prefix)
+}
+
+// inStringOrComment scans a line up to the cursor for an unclosed quote or a // comment.
+func inStringOrComment(prefix string) bool {
+	var quote, prev rune
+	escaped := false
+	for _, ch := range prefix {
+		if quote != 0 {
+			switch {
+			case escaped:
+				escaped = false
+			case ch == '\\':
+				escaped = true
+			case ch == quote:
+				quote = 0
+			}
+		} else if quoteChars[string(ch)] {
+			quote = ch
+		} else if ch == '/' && prev == '/' {
+			return true
+		}
+		prev = ch
+	}
+	return quote != 0
+}
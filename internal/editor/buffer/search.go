@@ -0,0 +1,230 @@
+package buffer
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lg2m/athena/internal/editor/state"
+	"github.com/rivo/uniseg"
+)
+
+// WordAt returns the word of letters, digits and underscores under pos along with
+// the position it starts at, or false when pos isn't on a word.
+func (b *Buffer) WordAt(pos int) (string, int, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	isWord := func(i int) bool {
+		g, err := b.document.GraphemeAt(i)
+		return err == nil && getWordType(g) == Letter
+	}
+	if !isWord(pos) {
+		return "", 0, false
+	}
+
+	start, end := pos, pos+1
+	for start > 0 && isWord(start-1) {
+		start--
+	}
+	for isWord(end) {
+		end++
+	}
+	word, err := b.document.Substring(start, end)
+	if err != nil {
+		return "", 0, false
+	}
+	return word, start, true
+}
+
+// Find returns the start of the next occurrence of pattern after pos, or of the
+// previous one before pos when searching backward, wrapping around the ends of the
+// document. With wholeWord, occurrences that are part of a longer word are skipped.
+// It also reports whether the search wrapped, and whether pattern occurs at all.
+func (b *Buffer) Find(pattern string, pos int, forward, wholeWord bool) (int, bool, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	matches := findMatches(b.document.String(), pattern, wholeWord)
+	if len(matches) == 0 {
+		return 0, false, false
+	}
+
+	if forward {
+		for _, m := range matches {
+			if m > pos {
+				return m, false, true
+			}
+		}
+		return matches[0], true, true
+	}
+	for i := len(matches) - 1; i >= 0; i-- {
+		if matches[i] < pos {
+			return matches[i], false, true
+		}
+	}
+	return matches[len(matches)-1], true, true
+}
+
+// FindWord is Find for whole words, as searching for the word under the cursor does.
+func (b *Buffer) FindWord(word string, pos int, forward bool) (int, bool, bool) {
+	return b.Find(word, pos, forward, true)
+}
+
+// findMatches returns the grapheme positions of the occurrences of pattern in text,
+// leaving out those that are part of a longer word with wholeWord.
+func findMatches(text, pattern string, wholeWord bool) []int {
+	if pattern == "" {
+		return nil
+	}
+
+	var offsets []int
+	for i := 0; i+len(pattern) <= len(text); {
+		idx := strings.Index(text[i:], pattern)
+		if idx < 0 {
+			break
+		}
+		start, end := i+idx, i+idx+len(pattern)
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if !wholeWord || (start == 0 || getWordType(string(before)) != Letter) && (end == len(text) || getWordType(string(after)) != Letter) {
+			offsets = append(offsets, start)
+		}
+		i = start + 1
+	}
+
+	// convert byte offsets to grapheme positions in a single pass, dropping
+	// matches that start inside a grapheme
+	positions := make([]int, 0, len(offsets))
+	gr := uniseg.NewGraphemes(text)
+	k := 0
+	for pos := 0; k < len(offsets) && gr.Next(); pos++ {
+		start, end := gr.Positions()
+		if offsets[k] == start {
+			positions = append(positions, pos)
+		}
+		for k < len(offsets) && offsets[k] < end {
+			k++
+		}
+	}
+	return positions
+}
+
+// ReplaceAll replaces every match of re in the document with repl, expanded as by
+// regexp.Regexp.Expand, and returns the number of replacements. The replacements
+// are undone as a single step.
+func (b *Buffer) ReplaceAll(re *regexp.Regexp, repl string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return 0, ErrReadOnly
+	}
+	text := b.document.String()
+	return b.substitute(text, re.FindAllStringSubmatchIndex(text, -1), re, repl)
+}
+
+// ReplaceInLines replaces the matches of re on each line from first to last
+// inclusive with repl, only the first one on a line unless global is set, and
+// returns the number of replacements. Matches don't span lines, and ^ and $ match
+// at the start and end of each line.
+func (b *Buffer) ReplaceInLines(re *regexp.Regexp, repl string, first, last int, global bool) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return 0, ErrReadOnly
+	}
+	text := b.document.String()
+	lines := strings.Split(text, "\n")
+	if first < 0 || last >= len(lines) || first > last {
+		return 0, ErrInvalidLineCol
+	}
+
+	limit := 1
+	if global {
+		limit = -1
+	}
+	var matches [][]int
+	offset := 0
+	for i, line := range lines[:last+1] {
+		if i >= first {
+			for _, m := range re.FindAllStringSubmatchIndex(line, limit) {
+				for j := range m {
+					if m[j] >= 0 {
+						m[j] += offset
+					}
+				}
+				matches = append(matches, m)
+			}
+		}
+		offset += len(line) + 1
+	}
+	return b.substitute(text, matches, re, repl)
+}
+
+// substitute replaces the matches of re in text, the document's content, with repl
+// as a single edit from the first match to the last, moving the selection along
+// with the text; the caller must hold the lock.
+func (b *Buffer) substitute(text string, matches [][]int, re *regexp.Regexp, repl string) (int, error) {
+	if len(matches) == 0 {
+		return 0, nil
+	}
+
+	// matches are in bytes, the rope and the selection in graphemes
+	starts := graphemeStarts(text)
+	floor := func(offset int) int {
+		i := sort.SearchInts(starts, offset)
+		if starts[i] != offset {
+			i--
+		}
+		return i
+	}
+	ceil := func(offset int) int { return sort.SearchInts(starts, offset) }
+
+	lo, hi := floor(matches[0][0]), ceil(matches[len(matches)-1][1])
+	var replaced strings.Builder
+	edits := make([]textEdit, 0, len(matches))
+	prev := starts[lo]
+	for _, m := range matches {
+		expanded := string(re.ExpandString(nil, repl, text, m))
+		replaced.WriteString(text[prev:m[0]])
+		replaced.WriteString(expanded)
+		prev = m[1]
+
+		// a match can start or end inside a grapheme, which is then replaced whole
+		start, end := floor(m[0]), ceil(m[1])
+		edit := text[starts[start]:m[0]] + expanded + text[m[1]:starts[end]]
+		edits = append(edits, textEdit{pos: start, removed: end - start, text: edit})
+	}
+	replaced.WriteString(text[prev:starts[hi]])
+
+	if b.history != nil && b.history.group == nil {
+		b.history.group = &UndoNode{selection: b.selections[b.primary]}
+		defer func() { b.history.group = nil }()
+	}
+	if err := b.replace(lo, hi, replaced.String()); err != nil {
+		return 0, err
+	}
+
+	total := b.document.TotalGraphemes()
+	start := min(shiftForEdits(b.selections[b.primary].Start, edits, false), total)
+	end := min(shiftForEdits(b.selections[b.primary].End, edits, false), total)
+	b.selections[b.primary] = state.Selection{Start: start, End: end}
+	b.markDirty()
+	b.updateLineCache()
+	return len(matches), nil
+}
+
+// graphemeStarts returns the byte offsets the grapheme clusters of text start at,
+// followed by the length of text.
+func graphemeStarts(text string) []int {
+	var starts []int
+	gr := uniseg.NewGraphemes(text)
+	for gr.Next() {
+		start, _ := gr.Positions()
+		starts = append(starts, start)
+	}
+	return append(starts, len(text))
+}
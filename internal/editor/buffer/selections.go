@@ -0,0 +1,210 @@
+package buffer
+
+import (
+	"slices"
+
+	"github.com/lg2m/athena/internal/editor/state"
+	"github.com/lg2m/athena/internal/util"
+)
+
+// Selections returns a copy of the selections, ordered by position, and the index of
+// the primary one. There's always at least one.
+func (b *Buffer) Selections() ([]state.Selection, int) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	// moving only the primary selection may have put it out of order
+	return normalized(slices.Clone(b.selections), b.primary)
+}
+
+// AddSelectionBelow adds a cursor on the line below the last selection's cursor, at
+// the same column or the end of the line when it's shorter. The new cursor becomes
+// the primary one, so repeating it walks down the buffer.
+func (b *Buffer) AddSelectionBelow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lineCacheMu.RLock()
+	defer b.lineCacheMu.RUnlock()
+
+	last := b.selections[len(b.selections)-1]
+	line, col := b.lineColAt(last.End)
+	if line+1 >= len(b.lineCache) {
+		return ErrInvalidLineCol
+	}
+
+	lineStart, lineEnd := b.lineBounds(line + 1)
+	pos := lineStart + min(col, lineEnd-lineStart)
+	b.selections = append(b.selections, state.Selection{Start: pos, End: pos})
+	b.primary = len(b.selections) - 1
+	b.normalizeSelections()
+	return nil
+}
+
+// KeepPrimarySelection drops every selection but the primary one.
+func (b *Buffer) KeepPrimarySelection() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.setSelection(b.selections[b.primary])
+}
+
+// MoveSelectionsByLines moves the cursor of every selection offset lines up or down,
+// keeping its column where the target line is long enough. Cursors stop at the first
+// and last lines.
+func (b *Buffer) MoveSelectionsByLines(offset int, extend bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lineCacheMu.RLock()
+	defer b.lineCacheMu.RUnlock()
+
+	for i, selection := range b.selections {
+		line, col := b.lineColAt(selection.End)
+		lineStart, lineEnd := b.lineBounds(util.Clamp(line+offset, 0, len(b.lineCache)-1))
+		pos := lineStart + min(col, lineEnd-lineStart)
+		if extend {
+			b.selections[i].End = pos
+		} else {
+			b.selections[i] = state.Selection{Start: pos, End: pos}
+		}
+	}
+	b.normalizeSelections()
+	return nil
+}
+
+// DeleteAtSelections deletes length graphemes after every cursor, or before it when
+// length is negative, as a single undo step. Deletions are cut short at the
+// document's edges, and each cursor is left where its text was removed.
+func (b *Buffer) DeleteAtSelections(length int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return ErrReadOnly
+	}
+
+	b.normalizeSelections()
+	total := b.document.TotalGraphemes()
+	ranges := make([]state.Selection, len(b.selections))
+	for i, selection := range b.selections {
+		pos := selection.End
+		ranges[i] = state.Selection{Start: max(pos+min(length, 0), 0), End: min(pos+max(length, 0), total)}
+		// cursors close together may want the same graphemes
+		if i > 0 {
+			ranges[i].Start = max(ranges[i].Start, ranges[i-1].End)
+			ranges[i].End = max(ranges[i].End, ranges[i].Start)
+		}
+	}
+
+	return b.editSelections(ranges, make([]string, len(ranges)))
+}
+
+// editSelections replaces each of ranges, one per selection and in the same order,
+// with the text at the same index of texts as a single undo step, leaving a cursor
+// after each insertion; the caller must hold the lock.
+func (b *Buffer) editSelections(ranges []state.Selection, texts []string) error {
+	if b.history != nil && b.history.group == nil {
+		b.history.group = &UndoNode{selection: b.selections[b.primary]}
+		defer func() { b.history.group = nil }()
+	}
+	defer func() {
+		b.markDirty()
+		b.updateLineCache()
+	}()
+
+	// back to front, so the positions of the ranges before stay valid; the text can
+	// merge with the clusters around it, so each edit's delta is taken from the
+	// document rather than counted from the text
+	deltas := make([]int, len(ranges))
+	for i := len(ranges) - 1; i >= 0; i-- {
+		total := b.document.TotalGraphemes()
+		if err := b.replace(ranges[i].Start, ranges[i].End, texts[i]); err != nil {
+			return err
+		}
+		deltas[i] = b.document.TotalGraphemes() - total
+	}
+
+	shift := 0
+	for i, r := range ranges {
+		pos := r.End + shift + deltas[i]
+		b.selections[i] = state.Selection{Start: pos, End: pos}
+		shift += deltas[i]
+	}
+	b.normalizeSelections()
+	return nil
+}
+
+// setSelection makes selection the only one; the caller must hold the lock.
+func (b *Buffer) setSelection(selection state.Selection) {
+	b.selections = []state.Selection{selection}
+	b.primary = 0
+}
+
+// shiftSelections moves the selections other than the primary one along with the
+// graphemes from start to end being replaced by inserted graphemes. The primary
+// selection is placed by the edit itself; the caller must hold the lock.
+func (b *Buffer) shiftSelections(start, end, inserted int) {
+	for i := range b.selections {
+		if i != b.primary {
+			b.selections[i].Start = shiftPosition(b.selections[i].Start, start, end, inserted)
+			b.selections[i].End = shiftPosition(b.selections[i].End, start, end, inserted)
+		}
+	}
+}
+
+// normalizeSelections sorts the selections by position and merges those that
+// overlap or coincide, keeping track of the primary one; the caller must hold the
+// lock.
+func (b *Buffer) normalizeSelections() {
+	b.selections, b.primary = normalized(b.selections, b.primary)
+}
+
+// normalized returns selections sorted by position, with those that overlap or
+// coincide merged, and the index primary ends up at.
+func normalized(selections []state.Selection, primary int) ([]state.Selection, int) {
+	if len(selections) == 1 {
+		return selections, primary
+	}
+
+	bounds := func(s state.Selection) (int, int) { return min(s.Start, s.End), max(s.Start, s.End) }
+	order := make([]int, len(selections))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(x, y int) int {
+		xStart, _ := bounds(selections[x])
+		yStart, _ := bounds(selections[y])
+		return xStart - yStart
+	})
+
+	merged := make([]state.Selection, 0, len(selections))
+	mergedPrimary := 0
+	for _, i := range order {
+		selection := selections[i]
+		start, end := bounds(selection)
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			_, lastEnd := bounds(*last)
+			if start < lastEnd || selection == *last {
+				// the merged selection keeps the direction of the first one
+				if end > lastEnd {
+					if last.Start <= last.End {
+						last.End = end
+					} else {
+						last.Start = end
+					}
+				}
+				if i == primary {
+					mergedPrimary = n - 1
+				}
+				continue
+			}
+		}
+		merged = append(merged, selection)
+		if i == primary {
+			mergedPrimary = len(merged) - 1
+		}
+	}
+	return merged, mergedPrimary
+}
@@ -0,0 +1,358 @@
+package buffer
+
+import (
+	"time"
+
+	"github.com/lg2m/athena/internal/editor/state"
+)
+
+// Change is a single edit: Removed, starting at grapheme Start, was replaced by Inserted.
+type Change struct {
+	Start    int
+	Removed  string
+	Inserted string
+}
+
+// UndoNode is a state in the undo tree. Its changes lead from its parent's state to
+// its own; undoing then typing adds a child next to the undone one, so no state is
+// ever lost.
+type UndoNode struct {
+	Seq       int // order the node was created in; the root is 0
+	Time      time.Time
+	changes   []Change
+	selection state.Selection // selection before the changes, restored by undoing them
+
+	parent   *UndoNode
+	children []*UndoNode
+	redo     int // index of the child redo follows, the one last created or visited
+}
+
+// Parent returns the state the node's changes were made in, nil for the root.
+func (n *UndoNode) Parent() *UndoNode { return n.parent }
+
+// Children returns the states reached from this one, oldest first.
+func (n *UndoNode) Children() []*UndoNode { return n.children }
+
+// undoTree is the edit history of a buffer.
+type undoTree struct {
+	root    *UndoNode
+	current *UndoNode
+	seq     int
+	group   *UndoNode // node collecting changes while a group is open
+	size    int       // nodes below the root
+	limit   int       // nodes kept before the oldest are dropped, 0 for no limit
+}
+
+func newUndoTree() *undoTree {
+	root := &UndoNode{Time: time.Now()}
+	return &undoTree{root: root, current: root}
+}
+
+// record adds a change to the open group, or as a node of its own made while
+// selection was active.
+func (t *undoTree) record(change Change, selection state.Selection) {
+	if t.group == nil {
+		t.add(&UndoNode{changes: []Change{change}, selection: selection})
+		return
+	}
+	if len(t.group.changes) == 0 {
+		t.add(t.group)
+	}
+	t.group.changes = append(t.group.changes, change)
+}
+
+// add makes node a child of the current node and moves to it.
+func (t *undoTree) add(node *UndoNode) {
+	t.seq++
+	node.Seq = t.seq
+	node.Time = time.Now()
+	node.parent = t.current
+	t.current.children = append(t.current.children, node)
+	t.current.redo = len(t.current.children) - 1
+	t.current = node
+	t.size++
+	t.prune()
+}
+
+// prune drops the oldest nodes while the tree holds more than its limit. The
+// branches off the root other than the one leading to the current node go first;
+// when that isn't enough, the root's child on that branch becomes the new root.
+func (t *undoTree) prune() {
+	for t.limit > 0 && t.size > t.limit && t.current != t.root {
+		next := t.current
+		for next.parent != t.root {
+			next = next.parent
+		}
+		for _, child := range t.root.children {
+			if child != next {
+				t.size -= child.count()
+			}
+		}
+		t.root.children, t.root.redo = []*UndoNode{next}, 0
+		if t.size <= t.limit {
+			return
+		}
+		t.size--
+		next.parent, next.changes = nil, nil
+		t.root = next
+	}
+}
+
+// count returns the number of nodes in the subtree rooted at n.
+func (n *UndoNode) count() int {
+	total := 1
+	for _, child := range n.children {
+		total += child.count()
+	}
+	return total
+}
+
+// sibling returns the child of the current node's parent offset places away from it,
+// or nil when there is none.
+func (t *undoTree) sibling(offset int) *UndoNode {
+	parent := t.current.parent
+	if parent == nil {
+		return nil
+	}
+	for i, child := range parent.children {
+		if child == t.current {
+			if j := i + offset; j >= 0 && j < len(parent.children) {
+				return parent.children[j]
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// replace replaces the graphemes from start to end with text, recording the change in
+// the undo history; the caller must hold the lock.
+func (b *Buffer) replace(start, end int, text string) error {
+	removed, err := b.document.Substring(start, end)
+	if err != nil {
+		return err
+	}
+	if removed == "" && text == "" {
+		return nil
+	}
+	before := b.document.Snapshot()
+	span, err := b.document.Replace(start, end, text)
+	if err != nil {
+		return err
+	}
+	b.invalidateDiff()
+	b.size += int64(len(text) - len(removed))
+
+	// the text can merge with the clusters around it, as a combining mark does with
+	// the one before; the history records all the clusters that changed
+	if span.Start != start || span.End != end {
+		if removed, err = before.Substring(span.Start, span.End); err != nil {
+			return err
+		}
+		if text, err = b.document.Substring(span.Start, span.Start+span.Inserted); err != nil {
+			return err
+		}
+	}
+	if b.history != nil {
+		b.history.record(Change{Start: span.Start, Removed: removed, Inserted: text}, b.selections[b.primary])
+	}
+	b.shiftLastVisual(span.Start, span.End, span.Inserted)
+	b.shiftMarks(span.Start, span.End, span.Inserted)
+	b.shiftFolds(before, span.Start, span.End, span.Inserted)
+	b.shiftSelections(span.Start, span.End, span.Inserted)
+	return nil
+}
+
+// SetMaxUndo limits the undo history to max steps, dropping the oldest ones first;
+// max below 1 removes the limit.
+func (b *Buffer) SetMaxUndo(max int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.history == nil {
+		return
+	}
+	b.history.limit = 0
+	if max > 0 {
+		b.history.limit = max
+	}
+	b.history.prune()
+}
+
+// BeginUndoGroup makes the following edits a single undo step, until EndUndoGroup.
+// Beginning a group while one is open keeps the open one.
+func (b *Buffer) BeginUndoGroup() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.history != nil && b.history.group == nil {
+		b.history.group = &UndoNode{selection: b.selections[b.primary]}
+	}
+}
+
+// EndUndoGroup closes the group opened by BeginUndoGroup.
+func (b *Buffer) EndUndoGroup() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.history != nil {
+		b.history.group = nil
+	}
+}
+
+// UndoTree returns the root of the undo tree and the node holding the current state.
+// Both are nil for buffers without history.
+func (b *Buffer) UndoTree() (root, current *UndoNode) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.history == nil {
+		return nil, nil
+	}
+	return b.history.root, b.history.current
+}
+
+// Undo reverts the current node's changes, moving to its parent. It reports false
+// when already at the oldest state.
+func (b *Buffer) Undo() (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return false, ErrReadOnly
+	}
+	if b.history == nil || b.history.current.parent == nil {
+		return false, nil
+	}
+	b.history.group = nil
+	return true, b.undo()
+}
+
+// Redo moves to the child of the current node that was last created or visited,
+// reapplying its changes. It reports false when already at the newest state.
+func (b *Buffer) Redo() (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return false, ErrReadOnly
+	}
+	if b.history == nil || len(b.history.current.children) == 0 {
+		return false, nil
+	}
+	b.history.group = nil
+	current := b.history.current
+	return true, b.redo(current.children[current.redo])
+}
+
+// UndoBranch moves to the sibling offset places from the current node, -1 being the
+// branch created before it and 1 the one after, by undoing the current node's changes
+// and applying the sibling's. It reports false when there is no such branch.
+func (b *Buffer) UndoBranch(offset int) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.readOnly {
+		return false, ErrReadOnly
+	}
+	if b.history == nil {
+		return false, nil
+	}
+	sibling := b.history.sibling(offset)
+	if sibling == nil {
+		return false, nil
+	}
+	b.history.group = nil
+	if err := b.undo(); err != nil {
+		return false, err
+	}
+	return true, b.redo(sibling)
+}
+
+// undo reverts the current node's changes, last first, and restores the selection
+// that was active before them; the caller must hold the lock and make sure the node
+// has a parent.
+func (b *Buffer) undo() error {
+	node := b.history.current
+	for i := len(node.changes) - 1; i >= 0; i-- {
+		change := node.changes[i]
+		if err := b.applyChange(change.Start, change.Inserted, change.Removed); err != nil {
+			return err
+		}
+	}
+	b.history.current = node.parent
+
+	total := b.document.TotalGraphemes()
+	b.setSelection(state.Selection{Start: min(node.selection.Start, total), End: min(node.selection.End, total)})
+	b.markDirty()
+	b.updateLineCache()
+	return nil
+}
+
+// redo applies the changes of a child of the current node and moves to it; the
+// caller must hold the lock.
+func (b *Buffer) redo(node *UndoNode) error {
+	cursor := b.document.TotalGraphemes()
+	for _, change := range node.changes {
+		if err := b.applyChange(change.Start, change.Removed, change.Inserted); err != nil {
+			return err
+		}
+		cursor = min(cursor, change.Start)
+	}
+	for i, child := range b.history.current.children {
+		if child == node {
+			b.history.current.redo = i
+		}
+	}
+	b.history.current = node
+	b.afterHistoryMove(cursor)
+	return nil
+}
+
+// applyChange replaces from with to at start without recording it; the caller must
+// hold the lock.
+func (b *Buffer) applyChange(start int, from, to string) error {
+	before := b.document.Snapshot()
+	span, err := b.document.Replace(start, start+countGraphemes(from), to)
+	if err != nil {
+		return err
+	}
+	b.invalidateDiff()
+	b.size += int64(len(to) - len(from))
+	b.shiftLastVisual(span.Start, span.End, span.Inserted)
+	b.shiftMarks(span.Start, span.End, span.Inserted)
+	b.shiftFolds(before, span.Start, span.End, span.Inserted)
+	return nil
+}
+
+// shiftLastVisual moves the last visual selection along with the graphemes from
+// start to end being replaced by inserted graphemes; the caller must hold the lock.
+func (b *Buffer) shiftLastVisual(start, end, inserted int) {
+	if b.lastVisual == nil {
+		return
+	}
+	b.lastVisual.Start = shiftPosition(b.lastVisual.Start, start, end, inserted)
+	b.lastVisual.End = shiftPosition(b.lastVisual.End, start, end, inserted)
+}
+
+// shiftPosition maps pos from before the graphemes from start to end were replaced
+// by inserted graphemes to after it. Positions inside the replaced text move to
+// where it began.
+func shiftPosition(pos, start, end, inserted int) int {
+	switch {
+	case pos >= end:
+		return pos + inserted - (end - start)
+	case pos > start:
+		return start
+	}
+	return pos
+}
+
+// afterHistoryMove places the cursor where the first change was made once the
+// document moved through the history; the caller must hold the lock.
+func (b *Buffer) afterHistoryMove(cursor int) {
+	cursor = min(cursor, b.document.TotalGraphemes())
+	b.setSelection(state.Selection{Start: cursor, End: cursor})
+	b.markDirty()
+	b.updateLineCache()
+}
@@ -0,0 +1,34 @@
+package editor
+
+import "github.com/lg2m/athena/internal/editor/buffer"
+
+// ToggleCase swaps the case of the letters in the selection, or of the grapheme
+// under the cursor without one.
+func (e *Editor) ToggleCase() error {
+	return e.changeCase((*buffer.Buffer).ToggleCaseSelection)
+}
+
+// Lowercase lowercases the letters in the selection.
+func (e *Editor) Lowercase() error {
+	return e.changeCase((*buffer.Buffer).LowercaseSelection)
+}
+
+// Uppercase uppercases the letters in the selection.
+func (e *Editor) Uppercase() error {
+	return e.changeCase((*buffer.Buffer).UppercaseSelection)
+}
+
+// changeCase applies change to the current buffer and records it as the last change.
+func (e *Editor) changeCase(change func(b *buffer.Buffer) error) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if err := change(e.current); err != nil {
+		return err
+	}
+	e.recordChange(1, func(int) error { return change(e.current) })
+	return nil
+}
@@ -0,0 +1,41 @@
+package editor
+
+// change is the last command that modified a buffer, for the . command to repeat.
+// Motions aren't changes.
+type change struct {
+	count int                   // count the command was given
+	run   func(count int) error // runs the command again at the cursor; the caller must hold the lock
+}
+
+// recordChange makes run the change . repeats, made with count; the caller must hold
+// the lock.
+func (e *Editor) recordChange(count int, run func(count int) error) {
+	e.lastChange = &change{count: count, run: run}
+}
+
+// RepeatLastChange repeats the last change at the cursor with the . command, undone
+// as a single step. A count of 0 keeps the count the change was made with, and
+// becomes the count later repeats use otherwise.
+func (e *Editor) RepeatLastChange(count int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if e.lastChange == nil {
+		return nil
+	}
+
+	last := *e.lastChange
+	if count > 0 {
+		last.count = count
+	}
+	e.current.BeginUndoGroup()
+	defer e.current.EndUndoGroup()
+	if err := last.run(last.count); err != nil {
+		return err
+	}
+	e.lastChange = &last
+	return nil
+}
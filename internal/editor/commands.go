@@ -0,0 +1,522 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/lg2m/athena/internal/editor/buffer"
+)
+
+var (
+	ErrUnknownCommand     = errors.New("not an editor command")
+	ErrUnterminatedQuote  = errors.New("unterminated quote")
+	ErrInvalidCommandName = errors.New("invalid command name")
+	ErrNoRangeAllowed     = errors.New("no range allowed")
+)
+
+// CommandFunc runs a command with the arguments typed after its name.
+type CommandFunc func(args []string) error
+
+// LineRange is the range of lines typed before a command name, such as 1,5, % or
+// '<,'>. Addresses are kept as typed for the editor to resolve; End equals Start
+// when a single address was given.
+type LineRange struct {
+	Start, End string
+}
+
+// RangeCommandFunc runs a command that accepts a line range; rng is nil when none
+// was typed.
+type RangeCommandFunc func(rng *LineRange, args []string) error
+
+// command is a registered command; only commands registered with RegisterRange
+// or RegisterLiteral accept a range.
+type command struct {
+	fn      CommandFunc
+	rangeFn RangeCommandFunc
+	literal bool // takes the rest of the line as its argument, unsplit
+}
+
+// CommandRegistry maps command names typed at the `:` prompt to their implementation.
+type CommandRegistry struct {
+	commands map[string]command
+	mu       sync.RWMutex
+}
+
+func NewCommandRegistry() *CommandRegistry {
+	return &CommandRegistry{commands: make(map[string]command)}
+}
+
+// Register adds a command under its name and any aliases, replacing existing ones.
+func (r *CommandRegistry) Register(name string, fn CommandFunc, aliases ...string) error {
+	return r.register(command{fn: fn}, name, aliases)
+}
+
+// RegisterRange adds a command that accepts a line range, like Register.
+func (r *CommandRegistry) RegisterRange(name string, fn RangeCommandFunc, aliases ...string) error {
+	return r.register(command{rangeFn: fn}, name, aliases)
+}
+
+// RegisterLiteral adds a command that accepts a line range and takes the rest of
+// the line after its name as a single argument, unsplit and unquoted, so that it
+// can hold patterns. The argument may follow the name directly, as in s/a/b/.
+func (r *CommandRegistry) RegisterLiteral(name string, fn RangeCommandFunc, aliases ...string) error {
+	return r.register(command{rangeFn: fn, literal: true}, name, aliases)
+}
+
+func (r *CommandRegistry) register(cmd command, name string, aliases []string) error {
+	names := append([]string{name}, aliases...)
+	for _, n := range names {
+		if n == "" || strings.ContainsAny(n, " \t\"'") {
+			return fmt.Errorf("%w: %q", ErrInvalidCommandName, n)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, n := range names {
+		r.commands[n] = cmd
+	}
+	return nil
+}
+
+// Lookup returns the command registered under name. Commands accepting a range
+// run without one.
+func (r *CommandRegistry) Lookup(name string) (CommandFunc, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	cmd, ok := r.commands[name]
+	if ok && cmd.rangeFn != nil {
+		return func(args []string) error { return cmd.rangeFn(nil, args) }, true
+	}
+	return cmd.fn, ok
+}
+
+// Names returns the registered command names and aliases in sorted order.
+func (r *CommandRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.commands))
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Execute tokenizes a command line with SplitArgs and runs the command named by
+// the first token, passing on the line range typed before it, if any. An empty
+// line does nothing. Commands registered with RegisterLiteral are looked up by the
+// letters at the start of the line instead.
+func (r *CommandRegistry) Execute(line string) error {
+	rng, line := splitRange(strings.TrimLeft(line, " \t"))
+	if fn, arg, ok := r.lookupLiteral(line); ok {
+		return fn(rng, arg)
+	}
+	args, err := SplitArgs(line)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return nil
+	}
+
+	r.mu.RLock()
+	cmd, ok := r.commands[args[0]]
+	r.mu.RUnlock()
+	switch {
+	case !ok:
+		return fmt.Errorf("%w: %s", ErrUnknownCommand, args[0])
+	case cmd.rangeFn != nil:
+		return cmd.rangeFn(rng, args[1:])
+	case rng != nil:
+		return fmt.Errorf("%w: %s", ErrNoRangeAllowed, args[0])
+	}
+	return cmd.fn(args[1:])
+}
+
+// lookupLiteral returns the literal command named by the letters line starts with
+// and its argument, if there is one.
+func (r *CommandRegistry) lookupLiteral(line string) (RangeCommandFunc, []string, bool) {
+	n := 0
+	for n < len(line) && (line[n] >= 'a' && line[n] <= 'z' || line[n] >= 'A' && line[n] <= 'Z') {
+		n++
+	}
+
+	r.mu.RLock()
+	cmd, ok := r.commands[line[:n]]
+	r.mu.RUnlock()
+	if n == 0 || !ok || !cmd.literal {
+		return nil, nil, false
+	}
+	if arg := strings.TrimLeft(line[n:], " \t"); arg != "" {
+		return cmd.rangeFn, []string{arg}, true
+	}
+	return cmd.rangeFn, []string{}, true
+}
+
+// splitRange splits the line range off the start of a command line, returning nil
+// when there is none. % stands for the whole buffer.
+func splitRange(line string) (*LineRange, string) {
+	if rest, ok := strings.CutPrefix(line, "%"); ok {
+		return &LineRange{Start: "1", End: "$"}, rest
+	}
+
+	start, rest := splitAddress(line)
+	if start == "" {
+		return nil, line
+	}
+	rng := &LineRange{Start: start, End: start}
+	if after, ok := strings.CutPrefix(rest, ","); ok {
+		rest = after
+		if end, after := splitAddress(after); end != "" {
+			rng.End, rest = end, after
+		}
+	}
+	return rng, rest
+}
+
+// splitAddress splits a line address off the start of s: a line number, . for the
+// cursor's line, $ for the last line or a mark such as '<.
+func splitAddress(s string) (string, string) {
+	switch {
+	case s == "":
+		return "", s
+	case s[0] == '.' || s[0] == '$':
+		return s[:1], s[1:]
+	case s[0] == '\'' && len(s) > 1:
+		_, size := utf8.DecodeRuneInString(s[1:])
+		return s[:1+size], s[1+size:]
+	}
+
+	n := 0
+	for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+		n++
+	}
+	return s[:n], s[n:]
+}
+
+// SplitArgs splits a command line on whitespace. Single quotes keep their content
+// as-is, double quotes allow \" and \\ escapes, and quoted text joins the word
+// around it, so `a"b c"` is the single argument `ab c`.
+func SplitArgs(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		switch {
+		case quote == '\'':
+			if ch == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(ch)
+			}
+		case quote == '"':
+			switch {
+			case ch == '"':
+				quote = 0
+			case ch == '\\' && i+1 < len(runes) && (runes[i+1] == '"' || runes[i+1] == '\\'):
+				i++
+				current.WriteRune(runes[i])
+			default:
+				current.WriteRune(ch)
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+			inWord = true
+		case ch == ' ' || ch == '\t':
+			if inWord {
+				args = append(args, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(ch)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, ErrUnterminatedQuote
+	}
+	if inWord {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// Commands returns the registry the command line dispatches to.
+func (e *Editor) Commands() *CommandRegistry {
+	return e.commands
+}
+
+// registerBuiltinCommands seeds the registry with the commands athena ships with.
+func (e *Editor) registerBuiltinCommands() {
+	_ = e.commands.Register("wa", e.writeAllCommand)
+	_ = e.commands.Register("q", e.quitCommand, "quit")
+	_ = e.commands.Register("q!", e.forceQuitCommand, "quit!")
+	_ = e.commands.Register("wq", e.writeQuitCommand)
+	_ = e.commands.Register("e", e.editCommand, "edit")
+	_ = e.commands.Register("e!", e.reloadCommand, "edit!")
+	_ = e.commands.Register("b", e.bufferCommand, "buffer")
+	_ = e.commands.Register("fixeol", e.fixEOLCommand)
+	_ = e.commands.Register("noh", e.noHighlightCommand, "nohlsearch")
+	_ = e.commands.Register("set", e.setCommand)
+	_ = e.commands.Register("messages", e.messagesCommand, "mes")
+	_ = e.commands.Register("hidden", e.hiddenCommand)
+	_ = e.commands.RegisterLiteral("r", e.readCommand, "read")
+	_ = e.commands.RegisterRange("w", e.writeCommand, "write")
+	_ = e.commands.Register("w!", e.overwriteCommand, "write!")
+	_ = e.commands.Register("saveas", e.saveAsCommand, "sav")
+	_ = e.commands.Register("saveas!", e.forceSaveAsCommand, "sav!")
+	_ = e.commands.RegisterLiteral("s", e.substituteCommand, "substitute")
+	_ = e.commands.RegisterRange("duplicate", e.duplicateCommand, "dup")
+}
+
+// writeAllCommand saves every dirty buffer and reports a summary.
+func (e *Editor) writeAllCommand(args []string) error {
+	dirty := len(e.DirtyBuffers())
+	errs := e.SaveAll()
+
+	// each failure names its file in the message log
+	for _, err := range errs {
+		e.LogMessage(err.Error())
+	}
+
+	msg := "1 buffer written"
+	if written := dirty - len(errs); written != 1 {
+		msg = fmt.Sprintf("%d buffers written", written)
+	}
+	if len(errs) > 0 {
+		msg += fmt.Sprintf(", %d failed", len(errs))
+	}
+	e.SetMessage(msg)
+	return nil
+}
+
+// quitCommand closes the current buffer, or quits after the last one, refusing to
+// lose unsaved changes.
+func (e *Editor) quitCommand(args []string) error {
+	err := e.Quit(false)
+	if errors.Is(err, ErrUnsavedChanges) {
+		return errors.New("No write since last change (add ! to override)")
+	}
+	return err
+}
+
+// forceQuitCommand is quitCommand discarding unsaved changes.
+func (e *Editor) forceQuitCommand(args []string) error {
+	return e.Quit(true)
+}
+
+// writeQuitCommand saves the current buffer, then closes it like quitCommand.
+func (e *Editor) writeQuitCommand(args []string) error {
+	if err := e.SaveCurrentBuffer(); err != nil {
+		return writeError(err)
+	}
+	return e.quitCommand(args)
+}
+
+// editCommand opens the file at the path given, switching to it if it's open.
+func (e *Editor) editCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("Argument required")
+	}
+	return e.OpenFile(strings.Join(args, " "))
+}
+
+// reloadCommand reads the current buffer's file again, discarding unsaved changes.
+func (e *Editor) reloadCommand(args []string) error {
+	return e.ReloadCurrentBuffer()
+}
+
+// bufferCommand switches to the open buffer matching the name given.
+func (e *Editor) bufferCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("Argument required")
+	}
+	return e.SwitchBufferByName(strings.Join(args, " "))
+}
+
+func (e *Editor) fixEOLCommand(args []string) error {
+	_, err := e.FixEOL()
+	return err
+}
+
+func (e *Editor) noHighlightCommand(args []string) error {
+	e.ClearSearchHighlight()
+	return nil
+}
+
+func (e *Editor) messagesCommand(args []string) error {
+	e.ToggleMessages()
+	return nil
+}
+
+// hiddenCommand toggles dotfiles in directory listings.
+func (e *Editor) hiddenCommand(args []string) error {
+	return e.ToggleHiddenFiles()
+}
+
+// readCommand inserts a file below the cursor's line, or with "!cmd" the output of a
+// shell command. The text after ! goes to the shell as typed.
+func (e *Editor) readCommand(rng *LineRange, args []string) error {
+	if rng != nil {
+		return fmt.Errorf("%w: r", ErrNoRangeAllowed)
+	}
+	if len(args) == 0 {
+		return errors.New("Argument required")
+	}
+	command, ok := strings.CutPrefix(args[0], "!")
+	if !ok {
+		return e.ReadFileBelow(strings.TrimRight(args[0], " \t"))
+	}
+	if strings.TrimSpace(command) == "" {
+		return errors.New("Argument required")
+	}
+	return e.ReadCommandBelow(command)
+}
+
+// setValueOption applies an option set with name=value.
+func (e *Editor) setValueOption(name, value string) error {
+	var err error
+	switch name {
+	case "fileencoding", "fenc":
+		err = e.SetFileEncoding(strings.ToLower(value))
+		if errors.Is(err, buffer.ErrUnsupportedEncoding) {
+			return fmt.Errorf("Unsupported encoding: %s", value)
+		}
+	case "fileformat", "ff":
+		err = e.SetFileFormat(value)
+		if errors.Is(err, buffer.ErrUnsupportedFormat) {
+			return fmt.Errorf("Invalid fileformat: %s", value)
+		}
+	default:
+		return fmt.Errorf("Unknown option: %s", name)
+	}
+	return err
+}
+
+// writeCommand saves the current buffer, or with a file name writes the lines in
+// range, the whole buffer by default, to that file instead. ">> file" appends them.
+func (e *Editor) writeCommand(rng *LineRange, args []string) error {
+	appendTo := false
+	if len(args) > 0 && strings.HasPrefix(args[0], ">>") {
+		appendTo = true
+		if args[0] = strings.TrimPrefix(args[0], ">>"); args[0] == "" {
+			args = args[1:]
+		}
+	}
+
+	path := strings.Join(args, " ")
+	if path == "" {
+		if rng != nil || appendTo {
+			return errors.New("Argument required")
+		}
+		return writeError(e.SaveCurrentBuffer())
+	}
+
+	if rng == nil && !appendTo {
+		return openElsewhereError(e.SaveAs(path), path)
+	}
+	start, end, err := e.ResolveRange(rng)
+	if err != nil {
+		return err
+	}
+	if appendTo {
+		return openElsewhereError(e.AppendRange(start, end, path), path)
+	}
+	return openElsewhereError(e.WriteRange(start, end, path), path)
+}
+
+// overwriteCommand saves the current buffer over changes made to its file on disk.
+func (e *Editor) overwriteCommand(args []string) error {
+	return e.OverwriteCurrentBuffer()
+}
+
+// saveAsCommand writes the current buffer to the path given and switches the buffer
+// over to that file. An existing file is left alone.
+func (e *Editor) saveAsCommand(args []string) error {
+	return e.saveAs(args, false)
+}
+
+// forceSaveAsCommand is saveAsCommand replacing an existing file.
+func (e *Editor) forceSaveAsCommand(args []string) error {
+	return e.saveAs(args, true)
+}
+
+func (e *Editor) saveAs(args []string, force bool) error {
+	if len(args) == 0 {
+		return errors.New("Argument required")
+	}
+	path := strings.Join(args, " ")
+	err := e.SaveCurrentBufferAs(path, force)
+	if errors.Is(err, ErrFileExists) {
+		return errors.New("File exists (add ! to override)")
+	}
+	return openElsewhereError(err, path)
+}
+
+// openElsewhereError explains that path can't be written while another buffer has it open.
+func openElsewhereError(err error, path string) error {
+	if errors.Is(err, ErrBufferOpen) {
+		return fmt.Errorf("File is open in another buffer: %s", path)
+	}
+	return err
+}
+
+// writeError explains how to save anyway when the file changed on disk.
+func writeError(err error) error {
+	if errors.Is(err, buffer.ErrExternalChange) {
+		return errors.New("File changed on disk since it was read (add ! to override)")
+	}
+	return err
+}
+
+// duplicateCommand copies the lines in range, the cursor's line by default, below
+// the last of them.
+func (e *Editor) duplicateCommand(rng *LineRange, args []string) error {
+	if rng == nil {
+		rng = &LineRange{Start: ".", End: "."}
+	}
+	first, last, err := e.ResolveRange(rng)
+	if err != nil {
+		return err
+	}
+	return e.DuplicateLines(first, last)
+}
+
+// setCommand applies buffer-local options: "wrap" turns an option on and "nowrap" turns
+// it off, while "fileencoding=utf-16" and "fileformat=dos" set how the buffer is saved.
+func (e *Editor) setCommand(args []string) error {
+	for _, arg := range args {
+		if name, value, ok := strings.Cut(arg, "="); ok {
+			if err := e.setValueOption(name, value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name, value := arg, true
+		if !buffer.IsOption(name) {
+			name, value = strings.TrimPrefix(arg, "no"), false
+		}
+		err := e.SetBufferOption(name, value)
+		if errors.Is(err, buffer.ErrUnknownOption) {
+			return fmt.Errorf("Unknown option: %s", arg)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,683 @@
+package editor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lg2m/athena/internal/editor/buffer"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []string
+		err      error
+	}{
+		{"", nil, nil},
+		{"  wa  ", []string{"wa"}, nil},
+		{"grep foo bar", []string{"grep", "foo", "bar"}, nil},
+		{`grep "foo bar" baz`, []string{"grep", "foo bar", "baz"}, nil},
+		{`grep 'a "b" \c'`, []string{"grep", `a "b" \c`}, nil},
+		{`echo "say \"hi\" \\ \n"`, []string{"echo", `say "hi" \ \n`}, nil},
+		{`a"b c"d`, []string{"ab cd"}, nil},
+		{`echo ""`, []string{"echo", ""}, nil},
+		{"tab\tseparated", []string{"tab", "separated"}, nil},
+		{`grep "open`, nil, ErrUnterminatedQuote},
+		{`grep 'open`, nil, ErrUnterminatedQuote},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := SplitArgs(tt.line)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCommandRegistry(t *testing.T) {
+	r := NewCommandRegistry()
+
+	var got []string
+	echo := func(args []string) error {
+		got = args
+		return nil
+	}
+	if err := r.Register("echo", echo, "ec"); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := r.Register("bad name", echo); !errors.Is(err, ErrInvalidCommandName) {
+		t.Errorf("expected ErrInvalidCommandName, got %v", err)
+	}
+
+	tests := []struct {
+		line     string
+		expected []string
+		err      error
+	}{
+		{`echo hello "big world"`, []string{"hello", "big world"}, nil},
+		{"ec alias", []string{"alias"}, nil},
+		{"echo", []string{}, nil},
+		{"nope", nil, ErrUnknownCommand},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got = nil
+			if err := r.Execute(tt.line); !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	if names := r.Names(); !reflect.DeepEqual(names, []string{"ec", "echo"}) {
+		t.Errorf("expected [ec echo], got %q", names)
+	}
+}
+
+func TestBuiltinCommands(t *testing.T) {
+	e := NewEditor()
+	e.NewScratchBuffer("*test*", "")
+
+	e.SetSearchPattern("foo")
+	if err := e.Commands().Execute("noh"); err != nil {
+		t.Fatalf("noh failed: %v", err)
+	}
+	if got := e.SearchHighlight(); got != "" {
+		t.Errorf("expected the highlight to be cleared, got %q", got)
+	}
+
+	if err := e.Commands().Execute("set nowrap"); err != nil {
+		t.Fatalf("set failed: %v", err)
+	}
+	if value, set := e.BufferOption("wrap"); value || !set {
+		t.Errorf("expected wrap to be turned off, got %v (set %v)", value, set)
+	}
+
+	// custom commands share the dispatch path with the built-in ones
+	_ = e.Commands().Register("echo", func(args []string) error {
+		e.SetMessage(args[0])
+		return nil
+	})
+	if err := e.Commands().Execute(`echo "hello world"`); err != nil {
+		t.Fatalf("echo failed: %v", err)
+	}
+	if got := e.Message(); got != "hello world" {
+		t.Errorf("expected %q, got %q", "hello world", got)
+	}
+}
+
+func TestReadCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fragment.txt")
+	if err := os.WriteFile(path, []byte("one\ntwo\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		command  string
+		expected string
+		line     int
+		err      string
+	}{
+		{"file", "r " + path, "a\none\ntwo\nb", 1, ""},
+		{"missing file", "r " + path + ".missing", "a\nb", 0, "Can't open file " + path + ".missing"},
+		{"command output", `r !printf 'x y\n'`, "a\nx y\nb", 1, ""},
+		{"quoted argument", `r !echo "x  y"`, "a\nx  y\nb", 1, ""},
+		{"shell syntax as typed", `r !echo 'a'"b" $((1+2)) | tr a-z A-Z`, "a\nAB 3\nb", 1, ""},
+		{"no space before the bang", "r!echo x", "a\nx\nb", 1, ""},
+		{"range", "2r " + path, "a\nb", 0, "no range allowed: r"},
+		{"failing command", "read !echo oops >&2; exit 3", "a\nb", 0, "Command failed: oops"},
+		{"no argument", "r !", "a\nb", 0, "Argument required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEditor()
+			e.NewScratchBuffer("*test*", "a\nb").SetReadOnly(false)
+
+			err := e.Commands().Execute(tt.command)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+			} else if err != nil {
+				t.Fatalf("%s failed: %v", tt.command, err)
+			}
+
+			if got := e.current.Text(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if line, col, _ := e.GetCurrentPosition(); line != tt.line || col != 0 {
+				t.Errorf("expected cursor at %d:0, got %d:%d", tt.line, line, col)
+			}
+		})
+	}
+}
+
+func TestReadCommandRunsUnlocked(t *testing.T) {
+	e := NewEditor()
+	e.NewScratchBuffer("*test*", "a").SetReadOnly(false)
+
+	done := make(chan error, 1)
+	go func() { done <- e.Commands().Execute("r !sleep 0.5; echo x") }()
+
+	// the editor answers while the command is still running
+	time.Sleep(100 * time.Millisecond)
+	answered := make(chan struct{})
+	go func() {
+		_, _, _ = e.GetCurrentPosition()
+		close(answered)
+	}()
+	select {
+	case <-answered:
+	case <-done:
+		t.Fatal("expected the command to still be running")
+	case <-time.After(300 * time.Millisecond):
+		t.Fatal("expected the editor not to wait for the command")
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("r failed: %v", err)
+	}
+	if got := e.current.Text(); got != "a\nx" {
+		t.Errorf("expected %q, got %q", "a\nx", got)
+	}
+}
+
+func TestSplitRange(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected *LineRange
+		rest     string
+	}{
+		{"w", nil, "w"},
+		{"2,3w out", &LineRange{"2", "3"}, "w out"},
+		{"'<,'>w", &LineRange{"'<", "'>"}, "w"},
+		{"%w", &LineRange{"1", "$"}, "w"},
+		{".,$w", &LineRange{".", "$"}, "w"},
+		{"5w", &LineRange{"5", "5"}, "w"},
+		{"5,w", &LineRange{"5", "5"}, "w"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			rng, rest := splitRange(tt.line)
+			if !reflect.DeepEqual(rng, tt.expected) || rest != tt.rest {
+				t.Errorf("expected %v, %q, got %v, %q", tt.expected, tt.rest, rng, rest)
+			}
+		})
+	}
+}
+
+func TestWriteRange(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(path, []byte("one\ntwo\nthree"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		setup    func(e *Editor)
+		command  string
+		expected string
+		err      error
+	}{
+		{"line numbers", nil, "2,3w out.txt", "two\nthree\n", nil},
+		{"backwards range", nil, "2,1w out.txt", "one\ntwo\n", nil},
+		{"selection", func(e *Editor) {
+			_ = e.SetCursor(0, 1, false)
+			_ = e.SetCursor(1, 3, true)
+		}, "'<,'>w out.txt", "one\ntwo\n", nil},
+		{"whole buffer", nil, "w out.txt", "one\ntwo\nthree", nil},
+		{"whole buffer with fixeol", func(e *Editor) {
+			e.SetFixEOLOnSave(true)
+		}, "w out.txt", "one\ntwo\nthree\n", nil},
+		{"append", func(e *Editor) {
+			_ = e.WriteRange(0, 0, filepath.Join(dir, "out.txt"))
+		}, "3w >> out.txt", "one\nthree\n", nil},
+		{"line out of range", nil, "2,5w out.txt", "", ErrInvalidRange},
+		{"range on a command without one", nil, "1,2noh", "", ErrNoRangeAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := filepath.Join(dir, "out.txt")
+			os.Remove(out)
+
+			e := NewEditor()
+			if err := e.OpenFile(path); err != nil {
+				t.Fatalf("OpenFile failed: %v", err)
+			}
+			if tt.setup != nil {
+				tt.setup(e)
+			}
+
+			err := e.Commands().Execute(strings.ReplaceAll(tt.command, "out.txt", out))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+
+			content, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatalf("failed to read the written file: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, content)
+			}
+			if e.current.IsDirty() || e.current.FilePath() != path {
+				t.Errorf("expected the buffer to stay clean and bound to %s", path)
+			}
+		})
+	}
+}
+
+func TestWriteRangeEncoding(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dos.txt")
+	if err := os.WriteFile(path, []byte("\xef\xbb\xbfone\r\ntwo\r\nthree"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	e := NewEditor()
+	if err := e.OpenFile(path); err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+
+	// the lines are written as saving would write them, and appending doesn't
+	// repeat the byte order mark
+	out := filepath.Join(dir, "out.txt")
+	for _, command := range []string{"2,3w " + out, "1w >> " + out} {
+		if err := e.Commands().Execute(command); err != nil {
+			t.Fatalf("%s failed: %v", command, err)
+		}
+	}
+	expected := "\xef\xbb\xbftwo\r\nthree\r\none\r\n"
+	if content, err := os.ReadFile(out); err != nil || string(content) != expected {
+		t.Errorf("expected %q, got %q (%v)", expected, content, err)
+	}
+
+	// a copy of the whole buffer matches the file it was read from
+	if err := e.Commands().Execute("w " + out); err != nil {
+		t.Fatalf("w failed: %v", err)
+	}
+	original, _ := os.ReadFile(path)
+	if content, err := os.ReadFile(out); err != nil || string(content) != string(original) {
+		t.Errorf("expected %q, got %q (%v)", original, content, err)
+	}
+}
+
+func TestSetFileEncodingCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(path, []byte("a\nb\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	e := NewEditor()
+	if err := e.OpenFile(path); err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+
+	tests := []struct {
+		command string
+		err     string
+	}{
+		{"set fileencoding=koi8", "Unsupported encoding: koi8"},
+		{"set ff=amiga", "Invalid fileformat: amiga"},
+		{"set tabs=4", "Unknown option: tabs"},
+		{"set fenc=UTF-16LE ff=dos", ""},
+	}
+	for _, tt := range tests {
+		err := e.Commands().Execute(tt.command)
+		if (err == nil && tt.err != "") || (err != nil && err.Error() != tt.err) {
+			t.Errorf("%s: expected error %q, got %v", tt.command, tt.err, err)
+		}
+	}
+
+	if encoding, format, _ := e.FileEncoding(); encoding != "utf-16le" || format != "dos" {
+		t.Errorf("expected utf-16le dos, got %s %s", encoding, format)
+	}
+	if len(e.DirtyBuffers()) != 1 {
+		t.Errorf("expected the buffer to be dirty after changing its encoding")
+	}
+	if err := e.SaveCurrentBuffer(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	content, _ := os.ReadFile(path)
+	expected := []byte{0xff, 0xfe, 'a', 0, '\r', 0, '\n', 0, 'b', 0, '\r', 0, '\n', 0}
+	if string(content) != string(expected) {
+		t.Errorf("expected %q on disk, got %q", expected, content)
+	}
+}
+
+func TestSubstituteCommand(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected string
+		message  string
+		err      string
+	}{
+		{"%s/ö/oe/", "schoen\nschoen schön\nbar", "2 substitutions", ""},
+		{"%s/ö/oe/g", "schoen\nschoen schoen\nbar", "3 substitutions", ""},
+		{"s/sch(ö)n/«$1»/", "«ö»\nschön schön\nbar", "1 substitution", ""},
+		{"2s#ö#/#g", "schön\nsch/n sch/n\nbar", "2 substitutions", ""},
+		{`%s/a\/r|b/ä/`, "schön\nschön schön\näar", "1 substitution", ""},
+		{"%substitute /bar/ba z", "schön\nschön schön\nba z", "1 substitution", ""},
+		{"%s/x/y/", "schön\nschön schön\nbar", "Pattern not found: x", ""},
+		{"s/(/x/", "schön\nschön schön\nbar", "", "Invalid pattern: ("},
+		{"s/a/b/q", "schön\nschön schön\nbar", "", "Invalid flag: q"},
+		{"s", "schön\nschön schön\nbar", "", "Argument required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			e := NewEditor()
+			e.NewScratchBuffer("*test*", "schön\nschön schön\nbar").SetReadOnly(false)
+
+			err := e.Commands().Execute(tt.command)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("expected error %q, got %v", tt.err, err)
+				}
+			} else if err != nil {
+				t.Fatalf("%s failed: %v", tt.command, err)
+			}
+
+			if got := e.current.Text(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if got := e.Message(); tt.err == "" && got != tt.message {
+				t.Errorf("expected message %q, got %q", tt.message, got)
+			}
+		})
+	}
+}
+
+func TestQuitAndBufferCommands(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	for _, path := range []string{a, b} {
+		if err := os.WriteFile(path, []byte("text\n"), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	e := NewEditor()
+	if err := e.OpenFile(a); err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+
+	run := func(command, expectedErr string) {
+		t.Helper()
+		err := e.Commands().Execute(command)
+		if expectedErr == "" && err != nil {
+			t.Fatalf("%s failed: %v", command, err)
+		}
+		if expectedErr != "" && (err == nil || err.Error() != expectedErr) {
+			t.Fatalf("%s: expected error %q, got %v", command, expectedErr, err)
+		}
+	}
+	expectCurrent := func(path string) {
+		t.Helper()
+		if got, _ := e.FilePath(); got != path {
+			t.Errorf("expected current buffer %s, got %s", path, got)
+		}
+	}
+
+	run("e", "Argument required")
+	run("e "+b, "")
+	expectCurrent(b)
+	run("b a.txt", "")
+	expectCurrent(a)
+	run("b .txt", "More than one match for .txt")
+	run("b nope", "No matching buffer for nope")
+
+	if err := e.current.Insert("x"); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	run("q", "No write since last change (add ! to override)")
+	expectCurrent(a)
+
+	run("wq", "")
+	expectCurrent(b)
+	if data, _ := os.ReadFile(a); string(data) != "xtext\n" {
+		t.Errorf("expected :wq to save %s, got %q", a, data)
+	}
+	if e.QuitRequested() {
+		t.Fatal("expected closing a buffer not to quit")
+	}
+
+	// :q! throws the changes away rather than writing them
+	run("e "+a, "")
+	if err := e.current.Insert("y"); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	run("q!", "")
+	expectCurrent(b)
+	if data, _ := os.ReadFile(a); string(data) != "xtext\n" {
+		t.Errorf("expected :q! to leave %s unchanged, got %q", a, data)
+	}
+
+	run("q", "")
+	if !e.QuitRequested() {
+		t.Error("expected :q on the last buffer to quit")
+	}
+}
+
+func TestExternalChangeCommands(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(path, []byte("one\ntwo\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	e := NewEditor()
+	if err := e.OpenFile(path); err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	run := func(command, expectedErr string) {
+		t.Helper()
+		err := e.Commands().Execute(command)
+		if expectedErr == "" && err != nil {
+			t.Fatalf("%s failed: %v", command, err)
+		}
+		if expectedErr != "" && (err == nil || err.Error() != expectedErr) {
+			t.Fatalf("%s: expected error %q, got %v", command, expectedErr, err)
+		}
+	}
+	expectFile := func(expected string) {
+		t.Helper()
+		if data, _ := os.ReadFile(path); string(data) != expected {
+			t.Errorf("expected the file to hold %q, got %q", expected, data)
+		}
+	}
+
+	_ = e.JumpToLine(1, false)
+	_ = e.current.Insert("x")
+	if err := os.WriteFile(path, []byte("changed\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	run("w", "File changed on disk since it was read (add ! to override)")
+	run("wq", "File changed on disk since it was read (add ! to override)")
+	expectFile("changed\n")
+
+	run("e!", "")
+	if line, _ := e.GetLine(0); line != "changed" {
+		t.Errorf("expected :e! to read the file again, got %q", line)
+	}
+	if line, col, _ := e.GetCurrentPosition(); line != 0 || col != 0 || e.current.IsDirty() {
+		t.Errorf("expected a clean buffer with the cursor at the start, got %d:%d (dirty %v)", line, col, e.current.IsDirty())
+	}
+
+	_ = e.current.Insert("x")
+	run("w", "")
+	expectFile("xchanged\n")
+
+	if err := os.WriteFile(path, []byte("again, from elsewhere\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	run("w!", "")
+	expectFile("xchanged\n")
+	run("w", "")
+}
+
+func TestWriteAllCommand(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	for _, path := range []string{first, second} {
+		if err := os.WriteFile(path, []byte("one\n"), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	e := NewEditor()
+	for _, path := range []string{first, second} {
+		if err := e.OpenFile(path); err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+		_ = e.current.Insert("x")
+	}
+	if err := os.WriteFile(second, []byte("changed\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	if err := e.Commands().Execute("wa"); err != nil {
+		t.Fatalf("wa failed: %v", err)
+	}
+	if msg := e.Message(); msg != "1 buffer written, 1 failed" {
+		t.Errorf("expected %q, got %q", "1 buffer written, 1 failed", msg)
+	}
+	logged := false
+	for _, entry := range e.Messages() {
+		if strings.Contains(entry.Text, second) && strings.Contains(entry.Text, buffer.ErrExternalChange.Error()) {
+			logged = true
+		}
+	}
+	if !logged {
+		t.Errorf("expected the failed write of %s to be logged, got %v", second, e.Messages())
+	}
+
+	// after reloading, both buffers are written again
+	if err := e.Commands().Execute("e!"); err != nil {
+		t.Fatalf("e! failed: %v", err)
+	}
+	for _, path := range []string{first, second} {
+		if err := e.SwitchBuffer(path); err != nil {
+			t.Fatalf("SwitchBuffer failed: %v", err)
+		}
+		_ = e.current.Insert("y")
+	}
+	if err := e.Commands().Execute("wa"); err != nil {
+		t.Fatalf("wa failed: %v", err)
+	}
+	if msg := e.Message(); msg != "2 buffers written" {
+		t.Errorf("expected %q, got %q", "2 buffers written", msg)
+	}
+}
+
+func TestSaveAsCommands(t *testing.T) {
+	dir := t.TempDir()
+	a, c := filepath.Join(dir, "a.txt"), filepath.Join(dir, "c.txt")
+	for _, path := range []string{a, c} {
+		if err := os.WriteFile(path, []byte("fn main() {}\n"), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	e := NewEditor()
+	for _, path := range []string{c, a} {
+		if err := e.OpenFile(path); err != nil {
+			t.Fatalf("OpenFile failed: %v", err)
+		}
+	}
+	run := func(command, expectedErr string) {
+		t.Helper()
+		err := e.Commands().Execute(command)
+		if expectedErr == "" && err != nil {
+			t.Fatalf("%s failed: %v", command, err)
+		}
+		if expectedErr != "" && (err == nil || err.Error() != expectedErr) {
+			t.Fatalf("%s: expected error %q, got %v", command, expectedErr, err)
+		}
+	}
+	expectFile := func(path string) {
+		t.Helper()
+		if data, err := os.ReadFile(path); err != nil || string(data) != "fn main() {}\n" {
+			t.Errorf("expected %s written, got %q (%v)", path, data, err)
+		}
+	}
+
+	// :w with a path writes a copy, creating its directories, and keeps the buffer's file
+	copyPath := filepath.Join(dir, "copies", "b.txt")
+	run("w "+copyPath, "")
+	expectFile(copyPath)
+	if path, _ := e.FilePath(); path != a {
+		t.Errorf("expected the buffer to keep %s, got %s", a, path)
+	}
+
+	run("saveas", "Argument required")
+	run("saveas "+c, "File is open in another buffer: "+c)
+
+	// writing a copy or a range doesn't clobber a file another buffer has open
+	for _, command := range []string{"w ", "1w ", "w >> "} {
+		run(command+c, "File is open in another buffer: "+c)
+	}
+
+	// an existing file that isn't the buffer's own is only replaced with !
+	d := filepath.Join(dir, "d.txt")
+	if err := os.WriteFile(d, []byte("keep\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	run("saveas "+d, "File exists (add ! to override)")
+	if data, _ := os.ReadFile(d); string(data) != "keep\n" {
+		t.Errorf("expected %s left alone, got %q", d, data)
+	}
+	if path, _ := e.FilePath(); path != a {
+		t.Errorf("expected the buffer to keep %s, got %s", a, path)
+	}
+	run("saveas "+a, "")
+	run("saveas! "+d, "")
+	expectFile(d)
+	if buffers := e.GetBufferList(); !slices.Contains(buffers, d) || slices.Contains(buffers, a) {
+		t.Errorf("expected the buffer keyed by %s only, got %v", d, buffers)
+	}
+
+	// :saveas moves the buffer over to the new file, detecting its language
+	rs := filepath.Join(dir, "src", "main.rs")
+	run("saveas "+rs, "")
+	expectFile(rs)
+	if path, _ := e.FilePath(); path != rs {
+		t.Errorf("expected the buffer bound to %s, got %s", rs, path)
+	}
+	buffers := e.GetBufferList()
+	if !slices.Contains(buffers, rs) || slices.Contains(buffers, a) {
+		t.Errorf("expected the buffer keyed by %s only, got %v", rs, buffers)
+	}
+	if !e.current.HasHighlighting() {
+		t.Error("expected the new extension to turn highlighting on")
+	}
+	if err := e.OpenFile(a); err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	if path, _ := e.FilePath(); path != a || len(e.GetBufferList()) != 3 {
+		t.Errorf("expected %s opened in a new buffer, got %s of %v", a, path, e.GetBufferList())
+	}
+}
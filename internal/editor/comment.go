@@ -0,0 +1,120 @@
+package editor
+
+import (
+	"errors"
+
+	"github.com/lg2m/athena/internal/editor/buffer"
+)
+
+// SetCommentResolver sets the function choosing the comment tokens of newly opened
+// buffers from their file name.
+func (e *Editor) SetCommentResolver(commentsFor func(fileName string) buffer.CommentTokens) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.commentsFor = commentsFor
+}
+
+// ToggleComment comments out or uncomments the selection, choosing the kind of
+// comment from the selection and the language's tokens: whole lines get line
+// comments, while a selection starting or ending within a line, or any selection in
+// a language without line comments, is wrapped in a block comment. Without a
+// selection, the cursor's line is toggled.
+func (e *Editor) ToggleComment() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if err := e.toggleComment(); err != nil {
+		return err
+	}
+	e.recordChange(1, func(int) error { return e.toggleComment() })
+	return nil
+}
+
+// toggleComment toggles comments on the selection or the cursor's line; the caller
+// must hold the lock.
+func (e *Editor) toggleComment() error {
+	tokens := e.current.CommentTokens()
+	first, last, whole, err := e.selectedLines()
+	if err != nil {
+		return err
+	}
+	if tokens.HasLine() && (whole || !tokens.HasBlock()) {
+		return commentError(e.current.ToggleLineComments(first, last))
+	}
+	return e.toggleBlockComment()
+}
+
+// ToggleBlockComment wraps the selection, or the cursor's line without one, in the
+// language's block comment tokens, or unwraps it when it's already a block comment.
+func (e *Editor) ToggleBlockComment() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if err := e.toggleBlockComment(); err != nil {
+		return err
+	}
+	e.recordChange(1, func(int) error { return e.toggleBlockComment() })
+	return nil
+}
+
+// toggleBlockComment toggles a block comment around the selection or the cursor's
+// line; the caller must hold the lock.
+func (e *Editor) toggleBlockComment() error {
+	selection := e.current.Selection()
+	start, end := min(selection.Start, selection.End), max(selection.Start, selection.End)
+	if start == end {
+		line, col, err := e.current.PositionToLineCol(start)
+		if err != nil {
+			return err
+		}
+		length, err := e.current.LineLength(line)
+		if err != nil {
+			return err
+		}
+		start -= col
+		end = start + length
+	}
+	return commentError(e.current.ToggleBlockComment(start, end))
+}
+
+// selectedLines returns the first and last lines of the selection, or the cursor's
+// line without one, and whether the selection covers those lines whole; the caller
+// must hold the lock.
+func (e *Editor) selectedLines() (int, int, bool, error) {
+	selection := e.current.Selection()
+	start, end := min(selection.Start, selection.End), max(selection.Start, selection.End)
+
+	first, startCol, err := e.current.PositionToLineCol(start)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if start == end {
+		return first, first, true, nil
+	}
+
+	// the selection's last grapheme may be the newline ending its last line
+	last, lastCol, err := e.current.PositionToLineCol(end - 1)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	length, err := e.current.LineLength(last)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return first, last, startCol == 0 && lastCol >= length-1, nil
+}
+
+// commentError turns a missing comment token into a message for the user.
+func commentError(err error) error {
+	if errors.Is(err, buffer.ErrNoCommentTokens) {
+		return errors.New("No comment tokens for this file type")
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package editor
+
+import (
+	"fmt"
+
+	"github.com/lg2m/athena/internal/editor/buffer"
+)
+
+// NextDiagnostic moves the cursor to the count-th diagnostic after it, wrapping
+// around the end of the buffer, and shows the diagnostic's message.
+func (e *Editor) NextDiagnostic(count int) error {
+	return e.jumpToDiagnostic(max(count, 1))
+}
+
+// PrevDiagnostic moves the cursor to the count-th diagnostic before it, wrapping
+// around the start of the buffer, and shows the diagnostic's message.
+func (e *Editor) PrevDiagnostic(count int) error {
+	return e.jumpToDiagnostic(-max(count, 1))
+}
+
+// jumpToDiagnostic moves offset diagnostics away from the cursor, forward when
+// offset is positive.
+func (e *Editor) jumpToDiagnostic(offset int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	diagnostics := e.current.Diagnostics()
+	if len(diagnostics) == 0 {
+		e.setMessage("No diagnostics")
+		return nil
+	}
+	line, col, err := e.current.PositionToLineCol(e.current.Selection().End)
+	if err != nil {
+		return err
+	}
+
+	// index of the first diagnostic after the cursor, and of the last one before it
+	after := len(diagnostics)
+	for i, d := range diagnostics {
+		if d.Line > line || d.Line == line && d.Col > col {
+			after = i
+			break
+		}
+	}
+	before := after - 1
+	for before >= 0 && diagnostics[before].Line == line && diagnostics[before].Col == col {
+		before--
+	}
+
+	var i int
+	if offset > 0 {
+		i = after + offset - 1
+	} else {
+		i = before + offset + 1
+	}
+	n := len(diagnostics)
+	d := diagnostics[(i%n+n)%n]
+
+	// diagnostics may be older than the last edits, so the position is clamped
+	target := min(d.Line, e.current.LineCount()-1)
+	e.recordJump()
+	if err := e.current.MoveSelectionToLineCol(target, d.Col, false); err != nil {
+		return err
+	}
+	e.setMessage(formatDiagnostic(d))
+	return e.trackColumn()
+}
+
+// formatDiagnostic renders a diagnostic for the message area, e.g.
+// "error: undefined: x".
+func formatDiagnostic(d buffer.Diagnostic) string {
+	return fmt.Sprintf("%s: %s", d.Severity, d.Message)
+}
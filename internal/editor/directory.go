@@ -0,0 +1,147 @@
+package editor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/lg2m/athena/internal/editor/buffer"
+)
+
+var ErrNotDirectoryListing = errors.New("not a directory listing")
+
+// DirEntry is an entry of a directory listing.
+type DirEntry struct {
+	Name  string
+	IsDir bool
+}
+
+// String returns the entry as it's listed, with a trailing slash for directories.
+func (d DirEntry) String() string {
+	if d.IsDir {
+		return d.Name + string(filepath.Separator)
+	}
+	return d.Name
+}
+
+// directoryListing is the directory shown in a listing buffer, one entry per line.
+type directoryListing struct {
+	path    string
+	entries []DirEntry
+}
+
+// ListDirectory returns the entries of a directory, directories first and each group
+// sorted by name, led by ".." unless path is the root. Dotfiles are skipped unless
+// showHidden is set.
+func ListDirectory(path string, showHidden bool) ([]DirEntry, error) {
+	files, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]DirEntry, 0, len(files)+1)
+	for _, f := range files {
+		if !showHidden && strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		isDir := f.IsDir()
+		// follow symlinks so linked directories can be entered
+		if f.Type()&os.ModeSymlink != 0 {
+			if info, err := os.Stat(filepath.Join(path, f.Name())); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+		entries = append(entries, DirEntry{Name: f.Name(), IsDir: isDir})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].IsDir != entries[j].IsDir {
+			return entries[i].IsDir
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	if filepath.Dir(path) != path {
+		entries = append([]DirEntry{{Name: "..", IsDir: true}}, entries...)
+	}
+	return entries, nil
+}
+
+// openDirectory shows the listing of the directory at absPath in a read-only buffer,
+// rebuilding it when it's already open; the caller must hold the lock.
+func (e *Editor) openDirectory(absPath string) error {
+	entries, err := ListDirectory(absPath, e.showHidden)
+	if err != nil {
+		return err
+	}
+
+	lines := make([]string, len(entries))
+	for i, entry := range entries {
+		lines[i] = entry.String()
+	}
+
+	if old, exists := e.buffers[absPath]; exists {
+		delete(e.directories, old)
+		e.recent = slices.DeleteFunc(e.recent, func(r *buffer.Buffer) bool { return r == old })
+	}
+
+	b := buffer.NewScratchBuffer(absPath+string(filepath.Separator), strings.Join(lines, "\n"))
+	e.buffers[absPath] = b
+	e.directories[b] = &directoryListing{path: absPath, entries: entries}
+	e.setCurrent(b)
+	return nil
+}
+
+// IsDirectoryListing reports whether the current buffer lists a directory.
+func (e *Editor) IsDirectoryListing() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	_, ok := e.directories[e.current]
+	return ok
+}
+
+// OpenEntryUnderCursor opens the entry on the cursor's line of a directory listing:
+// files open in a buffer and directories, ".." included, are listed in turn.
+func (e *Editor) OpenEntryUnderCursor() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	listing, ok := e.directories[e.current]
+	if !ok {
+		return ErrNotDirectoryListing
+	}
+
+	line, _, err := e.current.PositionToLineCol(e.current.Selection().End)
+	if err != nil {
+		return err
+	}
+	if line >= len(listing.entries) {
+		return nil
+	}
+
+	path := filepath.Clean(filepath.Join(listing.path, listing.entries[line].Name))
+	if listing.entries[line].IsDir {
+		return e.openDirectory(path)
+	}
+	return e.openFile(path)
+}
+
+// ToggleHiddenFiles shows or hides dotfiles in directory listings, refreshing the
+// current listing.
+func (e *Editor) ToggleHiddenFiles() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.showHidden = !e.showHidden
+	if listing, ok := e.directories[e.current]; ok {
+		return e.openDirectory(listing.path)
+	}
+	return nil
+}
@@ -2,12 +2,20 @@ package editor
 
 import (
 	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/lg2m/athena/internal/editor/buffer"
 	"github.com/lg2m/athena/internal/editor/state"
 	"github.com/lg2m/athena/internal/editor/treesitter"
+	"github.com/lg2m/athena/internal/util"
+	"github.com/rivo/uniseg"
 )
 
 var (
@@ -16,27 +24,72 @@ var (
 	ErrBufferNotFound   = errors.New("buffer not found")
 	ErrInvalidOperation = errors.New("invalid operation for current mode")
 	ErrUnsavedChanges   = errors.New("unsaved changes exist")
+	ErrBufferOpen       = errors.New("buffer already open")
+	ErrFileExists       = errors.New("file already exists")
+	ErrInvalidRange     = errors.New("invalid range")
 )
 
+// findCharMotion records the last f/t/F/T motion for repetition.
+type findCharMotion struct {
+	ch      string
+	forward bool
+	till    bool
+}
+
 // Editor represents the main editor application.
 type Editor struct {
 	buffers       map[string]*buffer.Buffer // keys by absolute file path
 	current       *buffer.Buffer
+	recent        []*buffer.Buffer // open buffers, least recently used first
 	mode          state.EditorMode
-	desiredColumn int // track movement
+	desiredColumn int    // column vertical moves aim for, -1 to use the cursor's; see trackColumn
+	message       string // transient message shown in the status area
+	messages      *messageLog
+	showMessages  bool                                 // whether the message log panel is open
+	directories   map[*buffer.Buffer]*directoryListing // listing buffers and the directory each shows
+	showHidden    bool                                 // whether directory listings include dotfiles
+	searchPattern string                               // last search pattern
+	hlsearch      bool                                 // whether matches of searchPattern are highlighted
+	wholeWord     bool                                 // whether searchPattern only matches whole words
+	searchForward bool                                 // direction of the last search, which n repeats
+	search        *searchSession                       // search being typed at the prompt, nil otherwise
+	lastFind      *findCharMotion
+	jumps         jumpList       // positions before large motions, for JumpBack and JumpForward
+	insert        *insertSession // insert being typed, nil outside insert mode
+	lastChange    *change        // last change, repeated by .
+	largeFile     int64          // size in bytes above which files open in chunked mode
+	fixEOLOnSave  bool           // whether saving normalizes the trailing newline
+	maxUndo       int            // undo steps kept per buffer, 0 for no limit
+	redraw        func()         // redraws the screen from outside the event loop, nil for none
+	indentFor     func(fileName string) buffer.Indentation
+	commentsFor   func(fileName string) buffer.CommentTokens
+	syntaxFor     func(fileName string) bool
+	clipboard     util.Clipboard
+	registers     map[rune]string // yanked text by register name
+	register      rune            // register the next yank or paste uses, 0 for the unnamed one
+	commands      *CommandRegistry
+	quit          bool // whether the last buffer was closed with :q
 	mu            sync.RWMutex
 }
 
 // NewEditor initializes a new Editor instance.
 func NewEditor() *Editor {
-	return &Editor{
+	e := &Editor{
 		buffers:       make(map[string]*buffer.Buffer),
+		directories:   make(map[*buffer.Buffer]*directoryListing),
 		mode:          state.Normal,
 		desiredColumn: -1,
+		clipboard:     util.NewClipboard(),
+		registers:     make(map[rune]string),
+		commands:      NewCommandRegistry(),
+		messages:      newMessageLog(MessageLogSize),
 	}
+	e.registerBuiltinCommands()
+	return e
 }
 
-// OpenFile opens a file and adds it to the buffer manager.
+// OpenFile opens a file and adds it to the buffer manager. A directory opens
+// as a listing of its entries.
 func (e *Editor) OpenFile(filePath string) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -45,24 +98,169 @@ func (e *Editor) OpenFile(filePath string) error {
 	if err != nil {
 		return err
 	}
+	return e.openFile(absPath)
+}
 
+// openFile opens the file or directory at absPath; the caller must hold the lock.
+func (e *Editor) openFile(absPath string) error {
 	// check if buffer exists
 	if b, exists := e.buffers[absPath]; exists {
-		e.current = b
+		e.setCurrent(b)
 		return nil
 	}
 
+	if info, err := os.Stat(absPath); err == nil && info.IsDir() {
+		return e.openDirectory(absPath)
+	}
+
 	// create new buffer
-	b, err := buffer.NewBuffer(absPath)
+	syntax := e.syntaxFor == nil || e.syntaxFor(absPath)
+	b, err := buffer.NewBuffer(absPath, e.largeFile, syntax)
 	if err != nil {
 		return err
 	}
 
+	if e.indentFor != nil {
+		b.SetIndentation(e.indentFor(absPath))
+	}
+	if e.commentsFor != nil {
+		b.SetCommentTokens(e.commentsFor(absPath))
+	}
+	b.SetMaxUndo(e.maxUndo)
+	b.SetOnDiff(e.redraw)
+
 	e.buffers[absPath] = b
-	e.current = b
+	e.setCurrent(b)
 	return nil
 }
 
+// SetLargeFileThreshold sets the size in bytes above which files are opened in chunked mode.
+// A threshold of 0 disables chunked mode.
+func (e *Editor) SetLargeFileThreshold(threshold int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.largeFile = threshold
+}
+
+// SetMaxUndo sets the number of undo steps kept per buffer, the oldest being dropped
+// first; 0 keeps them all.
+func (e *Editor) SetMaxUndo(max int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.maxUndo = max
+	for _, b := range e.buffers {
+		b.SetMaxUndo(max)
+	}
+}
+
+// SetRedraw sets the function called to redraw the screen when a buffer's changed
+// lines are diffed in the background.
+func (e *Editor) SetRedraw(redraw func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.redraw = redraw
+	for _, b := range e.buffers {
+		b.SetOnDiff(redraw)
+	}
+}
+
+// IsChunked reports whether the current buffer was opened in chunked mode.
+func (e *Editor) IsChunked() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.current != nil && e.current.IsChunked()
+}
+
+// IsLossyDecoded reports whether invalid UTF-8 in the current buffer's file was
+// replaced with U+FFFD on load.
+func (e *Editor) IsLossyDecoded() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.current != nil && e.current.IsLossyDecoded()
+}
+
+// FileEncoding returns the encoding and the line endings the current buffer is
+// written with.
+func (e *Editor) FileEncoding() (string, string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.current == nil {
+		return "", "", ErrNoBuffer
+	}
+	return e.current.FileEncoding(), e.current.FileFormat(), nil
+}
+
+// Encoding returns the encoding the current buffer is written in.
+func (e *Editor) Encoding() (string, error) {
+	encoding, _, err := e.FileEncoding()
+	return encoding, err
+}
+
+// SetFileEncoding changes the encoding the current buffer is written in on the next save.
+func (e *Editor) SetFileEncoding(encoding string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	return e.current.SetFileEncoding(encoding)
+}
+
+// SetFileFormat changes the line endings the current buffer is written with on the
+// next save.
+func (e *Editor) SetFileFormat(format string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	return e.current.SetFileFormat(format)
+}
+
+// ModifiedDuration returns how long the current buffer has had unsaved changes,
+// or 0 when it has none.
+func (e *Editor) ModifiedDuration() time.Duration {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.current == nil {
+		return 0
+	}
+	return e.current.ModifiedDuration()
+}
+
+// NewScratchBuffer creates a read-only buffer that is not backed by a file and makes it current.
+// When a buffer named name is already open, it is made current and returned as is.
+func (e *Editor) NewScratchBuffer(name string, content string) *buffer.Buffer {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if b, exists := e.buffers[name]; exists {
+		e.setCurrent(b)
+		return b
+	}
+
+	b := buffer.NewScratchBuffer(name, content)
+	if e.indentFor != nil {
+		b.SetIndentation(e.indentFor(name))
+	}
+	if e.commentsFor != nil {
+		b.SetCommentTokens(e.commentsFor(name))
+	}
+	b.SetMaxUndo(e.maxUndo)
+	e.buffers[name] = b
+	e.setCurrent(b)
+	return b
+}
+
 // FileName returns the file name related to the current active buffer.
 func (e *Editor) FileName() (string, error) {
 	if e.current == nil {
@@ -97,10 +295,51 @@ func (e *Editor) SwitchBuffer(filePath string) error {
 		return err
 	}
 
-	e.current = b
+	e.setCurrent(b)
 	return nil
 }
 
+// SwitchBufferByName switches to the open buffer whose file name is name, or
+// failing that, the only one whose path contains it.
+func (e *Editor) SwitchBufferByName(name string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if b, err := e.getBuffer(name); err == nil {
+		e.setCurrent(b)
+		return nil
+	}
+
+	var named, partial []*buffer.Buffer
+	for path, b := range e.buffers {
+		switch {
+		case filepath.Base(path) == name:
+			named = append(named, b)
+		case strings.Contains(path, name):
+			partial = append(partial, b)
+		}
+	}
+	if len(named) == 0 {
+		named = partial
+	}
+	switch len(named) {
+	case 0:
+		return fmt.Errorf("No matching buffer for %s", name)
+	case 1:
+		e.setCurrent(named[0])
+		return nil
+	}
+	return fmt.Errorf("More than one match for %s", name)
+}
+
+// setCurrent makes b the current buffer and the most recently used one;
+// the caller must hold the lock.
+func (e *Editor) setCurrent(b *buffer.Buffer) {
+	e.recent = slices.DeleteFunc(e.recent, func(r *buffer.Buffer) bool { return r == b })
+	e.recent = append(e.recent, b)
+	e.current = b
+}
+
 // GetBufferList returns a list of all open buffer file paths
 func (e *Editor) GetBufferList() []string {
 	e.mu.RLock()
@@ -116,122 +355,181 @@ func (e *Editor) GetBufferList() []string {
 
 // GetMode returns the current mode state.
 func (e *Editor) GetMode() state.EditorMode {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
 	return e.mode
 }
 
 // SetMode sets the current editor mode state.
+// Entering insert mode starts an insert session as with BeginInsert(InsertBefore, 1)
+// and forgets the desired column, since typing moves the cursor. Leaving it ends
+// the session.
 func (e *Editor) SetMode(mode state.EditorMode) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	switch {
+	case mode == state.Insert && e.mode != state.Insert && e.current != nil:
+		e.beginInsert(InsertBefore, 1)
+	case mode != state.Insert && e.mode == state.Insert:
+		e.endInsert()
+	}
+	if e.current != nil {
+		// everything typed in replace mode is undone at once
+		switch {
+		case mode == state.Replace && e.mode != state.Replace:
+			e.current.CollapseSelectionsToCursor()
+			e.current.BeginUndoGroup()
+		case mode != state.Replace && e.mode == state.Replace:
+			e.current.EndUndoGroup()
+		}
+	}
+	if e.current != nil {
+		switch {
+		case mode == state.Visual && e.mode != state.Visual:
+			// the selection grows from the cursor
+			e.current.CollapseSelectionsToCursor()
+		case mode != state.Visual && e.mode == state.Visual:
+			e.current.SaveVisualSelection()
+			e.current.CollapseSelectionsToCursor()
+		}
+	}
+	if mode == state.Insert {
+		e.desiredColumn = -1
+	}
 	e.mode = mode
 }
 
-// InsertText inserts text at the cursor position in the current buffer.
-func (e *Editor) InsertText(text string) error {
+// ReselectVisual restores the last visual selection of the current buffer and enters
+// visual mode, as it was when visual mode was left.
+func (e *Editor) ReselectVisual() error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
 	if e.current == nil {
 		return ErrNoBuffer
 	}
-
-	// TODO: may not be desirable
-	if e.mode != state.Insert {
-		return ErrInvalidOperation
+	selection, ok := e.current.LastVisualSelection()
+	if !ok {
+		e.setMessage("No previous visual selection")
+		return nil
+	}
+	if e.mode == state.Insert {
+		e.endInsert()
+	}
+	if err := e.current.MoveSelectionTo(selection.Start, false); err != nil {
+		return err
+	}
+	if err := e.current.MoveSelectionTo(selection.End, true); err != nil {
+		return err
 	}
+	e.mode = state.Visual
+	return e.trackColumn()
+}
 
-	e.current.CollapseSelectionsToCursor()
+// Message returns the current status message.
+func (e *Editor) Message() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
 
-	return e.current.Insert(text)
+	return e.message
 }
 
-func (e *Editor) DeleteSelection() error {
+// SetMessage sets the status message and records it in the message log;
+// an empty string clears it.
+func (e *Editor) SetMessage(msg string) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	if e.current == nil {
-		return ErrNoBuffer
-	}
-
-	return e.current.DeleteSelection()
+	e.setMessage(msg)
 }
 
-// DeleteText deletes text of specified length from the cursor position.
-func (e *Editor) DeleteText(length int) error {
+// SetSearchPattern sets the active search pattern and re-enables its highlighting.
+func (e *Editor) SetSearchPattern(pattern string) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	if e.current == nil {
-		return ErrNoBuffer
-	}
-
-	selection := e.current.Selection()
-	pos := selection.End
-
-	if length < 0 {
-		// Handle backward delete
-		pos += length
-		length = -length
-	}
-
-	return e.current.Delete(pos, pos+length)
+	e.searchPattern = pattern
+	e.hlsearch = pattern != ""
+	e.wholeWord = false
 }
 
-// GetCurrentPosition retrieves the current line and column of the cursor.
-func (e *Editor) GetCurrentPosition() (int, int, error) {
-	selection := e.current.Selection()
-	pos := selection.End
-	return e.current.PositionToLineCol(pos)
+// SearchPattern returns the last search pattern, even when its highlighting is cleared.
+func (e *Editor) SearchPattern() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.searchPattern
 }
 
-// LineCol retrieves the current line and column of a position.
-func (e *Editor) LineCol(pos int) (int, int, error) {
+// SearchHighlight returns the pattern whose matches should be highlighted, or "" when none.
+// Chunked buffers are never highlighted.
+func (e *Editor) SearchHighlight() string {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	if e.current == nil {
-		return 0, 0, ErrNoBuffer
+	if !e.hlsearch || (e.current != nil && e.current.IsChunked()) {
+		return ""
 	}
-	return e.current.PositionToLineCol(pos)
+	return e.searchPattern
 }
 
-// Selection retrieves the current selection in the active buffer.
-func (e *Editor) Selection() (state.Selection, error) {
+// SearchWholeWord reports whether the search pattern only matches whole words.
+func (e *Editor) SearchWholeWord() bool {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	if e.current == nil {
-		return state.Selection{}, ErrNoBuffer
-	}
-	return e.current.Selection(), nil
+	return e.wholeWord
 }
 
-// MoveCursorHorizontal moves the cursor horizontally in the current buffer.
-func (e *Editor) MoveCursorHorizontal(offset int, extend bool) error {
+// SearchWordUnderCursor searches for the word under the cursor as a whole word and
+// jumps to its next occurrence, or the previous one when backward, wrapping around
+// the buffer. It does nothing when the cursor isn't on a word.
+func (e *Editor) SearchWordUnderCursor(forward bool) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
 	if e.current == nil {
 		return ErrNoBuffer
 	}
-
-	if err := e.current.MoveSelections(offset, extend); err != nil {
-		return err
+	if e.searchDisabled() {
+		return nil
 	}
 
-	// Update desiredColumn based on the selection's end position
-	selection := e.current.Selection()
+	word, start, ok := e.current.WordAt(e.current.Selection().End)
+	if !ok {
+		return nil
+	}
+	e.searchPattern, e.hlsearch, e.wholeWord = word, true, true
+	e.searchForward = forward
 
-	pos := selection.End
-	_, col, err := e.current.PositionToLineCol(pos)
-	if err != nil {
+	match, wrapped, found := e.current.FindWord(word, start, forward)
+	if !found {
+		return nil
+	}
+	if wrapped && forward {
+		e.setMessage("search hit BOTTOM, continuing at TOP")
+	} else if wrapped {
+		e.setMessage("search hit TOP, continuing at BOTTOM")
+	}
+	e.recordJump()
+	if err := e.current.MoveSelectionTo(match, false); err != nil {
 		return err
 	}
+	return e.trackColumn()
+}
 
-	e.desiredColumn = col
-	return nil
+// ClearSearchHighlight hides search highlighting without forgetting the pattern or moving the cursor.
+func (e *Editor) ClearSearchHighlight() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.hlsearch = false
 }
 
-// JumpFromCursor moves the cursor a specified number of lines relative to the current cursor position while maintaining the column position.
-func (e *Editor) JumpFromCursor(offset int, extend bool) error {
+// InsertText inserts text at the cursor position in the current buffer.
+func (e *Editor) InsertText(text string) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
@@ -239,106 +537,991 @@ func (e *Editor) JumpFromCursor(offset int, extend bool) error {
 		return ErrNoBuffer
 	}
 
-	// get current pos
-	selection := e.current.Selection()
-	currLine, currCol, err := e.current.PositionToLineCol(selection.End)
-	if err != nil {
-		return err
+	// TODO: may not be desirable
+	if e.mode != state.Insert {
+		return ErrInvalidOperation
 	}
 
-	// calc target line
-	targetLine := currLine + offset
+	e.current.CollapseSelectionsToCursor()
 
-	// bounds check
-	if targetLine < 0 {
-		targetLine = 0
+	return e.current.Insert(text)
+}
+
+// InsertNewline breaks the line at the cursor, in replace mode as well. With
+// autoIndent, the new line starts with the indentation of the line broken.
+func (e *Editor) InsertNewline(autoIndent bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
 	}
-	totalLines := e.current.LineCount()
-	if targetLine >= totalLines {
-		targetLine = totalLines - 1
+	if e.mode != state.Insert && e.mode != state.Replace {
+		return ErrInvalidOperation
 	}
 
-	if e.desiredColumn == -1 {
-		e.desiredColumn = currCol
+	e.current.CollapseSelectionsToCursor()
+	if autoIndent {
+		return e.current.InsertNewlineWithIndent()
 	}
+	return e.current.Insert("\n")
+}
 
-	return e.current.MoveSelectionToLineCol(targetLine, e.desiredColumn, extend)
+// autoPairs maps the characters that open a pair to the character closing it.
+var autoPairs = map[string]string{
+	"(": ")", "[": "]", "{": "}",
+	`"`: `"`, "'": "'", "`": "`",
 }
 
-// JumpToLine moves the cursor to a specific line number (0-based) and attempts to retain column position (when possible).
-func (e *Editor) JumpToLine(lineNum int, extend bool) error {
+// InsertAutoPair types ch, inserting the closing character as well when ch opens a
+// pair and stepping over the next character when it's the closer being typed. With
+// contextAware, pairs aren't completed inside strings and comments.
+func (e *Editor) InsertAutoPair(ch string, contextAware bool) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
 	if e.current == nil {
 		return ErrNoBuffer
 	}
-
-	// bounds check
-	if lineNum < 0 {
-		lineNum = 0
-	}
-	totalLines := e.current.LineCount()
-	if lineNum >= totalLines {
-		lineNum = totalLines - 1
+	if e.mode != state.Insert {
+		return ErrInvalidOperation
 	}
 
-	// current column for maintaining desired column
-	selection := e.current.Selection()
-	_, currCol, err := e.current.PositionToLineCol(selection.End)
-	if err != nil {
-		return err
+	e.current.CollapseSelectionsToCursor()
+	pos := e.current.Selection().End
+
+	// type over the closer that was inserted with its opener
+	if next, err := e.current.GraphemeAt(pos); err == nil && next == ch && isAutoPairCloser(ch) {
+		return e.current.MoveSelections(1, false)
 	}
 
-	if e.desiredColumn == -1 {
-		e.desiredColumn = currCol
+	closing, ok := autoPairs[ch]
+	if !ok || contextAware && e.current.InStringOrComment(pos) {
+		return e.current.Insert(ch)
 	}
 
-	return e.current.MoveSelectionToLineCol(lineNum, e.desiredColumn, extend)
+	if err := e.current.Insert(ch + closing); err != nil {
+		return err
+	}
+	// back between the pair, at every cursor
+	return e.current.MoveSelections(-1, false)
 }
 
-// JumpToTop moves the cursor to the beginning of the document.
-func (e *Editor) JumpToTop(extend bool) error {
-	e.mu.Lock()
-	defer e.mu.Unlock()
-	if e.current == nil {
-		return ErrNoBuffer
+// isAutoPairCloser reports whether ch closes one of the auto pairs.
+func isAutoPairCloser(ch string) bool {
+	for _, closing := range autoPairs {
+		if closing == ch {
+			return true
+		}
 	}
-	return e.current.MoveSelectionToLineCol(0, 0, extend)
+	return false
 }
 
-// JumpToBottom moves the cursor to the end of the document.
-func (e *Editor) JumpToBottom(extend bool) error {
+func (e *Editor) DeleteSelection() error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+
 	if e.current == nil {
 		return ErrNoBuffer
 	}
-	lastLine := e.current.LineCount() - 1
-	return e.current.MoveSelectionToLineCol(lastLine, 0, extend)
+
+	return e.current.DeleteSelection()
 }
 
-// MoveToNextWord moves the cursor to the beginning of the next word boundary.
-func (e *Editor) MoveToNextWord(extend bool) error {
+// DeleteText deletes text of specified length from every cursor, backwards when
+// length is negative.
+func (e *Editor) DeleteText(length int) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+
 	if e.current == nil {
 		return ErrNoBuffer
 	}
-	return e.current.MoveToNextWord(extend)
+
+	return e.current.DeleteAtSelections(length)
 }
 
-// MoveToPrevWord moves the cursor to the beginning of the previous word boundary.
-func (e *Editor) MoveToPrevWord(extend bool) error {
+// DeleteSoftTab deletes backwards from the cursor like DeleteText(-1), except that
+// within a line's leading spaces it removes spaces back to the previous multiple of stop.
+// With several cursors, it's DeleteText(-1).
+func (e *Editor) DeleteSoftTab(stop int) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+
 	if e.current == nil {
 		return ErrNoBuffer
 	}
-	return e.current.MoveToPrevWord(extend)
-}
+	if selections, _ := e.current.Selections(); len(selections) > 1 {
+		return e.current.DeleteAtSelections(-1)
+	}
 
-// SaveCurrentBuffer saves the current buffer.
+	pos := e.current.Selection().End
+	line, col, err := e.current.PositionToLineCol(pos)
+	if err != nil {
+		return err
+	}
+	text, err := e.current.GetLine(line)
+	if err != nil {
+		return err
+	}
+
+	length := 1
+	leading := len(text) - len(strings.TrimLeft(text, " "))
+	if stop > 0 && col > 0 && col <= leading {
+		if length = col % stop; length == 0 {
+			length = stop
+		}
+	}
+
+	return e.current.Delete(pos-length, pos)
+}
+
+// DeletePair deletes inside (or around) the pair enclosing the cursor: a bracket,
+// a quote, or "t" for a markup tag. The cursor is left where the deleted text began.
+func (e *Editor) DeletePair(pair string, inner bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if err := e.deletePair(pair, inner); err != nil {
+		return err
+	}
+	e.recordChange(1, func(int) error { return e.deletePair(pair, inner) })
+	return nil
+}
+
+// deletePair deletes inside or around the pair enclosing the cursor; the caller
+// must hold the lock.
+func (e *Editor) deletePair(pair string, inner bool) error {
+	start, end, err := e.current.PairRange(e.current.Selection().End, pair, inner)
+	if err != nil {
+		return err
+	}
+	if err := e.current.Delete(start, end); err != nil {
+		return err
+	}
+	e.desiredColumn = -1
+	return e.current.MoveSelectionTo(start, false)
+}
+
+// JoinLines joins count lines from the cursor's line into one, as J does, counts
+// below 2 joining the cursor's line with the next. The joins are undone as a single
+// step, and joining on the last line does nothing.
+func (e *Editor) JoinLines(count int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if err := e.joinLines(count); err != nil {
+		return err
+	}
+	e.recordChange(count, e.joinLines)
+	return nil
+}
+
+// joinLines joins count lines from the cursor's line; the caller must hold the lock.
+func (e *Editor) joinLines(count int) error {
+	line, _, err := e.current.PositionToLineCol(e.current.Selection().End)
+	if err != nil {
+		return err
+	}
+
+	e.current.BeginUndoGroup()
+	defer e.current.EndUndoGroup()
+
+	for range max(count-1, 1) {
+		if err := e.current.JoinLines(line); err != nil {
+			return err
+		}
+	}
+	return e.trackColumn()
+}
+
+// IndentLines indents count lines from the cursor's line by one level, as a single
+// undo step.
+func (e *Editor) IndentLines(count int) error {
+	return e.shiftLines(count, (*buffer.Buffer).IndentLine)
+}
+
+// DedentLines removes one level of indentation from count lines from the cursor's
+// line, as a single undo step.
+func (e *Editor) DedentLines(count int) error {
+	return e.shiftLines(count, (*buffer.Buffer).DedentLine)
+}
+
+// shiftLines applies shift to count lines from the cursor's line and records it as
+// the last change.
+func (e *Editor) shiftLines(count int, shift func(b *buffer.Buffer, lineNum, width int) error) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	run := func(count int) error {
+		line, _, err := e.current.PositionToLineCol(e.current.Selection().End)
+		if err != nil {
+			return err
+		}
+
+		e.current.BeginUndoGroup()
+		defer e.current.EndUndoGroup()
+
+		width := e.current.Indentation().TabWidth
+		for l := line; l < min(line+max(count, 1), e.current.LineCount()); l++ {
+			if err := shift(e.current, l, width); err != nil {
+				return err
+			}
+		}
+		return e.trackColumn()
+	}
+	if err := run(count); err != nil {
+		return err
+	}
+	e.recordChange(count, run)
+	return nil
+}
+
+// SetClipboard replaces the clipboard used for copy and paste.
+func (e *Editor) SetClipboard(clipboard util.Clipboard) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.clipboard = clipboard
+}
+
+// HasSelection reports whether the current selection spans any text.
+func (e *Editor) HasSelection() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.current == nil {
+		return false
+	}
+	selection := e.current.Selection()
+	return selection.Start != selection.End
+}
+
+// SelectionInfo returns the number of graphemes in the selection and the number of
+// lines it spans, counting the line of its last grapheme. Both are 0 when nothing
+// is selected.
+func (e *Editor) SelectionInfo() (int, int) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.current == nil {
+		return 0, 0
+	}
+	selection := e.current.Selection()
+	start, end := min(selection.Start, selection.End), max(selection.Start, selection.End)
+	if start == end {
+		return 0, 0
+	}
+
+	startLine, _, err1 := e.current.PositionToLineCol(start)
+	endLine, _, err2 := e.current.PositionToLineCol(end - 1)
+	if err1 != nil || err2 != nil {
+		return 0, 0
+	}
+	return end - start, endLine - startLine + 1
+}
+
+// CopySelection writes the selected text to the clipboard.
+func (e *Editor) CopySelection() error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+
+	selection := e.current.Selection()
+	start, end := min(selection.Start, selection.End), max(selection.Start, selection.End)
+	text, err := e.current.Substring(start, end)
+	if err != nil {
+		return err
+	}
+	return e.clipboard.Write(text)
+}
+
+// PasteClipboard inserts the clipboard's text at the cursor, in any mode.
+func (e *Editor) PasteClipboard() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+
+	text, err := e.clipboard.Read()
+	if err != nil {
+		return err
+	}
+	e.current.CollapseSelectionsToCursor()
+	return e.current.Insert(text)
+}
+
+// SetCursor moves the cursor to a line and column, e.g. for a mouse click.
+func (e *Editor) SetCursor(line, col int, extend bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+
+	if err := e.current.MoveSelectionToLineCol(line, col, extend); err != nil {
+		return err
+	}
+	return e.trackColumn()
+}
+
+// GetCurrentPosition retrieves the current line and column of the cursor.
+func (e *Editor) GetCurrentPosition() (int, int, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.current == nil {
+		return 0, 0, ErrNoBuffer
+	}
+	return e.current.PositionToLineCol(e.current.Selection().End)
+}
+
+// VirtualColumn returns the screen column of the cursor on its line, with tabs
+// expanded to the current buffer's tab width and wide characters taking two columns.
+func (e *Editor) VirtualColumn() (int, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.current == nil {
+		return 0, ErrNoBuffer
+	}
+	return e.current.VirtualColumn(e.current.Selection().End)
+}
+
+// LineCol retrieves the current line and column of a position.
+func (e *Editor) LineCol(pos int) (int, int, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.current == nil {
+		return 0, 0, ErrNoBuffer
+	}
+	return e.current.PositionToLineCol(pos)
+}
+
+// Selection retrieves the current selection in the active buffer.
+func (e *Editor) Selection() (state.Selection, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.current == nil {
+		return state.Selection{}, ErrNoBuffer
+	}
+	return e.current.Selection(), nil
+}
+
+// Selections returns the selections of the current buffer, ordered by position, and
+// the index of the primary one.
+func (e *Editor) Selections() ([]state.Selection, int, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.current == nil {
+		return nil, 0, ErrNoBuffer
+	}
+	selections, primary := e.current.Selections()
+	return selections, primary, nil
+}
+
+// AddCursorBelow adds a cursor on the line below the last one, at the same column.
+func (e *Editor) AddCursorBelow() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if err := e.current.AddSelectionBelow(); err != nil {
+		return err
+	}
+	return e.trackColumn()
+}
+
+// KeepPrimaryCursor removes every cursor but the primary one.
+func (e *Editor) KeepPrimaryCursor() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	e.current.KeepPrimarySelection()
+	return nil
+}
+
+// MatchingBracket returns the position of the bracket matching the one under the cursor.
+// When adjacent is true, a bracket immediately before the cursor is matched as well.
+func (e *Editor) MatchingBracket(adjacent bool) (int, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.current == nil {
+		return 0, false
+	}
+
+	pos := e.current.Selection().End
+	if match, ok := e.current.MatchingBracket(pos); ok {
+		return match, true
+	}
+	if adjacent && pos > 0 {
+		return e.current.MatchingBracket(pos - 1)
+	}
+	return 0, false
+}
+
+// JumpToMatchingBracket moves the cursor to the bracket matching the one under it,
+// staying put when it isn't on a bracket or the bracket is unmatched.
+func (e *Editor) JumpToMatchingBracket(extend bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	match, ok := e.current.MatchingBracket(e.current.Selection().End)
+	if !ok {
+		return nil
+	}
+	e.recordJump()
+	if err := e.current.MoveSelectionTo(match, extend); err != nil {
+		return err
+	}
+	return e.trackColumn()
+}
+
+// MoveCursorHorizontal moves the cursor horizontally in the current buffer.
+func (e *Editor) MoveCursorHorizontal(offset int, extend bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+
+	if err := e.current.MoveSelections(offset, extend); err != nil {
+		return err
+	}
+	return e.trackColumn()
+}
+
+// trackColumn makes the cursor's column the one later vertical moves aim for;
+// the caller must hold the lock. Horizontal moves and jumps to a column call it,
+// while vertical moves and line jumps keep the desired column through
+// verticalColumn, so crossing a short line doesn't lose it. Edits and entering
+// insert mode reset it to -1, after which the cursor's column is used.
+func (e *Editor) trackColumn() error {
+	_, col, err := e.current.PositionToLineCol(e.current.Selection().End)
+	if err != nil {
+		return err
+	}
+	e.desiredColumn = col
+	return nil
+}
+
+// verticalColumn returns the column a vertical move from currCol aims for, taking
+// currCol as the desired column when none is set; the caller must hold the lock.
+func (e *Editor) verticalColumn(currCol int) int {
+	if e.desiredColumn == -1 {
+		e.desiredColumn = currCol
+	}
+	return e.desiredColumn
+}
+
+// JumpFromCursor moves the cursor a specified number of lines relative to the current cursor position while maintaining the column position.
+func (e *Editor) JumpFromCursor(offset int, extend bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+
+	// every cursor moves along, each keeping its own column
+	if selections, _ := e.current.Selections(); len(selections) > 1 {
+		return e.current.MoveSelectionsByLines(offset, extend)
+	}
+
+	// get current pos
+	selection := e.current.Selection()
+	currLine, currCol, err := e.current.PositionToLineCol(selection.End)
+	if err != nil {
+		return err
+	}
+
+	// calc target line
+	targetLine := currLine + offset
+
+	// bounds check
+	if targetLine < 0 {
+		targetLine = 0
+	}
+	totalLines := e.current.LineCount()
+	if targetLine >= totalLines {
+		targetLine = totalLines - 1
+	}
+
+	// step over closed folds rather than landing inside them
+	if start, end, ok := e.current.FoldContaining(targetLine); ok {
+		if offset > 0 && end+1 < totalLines {
+			targetLine = end + 1
+		} else {
+			targetLine = start
+		}
+	}
+
+	return e.current.MoveSelectionToLineCol(targetLine, e.verticalColumn(currCol), extend)
+}
+
+// displayColumns returns the screen column each grapheme of line starts at, followed
+// by the width of the whole line, as the view lays it out; the caller must hold the
+// lock.
+func (e *Editor) displayColumns(line int) []int {
+	text, _ := e.current.GetLine(line)
+	tabWidth := e.current.Indentation().TabWidth
+	cols := []int{0}
+	gr := uniseg.NewGraphemes(text)
+	for gr.Next() {
+		cols = append(cols, buffer.AdvanceColumn(cols[len(cols)-1], gr.Str(), tabWidth))
+	}
+	return cols
+}
+
+// MoveVisualLines moves the cursor a number of screen rows when lines are soft-wrapped
+// at width columns, keeping the cursor's screen column. A width of 0 means lines are
+// not wrapped, so rows and buffer lines coincide.
+func (e *Editor) MoveVisualLines(offset, width int, extend bool) error {
+	if width <= 0 {
+		return e.JumpFromCursor(offset, extend)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+
+	selection := e.current.Selection()
+	line, col, err := e.current.PositionToLineCol(selection.End)
+	if err != nil {
+		return err
+	}
+
+	// rows break by screen columns, as the view wraps them
+	cols := e.displayColumns(line)
+	screenCol := cols[min(e.verticalColumn(col), len(cols)-1)] % width
+
+	rows := func(line int) int {
+		// a closed fold is drawn as a single row
+		if _, folded := e.current.FoldAt(line); folded {
+			return 1
+		}
+		cols := e.displayColumns(line)
+		return max(1, (cols[len(cols)-1]+width-1)/width)
+	}
+
+	totalLines := e.current.LineCount()
+	row := min(cols[min(col, len(cols)-1)]/width, rows(line)-1)
+	for ; offset > 0; offset-- {
+		if row+1 < rows(line) {
+			row++
+			continue
+		}
+		next := line + 1
+		if end, ok := e.current.FoldAt(line); ok {
+			next = end + 1
+		}
+		if next >= totalLines {
+			break
+		}
+		line, row = next, 0
+	}
+	for ; offset < 0; offset++ {
+		if row > 0 {
+			row--
+			continue
+		}
+		if line == 0 {
+			break
+		}
+		line--
+		if start, _, ok := e.current.FoldContaining(line); ok {
+			line = start
+		}
+		row = rows(line) - 1
+	}
+
+	// land on the grapheme drawn at the screen column, or the end of a shorter row
+	cols = e.displayColumns(line)
+	last := len(cols) - 1
+	target := 0
+	for target < last && cols[target+1] <= row*width+screenCol {
+		target++
+	}
+	// a wide character straddling the row's start belongs to the row above
+	if target < last && cols[target] < row*width {
+		target++
+	}
+	return e.current.MoveSelectionToLineCol(line, target, extend)
+}
+
+// JumpToLine moves the cursor to a specific line number (0-based) and attempts to retain column position (when possible).
+func (e *Editor) JumpToLine(lineNum int, extend bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+
+	// bounds check
+	if lineNum < 0 {
+		lineNum = 0
+	}
+	totalLines := e.current.LineCount()
+	if lineNum >= totalLines {
+		lineNum = totalLines - 1
+	}
+
+	// current column for maintaining desired column
+	selection := e.current.Selection()
+	_, currCol, err := e.current.PositionToLineCol(selection.End)
+	if err != nil {
+		return err
+	}
+
+	e.recordJump()
+	return e.current.MoveSelectionToLineCol(lineNum, e.verticalColumn(currCol), extend)
+}
+
+// AppendToLineEnd moves the cursor past the last grapheme of its line and enters
+// insert mode, so typed text is appended to the line.
+func (e *Editor) AppendToLineEnd() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+
+	if err := e.runInsertCommand(InsertLineEnd); err != nil {
+		return err
+	}
+	e.beginInsert(InsertLineEnd, 1)
+	return nil
+}
+
+// JumpToPercent moves the cursor to the line at a percentage of the buffer.
+func (e *Editor) JumpToPercent(percent int, extend bool) error {
+	total, err := e.GetLineCount()
+	if err != nil {
+		return err
+	}
+	return e.JumpToLine(util.LineAtPercent(total, percent), extend)
+}
+
+// JumpToTop moves the cursor to the beginning of the document.
+func (e *Editor) JumpToTop(extend bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	e.recordJump()
+	if err := e.current.MoveSelectionToLineCol(0, 0, extend); err != nil {
+		return err
+	}
+	return e.trackColumn()
+}
+
+// JumpToBottom moves the cursor to the end of the document.
+func (e *Editor) JumpToBottom(extend bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	lastLine := e.current.LineCount() - 1
+	e.recordJump()
+	if err := e.current.MoveSelectionToLineCol(lastLine, 0, extend); err != nil {
+		return err
+	}
+	return e.trackColumn()
+}
+
+// MoveToFirstNonBlank moves the cursor to the first non-blank grapheme of its line.
+func (e *Editor) MoveToFirstNonBlank(extend bool) error {
+	return e.moveWithinLine(0, extend, func(x buffer.LineExtent) int { return x.FirstNonBlank })
+}
+
+// MoveToLineEnd moves the cursor to the last grapheme of the line count-1 lines
+// below its own, so a count of 1 stays on the cursor's line.
+func (e *Editor) MoveToLineEnd(count int, extend bool) error {
+	return e.moveWithinLine(count-1, extend, func(x buffer.LineExtent) int { return x.Last })
+}
+
+// MoveToLastNonBlank moves the cursor to the last non-blank grapheme of the line
+// count-1 lines below its own.
+func (e *Editor) MoveToLastNonBlank(count int, extend bool) error {
+	return e.moveWithinLine(count-1, extend, func(x buffer.LineExtent) int { return x.LastNonBlank })
+}
+
+// moveWithinLine moves the cursor to the column column picks on the line offset
+// lines below the cursor's, stopping at the last line.
+func (e *Editor) moveWithinLine(offset int, extend bool, column func(buffer.LineExtent) int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	line, _, err := e.current.PositionToLineCol(e.current.Selection().End)
+	if err != nil {
+		return err
+	}
+	line = min(line+max(offset, 0), e.current.LineCount()-1)
+
+	extent, err := e.current.LineExtent(line)
+	if err != nil {
+		return err
+	}
+	if err := e.current.MoveSelectionToLineCol(line, column(extent), extend); err != nil {
+		return err
+	}
+	return e.trackColumn()
+}
+
+// MoveToSameIndent moves the cursor to the first non-blank of the next line, or the
+// previous one, indented as deep as the cursor's line. Deeper lines and blank lines
+// are skipped, and the cursor stays put when a shallower line, ending the block,
+// or the edge of the buffer comes first.
+func (e *Editor) MoveToSameIndent(forward, extend bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	line, _, err := e.current.PositionToLineCol(e.current.Selection().End)
+	if err != nil {
+		return err
+	}
+	indent, blank, err := e.current.IndentWidth(line)
+	if err != nil {
+		return err
+	}
+	if blank {
+		e.setMessage("Line is blank")
+		return nil
+	}
+
+	step := 1
+	if !forward {
+		step = -1
+	}
+	for target := line + step; target >= 0 && target < e.current.LineCount(); target += step {
+		width, blank, err := e.current.IndentWidth(target)
+		if err != nil {
+			return err
+		}
+		if blank || width > indent {
+			continue
+		}
+		if width < indent {
+			break
+		}
+		extent, err := e.current.LineExtent(target)
+		if err != nil {
+			return err
+		}
+		if err := e.current.MoveSelectionToLineCol(target, extent.FirstNonBlank, extend); err != nil {
+			return err
+		}
+		return e.trackColumn()
+	}
+	e.setMessage("No line with the same indentation")
+	return nil
+}
+
+// MoveToNextWord moves the cursor to the beginning of the next word boundary.
+func (e *Editor) MoveToNextWord(kind buffer.WordKind, extend bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if err := e.current.MoveToNextWord(kind, extend); err != nil {
+		return err
+	}
+	return e.trackColumn()
+}
+
+// MoveToWordEnd moves the cursor to the end of the word, or of the next one when
+// it's already at the end of a word.
+func (e *Editor) MoveToWordEnd(kind buffer.WordKind, extend bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if err := e.current.MoveToWordEnd(kind, extend); err != nil {
+		return err
+	}
+	return e.trackColumn()
+}
+
+// MoveToPrevWord moves the cursor to the beginning of the previous word boundary.
+func (e *Editor) MoveToPrevWord(kind buffer.WordKind, extend bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if err := e.current.MoveToPrevWord(kind, extend); err != nil {
+		return err
+	}
+	return e.trackColumn()
+}
+
+// FindChar moves the cursor to the count-th occurrence of ch on the current line.
+func (e *Editor) FindChar(ch string, forward, till bool, count int, extend bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+
+	e.lastFind = &findCharMotion{ch: ch, forward: forward, till: till}
+	return e.findChar(*e.lastFind, count, false, extend)
+}
+
+// RepeatFind repeats the last find-char motion count times, in the opposite direction when reverse is set.
+func (e *Editor) RepeatFind(reverse bool, count int, extend bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if e.lastFind == nil {
+		return ErrInvalidOperation
+	}
+
+	motion := *e.lastFind
+	if reverse {
+		motion.forward = !motion.forward
+	}
+	return e.findChar(motion, count, true, extend)
+}
+
+// findChar performs a find-char motion; the caller must hold the lock.
+func (e *Editor) findChar(motion findCharMotion, count int, repeat bool, extend bool) error {
+	pos := e.current.Selection().End
+	target, err := e.current.FindCharInLine(motion.ch, motion.forward, motion.till, count)
+	if err != nil {
+		return err
+	}
+
+	// a repeated till motion adjacent to its character would not move; skip past it
+	if repeat && motion.till && target == pos {
+		if target, err = e.current.FindCharInLine(motion.ch, motion.forward, motion.till, count+1); err != nil {
+			return err
+		}
+	}
+
+	if err := e.current.MoveSelectionTo(target, extend); err != nil {
+		return err
+	}
+	return e.trackColumn()
+}
+
+// SetIndentationResolver sets the function choosing the indentation of newly opened
+// buffers from their file name, e.g. to apply per-language overrides.
+func (e *Editor) SetIndentationResolver(indentFor func(fileName string) buffer.Indentation) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.indentFor = indentFor
+}
+
+// SetSyntaxResolver sets the function deciding from their file name whether newly
+// opened buffers get syntax highlighting.
+func (e *Editor) SetSyntaxResolver(syntaxFor func(fileName string) bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.syntaxFor = syntaxFor
+}
+
+// Indentation returns how the current buffer inserts indentation.
+func (e *Editor) Indentation() (buffer.Indentation, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.current == nil {
+		return buffer.Indentation{}, ErrNoBuffer
+	}
+	return e.current.Indentation(), nil
+}
+
+// LineChanges returns the lines of the current buffer changed since it was last
+// loaded or saved.
+func (e *Editor) LineChanges() ([]buffer.LineChange, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.current == nil {
+		return nil, ErrNoBuffer
+	}
+	return e.current.DiffAgainstDisk()
+}
+
+// InsertIndent inserts one level of indentation at the cursor using the current buffer's indentation.
+func (e *Editor) InsertIndent() error {
+	indentation, err := e.Indentation()
+	if err != nil {
+		return err
+	}
+	return e.InsertText(indentation.Unit())
+}
+
+// SetFixEOLOnSave sets whether buffers are normalized to a single trailing newline when saved.
+func (e *Editor) SetFixEOLOnSave(enabled bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.fixEOLOnSave = enabled
+}
+
+// FixEOL makes the current buffer end with exactly one newline.
+// It reports whether the buffer changed.
+func (e *Editor) FixEOL() (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return false, ErrNoBuffer
+	}
+	return e.current.FixEOL()
+}
+
+// SaveCurrentBuffer saves the current buffer.
 func (e *Editor) SaveCurrentBuffer() error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -346,7 +1529,95 @@ func (e *Editor) SaveCurrentBuffer() error {
 	if e.current == nil {
 		return ErrNoBuffer
 	}
-	return e.current.Save()
+	return e.save(e.current, false)
+}
+
+// OverwriteCurrentBuffer saves the current buffer even when its file was changed by
+// another program since it was read.
+func (e *Editor) OverwriteCurrentBuffer() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	return e.save(e.current, true)
+}
+
+// ReloadCurrentBuffer discards the unsaved changes of the current buffer and reads
+// its file again, moving the cursor to the start.
+func (e *Editor) ReloadCurrentBuffer() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if err := e.current.Reload(); err != nil {
+		return err
+	}
+	if err := e.current.MoveSelectionTo(0, false); err != nil {
+		return err
+	}
+	return e.trackColumn()
+}
+
+// SaveAll saves every dirty file-backed buffer, collecting per-buffer errors.
+// A failure to save one buffer does not prevent the others from being saved.
+func (e *Editor) SaveAll() []error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var errs []error
+	for _, path := range e.dirtyBuffers() {
+		if err := e.save(e.buffers[path], false); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+	return errs
+}
+
+// save writes b, first fixing its trailing newline if enabled; the caller must hold the lock.
+// Saving a buffer whose invalid UTF-8 was replaced on load warns that the original
+// bytes are gone. Unless forced, a file changed by another program isn't written.
+func (e *Editor) save(b *buffer.Buffer, force bool) error {
+	if e.fixEOLOnSave && !b.IsReadOnly() {
+		if _, err := b.FixEOL(); err != nil {
+			return err
+		}
+	}
+	lossy := b.IsLossyDecoded()
+	write := b.Save
+	if force {
+		write = b.ForceSave
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	if lossy {
+		e.setMessage(fmt.Sprintf("%s: invalid UTF-8 was saved as U+FFFD", b.FileName()))
+	}
+	return nil
+}
+
+// DirtyBuffers returns the sorted keys of file-backed buffers with unsaved changes.
+func (e *Editor) DirtyBuffers() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.dirtyBuffers()
+}
+
+// dirtyBuffers returns the sorted keys of dirty buffers; the caller must hold the lock.
+func (e *Editor) dirtyBuffers() []string {
+	var paths []string
+	for path, b := range e.buffers {
+		if b.IsDirty() && !b.IsScratch() {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
 }
 
 // CloseCurrentBuffer closes the current buffer.
@@ -357,7 +1628,19 @@ func (e *Editor) CloseCurrentBuffer() error {
 	if e.current == nil {
 		return ErrNoBuffer
 	}
+	return e.closeCurrent(false)
+}
 
+// closeCurrent closes the current buffer, falling back to the most recently used
+// one; the caller must hold the lock and make sure there is a current buffer.
+// Unless discard is set, unsaved changes are saved first as SaveCurrentBuffer would,
+// and the buffer stays open when that fails.
+func (e *Editor) closeCurrent(discard bool) error {
+	if !discard && e.current.IsDirty() && !e.current.IsScratch() {
+		if err := e.save(e.current, false); err != nil {
+			return err
+		}
+	}
 	if err := e.current.Close(); err != nil {
 		return err
 	}
@@ -369,17 +1652,56 @@ func (e *Editor) CloseCurrentBuffer() error {
 		}
 	}
 
-	for _, buf := range e.buffers {
-		if buf != nil {
-			e.current = buf
-			return nil
-		}
-	}
-
+	// fall back to the most recently used remaining buffer
+	closed := e.current
+	e.recent = slices.DeleteFunc(e.recent, func(r *buffer.Buffer) bool { return r == closed })
 	e.current = nil
+	if len(e.recent) > 0 {
+		e.current = e.recent[len(e.recent)-1]
+	}
 	return nil
 }
 
+// Quit closes the current buffer, or asks the application to exit when it's the
+// last one open. Unless force is set, a buffer with unsaved changes stays open and
+// ErrUnsavedChanges is returned.
+func (e *Editor) Quit(force bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if !force && e.current.IsDirty() && !e.current.IsScratch() {
+		return ErrUnsavedChanges
+	}
+	if len(e.buffers) <= 1 {
+		e.quit = true
+		return nil
+	}
+	return e.closeCurrent(force)
+}
+
+// QuitRequested reports whether Quit was called on the last buffer, for the
+// application to exit.
+func (e *Editor) QuitRequested() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.quit
+}
+
+// Text returns the content of the current buffer.
+func (e *Editor) Text() (string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.current == nil {
+		return "", ErrNoBuffer
+	}
+	return e.current.Text(), nil
+}
+
 // GetLine returns a line as a string from the document.
 func (e *Editor) GetLine(lineNum int) (string, error) {
 	e.mu.RLock()
@@ -401,6 +1723,74 @@ func (e *Editor) GetHighlights() ([]treesitter.Highlight, error) {
 	return e.current.GetHighlights()
 }
 
+// HighlightsByLine returns the current buffer's highlights indexed by row.
+func (e *Editor) HighlightsByLine() (map[int][]treesitter.Highlight, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.current == nil {
+		return nil, ErrNoBuffer
+	}
+	return e.current.HighlightsByLine()
+}
+
+// IndentStats returns the number of tab- and space-indented lines in the current buffer.
+func (e *Editor) IndentStats() (int, int, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.current == nil {
+		return 0, 0, ErrNoBuffer
+	}
+	tabs, spaces := e.current.IndentStats()
+	return tabs, spaces, nil
+}
+
+// ToggleFold opens or closes the fold starting at the given line.
+func (e *Editor) ToggleFold(line int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	return e.current.ToggleFold(line)
+}
+
+// FoldAt returns the last line hidden by a closed fold starting at line.
+func (e *Editor) FoldAt(line int) (int, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.current == nil {
+		return 0, false
+	}
+	return e.current.FoldAt(line)
+}
+
+// BufferOption returns the current buffer's local value for an option and
+// whether it overrides the editor config.
+func (e *Editor) BufferOption(name string) (bool, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.current == nil {
+		return false, false
+	}
+	return e.current.Option(name)
+}
+
+// SetBufferOption overrides an option for the current buffer only.
+func (e *Editor) SetBufferOption(name string, value bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	return e.current.SetOption(name, value)
+}
+
 // GetLineCount returns the total number of lines in the buffer.
 func (e *Editor) GetLineCount() (int, error) {
 	e.mu.RLock()
@@ -412,8 +1802,12 @@ func (e *Editor) GetLineCount() (int, error) {
 	return e.current.LineCount(), nil
 }
 
-// getBuffer returns a buffer by file path
+// getBuffer returns a buffer by file path or scratch buffer name
 func (e *Editor) getBuffer(filePath string) (*buffer.Buffer, error) {
+	if buf, exists := e.buffers[filePath]; exists {
+		return buf, nil
+	}
+
 	absPath, err := filepath.Abs(filePath)
 	if err != nil {
 		return nil, err
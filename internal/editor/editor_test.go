@@ -0,0 +1,1530 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lg2m/athena/internal/editor/buffer"
+	"github.com/lg2m/athena/internal/editor/state"
+)
+
+// writeTempFile creates a file with the given content in a temporary directory.
+func writeTempFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write temp file: %v", err)
+	}
+	return path
+}
+
+func TestScratchBuffer(t *testing.T) {
+	e := NewEditor()
+	path := writeTempFile(t, "main.go", "package main\n")
+	if err := e.OpenFile(path); err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+
+	scratch := e.NewScratchBuffer("*search*", "first\nsecond")
+	if !scratch.IsScratch() || !scratch.IsReadOnly() {
+		t.Errorf("expected scratch buffer to be file-less and read-only")
+	}
+
+	name, _ := e.FileName()
+	if name != "*search*" {
+		t.Errorf("expected current buffer name %q, got %q", "*search*", name)
+	}
+	if total, _ := e.GetLineCount(); total != 2 {
+		t.Errorf("expected 2 lines in scratch buffer, got %d", total)
+	}
+
+	e.SetMode(state.Insert)
+	if err := e.InsertText("x"); !errors.Is(err, buffer.ErrReadOnly) {
+		t.Errorf("expected ErrReadOnly inserting into scratch buffer, got %v", err)
+	}
+
+	if err := e.SwitchBuffer(path); err != nil {
+		t.Fatalf("SwitchBuffer to file failed: %v", err)
+	}
+	if err := e.SwitchBuffer("*search*"); err != nil {
+		t.Fatalf("SwitchBuffer to scratch failed: %v", err)
+	}
+	if line, _ := e.GetLine(1); line != "second" {
+		t.Errorf("expected line %q, got %q", "second", line)
+	}
+
+	// opening the same name again reuses the open buffer
+	if err := e.SwitchBuffer(path); err != nil {
+		t.Fatalf("SwitchBuffer to file failed: %v", err)
+	}
+	if again := e.NewScratchBuffer("*search*", "other"); again != scratch {
+		t.Errorf("expected the open scratch buffer to be returned")
+	}
+	if name, _ := e.FileName(); name != "*search*" {
+		t.Errorf("expected current buffer name %q, got %q", "*search*", name)
+	}
+	if line, _ := e.GetLine(0); line != "first" {
+		t.Errorf("expected line %q, got %q", "first", line)
+	}
+
+	if err := e.CloseCurrentBuffer(); err != nil {
+		t.Errorf("closing scratch buffer failed: %v", err)
+	}
+	if err := e.SwitchBuffer("*search*"); !errors.Is(err, ErrBufferNotFound) {
+		t.Errorf("expected ErrBufferNotFound after closing the scratch buffer, got %v", err)
+	}
+}
+
+func TestSaveAll(t *testing.T) {
+	e := NewEditor()
+	e.SetMode(state.Insert)
+
+	clean := writeTempFile(t, "clean.go", "package clean\n")
+	dirty := writeTempFile(t, "dirty.go", "package dirty\n")
+	failing := filepath.Join(t.TempDir(), "missing", "fail.go")
+
+	for _, path := range []string{clean, dirty, failing} {
+		if err := e.OpenFile(path); err != nil {
+			t.Fatalf("OpenFile(%q) failed: %v", path, err)
+		}
+		if path != clean {
+			if err := e.InsertText("// edit\n"); err != nil {
+				t.Fatalf("InsertText failed: %v", err)
+			}
+		}
+	}
+	e.NewScratchBuffer("*messages*", "not saved")
+
+	if got := len(e.DirtyBuffers()); got != 2 {
+		t.Fatalf("expected 2 dirty buffers, got %d", got)
+	}
+
+	errs := e.SaveAll()
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 failed save, got %d: %v", len(errs), errs)
+	}
+
+	got, _ := os.ReadFile(dirty)
+	if string(got) != "// edit\npackage dirty\n" {
+		t.Errorf("expected dirty buffer to be written, got %q", string(got))
+	}
+	got, _ = os.ReadFile(clean)
+	if string(got) != "package clean\n" {
+		t.Errorf("expected clean buffer to be untouched, got %q", string(got))
+	}
+
+	remaining := e.DirtyBuffers()
+	if len(remaining) != 1 || remaining[0] != failing {
+		t.Errorf("expected only %q to remain dirty, got %v", failing, remaining)
+	}
+}
+
+func TestMatchingBracketAdjacent(t *testing.T) {
+	e := NewEditor()
+	e.NewScratchBuffer("*test*", "f(a[b]c)")
+
+	// cursor on '('
+	_ = e.MoveCursorHorizontal(1, false)
+	if match, ok := e.MatchingBracket(false); !ok || match != 7 {
+		t.Errorf("expected match at 7 with cursor on bracket, got %d (%v)", match, ok)
+	}
+
+	// cursor just after '('
+	_ = e.MoveCursorHorizontal(1, false)
+	if _, ok := e.MatchingBracket(false); ok {
+		t.Errorf("expected no match in cursor mode when not on a bracket")
+	}
+	if match, ok := e.MatchingBracket(true); !ok || match != 7 {
+		t.Errorf("expected match at 7 in adjacent mode, got %d (%v)", match, ok)
+	}
+}
+
+func TestClearSearchHighlight(t *testing.T) {
+	e := NewEditor()
+	e.NewScratchBuffer("*test*", "foo bar foo")
+	_ = e.MoveCursorHorizontal(4, false)
+
+	e.SetSearchPattern("foo")
+	if got := e.SearchHighlight(); got != "foo" {
+		t.Errorf("expected highlight pattern %q, got %q", "foo", got)
+	}
+
+	e.ClearSearchHighlight()
+	if got := e.SearchHighlight(); got != "" {
+		t.Errorf("expected no highlight after clearing, got %q", got)
+	}
+	if got := e.SearchPattern(); got != "foo" {
+		t.Errorf("expected pattern to survive clearing, got %q", got)
+	}
+	if sel, _ := e.Selection(); sel.End != 4 {
+		t.Errorf("expected cursor to stay at 4, got %d", sel.End)
+	}
+
+	// searching again re-enables highlighting
+	e.SetSearchPattern("foo")
+	if got := e.SearchHighlight(); got != "foo" {
+		t.Errorf("expected highlight re-enabled, got %q", got)
+	}
+}
+
+func TestSearchWordUnderCursor(t *testing.T) {
+	tests := []struct {
+		name     string
+		cursor   int
+		forward  bool
+		expected int
+		wrapped  bool
+	}{
+		{"next occurrence skips longer words", 1, true, 16, false},
+		{"wraps to the first occurrence", 16, true, 0, true},
+		{"previous occurrence", 17, false, 0, false},
+		{"wraps to the last occurrence", 0, false, 16, true},
+		{"not on a word", 3, true, 3, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEditor()
+			e.NewScratchBuffer("*test*", "foo foobar xfoo foo")
+			_ = e.MoveCursorHorizontal(tt.cursor, false)
+
+			if err := e.SearchWordUnderCursor(tt.forward); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if sel, _ := e.Selection(); sel.End != tt.expected {
+				t.Errorf("expected cursor at %d, got %d", tt.expected, sel.End)
+			}
+			if wrapped := e.Message() != ""; wrapped != tt.wrapped {
+				t.Errorf("expected wrapped %v, got message %q", tt.wrapped, e.Message())
+			}
+			if tt.cursor != 3 && (e.SearchHighlight() != "foo" || !e.SearchWholeWord()) {
+				t.Errorf("expected whole-word highlight of %q, got %q", "foo", e.SearchHighlight())
+			}
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		cursor   int
+		forward  bool
+		expected int
+		message  string
+	}{
+		{"next match, inside longer words too", "foo", 1, true, 4, ""},
+		{"wraps to the first match", "foo", 16, true, 0, "search hit BOTTOM, continuing at TOP"},
+		{"previous match", "foo", 16, false, 12, ""},
+		{"wraps to the last match", "foo", 0, false, 16, "search hit TOP, continuing at BOTTOM"},
+		{"across words", "o f", 0, true, 2, ""},
+		{"no match", "baz", 5, true, 5, "Pattern not found: baz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEditor()
+			e.NewScratchBuffer("*test*", "foo foobar xfoo foo")
+			_ = e.MoveCursorHorizontal(tt.cursor, false)
+
+			pos, err := e.Search(tt.pattern, tt.forward)
+			if err != nil {
+				t.Fatalf("Search failed: %v", err)
+			}
+			if sel, _ := e.Selection(); pos != tt.expected || sel.End != tt.expected {
+				t.Errorf("expected cursor at %d, got %d (returned %d)", tt.expected, sel.End, pos)
+			}
+			if got := e.Message(); got != tt.message {
+				t.Errorf("expected message %q, got %q", tt.message, got)
+			}
+			if e.SearchHighlight() != tt.pattern || e.SearchWholeWord() {
+				t.Errorf("expected a literal highlight of %q, got %q", tt.pattern, e.SearchHighlight())
+			}
+		})
+	}
+}
+
+func TestSearchNext(t *testing.T) {
+	e := NewEditor()
+	e.NewScratchBuffer("*test*", "ab ab ab")
+
+	if err := e.SearchNext(false); err != nil {
+		t.Fatalf("SearchNext failed: %v", err)
+	}
+	if got := e.Message(); got != "No previous search pattern" {
+		t.Errorf("expected a message without a pattern, got %q", got)
+	}
+
+	// n keeps the direction of the search and N reverses it
+	_, _ = e.Search("ab", false)
+	steps := []struct {
+		reverse  bool
+		expected int
+	}{
+		{false, 3},
+		{false, 0},
+		{true, 3},
+		{true, 6},
+	}
+	for i, step := range steps {
+		if err := e.SearchNext(step.reverse); err != nil {
+			t.Fatalf("SearchNext failed: %v", err)
+		}
+		if sel, _ := e.Selection(); sel.End != step.expected {
+			t.Errorf("step %d: expected cursor at %d, got %d", i, step.expected, sel.End)
+		}
+	}
+}
+
+func TestSearchChunkedBuffer(t *testing.T) {
+	e := NewEditor()
+	e.SetLargeFileThreshold(1)
+	if err := e.OpenFile(writeTempFile(t, "big.txt", "one two\nthree two\n")); err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+
+	searches := []struct {
+		name   string
+		search func() error
+	}{
+		{"search", func() error { _, err := e.Search("two", true); return err }},
+		{"repeat", func() error { return e.SearchNext(false) }},
+		{"word under the cursor", func() error { return e.SearchWordUnderCursor(true) }},
+		{"prompt", func() error { return e.StartSearch(true) }},
+	}
+	for _, tt := range searches {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.search(); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if sel, _ := e.Selection(); sel.End != 0 {
+				t.Errorf("expected the cursor to stay put, got %d", sel.End)
+			}
+			if got := e.Message(); got != "Search is disabled for large files" {
+				t.Errorf("expected a message, got %q", got)
+			}
+			if e.GetMode() != state.Normal {
+				t.Errorf("expected no search prompt, got mode %v", e.GetMode())
+			}
+		})
+	}
+}
+
+func TestIncrementalSearch(t *testing.T) {
+	e := NewEditor()
+	e.NewScratchBuffer("*test*", "one two three two")
+	_ = e.MoveCursorHorizontal(4, false)
+	cursor := func() int {
+		sel, _ := e.Selection()
+		return sel.End
+	}
+
+	// the cursor follows the pattern as it's typed, and comes back on cancel
+	_ = e.StartSearch(true)
+	if e.GetMode() != state.Search || !e.SearchPromptForward() {
+		t.Fatalf("expected a forward search prompt")
+	}
+	for _, step := range []struct {
+		pattern  string
+		expected int
+	}{
+		{"t", 8},
+		{"tw", 14},
+		{"twx", 4},
+		{"", 4},
+	} {
+		_ = e.UpdateSearch(step.pattern)
+		if got := cursor(); got != step.expected {
+			t.Errorf("%q: expected cursor at %d, got %d", step.pattern, step.expected, got)
+		}
+	}
+	_ = e.UpdateSearch("thr")
+	_ = e.CancelSearch()
+	if e.GetMode() != state.Normal || cursor() != 4 || e.SearchPattern() != "" {
+		t.Errorf("expected cancelling to restore the cursor and pattern, got %d and %q", cursor(), e.SearchPattern())
+	}
+
+	// confirming keeps the match, and an empty pattern repeats the last one
+	_ = e.StartSearch(false)
+	_ = e.UpdateSearch("o")
+	_ = e.ConfirmSearch("o")
+	if e.GetMode() != state.Normal || cursor() != 0 || e.SearchPattern() != "o" {
+		t.Errorf("expected the cursor on the previous match, got %d", cursor())
+	}
+	_ = e.StartSearch(true)
+	_ = e.ConfirmSearch("")
+	if got := cursor(); got != 6 {
+		t.Errorf("expected the last pattern to be searched again, got %d", got)
+	}
+}
+
+func TestAppendToLineEnd(t *testing.T) {
+	e := NewEditor()
+	e.NewScratchBuffer("*test*", "ab\n\ncd")
+	e.current.SetReadOnly(false)
+
+	if err := e.AppendToLineEnd(); err != nil {
+		t.Fatalf("AppendToLineEnd failed: %v", err)
+	}
+	_ = e.InsertText("!")
+
+	// append on the empty line
+	_ = e.SetCursor(1, 0, false)
+	if err := e.AppendToLineEnd(); err != nil {
+		t.Fatalf("AppendToLineEnd failed: %v", err)
+	}
+	_ = e.InsertText("x")
+
+	if got := e.current.Text(); got != "ab!\nx\ncd" {
+		t.Errorf("expected %q, got %q", "ab!\nx\ncd", got)
+	}
+	if e.GetMode() != state.Insert {
+		t.Errorf("expected insert mode, got %v", e.GetMode())
+	}
+}
+
+func TestMessageLog(t *testing.T) {
+	e := NewEditor()
+
+	e.SetMessage("first")
+	e.SetMessage("")
+	e.LogMessage("logged")
+	if got := e.Message(); got != "" {
+		t.Errorf("expected logging to leave the status message alone, got %q", got)
+	}
+
+	messages := e.Messages()
+	if len(messages) != 2 || messages[0].Text != "first" || messages[1].Text != "logged" {
+		t.Fatalf("expected [first logged], got %v", messages)
+	}
+	if messages[0].Time.IsZero() {
+		t.Errorf("expected messages to be timestamped")
+	}
+
+	// the log keeps the newest MessageLogSize messages, oldest first
+	for i := range MessageLogSize + 5 {
+		e.SetMessage(fmt.Sprintf("msg %d", i))
+	}
+	messages = e.Messages()
+	if len(messages) != MessageLogSize {
+		t.Fatalf("expected the log to be capped at %d, got %d", MessageLogSize, len(messages))
+	}
+	if messages[0].Text != "msg 5" || messages[len(messages)-1].Text != fmt.Sprintf("msg %d", MessageLogSize+4) {
+		t.Errorf("expected msg 5 through msg %d, got %q through %q",
+			MessageLogSize+4, messages[0].Text, messages[len(messages)-1].Text)
+	}
+
+	if err := e.Commands().Execute("messages"); err != nil || !e.MessagesVisible() {
+		t.Errorf("expected :messages to open the panel, got %v", err)
+	}
+	if err := e.Commands().Execute("messages"); err != nil || e.MessagesVisible() {
+		t.Errorf("expected :messages to close the panel again, got %v", err)
+	}
+}
+
+func TestListDirectory(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.go", "a.rs", ".hidden", "zdir/x.go", "adir/y.go", ".git/config"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create dir: %v", err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		showHidden bool
+		expected   []string
+	}{
+		{"directories first", false, []string{"../", "adir/", "zdir/", "a.rs", "b.go"}},
+		{"hidden files", true, []string{"../", ".git/", "adir/", "zdir/", ".hidden", "a.rs", "b.go"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := ListDirectory(dir, tt.showHidden)
+			if err != nil {
+				t.Fatalf("ListDirectory failed: %v", err)
+			}
+			var got []string
+			for _, entry := range entries {
+				got = append(got, filepath.ToSlash(entry.String()))
+			}
+			if strings.Join(got, " ") != strings.Join(tt.expected, " ") {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestOpenDirectory(t *testing.T) {
+	path := writeTempFile(t, "main.go", "package main\n")
+	dir := filepath.Dir(path)
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatalf("failed to create dir: %v", err)
+	}
+
+	e := NewEditor()
+	if err := e.OpenFile(dir); err != nil {
+		t.Fatalf("expected opening a directory to list it, got %v", err)
+	}
+	if !e.IsDirectoryListing() {
+		t.Fatalf("expected the current buffer to be a directory listing")
+	}
+	if got := e.current.Text(); got != "../\nsub/\nmain.go" {
+		t.Errorf("unexpected listing %q", got)
+	}
+
+	// enter the subdirectory, then go back up through ".."
+	_ = e.SetCursor(1, 0, false)
+	if err := e.OpenEntryUnderCursor(); err != nil {
+		t.Fatalf("OpenEntryUnderCursor failed: %v", err)
+	}
+	if got := e.current.Text(); got != "../" {
+		t.Errorf("expected the empty subdirectory listing, got %q", got)
+	}
+	if err := e.OpenEntryUnderCursor(); err != nil {
+		t.Fatalf("OpenEntryUnderCursor failed: %v", err)
+	}
+
+	_ = e.SetCursor(2, 0, false)
+	if err := e.OpenEntryUnderCursor(); err != nil {
+		t.Fatalf("OpenEntryUnderCursor failed: %v", err)
+	}
+	if e.IsDirectoryListing() {
+		t.Fatalf("expected the file to open in a regular buffer")
+	}
+	if got, _ := e.FilePath(); got != path {
+		t.Errorf("expected %s to be open, got %s", path, got)
+	}
+	if err := e.OpenEntryUnderCursor(); !errors.Is(err, ErrNotDirectoryListing) {
+		t.Errorf("expected ErrNotDirectoryListing outside listings, got %v", err)
+	}
+}
+
+func TestDesiredColumn(t *testing.T) {
+	cursor := func(e *Editor) [2]int {
+		line, col, _ := e.GetCurrentPosition()
+		return [2]int{line, col}
+	}
+
+	tests := []struct {
+		name     string
+		moves    func(e *Editor)
+		expected [2]int
+	}{
+		{"restored after crossing a short line", func(e *Editor) {
+			_ = e.JumpFromCursor(1, false)
+			_ = e.JumpFromCursor(1, false)
+		}, [2]int{2, 6}},
+		{"restored after going back up", func(e *Editor) {
+			_ = e.JumpFromCursor(1, false)
+			_ = e.JumpFromCursor(-1, false)
+		}, [2]int{0, 6}},
+		{"kept by line jumps", func(e *Editor) {
+			_ = e.JumpToLine(1, false)
+			_ = e.JumpToLine(2, false)
+		}, [2]int{2, 6}},
+		{"set by horizontal moves on the short line", func(e *Editor) {
+			_ = e.JumpFromCursor(1, false)
+			_ = e.MoveCursorHorizontal(-1, false)
+			_ = e.JumpFromCursor(1, false)
+		}, [2]int{2, 1}},
+		{"set by column jumps", func(e *Editor) {
+			_ = e.SetCursor(0, 3, false)
+			_ = e.JumpFromCursor(2, false)
+		}, [2]int{2, 3}},
+		{"reset by insert mode", func(e *Editor) {
+			_ = e.JumpFromCursor(1, false)
+			e.SetMode(state.Insert)
+			e.SetMode(state.Normal)
+			_ = e.JumpFromCursor(1, false)
+		}, [2]int{2, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEditor()
+			e.NewScratchBuffer("*test*", "long line\nab\nanother long line")
+			_ = e.MoveCursorHorizontal(6, false)
+
+			tt.moves(e)
+			if got := cursor(e); got != tt.expected {
+				t.Errorf("expected cursor at %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"utf-8", "héllo\n", buffer.EncodingUTF8},
+		{"utf-8 with a byte order mark", "\xef\xbb\xbfhéllo\n", buffer.EncodingUTF8BOM},
+		{"invalid utf-8 falls back to latin1", "h\xe9llo\n", buffer.EncodingLatin1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEditor()
+			if err := e.OpenFile(writeTempFile(t, "file.txt", tt.content)); err != nil {
+				t.Fatalf("OpenFile failed: %v", err)
+			}
+			if encoding, err := e.Encoding(); err != nil || encoding != tt.expected {
+				t.Errorf("expected %s, got %s (%v)", tt.expected, encoding, err)
+			}
+			if line, _ := e.GetLine(0); line != "héllo" {
+				t.Errorf("expected %q, got %q", "héllo", line)
+			}
+		})
+	}
+
+	if _, err := NewEditor().Encoding(); !errors.Is(err, ErrNoBuffer) {
+		t.Errorf("expected ErrNoBuffer without a buffer, got %v", err)
+	}
+}
+
+func TestSaveWarnsAboutLossyDecoding(t *testing.T) {
+	e := NewEditor()
+	path := writeTempFile(t, "bad.rs", "\xef\xbb\xbffn \xff() {}\n")
+	if err := e.OpenFile(path); err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	if !e.IsLossyDecoded() {
+		t.Fatalf("expected the file to be lossy decoded")
+	}
+
+	if err := e.SaveCurrentBuffer(); err != nil {
+		t.Fatalf("SaveCurrentBuffer failed: %v", err)
+	}
+	if msg := e.Message(); !strings.Contains(msg, "U+FFFD") {
+		t.Errorf("expected a warning about replaced bytes, got %q", msg)
+	}
+
+	// the file is valid from now on
+	e.SetMessage("")
+	if err := e.SaveCurrentBuffer(); err != nil {
+		t.Fatalf("SaveCurrentBuffer failed: %v", err)
+	}
+	if msg := e.Message(); msg != "" {
+		t.Errorf("expected no warning on the second save, got %q", msg)
+	}
+}
+
+func TestSelectionInfo(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end int
+		chars      int
+		lines      int
+	}{
+		{"empty selection", 3, 3, 0, 0},
+		{"single line", 1, 4, 3, 1},
+		{"backwards selection", 4, 1, 3, 1},
+		{"multiple lines", 2, 13, 11, 3},
+		{"ending on a newline", 0, 6, 6, 1},
+		{"ending after a newline", 0, 7, 7, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEditor()
+			b := e.NewScratchBuffer("*test*", "hello\nworld\nagain")
+			_ = b.MoveSelectionTo(tt.start, false)
+			_ = b.MoveSelectionTo(tt.end, true)
+
+			chars, lines := e.SelectionInfo()
+			if chars != tt.chars || lines != tt.lines {
+				t.Errorf("expected %d chars on %d lines, got %d on %d", tt.chars, tt.lines, chars, lines)
+			}
+		})
+	}
+}
+
+func TestToggleComment(t *testing.T) {
+	cStyle := buffer.CommentTokens{Line: "//", BlockStart: "/*", BlockEnd: "*/"}
+	blockOnly := buffer.CommentTokens{BlockStart: "/*", BlockEnd: "*/"}
+
+	tests := []struct {
+		name       string
+		tokens     buffer.CommentTokens
+		start, end int
+		expected   string
+		err        bool
+	}{
+		{"cursor line", cStyle, 5, 5, "one\n// two\nthree", false},
+		{"whole lines", cStyle, 0, 8, "// one\n// two\nthree", false},
+		{"whole lines without the last newline", cStyle, 4, 13, "one\n// two\n// three", false},
+		{"part of a line", cStyle, 5, 7, "one\nt/* wo */\nthree", false},
+		{"across lines", cStyle, 1, 6, "o/* ne\ntw */o\nthree", false},
+		{"block only language on the cursor line", blockOnly, 5, 5, "one\n/* two */\nthree", false},
+		{"block only language on whole lines", blockOnly, 0, 8, "/* one\ntwo */\nthree", false},
+		{"no tokens", buffer.CommentTokens{}, 5, 5, "one\ntwo\nthree", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEditor()
+			e.SetCommentResolver(func(string) buffer.CommentTokens { return tt.tokens })
+			b := e.NewScratchBuffer("*test*", "one\ntwo\nthree")
+			b.SetReadOnly(false)
+			_ = b.MoveSelectionTo(tt.start, false)
+			_ = b.MoveSelectionTo(tt.end, true)
+
+			if err := e.ToggleComment(); (err != nil) != tt.err {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if got := b.Text(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+
+			// a second toggle restores the text
+			if !tt.err {
+				_ = e.ToggleComment()
+				if got := b.Text(); got != "one\ntwo\nthree" {
+					t.Errorf("expected toggling again to uncomment, got %q", got)
+				}
+			}
+		})
+	}
+}
+
+func TestIntraLineMotions(t *testing.T) {
+	content := "  \tfoo bar  \nlast\n   \n"
+
+	tests := []struct {
+		name     string
+		start    int
+		move     func(e *Editor) error
+		expected int
+	}{
+		{"first non-blank", 8, func(e *Editor) error { return e.MoveToFirstNonBlank(false) }, 3},
+		{"first non-blank from the indentation", 0, func(e *Editor) error { return e.MoveToFirstNonBlank(false) }, 3},
+		{"line end keeps trailing blanks", 3, func(e *Editor) error { return e.MoveToLineEnd(1, false) }, 11},
+		{"last non-blank skips trailing blanks", 3, func(e *Editor) error { return e.MoveToLastNonBlank(1, false) }, 9},
+		{"counted line end moves down", 3, func(e *Editor) error { return e.MoveToLineEnd(2, false) }, 16},
+		{"count past the last line stops there", 3, func(e *Editor) error { return e.MoveToLineEnd(9, false) }, 22},
+		{"blank line", 18, func(e *Editor) error { return e.MoveToFirstNonBlank(false) }, 20},
+		{"empty line", 22, func(e *Editor) error { return e.MoveToLastNonBlank(1, false) }, 22},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEditor()
+			b := e.NewScratchBuffer("*test*", content)
+			_ = b.MoveSelectionTo(tt.start, false)
+
+			if err := tt.move(e); err != nil {
+				t.Fatalf("motion failed: %v", err)
+			}
+			if got := b.Selection().End; got != tt.expected {
+				t.Errorf("expected cursor at %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestJumpToMatchingBracket(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		cursor   int
+		expected int
+	}{
+		{"opening to closing", "f(a, (b))", 1, 8},
+		{"closing to opening", "f(a, (b))", 8, 1},
+		{"nested of the same type", "{ {} { {} } }", 5, 10},
+		{"multi-byte text between", "[\"日本\", é]", 0, 8},
+		{"across lines", "{\n\tx\n}", 0, 5},
+		{"not on a bracket", "f(a)", 2, 2},
+		{"unmatched", "(a", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEditor()
+			b := e.NewScratchBuffer("*test*", tt.content)
+			_ = b.MoveSelectionTo(tt.cursor, false)
+
+			if err := e.JumpToMatchingBracket(false); err != nil {
+				t.Fatalf("JumpToMatchingBracket failed: %v", err)
+			}
+			if got := b.Selection().End; got != tt.expected {
+				t.Errorf("expected cursor at %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestLineOperations(t *testing.T) {
+	content := "one\ntwo\nthree\nfour"
+
+	tests := []struct {
+		name      string
+		start     int // line the cursor starts on
+		run       func(e *Editor) error
+		expected  string
+		register  string
+		line, col int // where the cursor ends
+	}{
+		{"delete a line", 1, func(e *Editor) error { return e.DeleteLines(1) }, "one\nthree\nfour", "two\n", 1, 0},
+		{"delete with a count", 1, func(e *Editor) error { return e.DeleteLines(2) }, "one\nfour", "two\nthree\n", 1, 0},
+		{"delete past the end", 2, func(e *Editor) error { return e.DeleteLines(5) }, "one\ntwo", "three\nfour\n", 1, 0},
+		{"yank lines", 2, func(e *Editor) error { return e.YankLines(2) }, content, "three\nfour\n", 2, 1},
+		{"duplicate a line", 1, func(e *Editor) error { return e.DuplicateLines(1, 1) }, "one\ntwo\ntwo\nthree\nfour", "", 2, 0},
+		{"duplicate the last line", 3, func(e *Editor) error { return e.DuplicateLines(3, 3) }, content + "\nfour", "", 4, 0},
+		{"duplicate command", 0, func(e *Editor) error { return e.Commands().Execute("1,2dup") }, "one\ntwo\none\ntwo\nthree\nfour", "", 2, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEditor()
+			b := e.NewScratchBuffer("*test*", content)
+			b.SetReadOnly(false)
+			_ = b.MoveSelectionToLineCol(tt.start, 1, false)
+
+			if err := tt.run(e); err != nil {
+				t.Fatalf("%s failed: %v", tt.name, err)
+			}
+			if got := b.Text(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if got, _ := e.Register(UnnamedRegister); got != tt.register {
+				t.Errorf("expected register %q, got %q", tt.register, got)
+			}
+			line, col, _ := b.PositionToLineCol(b.Selection().End)
+			if line != tt.line || col != tt.col {
+				t.Errorf("expected cursor at %d:%d, got %d:%d", tt.line, tt.col, line, col)
+			}
+
+			// each operation is undone in one step
+			_ = e.Undo()
+			if got := b.Text(); got != content {
+				t.Errorf("expected undo to restore %q, got %q", content, got)
+			}
+		})
+	}
+}
+
+func TestMoveToSameIndent(t *testing.T) {
+	content := strings.Join([]string{
+		"def a():",
+		"    if x:",
+		"        pass",
+		"",
+		"    return x",
+		"def b():",
+		"\tpass", // a tab is as deep as four spaces
+		"    pass",
+	}, "\n")
+
+	tests := []struct {
+		name     string
+		line     int
+		forward  bool
+		expected int // line the cursor ends on
+		message  string
+	}{
+		{"skips deeper and blank lines", 1, true, 4, ""},
+		{"top level", 0, true, 5, ""},
+		{"back to the top level", 5, false, 0, ""},
+		{"back over deeper lines", 4, false, 1, ""},
+		{"tabs match spaces", 6, true, 7, ""},
+		{"stops at the end of the block", 4, true, 4, "No line with the same indentation"},
+		{"stops at the start of the block", 6, false, 6, "No line with the same indentation"},
+		{"stops at the end of the buffer", 5, true, 5, "No line with the same indentation"},
+		{"blank line", 3, true, 3, "Line is blank"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEditor()
+			b := e.NewScratchBuffer("*test*", content)
+			_ = b.MoveSelectionToLineCol(tt.line, 0, false)
+
+			if err := e.MoveToSameIndent(tt.forward, false); err != nil {
+				t.Fatalf("MoveToSameIndent failed: %v", err)
+			}
+			line, col, _ := b.PositionToLineCol(b.Selection().End)
+			extent, _ := b.LineExtent(line)
+			if line != tt.expected {
+				t.Errorf("expected cursor on line %d, got %d", tt.expected, line)
+			}
+			if tt.message == "" && col != extent.FirstNonBlank {
+				t.Errorf("expected cursor on the first non-blank, got column %d", col)
+			}
+			if got := e.Message(); got != tt.message {
+				t.Errorf("expected message %q, got %q", tt.message, got)
+			}
+		})
+	}
+}
+
+func TestYankAndPaste(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		yank     [2]int // selection yanked into the unnamed register
+		cursor   int
+		before   bool
+		count    int
+		expected string
+		cursorAt int
+	}{
+		{"after the cursor", "abc def", [2]int{0, 3}, 4, false, 1, "abc dabcef", 7},
+		{"before the cursor", "abc def", [2]int{0, 3}, 4, true, 1, "abc abcdef", 6},
+		{"after the end of a line", "ab\ncd", [2]int{3, 5}, 2, false, 1, "abcd\ncd", 3},
+		{"lines below", "one\ntwo\n", [2]int{0, 4}, 5, false, 1, "one\ntwo\none\n", 8},
+		{"lines above", "one\ntwo\n", [2]int{4, 8}, 1, true, 1, "two\none\ntwo\n", 0},
+		{"lines below the last line", "one\ntwo", [2]int{0, 4}, 5, false, 1, "one\ntwo\none", 8},
+		{"counted text", "abc def", [2]int{0, 2}, 4, false, 3, "abc dabababef", 10},
+		{"counted lines", "one\ntwo\n", [2]int{0, 4}, 0, false, 2, "one\none\none\ntwo\n", 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEditor()
+			b := e.NewScratchBuffer("*test*", tt.content)
+			b.SetReadOnly(false)
+			_ = b.MoveSelectionTo(tt.yank[0], false)
+			_ = b.MoveSelectionTo(tt.yank[1], true)
+			if err := e.Yank(); err != nil {
+				t.Fatalf("Yank failed: %v", err)
+			}
+			_ = b.MoveSelectionTo(tt.cursor, false)
+
+			if err := e.Paste(tt.before, tt.count); err != nil {
+				t.Fatalf("Paste failed: %v", err)
+			}
+			if got := b.Text(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if got := b.Selection().End; got != tt.cursorAt {
+				t.Errorf("expected cursor at %d, got %d", tt.cursorAt, got)
+			}
+
+			// the paste is undone at once, back to where the cursor was
+			if err := e.Undo(); err != nil {
+				t.Fatalf("Undo failed: %v", err)
+			}
+			if got := b.Text(); got != tt.content {
+				t.Errorf("expected undo to restore %q, got %q", tt.content, got)
+			}
+			if got := b.Selection().End; got != tt.cursor {
+				t.Errorf("expected undo to put the cursor back at %d, got %d", tt.cursor, got)
+			}
+		})
+	}
+}
+
+func TestRegisters(t *testing.T) {
+	e := NewEditor()
+	b := e.NewScratchBuffer("*test*", "foo bar")
+	b.SetReadOnly(false)
+
+	if err := e.Paste(false, 1); err != nil {
+		t.Fatalf("Paste failed: %v", err)
+	}
+	if got := e.Message(); got != `Nothing in register "` {
+		t.Errorf("expected an empty register message, got %q", got)
+	}
+
+	// a named register keeps its text while the unnamed one moves on
+	_ = b.MoveSelectionTo(3, true)
+	e.SelectRegister('a')
+	_ = e.Yank()
+	_ = b.MoveSelectionTo(4, false)
+	_ = b.MoveSelectionTo(7, true)
+	_ = e.Yank()
+	if got, _ := e.Register('a'); got != "foo" {
+		t.Errorf("expected register a to hold %q, got %q", "foo", got)
+	}
+	if got, _ := e.Register(UnnamedRegister); got != "bar" {
+		t.Errorf("expected the unnamed register to hold %q, got %q", "bar", got)
+	}
+
+	// an empty selection yanks nothing
+	b.CollapseSelectionsToCursor()
+	_ = e.Yank()
+	if got, _ := e.Register(UnnamedRegister); got != "bar" {
+		t.Errorf("expected an empty yank to keep %q, got %q", "bar", got)
+	}
+
+	// the selected register is used once
+	_ = b.MoveSelectionTo(0, false)
+	e.SelectRegister('a')
+	_ = e.Paste(true, 1)
+	_ = e.Paste(true, 1)
+	if got := b.Text(); got != "fobarofoo bar" {
+		t.Errorf("expected %q, got %q", "fobarofoo bar", got)
+	}
+
+	e.SelectRegister('%')
+	if got := e.Message(); got != "Invalid register: %" {
+		t.Errorf("expected an invalid register message, got %q", got)
+	}
+}
+
+func TestJumpToDiagnostic(t *testing.T) {
+	e := NewEditor()
+	b := e.NewScratchBuffer("*test*", "one\ntwo\nthree\nfour")
+	// seeded out of order; the buffer sorts them by position
+	b.SetDiagnostics([]buffer.Diagnostic{
+		{Line: 2, Col: 1, Severity: buffer.SeverityWarning, Message: "unused"},
+		{Line: 0, Col: 2, Severity: buffer.SeverityError, Message: "undefined"},
+		{Line: 2, Col: 3, Severity: buffer.SeverityHint, Message: "simplify"},
+	})
+
+	steps := []struct {
+		name    string
+		move    func() error
+		line    int
+		col     int
+		message string
+	}{
+		{"next", func() error { return e.NextDiagnostic(1) }, 0, 2, "error: undefined"},
+		{"next on another line", func() error { return e.NextDiagnostic(1) }, 2, 1, "warning: unused"},
+		{"next on the same line", func() error { return e.NextDiagnostic(1) }, 2, 3, "hint: simplify"},
+		{"next wraps to the first", func() error { return e.NextDiagnostic(1) }, 0, 2, "error: undefined"},
+		{"prev wraps to the last", func() error { return e.PrevDiagnostic(1) }, 2, 3, "hint: simplify"},
+		{"prev", func() error { return e.PrevDiagnostic(1) }, 2, 1, "warning: unused"},
+		{"counted next", func() error { return e.NextDiagnostic(2) }, 0, 2, "error: undefined"},
+	}
+
+	for _, step := range steps {
+		if err := step.move(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		line, col, _ := e.current.PositionToLineCol(b.Selection().End)
+		if line != step.line || col != step.col {
+			t.Errorf("%s: expected %d:%d, got %d:%d", step.name, step.line, step.col, line, col)
+		}
+		if got := e.Message(); got != step.message {
+			t.Errorf("%s: expected message %q, got %q", step.name, step.message, got)
+		}
+	}
+
+	// a buffer without diagnostics stays put
+	b.SetDiagnostics(nil)
+	_ = b.MoveSelectionTo(5, false)
+	if err := e.NextDiagnostic(1); err != nil {
+		t.Fatalf("NextDiagnostic failed: %v", err)
+	}
+	if got := b.Selection().End; got != 5 || e.Message() != "No diagnostics" {
+		t.Errorf("expected no move and a message, got %d and %q", got, e.Message())
+	}
+}
+
+func TestReselectVisual(t *testing.T) {
+	e := NewEditor()
+	b := e.NewScratchBuffer("*test*", "one two three")
+	b.SetReadOnly(false)
+
+	if err := e.ReselectVisual(); err != nil || e.GetMode() == state.Visual {
+		t.Fatalf("expected nothing to reselect, got %v in mode %v", err, e.GetMode())
+	}
+
+	_ = b.MoveSelectionTo(4, false)
+	e.SetMode(state.Visual)
+	_ = b.MoveSelectionTo(7, true)
+	e.SetMode(state.Normal)
+	if sel := b.Selection(); sel.Start != sel.End {
+		t.Fatalf("expected leaving visual mode to collapse the selection, got %+v", sel)
+	}
+
+	if err := e.ReselectVisual(); err != nil {
+		t.Fatalf("ReselectVisual failed: %v", err)
+	}
+	if sel := b.Selection(); sel != (state.Selection{Start: 4, End: 7}) || e.GetMode() != state.Visual {
+		t.Errorf("expected 4-7 in visual mode, got %+v in mode %v", sel, e.GetMode())
+	}
+
+	// edits before the selection move it along
+	e.SetMode(state.Normal)
+	_ = b.MoveSelectionTo(0, false)
+	_ = b.Insert("> ")
+	_ = e.ReselectVisual()
+	if sel := b.Selection(); sel != (state.Selection{Start: 6, End: 9}) {
+		t.Errorf("expected 6-9 after inserting before it, got %+v", sel)
+	}
+
+	// deleting past the selection clamps it to the document
+	e.SetMode(state.Normal)
+	_ = b.MoveSelectionTo(0, false)
+	_ = b.MoveSelectionTo(8, true)
+	_ = b.DeleteSelection()
+	_ = e.ReselectVisual()
+	if sel := b.Selection(); sel != (state.Selection{Start: 0, End: 1}) {
+		t.Errorf("expected 0-1 after deleting over it, got %+v", sel)
+	}
+}
+
+func TestFindCharWithCount(t *testing.T) {
+	e := NewEditor()
+	e.NewScratchBuffer("*test*", "a,b,c,d,e\nx,y")
+
+	cursor := func() int {
+		sel, _ := e.Selection()
+		return sel.End
+	}
+
+	// 2f,
+	if err := e.FindChar(",", true, false, 2, false); err != nil {
+		t.Fatalf("FindChar failed: %v", err)
+	}
+	if cursor() != 3 {
+		t.Errorf("expected 2f, to land on 3, got %d", cursor())
+	}
+
+	// ;
+	if err := e.RepeatFind(false, 1, false); err != nil {
+		t.Fatalf("RepeatFind failed: %v", err)
+	}
+	if cursor() != 5 {
+		t.Errorf("expected ; to land on 5, got %d", cursor())
+	}
+
+	// 3, goes back three commas
+	_ = e.RepeatFind(true, 3, false)
+	if cursor() != 1 {
+		t.Errorf("expected 3, to land on 1, got %d", cursor())
+	}
+
+	// 3; then clamps to the last comma on the line without crossing into the next
+	_ = e.RepeatFind(false, 3, false)
+	if cursor() != 7 {
+		t.Errorf("expected 3; to land on 7, got %d", cursor())
+	}
+	_ = e.RepeatFind(false, 3, false)
+	if cursor() != 7 {
+		t.Errorf("expected 3; to stay on the last comma, got %d", cursor())
+	}
+
+	// t; repeated skips past the adjacent target
+	_ = e.MoveCursorHorizontal(-7, false)
+	_ = e.FindChar(",", true, true, 1, false)
+	if cursor() != 0 {
+		t.Errorf("expected t, adjacent to stay at 0, got %d", cursor())
+	}
+	_ = e.RepeatFind(false, 1, false)
+	if cursor() != 2 {
+		t.Errorf("expected ; after t, to land on 2, got %d", cursor())
+	}
+
+	// missing character leaves the cursor unchanged
+	if err := e.FindChar("z", true, false, 1, false); err == nil {
+		t.Errorf("expected error for missing character")
+	}
+	if cursor() != 2 {
+		t.Errorf("expected cursor unchanged at 2, got %d", cursor())
+	}
+}
+
+func TestMoveVisualLines(t *testing.T) {
+	e := NewEditor()
+	// the middle line wraps three times at a width of 30
+	e.NewScratchBuffer("*test*", "short\n"+strings.Repeat("x", 100)+"\nend")
+	_ = e.MoveCursorHorizontal(2, false)
+
+	steps := []struct {
+		name   string
+		offset int
+		line   int
+		col    int
+	}{
+		{"onto wrapped line", 1, 1, 2},
+		{"second row", 1, 1, 32},
+		{"third row", 1, 1, 62},
+		{"fourth row", 1, 1, 92},
+		{"past wrapped line", 1, 2, 2},
+		{"back onto last row", -1, 1, 92},
+		{"up two rows", -2, 1, 32},
+		{"up past wrapped line", -2, 0, 2},
+		{"counted move stops at last row", 10, 2, 2},
+	}
+
+	for _, step := range steps {
+		if err := e.MoveVisualLines(step.offset, 30, false); err != nil {
+			t.Fatalf("%s: MoveVisualLines failed: %v", step.name, err)
+		}
+		line, col, _ := e.GetCurrentPosition()
+		if line != step.line || col != step.col {
+			t.Errorf("%s: expected %d:%d, got %d:%d", step.name, step.line, step.col, line, col)
+		}
+	}
+
+	// without wrapping, visual movement is plain line movement
+	_ = e.JumpToLine(1, false)
+	if err := e.MoveVisualLines(1, 0, false); err != nil {
+		t.Fatalf("MoveVisualLines failed: %v", err)
+	}
+	if line, _, _ := e.GetCurrentPosition(); line != 2 {
+		t.Errorf("expected unwrapped move to reach line 2, got %d", line)
+	}
+}
+
+func TestMoveVisualLinesDisplayWidth(t *testing.T) {
+	e := NewEditor()
+	// at a width of 5 the tab fills columns 0-3 and the wide characters start at
+	// 4, 6, 8 and 10, so the middle line wraps into three rows and the first wide
+	// character straddles the first row break
+	e.NewScratchBuffer("*test*", "abc\n\t中中中中\nend")
+
+	steps := []struct {
+		name   string
+		offset int
+		line   int
+		col    int
+	}{
+		{"onto the tab", 1, 1, 0},
+		{"past the straddling character", 1, 1, 2},
+		{"third row", 1, 1, 4},
+		{"past wrapped line", 1, 2, 0},
+		{"back onto last row", -1, 1, 4},
+		{"second row", -1, 1, 2},
+		{"first row", -1, 1, 0},
+	}
+
+	for _, step := range steps {
+		if err := e.MoveVisualLines(step.offset, 5, false); err != nil {
+			t.Fatalf("%s: MoveVisualLines failed: %v", step.name, err)
+		}
+		line, col, _ := e.GetCurrentPosition()
+		if line != step.line || col != step.col {
+			t.Errorf("%s: expected %d:%d, got %d:%d", step.name, step.line, step.col, line, col)
+		}
+	}
+}
+
+func TestDeleteSoftTab(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		col      int
+		stop     int
+		expected string
+	}{
+		{"aligned indentation", "        x", 8, 4, "    x"},
+		{"unaligned indentation", "      x", 6, 4, "    x"},
+		{"partial indentation", "   x", 3, 4, "x"},
+		{"cursor inside indentation", "        x", 4, 4, "    x"},
+		{"after text", "    ab", 6, 4, "    a"},
+		{"spaces after text", "a       ", 8, 4, "a      "},
+		{"disabled", "        x", 8, 0, "       x"},
+		{"tab indentation", "\t\tx", 2, 4, "\tx"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEditor()
+			e.NewScratchBuffer("*test*", tt.content).SetReadOnly(false)
+			_ = e.MoveCursorHorizontal(tt.col, false)
+
+			if err := e.DeleteSoftTab(tt.stop); err != nil {
+				t.Fatalf("DeleteSoftTab failed: %v", err)
+			}
+			if got, _ := e.GetLine(0); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIndentationByLanguage(t *testing.T) {
+	e := NewEditor()
+	e.SetIndentationResolver(func(fileName string) buffer.Indentation {
+		if filepath.Ext(fileName) == ".py" {
+			return buffer.Indentation{UseTabs: false, TabWidth: 4}
+		}
+		return buffer.DefaultIndentation
+	})
+
+	tests := []struct {
+		fileName string
+		expected string
+	}{
+		{"main.go", "\tx"},
+		{"main.py", "    x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fileName, func(t *testing.T) {
+			e.NewScratchBuffer(tt.fileName, "x").SetReadOnly(false)
+			e.SetMode(state.Insert)
+
+			if err := e.InsertIndent(); err != nil {
+				t.Fatalf("InsertIndent failed: %v", err)
+			}
+			if got, _ := e.GetLine(0); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCloseCurrentBufferUsesMostRecent(t *testing.T) {
+	tests := []struct {
+		name     string
+		switches []string
+		expected string
+	}{
+		{"middle buffer after opening in order", []string{"*b*"}, "*c*"},
+		{"middle buffer after visiting the first", []string{"*a*", "*b*"}, "*a*"},
+		{"last buffer after visiting the first", []string{"*a*", "*c*"}, "*a*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEditor()
+			for _, name := range []string{"*a*", "*b*", "*c*"} {
+				e.NewScratchBuffer(name, name)
+			}
+			for _, name := range tt.switches {
+				if err := e.SwitchBuffer(name); err != nil {
+					t.Fatalf("SwitchBuffer(%s) failed: %v", name, err)
+				}
+			}
+
+			if err := e.CloseCurrentBuffer(); err != nil {
+				t.Fatalf("CloseCurrentBuffer failed: %v", err)
+			}
+			if name, _ := e.FileName(); name != tt.expected {
+				t.Errorf("expected %q to be current, got %q", tt.expected, name)
+			}
+			if got := len(e.GetBufferList()); got != 2 {
+				t.Errorf("expected 2 open buffers, got %d", got)
+			}
+		})
+	}
+
+	e := NewEditor()
+	e.NewScratchBuffer("*only*", "")
+	_ = e.CloseCurrentBuffer()
+	if _, err := e.FileName(); !errors.Is(err, ErrNoBuffer) {
+		t.Errorf("expected no current buffer after closing the last one, got %v", err)
+	}
+}
+
+func TestCloseCurrentBufferSaves(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixEOL   bool
+		external string // content another program writes first, empty for none
+		expected string // file content after closing
+		err      error
+	}{
+		{"unsaved changes", false, "", "xa", nil},
+		{"trailing newline fixed", true, "", "xa\n", nil},
+		{"file changed on disk", false, "changed elsewhere", "changed elsewhere", buffer.ErrExternalChange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTempFile(t, "close.txt", "a")
+			e := NewEditor()
+			e.SetFixEOLOnSave(tt.fixEOL)
+			e.NewScratchBuffer("*other*", "")
+			if err := e.OpenFile(path); err != nil {
+				t.Fatalf("OpenFile failed: %v", err)
+			}
+			e.SetMode(state.Insert)
+			_ = e.InsertText("x")
+			if tt.external != "" {
+				if err := os.WriteFile(path, []byte(tt.external), 0644); err != nil {
+					t.Fatalf("failed to write file: %v", err)
+				}
+			}
+
+			if err := e.CloseCurrentBuffer(); !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if got, _ := os.ReadFile(path); string(got) != tt.expected {
+				t.Errorf("expected %q on disk, got %q", tt.expected, got)
+			}
+			// a buffer that couldn't be saved stays open with its changes
+			if current, _ := e.FilePath(); (tt.err != nil) != (current == path) {
+				t.Errorf("unexpected current buffer %q", current)
+			}
+		})
+	}
+}
+
+func TestPositionWithoutBuffer(t *testing.T) {
+	e := NewEditor()
+	e.NewScratchBuffer("*a*", "abc")
+	e.NewScratchBuffer("*b*", "def")
+	for range 2 {
+		if err := e.CloseCurrentBuffer(); err != nil {
+			t.Fatalf("CloseCurrentBuffer failed: %v", err)
+		}
+	}
+
+	if _, _, err := e.GetCurrentPosition(); !errors.Is(err, ErrNoBuffer) {
+		t.Errorf("GetCurrentPosition: expected ErrNoBuffer, got %v", err)
+	}
+	if _, _, err := e.LineCol(0); !errors.Is(err, ErrNoBuffer) {
+		t.Errorf("LineCol: expected ErrNoBuffer, got %v", err)
+	}
+	if _, err := e.VirtualColumn(); !errors.Is(err, ErrNoBuffer) {
+		t.Errorf("VirtualColumn: expected ErrNoBuffer, got %v", err)
+	}
+	if _, err := e.Selection(); !errors.Is(err, ErrNoBuffer) {
+		t.Errorf("Selection: expected ErrNoBuffer, got %v", err)
+	}
+}
+
+func TestBufferOptions(t *testing.T) {
+	e := NewEditor()
+	e.NewScratchBuffer("*a*", "")
+	e.NewScratchBuffer("*b*", "")
+
+	if err := e.SetBufferOption(buffer.OptionWrap, true); err != nil {
+		t.Fatalf("SetBufferOption failed: %v", err)
+	}
+	if err := e.SetBufferOption("bogus", true); !errors.Is(err, buffer.ErrUnknownOption) {
+		t.Errorf("expected ErrUnknownOption, got %v", err)
+	}
+	if value, set := e.BufferOption(buffer.OptionWrap); !value || !set {
+		t.Errorf("expected wrap to be set in *b*, got %v (set %v)", value, set)
+	}
+
+	if err := e.SwitchBuffer("*a*"); err != nil {
+		t.Fatalf("SwitchBuffer failed: %v", err)
+	}
+	if _, set := e.BufferOption(buffer.OptionWrap); set {
+		t.Errorf("expected wrap to be unset in *a*")
+	}
+}
+
+func TestInsertAutoPair(t *testing.T) {
+	tests := []struct {
+		name         string
+		file         string // opened from disk so it has a syntax tree; empty for a scratch buffer
+		content      string
+		line, col    int
+		ch           string
+		contextAware bool
+		expected     string
+	}{
+		{"pairs outside a string", "a.rs", `let s = "abc";`, 0, 14, `"`, true, `let s = "abc";""`},
+		{"no pair inside a string", "a.rs", `let s = "abc";`, 0, 10, `"`, true, `let s = "a"bc";`},
+		{"no pair inside a comment", "a.rs", "// note", 0, 7, "(", true, "// note("},
+		{"pairs after a block comment", "a.rs", "/* a */", 0, 7, "(", true, "/* a */()"},
+		{"no pair after a comment ending in a slash", "a.rs", "// a/b/", 0, 7, "(", true, "// a/b/("},
+		{"pairs after a division", "a.rs", "let x = a / b", 0, 13, "(", true, "let x = a / b()"},
+		{"inside a string without context", "a.rs", `let s = "abc";`, 0, 10, `"`, false, `let s = "a""bc";`},
+		{"types over the closer", "a.rs", "f()", 0, 2, ")", true, "f()"},
+		{"heuristic outside a string", "", `x = "a" `, 0, 8, "'", true, `x = "a" ''`},
+		{"heuristic inside a string", "", `x = "a b`, 0, 6, "[", true, `x = "a[ b`},
+		{"heuristic inside a comment", "", "x // y", 0, 6, "{", true, "x // y{"},
+		{"plain character", "", "ab", 0, 1, "x", true, "axb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewEditor()
+			if tt.file != "" {
+				if err := e.OpenFile(writeTempFile(t, tt.file, tt.content)); err != nil {
+					t.Fatalf("OpenFile failed: %v", err)
+				}
+			} else {
+				e.NewScratchBuffer("*test*", tt.content).SetReadOnly(false)
+			}
+			e.SetMode(state.Insert)
+			if err := e.SetCursor(tt.line, tt.col, false); err != nil {
+				t.Fatalf("SetCursor failed: %v", err)
+			}
+
+			if err := e.InsertAutoPair(tt.ch, tt.contextAware); err != nil {
+				t.Fatalf("InsertAutoPair failed: %v", err)
+			}
+			if text, _ := e.Text(); text != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, text)
+			}
+			if _, col, _ := e.GetCurrentPosition(); col != tt.col+1 {
+				t.Errorf("expected cursor at column %d, got %d", tt.col+1, col)
+			}
+		})
+	}
+}
+
+func TestJumpList(t *testing.T) {
+	e := NewEditor()
+	e.NewScratchBuffer("*test*", "one\ntwo\nthree\nfour")
+	cursor := func() int {
+		sel, _ := e.Selection()
+		return sel.End
+	}
+
+	// without jumps, there's nowhere to go
+	if err := e.JumpBack(1); err != nil || cursor() != 0 {
+		t.Fatalf("expected JumpBack to stay at 0, got %d (%v)", cursor(), err)
+	}
+
+	_ = e.MoveCursorHorizontal(1, false)
+	_ = e.JumpToBottom(false) // from 1 to 14
+	_ = e.JumpToBottom(false) // the same position isn't recorded twice
+	_, _ = e.Search("two", false)
+	_ = e.JumpToLine(2, false) // from 4 to 8
+
+	steps := []struct {
+		back     bool
+		count    int
+		expected int
+	}{
+		{true, 1, 4},
+		{true, 1, 14},
+		{true, 1, 1},
+		{true, 1, 1}, // the oldest entry
+		{false, 2, 4},
+		{false, 1, 8},
+		{false, 1, 8}, // the newest entry
+		{true, 3, 1},
+	}
+	for i, step := range steps {
+		var err error
+		if step.back {
+			err = e.JumpBack(step.count)
+		} else {
+			err = e.JumpForward(step.count)
+		}
+		if err != nil {
+			t.Fatalf("step %d failed: %v", i, err)
+		}
+		if got := cursor(); got != step.expected {
+			t.Errorf("step %d: expected cursor at %d, got %d", i, step.expected, got)
+		}
+	}
+
+	// positions past the end of the buffer after edits are clamped
+	e.NewScratchBuffer("*other*", "a")
+	b := e.NewScratchBuffer("*short*", "abcdef")
+	_ = e.JumpToBottom(false)
+	_ = e.MoveCursorHorizontal(5, false)
+	_ = e.JumpToTop(false)
+	b.SetReadOnly(false)
+	if err := b.Delete(2, 6); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.JumpBack(1); err != nil || cursor() != 2 {
+		t.Errorf("expected the jump clamped to 2, got %d (%v)", cursor(), err)
+	}
+
+	// going further back switches to the buffer the older jumps were made in
+	if err := e.JumpBack(2); err != nil {
+		t.Fatalf("JumpBack failed: %v", err)
+	}
+	if name, _ := e.FileName(); name != "*test*" || cursor() != 8 {
+		t.Errorf("expected to be back in *test* at 8, got %s at %d", name, cursor())
+	}
+}
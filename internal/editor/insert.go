@@ -0,0 +1,142 @@
+package editor
+
+import (
+	"strings"
+
+	"github.com/lg2m/athena/internal/editor/state"
+)
+
+// InsertCommand is the normal mode command an insert session was entered with.
+type InsertCommand string
+
+const (
+	InsertBefore    InsertCommand = "i" // insert at the cursor
+	InsertAfter     InsertCommand = "a" // insert after the cursor
+	InsertLineEnd   InsertCommand = "A" // append to the end of the line
+	InsertOpenBelow InsertCommand = "o" // open a new line below
+	InsertOpenAbove InsertCommand = "O" // open a new line above
+)
+
+// insertSession records an insert, from entering insert mode until leaving it.
+type insertSession struct {
+	command InsertCommand
+	count   int
+	start   int    // position typing began at
+	text    string // text typed, filled in when the session ends
+}
+
+// BeginInsert runs an insert command and enters insert mode. When insert mode is
+// left, the typed text is inserted count-1 more times: after itself for i, a and A,
+// and each time on a line of its own for o and O, so 3o opens three lines holding
+// the same text.
+func (e *Editor) BeginInsert(command InsertCommand, count int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if err := e.runInsertCommand(command); err != nil {
+		return err
+	}
+	e.beginInsert(command, count)
+	return nil
+}
+
+// replayInsert repeats an insert session for the . command: its insert command runs
+// again and the recorded text is typed count times; the caller must hold the lock.
+func (e *Editor) replayInsert(session insertSession, count int) error {
+	session.count = max(count, 1)
+	if err := e.runInsertCommand(session.command); err != nil {
+		return err
+	}
+	if err := e.current.Insert(session.text); err != nil {
+		return err
+	}
+	if err := e.repeatInsert(session); err != nil {
+		return err
+	}
+	e.desiredColumn = -1
+	return nil
+}
+
+// runInsertCommand moves the cursor to where an insert command starts typing, opening
+// a line for o and O, and opens the undo group the insert is recorded in; the caller
+// must hold the lock.
+func (e *Editor) runInsertCommand(command InsertCommand) error {
+	e.current.BeginUndoGroup()
+	e.current.CollapseSelectionsToCursor()
+	pos := e.current.Selection().End
+	line, col, err := e.current.PositionToLineCol(pos)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case InsertAfter:
+		if length, err := e.current.LineLength(line); err == nil && col < length {
+			return e.current.MoveSelectionTo(pos+1, false)
+		}
+	case InsertLineEnd:
+		return e.current.MoveSelectionToLineEnd(line, false)
+	case InsertOpenBelow:
+		if err := e.current.MoveSelectionToLineEnd(line, false); err != nil {
+			return err
+		}
+		return e.current.Insert("\n")
+	case InsertOpenAbove:
+		if err := e.current.MoveSelectionToLineCol(line, 0, false); err != nil {
+			return err
+		}
+		if err := e.current.Insert("\n"); err != nil {
+			return err
+		}
+		return e.current.MoveSelectionTo(e.current.Selection().End-1, false)
+	}
+	return nil
+}
+
+// beginInsert enters insert mode and starts recording, making the whole session a
+// single undo step; the caller must hold the lock.
+func (e *Editor) beginInsert(command InsertCommand, count int) {
+	e.current.BeginUndoGroup()
+	e.insert = &insertSession{
+		command: command,
+		count:   max(count, 1),
+		start:   e.current.Selection().End,
+	}
+	e.desiredColumn = -1
+	e.mode = state.Insert
+}
+
+// endInsert records the text typed since insert mode was entered and inserts it
+// count-1 more times; the caller must hold the lock. Text typed before moving the
+// cursor back past where typing began isn't recorded.
+func (e *Editor) endInsert() {
+	session := e.insert
+	e.insert = nil
+	if session == nil || e.current == nil {
+		return
+	}
+
+	if end := e.current.Selection().End; end > session.start {
+		session.text, _ = e.current.Substring(session.start, end)
+	}
+	_ = e.repeatInsert(*session)
+	e.current.EndUndoGroup()
+	e.recordChange(session.count, func(count int) error { return e.replayInsert(*session, count) })
+}
+
+// repeatInsert types the text of a session count-1 more times at the cursor;
+// the caller must hold the lock.
+func (e *Editor) repeatInsert(session insertSession) error {
+	if session.count <= 1 || session.text == "" {
+		return nil
+	}
+
+	text := session.text
+	if session.command == InsertOpenBelow || session.command == InsertOpenAbove {
+		text = "\n" + text
+	}
+	return e.current.Insert(strings.Repeat(text, session.count-1))
+}
@@ -0,0 +1,118 @@
+package editor
+
+import (
+	"slices"
+
+	"github.com/lg2m/athena/internal/editor/buffer"
+)
+
+// JumpListSize is the number of jumps kept before the oldest are dropped.
+const JumpListSize = 100
+
+// jump is a cursor position recorded before a large motion. The position is a
+// grapheme offset, clamped to the buffer when jumped back to.
+type jump struct {
+	buffer *buffer.Buffer
+	pos    int
+}
+
+// jumpList is the history of positions JumpBack and JumpForward move through.
+type jumpList struct {
+	entries []jump
+	index   int // entry the cursor was last moved to, len(entries) when not navigating
+}
+
+// recordJump adds the cursor's position to the jump list, before a motion that
+// may take it far away; the caller must hold the lock. Navigating the list ends,
+// and jumping from the newest entry's position adds nothing.
+func (e *Editor) recordJump() {
+	if e.current == nil {
+		return
+	}
+	e.jumps.add(jump{buffer: e.current, pos: e.current.Selection().End})
+}
+
+// add appends j unless it's the newest entry already, dropping the oldest entries
+// past JumpListSize.
+func (l *jumpList) add(j jump) {
+	if n := len(l.entries); n == 0 || l.entries[n-1] != j {
+		l.entries = append(l.entries, j)
+	}
+	if len(l.entries) > JumpListSize {
+		l.entries = slices.Delete(l.entries, 0, len(l.entries)-JumpListSize)
+	}
+	l.index = len(l.entries)
+}
+
+// JumpBack moves the cursor to the count-th position in the jump list before the
+// one it was last moved to, switching buffers when the position is in another.
+// The cursor's own position is recorded first, so JumpForward can return to it.
+func (e *Editor) JumpBack(count int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	e.dropClosedJumps()
+	if len(e.jumps.entries) == 0 {
+		return nil
+	}
+	if e.jumps.index == len(e.jumps.entries) {
+		e.recordJump()
+		e.jumps.index = len(e.jumps.entries) - 1
+	}
+	return e.jumpTo(e.jumps.index - max(count, 1))
+}
+
+// JumpForward moves the cursor to the count-th position in the jump list after the
+// one JumpBack last moved it to.
+func (e *Editor) JumpForward(count int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	e.dropClosedJumps()
+	if e.jumps.index >= len(e.jumps.entries) {
+		return nil
+	}
+	return e.jumpTo(e.jumps.index + max(count, 1))
+}
+
+// jumpTo moves the cursor to the jump list entry at index, clamped to the list;
+// the caller must hold the lock.
+func (e *Editor) jumpTo(index int) error {
+	if len(e.jumps.entries) == 0 {
+		return nil
+	}
+	index = max(0, min(index, len(e.jumps.entries)-1))
+	if index == e.jumps.index {
+		return nil
+	}
+	e.jumps.index = index
+
+	target := e.jumps.entries[index]
+	if target.buffer != e.current {
+		e.setCurrent(target.buffer)
+	}
+	pos := min(target.pos, e.current.TotalGraphemes())
+	if err := e.current.MoveSelectionTo(pos, false); err != nil {
+		return err
+	}
+	return e.trackColumn()
+}
+
+// dropClosedJumps removes the entries of buffers that were closed since they were
+// recorded; the caller must hold the lock.
+func (e *Editor) dropClosedJumps() {
+	for i := len(e.jumps.entries) - 1; i >= 0; i-- {
+		if !slices.Contains(e.recent, e.jumps.entries[i].buffer) {
+			e.jumps.entries = slices.Delete(e.jumps.entries, i, i+1)
+			if e.jumps.index > i {
+				e.jumps.index--
+			}
+		}
+	}
+}
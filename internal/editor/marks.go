@@ -0,0 +1,39 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lg2m/athena/internal/editor/buffer"
+)
+
+// SetMark sets the mark named r at the cursor in the current buffer.
+func (e *Editor) SetMark(r rune) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	e.current.SetMark(r)
+	return nil
+}
+
+// GotoMark moves the cursor to the mark named r in the current buffer, recording
+// the jump. An unset mark returns an error meant to be shown to the user.
+func (e *Editor) GotoMark(r rune) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	from := e.current.Selection().End
+	if err := e.current.GotoMark(r); errors.Is(err, buffer.ErrMarkNotSet) {
+		return fmt.Errorf("Mark not set: %c", r)
+	} else if err != nil {
+		return err
+	}
+	e.jumps.add(jump{buffer: e.current, pos: from})
+	return e.trackColumn()
+}
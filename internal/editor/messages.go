@@ -0,0 +1,80 @@
+package editor
+
+import "time"
+
+// MessageLogSize is the number of messages kept before the oldest are dropped.
+const MessageLogSize = 100
+
+// LogEntry is a message recorded in the editor's message log.
+type LogEntry struct {
+	Time time.Time
+	Text string
+}
+
+// messageLog is a fixed-size ring buffer of recent messages.
+type messageLog struct {
+	entries []LogEntry
+	next    int // index the next entry is written to once the log is full
+}
+
+func newMessageLog(size int) *messageLog {
+	return &messageLog{entries: make([]LogEntry, 0, size)}
+}
+
+// add records an entry, overwriting the oldest one when the log is full.
+func (l *messageLog) add(entry LogEntry) {
+	if len(l.entries) < cap(l.entries) {
+		l.entries = append(l.entries, entry)
+		return
+	}
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % len(l.entries)
+}
+
+// list returns the entries oldest first.
+func (l *messageLog) list() []LogEntry {
+	list := make([]LogEntry, 0, len(l.entries))
+	list = append(list, l.entries[l.next:]...)
+	return append(list, l.entries[:l.next]...)
+}
+
+// LogMessage records a message in the message log without showing it in the status area.
+func (e *Editor) LogMessage(msg string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.messages.add(LogEntry{Time: time.Now(), Text: msg})
+}
+
+// Messages returns the recorded messages, oldest first.
+func (e *Editor) Messages() []LogEntry {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.messages.list()
+}
+
+// MessagesVisible reports whether the message log panel is open.
+func (e *Editor) MessagesVisible() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.showMessages
+}
+
+// ToggleMessages opens or closes the message log panel.
+func (e *Editor) ToggleMessages() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.showMessages = !e.showMessages
+}
+
+// setMessage shows a status message and records it in the message log;
+// the caller must hold the lock.
+func (e *Editor) setMessage(msg string) {
+	e.message = msg
+	if msg != "" {
+		e.messages.add(LogEntry{Time: time.Now(), Text: msg})
+	}
+}
@@ -0,0 +1,67 @@
+package editor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ReadFileBelow inserts the content of the file at path as lines below the cursor's
+// line, leaving the cursor at the start of the inserted block.
+func (e *Editor) ReadFileBelow(path string) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("Can't open file %s", path)
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.readBelow(file)
+}
+
+// ReadCommandBelow runs command through the shell and inserts its output as lines
+// below the cursor's line. The output is collected before the buffer is touched, so
+// the editor stays responsive while the command runs. Output written before a
+// failure is kept, and the error carries the first line the command wrote to stderr.
+func (e *Editor) ReadCommandBelow(command string) error {
+	cmd := exec.Command("sh", "-c", command)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	runErr := cmd.Run()
+
+	e.mu.Lock()
+	readErr := e.readBelow(&stdout)
+	e.mu.Unlock()
+
+	if runErr != nil {
+		if msg, _, _ := strings.Cut(strings.TrimSpace(stderr.String()), "\n"); msg != "" {
+			return fmt.Errorf("Command failed: %s", msg)
+		}
+		return fmt.Errorf("Command failed: %w", runErr)
+	}
+	return readErr
+}
+
+// readBelow streams r into the current buffer below the cursor's line; the caller
+// must hold the lock.
+func (e *Editor) readBelow(r io.Reader) error {
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	line, _, err := e.current.PositionToLineCol(e.current.Selection().End)
+	if err != nil {
+		return err
+	}
+	if _, err := e.current.ReadBelow(line, r); err != nil {
+		return err
+	}
+	return e.trackColumn()
+}
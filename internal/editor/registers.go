@@ -0,0 +1,258 @@
+package editor
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// UnnamedRegister is the register yank and paste use unless another is selected.
+const UnnamedRegister = '"'
+
+// SelectRegister makes the next yank or paste use the register name, a letter or
+// digit, or the unnamed register ".
+func (e *Editor) SelectRegister(name rune) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if name != UnnamedRegister && !unicode.IsLetter(name) && !unicode.IsDigit(name) {
+		e.setMessage(fmt.Sprintf("Invalid register: %c", name))
+		return
+	}
+	e.register = name
+}
+
+// Register returns the text held by a register.
+func (e *Editor) Register(name rune) (string, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	text, ok := e.registers[name]
+	return text, ok
+}
+
+// Yank copies the selected text into the selected register, and into the unnamed
+// one as well. Nothing happens when the selection is empty, so the registers keep
+// what they hold.
+func (e *Editor) Yank() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	name := e.takeRegister()
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	selection := e.current.Selection()
+	start, end := min(selection.Start, selection.End), max(selection.Start, selection.End)
+	if start == end {
+		return nil
+	}
+	text, err := e.current.Substring(start, end)
+	if err != nil {
+		return err
+	}
+
+	e.registers[name] = text
+	e.registers[UnnamedRegister] = text
+	return nil
+}
+
+// YankLines copies count lines from the cursor's line, each with its newline, into
+// the selected register and the unnamed one, for them to be pasted as whole lines.
+func (e *Editor) YankLines(count int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	name := e.takeRegister()
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	text, _, err := e.countedLines(count)
+	if err != nil {
+		return err
+	}
+
+	e.registers[name] = text
+	e.registers[UnnamedRegister] = text
+	return nil
+}
+
+// DeleteLines deletes count lines from the cursor's line, keeping them in the
+// selected register and the unnamed one like YankLines. The cursor ends at the start
+// of the line after them, and the deletion is undone as a single step.
+func (e *Editor) DeleteLines(count int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	name := e.takeRegister()
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if err := e.deleteLines(name, count); err != nil {
+		return err
+	}
+	e.recordChange(count, func(count int) error { return e.deleteLines(name, count) })
+	return nil
+}
+
+// deleteLines deletes count lines from the cursor's line into register name and the
+// unnamed one; the caller must hold the lock.
+func (e *Editor) deleteLines(name rune, count int) error {
+	text, line, err := e.countedLines(count)
+	if err != nil {
+		return err
+	}
+
+	e.current.BeginUndoGroup()
+	defer e.current.EndUndoGroup()
+
+	// the lines below move up into the deleted one's place
+	for range strings.Count(text, "\n") {
+		if err := e.current.DeleteLine(line); err != nil {
+			return err
+		}
+	}
+	e.registers[name] = text
+	e.registers[UnnamedRegister] = text
+	return e.trackColumn()
+}
+
+// DuplicateLines inserts a copy of the lines from first to last inclusive below
+// them, leaving the cursor at the start of the copy. The registers are left alone.
+func (e *Editor) DuplicateLines(first, last int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	text, err := e.current.LineRange(first, last)
+	if err != nil {
+		return err
+	}
+
+	e.current.BeginUndoGroup()
+	defer e.current.EndUndoGroup()
+
+	if err := e.pasteLines(text, last, false); err != nil {
+		return err
+	}
+	return e.trackColumn()
+}
+
+// countedLines returns count lines from the cursor's line, fewer when the buffer
+// ends first, along with the cursor's line; the caller must hold the lock.
+func (e *Editor) countedLines(count int) (string, int, error) {
+	line, _, err := e.current.PositionToLineCol(e.current.Selection().End)
+	if err != nil {
+		return "", 0, err
+	}
+	last := min(line+max(count, 1), e.current.LineCount()) - 1
+	text, err := e.current.LineRange(line, last)
+	return text, line, err
+}
+
+// Paste inserts the text of the selected register count times after the cursor, or
+// before it. Text ending in a newline is pasted as whole lines, below or above the
+// cursor's line. The cursor ends on the last pasted grapheme, or at the start of the
+// pasted lines, and the paste is undone as a single step.
+func (e *Editor) Paste(before bool, count int) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	name := e.takeRegister()
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if err := e.paste(name, before, count); err != nil {
+		return err
+	}
+	e.recordChange(count, func(count int) error { return e.paste(name, before, count) })
+	return nil
+}
+
+// paste inserts the text of register name count times after or before the cursor;
+// the caller must hold the lock.
+func (e *Editor) paste(name rune, before bool, count int) error {
+	text, ok := e.registers[name]
+	if !ok || text == "" {
+		e.setMessage(fmt.Sprintf("Nothing in register %c", name))
+		return nil
+	}
+	text = strings.Repeat(text, max(count, 1))
+
+	e.current.CollapseSelectionsToCursor()
+	pos := e.current.Selection().End
+	line, col, err := e.current.PositionToLineCol(pos)
+	if err != nil {
+		return err
+	}
+
+	e.current.BeginUndoGroup()
+	defer e.current.EndUndoGroup()
+
+	if strings.HasSuffix(text, "\n") {
+		err = e.pasteLines(text, line, before)
+	} else {
+		err = e.pasteText(text, pos, line, col, before)
+	}
+	if err != nil {
+		return err
+	}
+	return e.trackColumn()
+}
+
+// pasteLines inserts whole lines above or below line, leaving the cursor at the
+// start of the first of them; the caller must hold the lock.
+func (e *Editor) pasteLines(text string, line int, before bool) error {
+	target := line
+	switch {
+	case before:
+	case line+1 < e.current.LineCount():
+		target = line + 1
+	default:
+		// below the last line, which has no newline to paste after
+		if err := e.current.MoveSelectionToLineEnd(line, false); err != nil {
+			return err
+		}
+		if err := e.current.Insert("\n" + strings.TrimSuffix(text, "\n")); err != nil {
+			return err
+		}
+		return e.current.MoveSelectionToLineCol(line+1, 0, false)
+	}
+
+	if err := e.current.MoveSelectionToLineCol(target, 0, false); err != nil {
+		return err
+	}
+	if err := e.current.Insert(text); err != nil {
+		return err
+	}
+	return e.current.MoveSelectionToLineCol(target, 0, false)
+}
+
+// pasteText inserts text at the cursor, or after the grapheme under it, leaving the
+// cursor on the last pasted grapheme; the caller must hold the lock.
+func (e *Editor) pasteText(text string, pos, line, col int, before bool) error {
+	if !before {
+		if length, err := e.current.LineLength(line); err == nil && col < length {
+			if err := e.current.MoveSelectionTo(pos+1, false); err != nil {
+				return err
+			}
+		}
+	}
+	if err := e.current.Insert(text); err != nil {
+		return err
+	}
+	return e.current.MoveSelectionTo(e.current.Selection().End-1, false)
+}
+
+// takeRegister returns the register selected for the next yank or paste and goes
+// back to the unnamed one; the caller must hold the lock.
+func (e *Editor) takeRegister() rune {
+	name := e.register
+	e.register = 0
+	if name == 0 {
+		return UnnamedRegister
+	}
+	return name
+}
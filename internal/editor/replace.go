@@ -0,0 +1,51 @@
+package editor
+
+import "github.com/lg2m/athena/internal/editor/state"
+
+// OverwriteText types text over the grapheme under the cursor in replace mode,
+// inserting it at the end of a line.
+func (e *Editor) OverwriteText(text string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if e.mode != state.Replace {
+		return ErrInvalidOperation
+	}
+	return e.current.Overwrite(text)
+}
+
+// ReplaceChar replaces the grapheme under the cursor with ch, leaving the cursor on
+// it. An empty line has nothing to replace and is left alone.
+func (e *Editor) ReplaceChar(ch string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if err := e.replaceChar(ch); err != nil {
+		return err
+	}
+	e.recordChange(1, func(int) error { return e.replaceChar(ch) })
+	return nil
+}
+
+// replaceChar replaces the grapheme under the cursor with ch; the caller must hold
+// the lock.
+func (e *Editor) replaceChar(ch string) error {
+	pos := e.current.Selection().End
+	if grapheme, err := e.current.GraphemeAt(pos); err != nil || grapheme == "\n" {
+		return nil
+	}
+	e.current.CollapseSelectionsToCursor()
+	if err := e.current.Overwrite(ch); err != nil {
+		return err
+	}
+	if err := e.current.MoveSelectionTo(pos, false); err != nil {
+		return err
+	}
+	return e.trackColumn()
+}
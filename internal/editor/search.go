@@ -0,0 +1,191 @@
+package editor
+
+import (
+	"fmt"
+
+	"github.com/lg2m/athena/internal/editor/state"
+)
+
+// searchSession is a search being typed at the prompt, moving the cursor to the
+// first match as the pattern changes.
+type searchSession struct {
+	origin  int  // cursor position the search started from
+	forward bool // whether the prompt is / rather than ?
+
+	// the search state before the prompt opened, restored when it's cancelled
+	pattern   string
+	hlsearch  bool
+	wholeWord bool
+}
+
+// Search looks for the next occurrence of pattern after the cursor, or the previous
+// one before it, wrapping around the buffer, and moves the cursor to it. The pattern
+// is matched literally and becomes the one n and N repeat. When it doesn't occur,
+// the cursor stays put and a message says so. It returns the cursor's position.
+func (e *Editor) Search(pattern string, forward bool) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return 0, ErrNoBuffer
+	}
+	if e.searchDisabled() {
+		return e.current.Selection().End, nil
+	}
+	e.searchPattern, e.hlsearch, e.wholeWord = pattern, pattern != "", false
+	e.searchForward = forward
+	return e.searchFrom(e.current.Selection().End, forward)
+}
+
+// SearchNext repeats the last search, in its direction or the opposite one with
+// reverse, as n and N do.
+func (e *Editor) SearchNext(reverse bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if e.searchDisabled() {
+		return nil
+	}
+	if e.searchPattern == "" {
+		e.setMessage("No previous search pattern")
+		return nil
+	}
+	e.hlsearch = true
+	_, err := e.searchFrom(e.current.Selection().End, e.searchForward != reverse)
+	return err
+}
+
+// searchFrom moves the cursor to the match of the search pattern after or before
+// pos; the caller must hold the lock.
+func (e *Editor) searchFrom(pos int, forward bool) (int, error) {
+	match, wrapped, found := e.current.Find(e.searchPattern, pos, forward, e.wholeWord)
+	if !found {
+		e.setMessage(fmt.Sprintf("Pattern not found: %s", e.searchPattern))
+		return e.current.Selection().End, nil
+	}
+	if wrapped && forward {
+		e.setMessage("search hit BOTTOM, continuing at TOP")
+	} else if wrapped {
+		e.setMessage("search hit TOP, continuing at BOTTOM")
+	}
+	// the prompt may have moved the cursor already, so the jump is from pos
+	e.jumps.add(jump{buffer: e.current, pos: pos})
+	if err := e.current.MoveSelectionTo(match, false); err != nil {
+		return 0, err
+	}
+	return match, e.trackColumn()
+}
+
+// searchDisabled reports whether the current buffer is chunked, saying so. Searching
+// one would read every chunk of the file back into memory at once; the caller must
+// hold the lock.
+func (e *Editor) searchDisabled() bool {
+	if !e.current.IsChunked() {
+		return false
+	}
+	e.setMessage("Search is disabled for large files")
+	return true
+}
+
+// StartSearch opens the search prompt, / when forward and ? otherwise, switching to
+// search mode until ConfirmSearch or CancelSearch.
+func (e *Editor) StartSearch(forward bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if e.searchDisabled() {
+		return nil
+	}
+	e.current.CollapseSelectionsToCursor()
+	e.search = &searchSession{
+		origin:    e.current.Selection().End,
+		forward:   forward,
+		pattern:   e.searchPattern,
+		hlsearch:  e.hlsearch,
+		wholeWord: e.wholeWord,
+	}
+	e.mode = state.Search
+	return nil
+}
+
+// SearchPromptForward reports whether the open search prompt searches forward.
+func (e *Editor) SearchPromptForward() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.search == nil || e.search.forward
+}
+
+// UpdateSearch moves the cursor to the first match of the pattern typed so far,
+// counting from where the search started, and highlights its matches. The cursor
+// goes back there while the pattern has no match.
+func (e *Editor) UpdateSearch(pattern string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.search == nil || e.current == nil {
+		return nil
+	}
+	e.searchPattern, e.hlsearch, e.wholeWord = pattern, pattern != "", false
+
+	target := e.search.origin
+	if match, _, found := e.current.Find(pattern, e.search.origin, e.search.forward, false); found {
+		target = match
+	}
+	if err := e.current.MoveSelectionTo(target, false); err != nil {
+		return err
+	}
+	return e.trackColumn()
+}
+
+// ConfirmSearch closes the search prompt and searches for pattern from where the
+// search started, or for the previous pattern when pattern is empty.
+func (e *Editor) ConfirmSearch(pattern string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	session := e.search
+	e.search = nil
+	e.mode = state.Normal
+	if session == nil || e.current == nil {
+		return nil
+	}
+
+	if pattern == "" {
+		pattern = session.pattern
+	}
+	if pattern == "" {
+		e.setMessage("No previous search pattern")
+		return nil
+	}
+	e.searchPattern, e.hlsearch, e.wholeWord = pattern, true, false
+	e.searchForward = session.forward
+	_, err := e.searchFrom(session.origin, session.forward)
+	return err
+}
+
+// CancelSearch closes the search prompt, putting the cursor and the search pattern
+// back as they were before it opened.
+func (e *Editor) CancelSearch() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	session := e.search
+	e.search = nil
+	e.mode = state.Normal
+	if session == nil || e.current == nil {
+		return nil
+	}
+
+	e.searchPattern, e.hlsearch, e.wholeWord = session.pattern, session.hlsearch, session.wholeWord
+	if err := e.current.MoveSelectionTo(session.origin, false); err != nil {
+		return err
+	}
+	return e.trackColumn()
+}
@@ -8,6 +8,10 @@ type EditorMode uint8
 const (
 	Normal EditorMode = iota
 	Insert
+	Command
+	Visual
+	Replace
+	Search // typing a search pattern at the / or ? prompt
 )
 
 // Selection represents the cursor and the text being selected.
@@ -0,0 +1,103 @@
+package editor
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Substitute replaces the matches of pattern, a regular expression, on the lines
+// from first to last inclusive with repl, in which $1 or ${name} stand for the
+// text of a group. Only the first match on a line is replaced unless global is set.
+// A message reports how many were made, or that there was no match.
+func (e *Editor) Substitute(first, last int, pattern, repl string, global bool) (int, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid pattern: %s", pattern)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return 0, ErrNoBuffer
+	}
+	n, err := e.current.ReplaceInLines(re, repl, first, last, global)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 0:
+		e.setMessage(fmt.Sprintf("Pattern not found: %s", pattern))
+		return 0, nil
+	case 1:
+		e.setMessage("1 substitution")
+	default:
+		e.setMessage(fmt.Sprintf("%d substitutions", n))
+	}
+	return n, e.trackColumn()
+}
+
+// substituteCommand runs :s/pattern/replacement/flags over the lines in range, the
+// cursor's line by default. Any punctuation can stand in for the slashes, and a
+// backslash before it keeps it in the pattern or replacement. The g flag replaces
+// every match on a line rather than the first.
+func (e *Editor) substituteCommand(rng *LineRange, args []string) error {
+	if len(args) == 0 || args[0] == "" {
+		return errors.New("Argument required")
+	}
+	pattern, repl, flags, err := parseSubstitute(args[0])
+	if err != nil {
+		return err
+	}
+	global := false
+	for _, flag := range flags {
+		if flag != 'g' {
+			return fmt.Errorf("Invalid flag: %c", flag)
+		}
+		global = true
+	}
+
+	if rng == nil {
+		rng = &LineRange{Start: ".", End: "."}
+	}
+	first, last, err := e.ResolveRange(rng)
+	if err != nil {
+		return err
+	}
+	_, err = e.Substitute(first, last, pattern, repl, global)
+	return err
+}
+
+// parseSubstitute splits /pattern/replacement/flags on its first character, which
+// must be ASCII punctuation other than a backslash or a double quote. The closing
+// delimiter may be left off.
+func parseSubstitute(arg string) (pattern, repl, flags string, err error) {
+	delim, arg := arg[:1], arg[1:]
+	if c := delim[0]; c >= utf8.RuneSelf || !unicode.IsPunct(rune(c)) && !unicode.IsSymbol(rune(c)) || c == '\\' || c == '"' {
+		return "", "", "", fmt.Errorf("Invalid delimiter: %s", delim)
+	}
+
+	var parts []string
+	var part strings.Builder
+	for i := 0; i < len(arg); i++ {
+		switch {
+		case arg[i] == '\\' && strings.HasPrefix(arg[i+1:], delim):
+			part.WriteString(delim)
+			i += len(delim)
+		case strings.HasPrefix(arg[i:], delim) && len(parts) < 2:
+			parts = append(parts, part.String())
+			part.Reset()
+		default:
+			part.WriteByte(arg[i])
+		}
+	}
+	parts = append(parts, part.String())
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	return parts[0], parts[1], parts[2], nil
+}
@@ -1,7 +1,10 @@
 package treesitter
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/gdamore/tcell/v2"
 	sitter "github.com/tree-sitter/go-tree-sitter"
@@ -17,7 +20,7 @@ type Highlight struct {
 // Position represents a position in the source code.
 type Position struct {
 	Row    uint32
-	Column uint32
+	Column uint32 // in bytes from the start of the row
 }
 
 // Highlighter represents a syntax highlighter for a specific language.
@@ -25,6 +28,10 @@ type Highlighter struct {
 	parser   *sitter.Parser
 	language LanguageProvider
 	registry *Registry
+
+	mu   sync.Mutex
+	code []byte       // code the tree was parsed from
+	tree *sitter.Tree // syntax tree of code, reused until Invalidate is called
 }
 
 // NewHighlighter creates a new syntax highlighter based on the detected language.
@@ -51,10 +58,41 @@ func NewHighlighter(registry *Registry, filename string) (*Highlighter, error) {
 	}, nil
 }
 
-// GetHighlights returns syntax highlighting information for the given code.
-func (h *Highlighter) GetHighlights(code []byte) ([]Highlight, error) {
-	tree := h.parser.Parse(code, nil)
-	defer tree.Close()
+// Invalidate drops the syntax tree once the code changed, so the next query parses
+// the code anew.
+func (h *Highlighter) Invalidate() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.tree != nil {
+		h.tree.Close()
+	}
+	h.code, h.tree = nil, nil
+}
+
+// Close releases the syntax tree and the parser.
+func (h *Highlighter) Close() {
+	h.Invalidate()
+	h.parser.Close()
+}
+
+// parse returns the syntax tree and the code it was parsed from, parsing what source
+// returns when the tree was invalidated since the last query; the caller must hold
+// h.mu.
+func (h *Highlighter) parse(source func() []byte) (*sitter.Tree, []byte) {
+	if h.tree == nil {
+		h.code = source()
+		h.tree = h.parser.Parse(h.code, nil)
+	}
+	return h.tree, h.code
+}
+
+// GetHighlights returns syntax highlighting information for the code source returns.
+func (h *Highlighter) GetHighlights(source func() []byte) ([]Highlight, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	tree, code := h.parse(source)
 
 	query := h.registry.queries[h.language.Name()][QueryHighlights]
 	if query == nil {
@@ -92,3 +130,36 @@ func (h *Highlighter) GetHighlights(code []byte) ([]Highlight, error) {
 
 	return highlights, nil
 }
+
+// InStringOrComment reports whether the byte offset in the code source returns lies
+// inside a string, character or comment node. The opening delimiter's position
+// counts as outside and so does the position after a closing quote or */, while
+// line comments extend to their end.
+func (h *Highlighter) InStringOrComment(source func() []byte, offset uint) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	tree, code := h.parse(source)
+
+	// look at the byte before the offset so a comment ending right there is found
+	before := offset
+	if before > 0 {
+		before--
+	}
+	for node := tree.RootNode().DescendantForByteRange(before, offset); node != nil; node = node.Parent() {
+		kind := node.Kind()
+		start, end := node.StartByte(), node.EndByte()
+		switch {
+		case strings.Contains(kind, "comment"):
+			lineComment := !bytes.HasSuffix(code[start:end], []byte("*/"))
+			if start < offset && (offset < end || lineComment && offset == end) {
+				return true
+			}
+		case strings.Contains(kind, "string"), strings.Contains(kind, "char"), strings.Contains(kind, "rune"):
+			if start < offset && offset < end {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -2,6 +2,7 @@ package treesitter
 
 import (
 	"embed"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"strings"
@@ -10,6 +11,9 @@ import (
 	sitter "github.com/tree-sitter/go-tree-sitter"
 )
 
+// ErrUnsupportedExtension is returned for files no registered language claims.
+var ErrUnsupportedExtension = errors.New("unsupported file extension")
+
 // StyleMap maps node types to tcell styles
 type StyleMap map[string]tcell.Style
 
@@ -93,5 +97,5 @@ func (r *Registry) DetectLanguage(filename string) (string, error) {
 			}
 		}
 	}
-	return "", fmt.Errorf("unsupported file extension: %s", ext)
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedExtension, ext)
 }
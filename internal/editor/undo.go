@@ -0,0 +1,53 @@
+package editor
+
+import "github.com/lg2m/athena/internal/editor/buffer"
+
+// Undo moves up the undo tree of the current buffer, reverting the last change.
+func (e *Editor) Undo() error {
+	return e.moveInHistory(func(b *buffer.Buffer) (bool, error) {
+		return b.Undo()
+	}, "Already at oldest change")
+}
+
+// Redo moves down the undo tree of the current buffer, into the branch last
+// created or visited.
+func (e *Editor) Redo() error {
+	return e.moveInHistory(func(b *buffer.Buffer) (bool, error) {
+		return b.Redo()
+	}, "Already at newest change")
+}
+
+// UndoTreeLeft switches to the branch of the undo tree created before the current
+// one, as if the change that started it had been undone and the older one redone.
+func (e *Editor) UndoTreeLeft() error {
+	return e.moveInHistory(func(b *buffer.Buffer) (bool, error) {
+		return b.UndoBranch(-1)
+	}, "Already at oldest branch")
+}
+
+// UndoTreeRight switches to the branch of the undo tree created after the current one.
+func (e *Editor) UndoTreeRight() error {
+	return e.moveInHistory(func(b *buffer.Buffer) (bool, error) {
+		return b.UndoBranch(1)
+	}, "Already at newest branch")
+}
+
+// moveInHistory runs a move through the undo tree of the current buffer, showing
+// limitMsg when it can't go any further.
+func (e *Editor) moveInHistory(move func(*buffer.Buffer) (bool, error), limitMsg string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	moved, err := move(e.current)
+	if err != nil {
+		return err
+	}
+	if !moved {
+		e.setMessage(limitMsg)
+		return nil
+	}
+	return e.trackColumn()
+}
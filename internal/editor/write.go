@@ -0,0 +1,233 @@
+package editor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/lg2m/athena/internal/util"
+)
+
+// ResolveRange converts a line range typed before a command into zero-based first
+// and last lines of the current buffer. A nil range covers the whole buffer, and a
+// backwards range is swapped.
+func (e *Editor) ResolveRange(rng *LineRange) (int, int, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if e.current == nil {
+		return 0, 0, ErrNoBuffer
+	}
+	if rng == nil {
+		return 0, e.current.LineCount() - 1, nil
+	}
+
+	start, err := e.resolveAddress(rng.Start)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := e.resolveAddress(rng.End)
+	if err != nil {
+		return 0, 0, err
+	}
+	return min(start, end), max(start, end), nil
+}
+
+// resolveAddress converts a single line address into a zero-based line; the caller
+// must hold the lock. '< and '> are the first and last lines of the selection.
+func (e *Editor) resolveAddress(addr string) (int, error) {
+	selection := e.current.Selection()
+	first, last := min(selection.Start, selection.End), max(selection.Start, selection.End)
+
+	var pos int
+	switch addr {
+	case ".":
+		pos = selection.End
+	case "$":
+		return e.current.LineCount() - 1, nil
+	case "'<":
+		pos = first
+	case "'>":
+		// the selection ends before its last grapheme's newline
+		pos = max(last-1, first)
+	default:
+		n, err := strconv.Atoi(addr)
+		if err != nil || n < 1 || n > e.current.LineCount() {
+			return 0, fmt.Errorf("%w: %s", ErrInvalidRange, addr)
+		}
+		return n - 1, nil
+	}
+
+	line, _, err := e.current.PositionToLineCol(pos)
+	return line, err
+}
+
+// WriteRange writes the lines from start to end inclusive to the file at path,
+// replacing it atomically. The buffer keeps its file and its dirty state.
+func (e *Editor) WriteRange(start, end int, path string) error {
+	return e.writeRange(start, end, path, false)
+}
+
+// AppendRange appends the lines from start to end inclusive to the file at path,
+// creating it when it doesn't exist.
+func (e *Editor) AppendRange(start, end int, path string) error {
+	return e.writeRange(start, end, path, true)
+}
+
+// writeRange writes or appends the lines from start to end inclusive to the file at
+// path in the buffer's encoding and line format, creating missing parent directories.
+// A path another buffer has open is refused.
+func (e *Editor) writeRange(start, end int, path string, appendTo bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	if err := e.checkOpenElsewhere(path); err != nil {
+		return err
+	}
+	text, err := e.current.LineRange(start, end)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// appended text continues a file that already starts with a byte order mark
+	bom := true
+	if info, err := os.Stat(path); appendTo && err == nil && info.Size() > 0 {
+		bom = false
+	}
+	data, err := e.current.EncodeText(text, bom)
+	if err != nil {
+		return err
+	}
+
+	verb := "written"
+	if appendTo {
+		verb = "appended"
+		err = appendFile(path, data)
+	} else {
+		err = util.WriteFileAtomic(path, data, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	e.setMessage(fmt.Sprintf("%q %dL %s", path, end-start+1, verb))
+	return nil
+}
+
+// SaveAs writes the current buffer to path as saving it would, creating missing
+// parent directories. The buffer stays on its own file, and its own path saves it.
+// A path another buffer has open is refused.
+func (e *Editor) SaveAs(path string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if absPath == e.current.FilePath() {
+		return e.save(e.current, false)
+	}
+	if err := e.checkOpenElsewhere(absPath); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+		return err
+	}
+
+	if err := e.current.SaveCopy(absPath, e.fixEOLOnSave); err != nil {
+		return err
+	}
+	e.setMessage(fmt.Sprintf("%q %dL written", path, e.current.LineCount()))
+	return nil
+}
+
+// SaveCurrentBufferAs writes the current buffer to path and makes it the buffer's
+// file, creating missing parent directories. The language is detected again when the
+// extension changes. A path another buffer has open is refused, and so is an
+// existing file other than the buffer's own unless force is set.
+func (e *Editor) SaveCurrentBufferAs(path string, force bool) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.current == nil {
+		return ErrNoBuffer
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	b := e.current
+	if err := e.checkOpenElsewhere(absPath); err != nil {
+		return err
+	}
+	if _, err := os.Stat(absPath); err == nil && !force && absPath != b.FilePath() {
+		return fmt.Errorf("%w: %s", ErrFileExists, path)
+	}
+	if err := os.MkdirAll(filepath.Dir(absPath), 0755); err != nil {
+		return err
+	}
+
+	oldExt := filepath.Ext(b.FilePath())
+	if err := b.SaveAs(absPath); err != nil {
+		return err
+	}
+	for key, other := range e.buffers {
+		if other == b {
+			delete(e.buffers, key)
+			break
+		}
+	}
+	e.buffers[absPath] = b
+
+	if filepath.Ext(absPath) != oldExt {
+		if err := b.SetSyntax(e.syntaxFor == nil || e.syntaxFor(absPath)); err != nil {
+			return err
+		}
+		if e.indentFor != nil {
+			b.SetIndentation(e.indentFor(absPath))
+		}
+		if e.commentsFor != nil {
+			b.SetCommentTokens(e.commentsFor(absPath))
+		}
+	}
+	e.setMessage(fmt.Sprintf("%q %dL written", path, b.LineCount()))
+	return nil
+}
+
+// checkOpenElsewhere refuses path when a buffer other than the current one has it
+// open, since writing it would clobber that buffer's file; the caller must hold the
+// lock.
+func (e *Editor) checkOpenElsewhere(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if other, open := e.buffers[absPath]; open && other != e.current {
+		return fmt.Errorf("%w: %s", ErrBufferOpen, path)
+	}
+	return nil
+}
+
+// appendFile appends data to the file at path, creating it when it doesn't exist.
+func appendFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
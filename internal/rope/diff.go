@@ -0,0 +1,272 @@
+package rope
+
+import (
+	"slices"
+	"strings"
+)
+
+// Edit describes replacing the lines [StartLine, EndLine) of the original
+// document with Lines. An insertion has StartLine == EndLine and a deletion
+// has no Lines.
+type Edit struct {
+	StartLine int
+	EndLine   int
+	Lines     []string
+}
+
+// Snapshot returns a rope sharing the current tree. Nodes are never mutated
+// in place, so later edits to either rope don't affect the other.
+func (r *Rope) Snapshot() *Rope {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return &Rope{root: r.root}
+}
+
+// EqualTo reports whether both ropes hold the same text. Ropes of different
+// lengths are rejected right away; otherwise their leaves are compared in order
+// without building either string.
+func (r *Rope) EqualTo(other *Rope) bool {
+	if r == other {
+		return true
+	}
+	if other == nil {
+		return false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	other.mu.RLock()
+	defer other.mu.RUnlock()
+
+	if r.root == other.root {
+		return true
+	}
+	if r.root.totalGraphemes() != other.root.totalGraphemes() {
+		return false
+	}
+
+	a, b := newLeafIterator(r.root), newLeafIterator(other.root)
+	var x, y string
+	for {
+		if x == "" {
+			x = a.next()
+		}
+		if y == "" {
+			y = b.next()
+		}
+		if x == "" || y == "" {
+			return x == y
+		}
+
+		n := min(len(x), len(y))
+		if x[:n] != y[:n] {
+			return false
+		}
+		x, y = x[n:], y[n:]
+	}
+}
+
+// leafIterator walks the non-empty leaves of a tree from left to right.
+type leafIterator struct {
+	stack []*RopeNode
+}
+
+func newLeafIterator(root *RopeNode) *leafIterator {
+	it := &leafIterator{}
+	it.push(root)
+	return it
+}
+
+// push descends the left spine of n.
+func (it *leafIterator) push(n *RopeNode) {
+	for n = n.resolve(); n != nil; n = n.left.resolve() {
+		it.stack = append(it.stack, n)
+	}
+}
+
+// next returns the data of the next non-empty leaf, or "" once all leaves are visited.
+func (it *leafIterator) next() string {
+	for len(it.stack) > 0 {
+		n := it.stack[len(it.stack)-1]
+		it.stack = it.stack[:len(it.stack)-1]
+		if n.left == nil && n.right == nil {
+			if n.data != "" {
+				return n.data
+			}
+			continue
+		}
+		it.push(n.right)
+	}
+	return ""
+}
+
+// SplitLines returns the document's lines without their trailing newlines.
+// A document ending in a newline yields a final empty line.
+func (r *Rope) SplitLines() []string {
+	return strings.Split(r.String(), "\n")
+}
+
+// Diff computes the minimal line-level edits that transform r into other.
+// Edits are ordered by StartLine and refer to line indices in r, so applying
+// them in reverse order keeps earlier indices valid.
+func (r *Rope) Diff(other *Rope) []Edit {
+	edits, _ := r.DiffWithin(other, -1)
+	return edits
+}
+
+// DiffWithin is Diff giving up, and reporting false, once more than maxLines lines
+// would have to be inserted or deleted, so the time and memory it takes grow with
+// maxLines rather than with the size of the documents. A negative maxLines sets no
+// limit.
+func (r *Rope) DiffWithin(other *Rope, maxLines int) ([]Edit, bool) {
+	return diffLines(r.SplitLines(), other.SplitLines(), maxLines)
+}
+
+// diffOp is a single step of an edit script.
+type diffOp uint8
+
+const (
+	opEqual diffOp = iota
+	opDelete
+	opInsert
+)
+
+// diffLines computes a line diff between a and b using the Myers algorithm, giving
+// up past maxD inserted or deleted lines unless maxD is negative.
+func diffLines(a, b []string, maxD int) ([]Edit, bool) {
+	// Trim the common prefix and suffix; they never contribute edits
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops, ok := myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], maxD)
+	if !ok {
+		return nil, false
+	}
+	return buildEdits(ops, b[prefix:len(b)-suffix], prefix), true
+}
+
+// myers returns the shortest edit script turning a into b, or false when it takes
+// more than maxD steps. The trace keeps, for each step d, only the diagonals it can
+// reach, so it takes O(d²) memory rather than O(d·(n+m)).
+func myers(a, b []string, maxD int) ([]diffOp, bool) {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil, true
+	}
+
+	if maxD < 0 || maxD > n+m {
+		maxD = n + m
+	}
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	var trace [][]int
+
+	for d := 0; d <= maxD; d++ {
+		// diagonals -d-1 through d+1, the ones step d reads
+		trace = append(trace, slices.Clone(v[offset-d-1:offset+d+2]))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1] // move down (insertion)
+			} else {
+				x = v[offset+k-1] + 1 // move right (deletion)
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, n, m), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// backtrack walks the recorded trace from the end to rebuild the edit script.
+// Step d of the trace holds diagonals -d-1 through d+1.
+func backtrack(trace [][]int, n, m int) []diffOp {
+	var ops []diffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		offset := d + 1
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			ops = append(ops, opEqual)
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, opInsert)
+			} else {
+				ops = append(ops, opDelete)
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	// ops were collected back to front
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// buildEdits groups consecutive deletions and insertions into edits.
+func buildEdits(ops []diffOp, b []string, lineOffset int) []Edit {
+	var edits []Edit
+	var current *Edit
+	ai, bi := 0, 0
+
+	flush := func() {
+		if current != nil {
+			edits = append(edits, *current)
+			current = nil
+		}
+	}
+
+	for _, op := range ops {
+		switch op {
+		case opEqual:
+			flush()
+			ai++
+			bi++
+		case opDelete:
+			if current == nil {
+				current = &Edit{StartLine: lineOffset + ai, EndLine: lineOffset + ai}
+			}
+			current.EndLine++
+			ai++
+		case opInsert:
+			if current == nil {
+				current = &Edit{StartLine: lineOffset + ai, EndLine: lineOffset + ai}
+			}
+			current.Lines = append(current.Lines, b[bi])
+			bi++
+		}
+	}
+	flush()
+	return edits
+}
@@ -0,0 +1,171 @@
+package rope
+
+import (
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+)
+
+// fuzzPieces are the snippets random edits insert, picked to sit next to each other
+// in every order: combining marks, joiners, skin tones and regional indicators all
+// merge with the cluster before them.
+var fuzzPieces = []string{
+	"a", "xyz", "\n", "\r", "\r\n", "日本",
+	"é", "́", "‍", "\U0001F3FD",
+	"👨", "👩", "👨‍👩‍👧", "👍🏽",
+	"🇺", "🇳", "🇺🇳", "🇫🇷",
+}
+
+// graphemes splits s into its grapheme clusters.
+func graphemes(s string) []string {
+	var clusters []string
+	for gr := uniseg.NewGraphemes(s); gr.Next(); {
+		clusters = append(clusters, gr.Str())
+	}
+	return clusters
+}
+
+// applyFuzzOps runs the edits encoded in ops on a rope and on a plain string, checking
+// after each one that the rope reads back as the string, segmented the same way.
+func applyFuzzOps(t *testing.T, initial string, ops []byte) {
+	t.Helper()
+
+	rope := NewRope(initial)
+	want := initial
+	clusters := graphemes(want)
+
+	// each edit takes four bytes: the kind, two positions and a piece
+	for ; len(ops) >= 4; ops = ops[4:] {
+		total := len(clusters)
+		start, end := int(ops[1])%(total+1), int(ops[2])%(total+1)
+		if start > end {
+			start, end = end, start
+		}
+		piece := fuzzPieces[int(ops[3])%len(fuzzPieces)]
+		before := strings.Join(clusters[:start], "")
+		after := strings.Join(clusters[end:], "")
+
+		var span Span
+		var err error
+		switch ops[0] % 4 {
+		case 0:
+			span, err = rope.Insert(start, piece)
+			want = before + piece + strings.Join(clusters[start:], "")
+		case 1:
+			span, err = rope.Delete(start, end)
+			want = before + after
+		case 2:
+			span, err = rope.Replace(start, end, piece)
+			want = before + piece + after
+		case 3:
+			got, subErr := rope.Substring(start, end)
+			if subErr != nil {
+				t.Fatalf("Substring(%d, %d) failed: %v", start, end, subErr)
+			}
+			if sub := strings.Join(clusters[start:end], ""); got != sub {
+				t.Fatalf("Substring(%d, %d) of %q: expected %q, got %q", start, end, want, sub, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("edit %d at %d-%d with %q failed: %v", ops[0]%4, start, end, piece, err)
+		}
+		old := clusters
+		clusters = graphemes(want)
+		checkRope(t, rope, want, clusters)
+		checkSpan(t, span, old, clusters)
+	}
+}
+
+// checkSpan fails unless span covers every cluster an edit from old to clusters
+// changed, leaving those around it as they were.
+func checkSpan(t *testing.T, span Span, old, clusters []string) {
+	t.Helper()
+
+	if span.Start < 0 || span.Start > span.End || span.End > len(old) || span.Start+span.Inserted > len(clusters) {
+		t.Fatalf("span %+v out of range for %q to %q", span, old, clusters)
+	}
+	if len(clusters)-len(old) != span.Delta() {
+		t.Fatalf("span %+v: expected a delta of %d", span, len(clusters)-len(old))
+	}
+	if !slices.Equal(old[:span.Start], clusters[:span.Start]) || !slices.Equal(old[span.End:], clusters[span.Start+span.Inserted:]) {
+		t.Fatalf("span %+v leaves out changed clusters of %q to %q", span, old, clusters)
+	}
+}
+
+// checkRope fails unless rope holds want, split into clusters.
+func checkRope(t *testing.T, rope *Rope, want string, clusters []string) {
+	t.Helper()
+
+	if got := rope.String(); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	if got := rope.TotalGraphemes(); got != len(clusters) {
+		t.Fatalf("%q: expected %d graphemes, got %d", want, len(clusters), got)
+	}
+	for i, cluster := range clusters {
+		if got, err := rope.GraphemeAt(i); err != nil || got != cluster {
+			t.Fatalf("%q: expected grapheme %d to be %q, got %q (%v)", want, i, cluster, got, err)
+		}
+	}
+	var weights func(n *RopeNode) int
+	weights = func(n *RopeNode) int {
+		if n == nil {
+			return 0
+		}
+		if n.left == nil && n.right == nil {
+			if count := uniseg.GraphemeClusterCount(n.data); count != n.weight {
+				t.Fatalf("%q: leaf %q has weight %d for %d graphemes", want, n.data, n.weight, count)
+			}
+			return n.weight
+		}
+		left := weights(n.left)
+		if left != n.weight {
+			t.Fatalf("%q: node has weight %d for %d graphemes on its left", want, n.weight, left)
+		}
+		return left + weights(n.right)
+	}
+	weights(rope.root)
+}
+
+func TestRopeRandomEdits(t *testing.T) {
+	initials := []string{
+		"",
+		"hello, world",
+		strings.Repeat("line\n", 300),
+		strings.Repeat("👋🌍é🇺🇳", 100),
+	}
+
+	for seed := int64(1); seed <= 20; seed++ {
+		rng := rand.New(rand.NewSource(seed))
+		ops := make([]byte, 4*500)
+		rng.Read(ops)
+		applyFuzzOps(t, initials[seed%int64(len(initials))], ops)
+	}
+}
+
+func FuzzRope(f *testing.F) {
+	f.Add("", []byte{0, 0, 0, 0})
+	f.Add("hello", []byte{2, 1, 3, 5, 3, 0, 9, 0})
+
+	// edits whose clusters merge with their neighbours
+	f.Add("hello", []byte{0, 5, 5, 7})          // a combining mark joins the o
+	f.Add("👨", []byte{0, 1, 1, 8, 0, 1, 1, 11}) // a joiner, then a second person
+	f.Add("🇺🇳🇫", []byte{0, 0, 0, 14})           // a flag half pairs the run anew
+	f.Add("a\nb", []byte{0, 1, 1, 3})           // \r before \n
+	f.Add("🇺x🇳", []byte{1, 1, 2, 0})            // deleting between two flag halves
+	f.Add("ab", []byte{2, 1, 2, 7, 3, 0, 1, 0}) // replacing with a combining mark
+
+	f.Fuzz(func(t *testing.T, initial string, ops []byte) {
+		// buffers hand the rope valid text only; bytes of a broken sequence on either
+		// side of an edit could otherwise join into a character
+		if !utf8.ValidString(initial) {
+			t.Skip()
+		}
+		applyFuzzOps(t, initial, ops)
+	})
+}
@@ -0,0 +1,23 @@
+package rope
+
+import "hash/fnv"
+
+// Hash returns a 64-bit FNV-1a hash of the text. It depends only on the text, not
+// on how it is split into leaves, and is remembered until the next edit, so calling
+// it again on an unchanged rope is free.
+func (r *Rope) Hash() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.hashed != nil && r.hashed == r.root {
+		return r.hash
+	}
+
+	h := fnv.New64a()
+	it := newLeafIterator(r.root)
+	for leaf := it.next(); leaf != ""; leaf = it.next() {
+		_, _ = h.Write([]byte(leaf))
+	}
+	r.hashed, r.hash = r.root, h.Sum64()
+	return r.hash
+}
@@ -34,9 +34,8 @@ func (r *Rope) NewIterator() *RopeIterator {
 func (it *RopeIterator) Next() (string, bool) {
 	for {
 		// Traverse to the leftmost leaf node.
-		for it.current != nil {
+		for it.current = it.current.resolve(); it.current != nil; it.current = it.current.left.resolve() {
 			it.stack = append(it.stack, it.current)
-			it.current = it.current.left
 		}
 
 		if len(it.stack) == 0 {
@@ -103,16 +102,16 @@ func (it *RopeIterator) Prev() (string, bool) {
 				it.stack = it.stack[:len(it.stack)-1]
 
 				// If we popped from the right subtree, this node is our predecessor
-				if it.current.right == lastPopped {
+				if it.current.right.resolve() == lastPopped {
 					// Found our predecessor, if it's a leaf we'll process it
 					if it.current.left == nil && it.current.right == nil {
 						break
 					}
 					// If not a leaf, move to rightmost leaf of left subtree
-					it.current = it.current.left
+					it.current = it.current.left.resolve()
 					for it.current.right != nil {
 						it.stack = append(it.stack, it.current)
-						it.current = it.current.right
+						it.current = it.current.right.resolve()
 					}
 					break
 				}
@@ -0,0 +1,91 @@
+package rope
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+)
+
+// Piece is text a lazy rope keeps out of memory until it's needed, such as a chunk of
+// a large file: Size bytes at Offset, holding Graphemes grapheme clusters.
+type Piece struct {
+	Offset    int64
+	Size      int
+	Graphemes int
+}
+
+// Loader reads back the text of a piece.
+type Loader func(offset int64, size int) (string, error)
+
+// NewLazyRope creates a rope over pieces whose text is read through load only when
+// it's needed, keeping the text of at most cached pieces in memory at a time. Pieces
+// must end on grapheme cluster boundaries, as they do after a newline. Text that
+// can't be read back, or no longer holds as many clusters, reads as U+FFFD.
+func NewLazyRope(pieces []Piece, load Loader, cached int) *Rope {
+	source := &lazySource{load: load, limit: max(cached, 1), recent: list.New()}
+	leaves := make([]*RopeNode, 0, len(pieces))
+	for _, piece := range pieces {
+		if piece.Graphemes > 0 {
+			leaves = append(leaves, &RopeNode{weight: piece.Graphemes, lazy: &lazyPiece{Piece: piece, source: source}})
+		}
+	}
+	return &Rope{root: buildBalancedTree(leaves)}
+}
+
+// lazySource loads the pieces of a lazy rope, keeping the trees of the most recently
+// used ones.
+type lazySource struct {
+	load  Loader
+	limit int
+
+	mu     sync.Mutex
+	recent *list.List // of *lazyPiece, the most recently used first
+}
+
+// lazyPiece is the piece behind a lazy leaf. Leaves split off it by an edit hold
+// their text like any other, so only untouched pieces are ever unloaded.
+type lazyPiece struct {
+	Piece
+	source *lazySource
+	tree   *RopeNode     // the piece's text while it's cached
+	elem   *list.Element // the piece's place in source.recent while it's cached
+}
+
+// resolve returns the tree holding the text of a lazy leaf, loading it when it isn't
+// cached, and any other node as it is.
+func (n *RopeNode) resolve() *RopeNode {
+	if n == nil || n.lazy == nil {
+		return n
+	}
+	return n.lazy.load()
+}
+
+// load returns the piece's tree, reading it back when it isn't cached and unloading
+// the least recently used piece past the source's limit.
+func (p *lazyPiece) load() *RopeNode {
+	s := p.source
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if p.elem != nil {
+		s.recent.MoveToFront(p.elem)
+		return p.tree
+	}
+
+	leaves := []*RopeNode{}
+	if text, err := s.load(p.Offset, p.Size); err == nil {
+		leaves = splitIntoLeaves(text, MaxLeafSize)
+	}
+	if tree := buildBalancedTree(leaves); tree.totalGraphemes() == p.Graphemes {
+		p.tree = tree
+	} else {
+		p.tree = NewRope(strings.Repeat("\uFFFD", p.Graphemes)).root
+	}
+
+	p.elem = s.recent.PushFront(p)
+	if s.recent.Len() > s.limit {
+		oldest := s.recent.Remove(s.recent.Back()).(*lazyPiece)
+		oldest.tree, oldest.elem = nil, nil
+	}
+	return p.tree
+}
@@ -21,14 +21,18 @@ var (
 type RopeNode struct {
 	left   *RopeNode
 	right  *RopeNode
-	weight int    // Number of grapheme clusters in the left subtree
-	data   string // Only for leaf nodes
+	weight int        // Number of grapheme clusters in the left subtree, or in a leaf
+	data   string     // Only for leaf nodes
+	lazy   *lazyPiece // Only for leaves of a lazy rope, whose data is loaded on demand
 }
 
 // Rope represents the Rope data structure.
 type Rope struct {
 	root *RopeNode
 	mu   sync.RWMutex
+
+	hashed *RopeNode // root the cached hash was computed for
+	hash   uint64
 }
 
 // NewRope creates a new Rope from a string.
@@ -38,57 +42,103 @@ func NewRope(s string) *Rope {
 	return &Rope{root: root}
 }
 
-// Insert inserts text at a given grapheme index in the Rope.
-func (r *Rope) Insert(index int, s string) error {
+// Span is the range of grapheme clusters an edit replaced: Start to End before it,
+// Start to Start+Inserted after it. It reaches past the range the edit was asked for
+// when the text re-segments across a seam, as a combining mark merges with the
+// cluster before it.
+type Span struct {
+	Start, End int
+	Inserted   int
+}
+
+// Delta returns how many grapheme clusters the edit added, negative when it removed
+// some.
+func (s Span) Delta() int {
+	return s.Inserted - (s.End - s.Start)
+}
+
+// Insert inserts text at a given grapheme index in the Rope, returning the span of
+// clusters it replaced.
+func (r *Rope) Insert(index int, s string) (Span, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if index < 0 || index > r.root.totalGraphemes() {
-		return fmt.Errorf("%w: index: %d", ErrOutOfBounds, index)
+	total := r.root.totalGraphemes()
+	if index < 0 || index > total {
+		return Span{}, fmt.Errorf("%w: index: %d", ErrOutOfBounds, index)
 	}
 
-	// Split the rope at the position
-	left, right := r.root.Split(index)
-	insertRope := NewRope(s)
-	newLeft := concatenateNodes(left, insertRope.root)
-	r.root = concatenateNodes(newLeft, right)
-	r.root = rebalance(r.root)
-	return nil
+	// Appending usually fits in the last leaf, which avoids rebuilding the tree, as
+	// long as the text doesn't merge with the last cluster
+	if index == total && r.root != nil && s != "" {
+		tail, _ := r.root.graphemeAt(total - 1)
+		if first, _, _, _ := uniseg.FirstGraphemeClusterInString(tail+s, -1); first == tail {
+			if root, ok := r.root.appendToRightmost(s); ok {
+				r.root = root
+				return Span{Start: total, End: total, Inserted: root.totalGraphemes() - total}, nil
+			}
+		}
+	}
+
+	return r.insertSplit(index, s), nil
 }
 
-// Delete removes grapheme clusters from start to end (exclusive).
-func (r *Rope) Delete(start, end int) error {
+// insertSplit inserts text by splitting the tree at index and rebalancing;
+// the caller must hold the lock.
+func (r *Rope) insertSplit(index int, s string) Span {
+	return r.replaceSplit(index, index, s)
+}
+
+// Delete removes grapheme clusters from start to end (exclusive), returning the
+// span of clusters it replaced.
+func (r *Rope) Delete(start, end int) (Span, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	if start < 0 || end > r.root.totalGraphemes() || start > end {
-		return fmt.Errorf("%w: start %d, end %d", ErrInvalidRange, start, end)
+		return Span{}, fmt.Errorf("%w: start %d, end %d", ErrInvalidRange, start, end)
 	}
-
-	left, temp := r.root.Split(start)
-	_, right := temp.Split(end - start)
-	r.root = concatenateNodes(left, right)
-	r.root = rebalance(r.root)
-	return nil
+	return r.replaceSplit(start, end, ""), nil
 }
 
-// Replace replaces text in the given range with the provided string.
-func (r *Rope) Replace(start, end int, s string) error {
+// Replace replaces text in the given range with the provided string, returning the
+// span of clusters it replaced.
+func (r *Rope) Replace(start, end int, s string) (Span, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	total := r.root.totalGraphemes()
 	if start < 0 || end > total || start > end {
-		return fmt.Errorf("%w: start %d, end %d", ErrInvalidRange, start, end)
+		return Span{}, fmt.Errorf("%w: start %d, end %d", ErrInvalidRange, start, end)
 	}
+	return r.replaceSplit(start, end, s), nil
+}
 
+// replaceSplit replaces the clusters from start to end with s by splitting the tree
+// around them, mending the seams and rebalancing; the caller must hold the lock.
+func (r *Rope) replaceSplit(start, end int, s string) Span {
+	total := r.root.totalGraphemes()
 	left, temp := r.root.Split(start)
 	_, right := temp.Split(end - start)
-	insertRope := NewRope(s)
-	newRoot := concatenateNodes(left, insertRope.root)
-	r.root = concatenateNodes(newRoot, right)
-	r.root = rebalance(r.root)
-	return nil
+
+	span := Span{Start: start, End: end}
+	newLeft, absorbed := mend(left, NewRope(s).root)
+	if absorbed > 0 {
+		// s merged with the last cluster before it
+		span.Start = start - 1
+	}
+	root, absorbed := mend(newLeft, right)
+	if absorbed > 0 {
+		span.End += absorbed
+		if newLeft.totalGraphemes() == start {
+			// nothing of s is left on its own, so the cluster before it took the
+			// ones after it
+			span.Start = start - 1
+		}
+	}
+	r.root = rebalance(root)
+	span.Inserted = r.root.totalGraphemes() - (total - span.End) - span.Start
+	return span
 }
 
 // String implements the fmt.Stringer interface.
@@ -147,6 +197,9 @@ func (n *RopeNode) Split(index int) (*RopeNode, *RopeNode) {
 		if index >= n.weight {
 			return n, nil
 		}
+		if n.lazy != nil {
+			return n.resolve().Split(index)
+		}
 
 		gr := uniseg.NewGraphemes(n.data)
 		var leftData, rightData strings.Builder
@@ -183,6 +236,7 @@ func (n *RopeNode) Split(index int) (*RopeNode, *RopeNode) {
 
 // writeToString writes the node's data to a StringBuilder.
 func (n *RopeNode) writeToString(sb *strings.Builder) {
+	n = n.resolve()
 	if n == nil {
 		return
 	}
@@ -199,6 +253,7 @@ func (n *RopeNode) appendTextRange(sb *strings.Builder, start, end int) {
 	if n == nil || start >= end {
 		return
 	}
+	n = n.resolve()
 	if n.left == nil && n.right == nil {
 		// Leaf node: extract the substring within the range.
 		gr := uniseg.NewGraphemes(n.data)
@@ -229,6 +284,7 @@ func (n *RopeNode) appendTextRange(sb *strings.Builder, start, end int) {
 
 // graphemeAt returns the grapheme at the specified index.
 func (n *RopeNode) graphemeAt(index int) (string, error) {
+	n = n.resolve()
 	if n == nil {
 		return "", fmt.Errorf("%w: index %d", ErrOutOfBounds, index)
 	}
@@ -249,6 +305,28 @@ func (n *RopeNode) graphemeAt(index int) (string, error) {
 	return n.right.graphemeAt(index - n.weight)
 }
 
+// appendToRightmost returns a copy of the node with s appended to its rightmost leaf,
+// or false when the leaf would grow past MaxLeafSize. Only the nodes on the right
+// spine are copied; the rest of the tree is shared, as snapshots rely on.
+func (n *RopeNode) appendToRightmost(s string) (*RopeNode, bool) {
+	n = n.resolve()
+	if n.left == nil && n.right == nil {
+		data := n.data + s
+		count := uniseg.GraphemeClusterCount(data)
+		if count > MaxLeafSize {
+			return nil, false
+		}
+		return &RopeNode{data: data, weight: count}, true
+	}
+
+	right, ok := n.right.appendToRightmost(s)
+	if !ok {
+		return nil, false
+	}
+	// the weight only counts the left subtree, which is unchanged
+	return &RopeNode{left: n.left, right: right, weight: n.weight}, true
+}
+
 // totalGraphemes returns the total number of grapheme clusters in the node.
 func (n *RopeNode) totalGraphemes() int {
 	if n == nil {
@@ -324,6 +402,52 @@ func concatenateNodes(left, right *RopeNode) *RopeNode {
 	}
 }
 
+// mend joins left and right like concatenateNodes, re-segmenting the text around the
+// seam so that the tree's clusters stay those of its text. The cluster before the
+// seam can absorb the ones after it, as with a combining mark or a joiner, and a
+// regional indicator pairs up the rest of its run of flags differently. It returns
+// how many clusters of right the last one of left absorbed.
+func mend(left, right *RopeNode) (*RopeNode, int) {
+	if left == nil || right == nil {
+		return concatenateNodes(left, right), 0
+	}
+
+	rest, tail := left.Split(left.totalGraphemes() - 1)
+	var sb strings.Builder
+	tail.writeToString(&sb)
+	text := sb.String()
+
+	// take clusters from the right until one comes out of the seam unchanged
+	absorbed := 0
+	it := newLeafIterator(right)
+	for leaf := it.next(); leaf != ""; leaf = it.next() {
+		for gr := uniseg.NewGraphemes(leaf); gr.Next(); absorbed++ {
+			next := gr.Str()
+			if lastGrapheme(text+next) != next {
+				text += next
+				continue
+			}
+			if absorbed == 0 {
+				return concatenateNodes(left, right), 0
+			}
+			_, after := right.Split(absorbed)
+			seam := buildBalancedTree(splitIntoLeaves(text, MaxLeafSize))
+			return concatenateNodes(concatenateNodes(rest, seam), after), absorbed
+		}
+	}
+	return concatenateNodes(rest, buildBalancedTree(splitIntoLeaves(text, MaxLeafSize))), absorbed
+}
+
+// lastGrapheme returns the last grapheme cluster of s.
+func lastGrapheme(s string) string {
+	var cluster string
+	state := -1
+	for s != "" {
+		cluster, s, _, state = uniseg.FirstGraphemeClusterInString(s, state)
+	}
+	return cluster
+}
+
 // Rebalancing functions
 
 // rebalance rebalances the rope to maintain optimal performance.
@@ -1,7 +1,9 @@
 package rope
 
 import (
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/rivo/uniseg"
@@ -72,7 +74,7 @@ func TestInsert(t *testing.T) {
 
 	for _, tt := range tests {
 		rope := NewRope(tt.initial)
-		err := rope.Insert(tt.insertPos, tt.toInsert)
+		_, err := rope.Insert(tt.insertPos, tt.toInsert)
 		if err != nil {
 			t.Errorf("Insert failed for initial %q at pos %d with %q: %v",
 				tt.initial, tt.insertPos, tt.toInsert, err)
@@ -90,12 +92,12 @@ func TestInsert(t *testing.T) {
 
 func TestInsertOutOfBounds(t *testing.T) {
 	rope := NewRope("Test")
-	err := rope.Insert(-1, "Invalid")
+	_, err := rope.Insert(-1, "Invalid")
 	if err == nil {
 		t.Errorf("Expected ErrOutOfBounds for negative index, got %v", err)
 	}
 
-	err = rope.Insert(5, "Invalid") // len("Test") is 4 graphemes
+	_, err = rope.Insert(5, "Invalid") // len("Test") is 4 graphemes
 	if err == nil {
 		t.Errorf("Expected ErrOutOfBounds for index beyond length, got %v", err)
 	}
@@ -126,7 +128,7 @@ func TestDelete(t *testing.T) {
 
 	for _, tt := range tests {
 		rope := NewRope(tt.initial)
-		err := rope.Delete(tt.start, tt.end)
+		_, err := rope.Delete(tt.start, tt.end)
 		if err != nil {
 			t.Errorf("Delete failed for initial %q from %d to %d: %v",
 				tt.initial, tt.start, tt.end, err)
@@ -144,17 +146,17 @@ func TestDelete(t *testing.T) {
 
 func TestDeleteInvalidRange(t *testing.T) {
 	rope := NewRope("Test")
-	err := rope.Delete(-1, 2)
+	_, err := rope.Delete(-1, 2)
 	if err == nil {
 		t.Errorf("Expected ErrInvalidRange for negative start, got %v", err)
 	}
 
-	err = rope.Delete(1, 5) // len("Test") is 4 graphemes
+	_, err = rope.Delete(1, 5) // len("Test") is 4 graphemes
 	if err == nil {
 		t.Errorf("Expected ErrInvalidRange for end beyond length, got %v", err)
 	}
 
-	err = rope.Delete(3, 2) // start > end
+	_, err = rope.Delete(3, 2) // start > end
 	if err == nil {
 		t.Errorf("Expected ErrInvalidRange for start > end, got %v", err)
 	}
@@ -246,3 +248,347 @@ func TestTotalGraphemes(t *testing.T) {
 		}
 	}
 }
+
+// applyEdits applies line edits to lines in reverse order.
+func applyEdits(lines []string, edits []Edit) []string {
+	result := append([]string(nil), lines...)
+	for i := len(edits) - 1; i >= 0; i-- {
+		e := edits[i]
+		tail := append([]string(nil), result[e.EndLine:]...)
+		result = append(append(result[:e.StartLine], e.Lines...), tail...)
+	}
+	return result
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   string
+		after    string
+		expected []Edit
+	}{
+		{"identical", "a\nb\nc", "a\nb\nc", nil},
+		{"modify middle line", "a\nb\nc", "a\nB\nc", []Edit{{StartLine: 1, EndLine: 2, Lines: []string{"B"}}}},
+		{"insert line", "a\nc", "a\nb\nc", []Edit{{StartLine: 1, EndLine: 1, Lines: []string{"b"}}}},
+		{"delete line", "a\nb\nc", "a\nc", []Edit{{StartLine: 1, EndLine: 2}}},
+		{"append trailing newline", "a", "a\n", []Edit{{StartLine: 1, EndLine: 1, Lines: []string{""}}}},
+		{
+			"separate hunks",
+			"one\ntwo\nthree\nfour\nfive",
+			"one\n2\nthree\nfour\nfive\nsix",
+			[]Edit{
+				{StartLine: 1, EndLine: 2, Lines: []string{"2"}},
+				{StartLine: 5, EndLine: 5, Lines: []string{"six"}},
+			},
+		},
+		{"from empty", "", "x\ny", []Edit{{StartLine: 0, EndLine: 1, Lines: []string{"x", "y"}}}},
+		{"graphemes", "👋\n🇺🇳", "👋\n🌍", []Edit{{StartLine: 1, EndLine: 2, Lines: []string{"🌍"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, after := NewRope(tt.before), NewRope(tt.after)
+			edits := before.Diff(after)
+			if !reflect.DeepEqual(edits, tt.expected) {
+				t.Errorf("Diff mismatch: expected %+v, got %+v", tt.expected, edits)
+			}
+			got := applyEdits(before.SplitLines(), edits)
+			if !reflect.DeepEqual(got, after.SplitLines()) {
+				t.Errorf("applying edits: expected %q, got %q", after.SplitLines(), got)
+			}
+		})
+	}
+}
+
+func TestDiffWithin(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   string
+		after    string
+		maxLines int
+		ok       bool
+	}{
+		{"within the limit", "a\nb\nc", "a\nB\nc", 2, true},
+		{"past the limit", "a\nb\nc", "x\ny\nz", 5, false},
+		{"at the limit", "a\nb\nc", "x\ny\nz", 6, true},
+		{"no limit", strings.Repeat("a\n", 500), strings.Repeat("b\n", 500), -1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, after := NewRope(tt.before), NewRope(tt.after)
+			edits, ok := before.DiffWithin(after, tt.maxLines)
+			if ok != tt.ok {
+				t.Fatalf("expected ok %v, got %v", tt.ok, ok)
+			}
+			if !ok {
+				return
+			}
+			if got := applyEdits(before.SplitLines(), edits); !reflect.DeepEqual(got, after.SplitLines()) {
+				t.Errorf("applying edits: expected %q, got %q", after.SplitLines(), got)
+			}
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	rope := NewRope("Hello")
+	snap := rope.Snapshot()
+	if _, err := rope.Insert(5, ", World!"); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if snap.String() != "Hello" {
+		t.Errorf("Snapshot changed after edit: got %q", snap.String())
+	}
+	if rope.String() != "Hello, World!" {
+		t.Errorf("Insert result mismatch: got %q", rope.String())
+	}
+}
+
+func TestInsertAppendMatchesSplit(t *testing.T) {
+	tests := []struct {
+		name    string
+		initial string
+		appends []string
+	}{
+		{"empty rope", "", []string{"a", "b", "c"}},
+		{"fills a leaf", "", []string{strings.Repeat("x", MaxLeafSize-1), "y", "z"}},
+		{"multi-leaf rope", strings.Repeat("line\n", 200), []string{"f", "o", "o", "\n"}},
+		{"large append", "start", []string{strings.Repeat("ab", MaxLeafSize)}},
+		{"graphemes", "👋", []string{"🌍", "こ", "🇺🇳"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fast := NewRope(tt.initial)
+			slow := NewRope(tt.initial)
+			snap := fast.Snapshot()
+
+			for _, s := range tt.appends {
+				if _, err := fast.Insert(fast.TotalGraphemes(), s); err != nil {
+					t.Fatalf("Insert failed: %v", err)
+				}
+				slow.insertSplit(slow.TotalGraphemes(), s)
+			}
+
+			if fast.String() != slow.String() {
+				t.Errorf("expected %q, got %q", slow.String(), fast.String())
+			}
+			if fast.TotalGraphemes() != slow.TotalGraphemes() {
+				t.Errorf("expected %d graphemes, got %d", slow.TotalGraphemes(), fast.TotalGraphemes())
+			}
+			for i := 0; i < fast.TotalGraphemes(); i++ {
+				want, _ := slow.GraphemeAt(i)
+				if got, _ := fast.GraphemeAt(i); got != want {
+					t.Fatalf("grapheme %d: expected %q, got %q", i, want, got)
+				}
+			}
+			if snap.String() != tt.initial {
+				t.Errorf("snapshot changed after appending: got %q", snap.String())
+			}
+		})
+	}
+}
+
+func BenchmarkInsertAppend(b *testing.B) {
+	initial := strings.Repeat("some text on a line\n", 1000)
+
+	b.Run("fast path", func(b *testing.B) {
+		rope := NewRope(initial)
+		for i := 0; i < b.N; i++ {
+			_, _ = rope.Insert(rope.TotalGraphemes(), "x")
+		}
+	})
+
+	b.Run("split", func(b *testing.B) {
+		rope := NewRope(initial)
+		for i := 0; i < b.N; i++ {
+			rope.insertSplit(rope.root.totalGraphemes(), "x")
+		}
+	})
+}
+
+func TestEqualTo(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{"empty", "", "", true},
+		{"small equal", "hello", "hello", true},
+		{"small different", "hello", "hellp", false},
+		{"different length", "hello", "hello!", false},
+		{"one leaf", strings.Repeat("a", MaxLeafSize), strings.Repeat("a", MaxLeafSize), true},
+		{"many leaves", strings.Repeat("line\n", 1000), strings.Repeat("line\n", 1000), true},
+		{"last grapheme differs", strings.Repeat("line\n", 1000) + "a", strings.Repeat("line\n", 1000) + "b", false},
+		{"first grapheme differs", "x" + strings.Repeat("line\n", 1000), "y" + strings.Repeat("line\n", 1000), false},
+		{"same count, different bytes", "é" + strings.Repeat("a", 600), "e" + strings.Repeat("a", 600), false},
+		{"graphemes", strings.Repeat("👋🌍", 300), strings.Repeat("👋🌍", 300), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := NewRope(tt.a), NewRope(tt.b)
+			if got := a.EqualTo(b); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+			if got := b.EqualTo(a); got != tt.want {
+				t.Errorf("expected %v in reverse, got %v", tt.want, got)
+			}
+		})
+	}
+
+	// equal text split into different leaves
+	a := NewRope(strings.Repeat("ab", 400))
+	b := NewRope("")
+	for i := 0; i < 400; i++ {
+		_, _ = b.Insert(b.TotalGraphemes(), "ab")
+	}
+	if !a.EqualTo(b) {
+		t.Errorf("expected ropes with different leaf layouts to be equal")
+	}
+	if !a.EqualTo(a.Snapshot()) {
+		t.Errorf("expected a snapshot to equal its rope")
+	}
+	if a.EqualTo(nil) {
+		t.Errorf("expected a rope not to equal nil")
+	}
+}
+
+func TestHash(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{"empty", "", "", true},
+		{"equal", "hello", "hello", true},
+		{"one character differs", "hello", "hellp", false},
+		{"many leaves", strings.Repeat("line\n", 1000), strings.Repeat("line\n", 1000), true},
+		{"one character differs in many leaves", strings.Repeat("line\n", 1000) + "a", strings.Repeat("line\n", 1000) + "b", false},
+		{"empty and newline", "", "\n", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewRope(tt.a).Hash() == NewRope(tt.b).Hash(); got != tt.want {
+				t.Errorf("expected equal hashes to be %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	// equal text split into different leaves
+	a := NewRope(strings.Repeat("ab", 400))
+	b := NewRope("")
+	for i := 0; i < 400; i++ {
+		_, _ = b.Insert(b.TotalGraphemes(), "ab")
+	}
+	if a.Hash() != b.Hash() {
+		t.Errorf("expected ropes with different leaf layouts to hash the same")
+	}
+
+	// the cached hash follows edits
+	before := a.Hash()
+	_, _ = a.Replace(0, 1, "x")
+	if a.Hash() == before {
+		t.Errorf("expected an edit to change the hash")
+	}
+	_, _ = a.Replace(0, 1, "a")
+	if a.Hash() != before {
+		t.Errorf("expected undoing the edit to restore the hash")
+	}
+}
+
+// lazyRope returns a lazy rope over lines, a piece per line, caching one piece,
+// and the number of times pieces were loaded.
+func lazyRope(lines []string) (*Rope, *int) {
+	text := strings.Join(lines, "")
+	var pieces []Piece
+	offset := 0
+	for _, line := range lines {
+		pieces = append(pieces, Piece{Offset: int64(offset), Size: len(line), Graphemes: countGraphemes(line)})
+		offset += len(line)
+	}
+	loads := 0
+	load := func(offset int64, size int) (string, error) {
+		loads++
+		return text[offset : int(offset)+size], nil
+	}
+	return NewLazyRope(pieces, load, 1), &loads
+}
+
+func TestLazyRope(t *testing.T) {
+	lines := []string{"héllo\n", "👋🌍\n", "A🇺🇳B\n", "end"}
+	text := strings.Join(lines, "")
+	r, loads := lazyRope(lines)
+
+	if *loads != 0 {
+		t.Fatalf("expected no pieces loaded up front, got %d", *loads)
+	}
+	if got, want := r.TotalGraphemes(), countGraphemes(text); got != want {
+		t.Errorf("expected %d graphemes, got %d", want, got)
+	}
+	if got, err := r.Substring(7, 10); err != nil || got != "🌍\nA" {
+		t.Errorf("expected %q, got %q (%v)", "🌍\nA", got, err)
+	}
+	if got, err := r.GraphemeAt(10); err != nil || got != "🇺🇳" {
+		t.Errorf("expected %q, got %q (%v)", "🇺🇳", got, err)
+	}
+	if got := r.String(); got != text {
+		t.Errorf("expected %q, got %q", text, got)
+	}
+
+	var graphemes []string
+	for it := r.NewIterator(); ; {
+		g, ok := it.Next()
+		if !ok {
+			break
+		}
+		graphemes = append(graphemes, g)
+	}
+	if got := strings.Join(graphemes, ""); got != text {
+		t.Errorf("expected the iterator to walk %q, got %q", text, got)
+	}
+	if !r.EqualTo(NewRope(text)) || r.Hash() != NewRope(text).Hash() {
+		t.Errorf("expected the lazy rope to equal the same text in memory")
+	}
+
+	// reading the same piece again doesn't load it again
+	before := *loads
+	_, _ = r.GraphemeAt(0)
+	_, _ = r.GraphemeAt(1)
+	if *loads != before+1 {
+		t.Errorf("expected a cached piece to be reused, got %d loads", *loads-before)
+	}
+
+	// edits split the pieces they touch like any other leaves
+	snapshot := r.Snapshot()
+	if _, err := r.Replace(1, 2, "e"); err != nil {
+		t.Fatalf("Replace failed: %v", err)
+	}
+	if _, err := r.Insert(r.TotalGraphemes(), "!"); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if got, want := r.String(), "hello\n👋🌍\nA🇺🇳B\nend!"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got := snapshot.String(); got != text {
+		t.Errorf("expected the snapshot to keep %q, got %q", text, got)
+	}
+}
+
+func TestLazyRopeUnreadable(t *testing.T) {
+	load := func(offset int64, size int) (string, error) {
+		return "", errors.New("unreadable")
+	}
+	r := NewLazyRope([]Piece{{Offset: 0, Size: 4, Graphemes: 3}}, load, 1)
+	if got := r.String(); got != strings.Repeat("\uFFFD", 3) {
+		t.Errorf("expected replacement characters, got %q", got)
+	}
+
+	// text that no longer holds as many graphemes is replaced as well
+	r = NewLazyRope([]Piece{{Offset: 0, Size: 2, Graphemes: 2}}, func(int64, int) (string, error) { return "abc", nil }, 1)
+	if got := r.String(); got != strings.Repeat("\uFFFD", 2) {
+		t.Errorf("expected replacement characters, got %q", got)
+	}
+}
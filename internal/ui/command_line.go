@@ -0,0 +1,145 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/lg2m/athena/internal/editor"
+	"github.com/lg2m/athena/internal/editor/state"
+)
+
+// CommandLineView represents the `:` prompt drawn in place of the status bar, which
+// doubles as the `/` and `?` search prompt in search mode.
+type CommandLineView struct {
+	BaseView
+	editor *editor.Editor
+	input  []rune
+	style  tcell.Style
+}
+
+func NewCommandLineView(e *editor.Editor) *CommandLineView {
+	return &CommandLineView{
+		editor: e,
+		style:  tcell.StyleDefault,
+	}
+}
+
+// Draw implements the command line view.
+func (v *CommandLineView) Draw(screen tcell.Screen) {
+	for x := v.x; x < v.x+v.width; x++ {
+		screen.SetContent(x, v.y, ' ', nil, v.style)
+	}
+
+	line := append([]rune{v.prompt()}, v.input...)
+	for i, ch := range line {
+		if i >= v.width {
+			break
+		}
+		screen.SetContent(v.x+i, v.y, ch, nil, v.style)
+	}
+
+	// Draw the prompt cursor after the typed input
+	if len(line) < v.width {
+		screen.SetContent(v.x+len(line), v.y, ' ', nil, v.style.Reverse(true))
+	}
+}
+
+// Open reports whether the prompt is taking input, in command or search mode.
+func (v *CommandLineView) Open() bool {
+	mode := v.editor.GetMode()
+	return mode == state.Command || mode == state.Search
+}
+
+// prompt returns the character the prompt starts with.
+func (v *CommandLineView) prompt() rune {
+	switch {
+	case v.editor.GetMode() != state.Search:
+		return ':'
+	case v.editor.SearchPromptForward():
+		return '/'
+	default:
+		return '?'
+	}
+}
+
+func (v *CommandLineView) HandleEvent(ev tcell.Event) bool {
+	keyEv, ok := ev.(*tcell.EventKey)
+	if !ok {
+		return false
+	}
+	if v.editor.GetMode() == state.Search {
+		return v.handleSearchKey(keyEv)
+	}
+
+	switch getKeyString(keyEv) {
+	case "<esc>":
+		v.close()
+	case "<cr>":
+		cmd := string(v.input)
+		v.close()
+		v.execute(cmd)
+	case "<bs>":
+		if len(v.input) == 0 {
+			v.close()
+			return true
+		}
+		v.input = v.input[:len(v.input)-1]
+	default:
+		if keyEv.Key() != tcell.KeyRune {
+			return false
+		}
+		v.input = append(v.input, keyEv.Rune())
+	}
+	return true
+}
+
+// handleSearchKey edits the search pattern, moving the cursor to its first match
+// as it's typed.
+func (v *CommandLineView) handleSearchKey(ev *tcell.EventKey) bool {
+	var err error
+	switch getKeyString(ev) {
+	case "<esc>":
+		v.input = nil
+		err = v.editor.CancelSearch()
+	case "<cr>":
+		pattern := string(v.input)
+		v.input = nil
+		err = v.editor.ConfirmSearch(pattern)
+	case "<bs>":
+		if len(v.input) == 0 {
+			err = v.editor.CancelSearch()
+			break
+		}
+		v.input = v.input[:len(v.input)-1]
+		err = v.editor.UpdateSearch(string(v.input))
+	default:
+		if ev.Key() != tcell.KeyRune {
+			return false
+		}
+		v.input = append(v.input, ev.Rune())
+		err = v.editor.UpdateSearch(string(v.input))
+	}
+	if err != nil {
+		v.editor.SetMessage(err.Error())
+	}
+	return true
+}
+
+// close clears the prompt and returns to normal mode.
+func (v *CommandLineView) close() {
+	v.input = nil
+	v.editor.SetMode(state.Normal)
+}
+
+// execute runs a command typed at the prompt through the editor's command registry.
+func (v *CommandLineView) execute(cmd string) {
+	err := v.editor.Commands().Execute(cmd)
+	if errors.Is(err, editor.ErrUnknownCommand) {
+		name, _, _ := strings.Cut(strings.TrimSpace(cmd), " ")
+		v.editor.SetMessage(fmt.Sprintf("Not an editor command: %s", name))
+	} else if err != nil {
+		v.editor.SetMessage(err.Error())
+	}
+}
@@ -2,13 +2,20 @@ package ui
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/lg2m/athena/internal/athena/config"
 	"github.com/lg2m/athena/internal/editor"
+	"github.com/lg2m/athena/internal/editor/buffer"
 	"github.com/lg2m/athena/internal/editor/state"
+	"github.com/lg2m/athena/internal/editor/treesitter"
+	"github.com/lg2m/athena/internal/util"
 )
 
 // DocumentView represents the main document (or file) view.
@@ -18,148 +25,308 @@ type DocumentView struct {
 	cfg      *config.Config
 	viewport *Viewport
 
-	keyBuffer     string
+	keyBuffer     []string // keys of the sequence being typed
 	numericPrefix string
 
-	goToMenu *GoToMenu
+	pendingTarget string // action waiting for its target character, e.g. find-char
+	pendingCount  int    // numeric prefix captured for the pending action
+
+	literal *literalInput // pending insert-literal sequence started with <c-v>
+
+	bracketCursor int // cursor position the bracket match was computed for
+	bracketMatch  int // matching bracket position, -1 when none
+
+	dragging       bool // mouse button held down inside the document
+	mouseSelection bool // selection was made by dragging the mouse
+
+	lastCursor [2]int // line and column of the cursor when last drawn
+
+	whichKey *WhichKeyMenu
 }
 
 func NewDocumentView(e *editor.Editor, cfg *config.Config, v *Viewport) *DocumentView {
 	return &DocumentView{
-		editor:   e,
-		cfg:      cfg,
-		viewport: v,
-		goToMenu: NewGoToMenu(cfg),
+		editor:        e,
+		cfg:           cfg,
+		viewport:      v,
+		bracketCursor: -1,
+		bracketMatch:  -1,
+		whichKey:      NewWhichKeyMenu(cfg),
 	}
 }
 
+// SetRedraw sets the function called to redraw the screen when the which-key menu's
+// delay elapses while the event loop waits for input.
+func (v *DocumentView) SetRedraw(redraw func()) {
+	v.whichKey.wake = redraw
+}
+
 // Draw implements the document view.
 func (v *DocumentView) Draw(screen tcell.Screen) {
 	currLine, currCol, _ := v.editor.GetCurrentPosition()
 	total, _ := v.editor.GetLineCount()
 
-	// Update viewport to ensure cursor visibility
+	// the buffer's :set wrap may differ from the last one drawn
+	v.updateWrapWidth()
+
+	// Update viewport to ensure cursor visibility; horizontal scrolling only
+	// follows the cursor when it moved, so it can be scrolled away from it
+	cursorCol := screenColumn(v.editor, currLine, currCol)
 	v.viewport.Update(currLine, v.height)
+	v.viewport.ScrollToCursor(v.editor, currLine, cursorCol, v.height, total)
+	if cursor := [2]int{currLine, currCol}; cursor != v.lastCursor {
+		v.viewport.UpdateColumn(cursorCol, v.width)
+		v.lastCursor = cursor
+	}
 
 	// Get visible range from viewport
-	start, end := v.viewport.VisibleRange(v.height, total)
+	start, _ := v.viewport.VisibleRange(v.height, total)
 
 	mode := v.editor.GetMode()
 	cursorShape := v.getCursorShape(mode)
+	cursorX, cursorY := -1, -1
+
+	matchLine, matchCol, hasMatch := v.matchingBracket()
+	searchPattern := []rune(v.editor.SearchHighlight())
+	wholeWord := v.editor.SearchWholeWord()
+
+	// Highlight the selection made with the mouse or in visual mode
+	var selStart, selEnd [2]int
+	hasSelection := false
+	if selection, err := v.editor.Selection(); err == nil && (v.HasMouseSelection() || mode == state.Visual) {
+		startLine, startCol, err1 := v.editor.LineCol(min(selection.Start, selection.End))
+		endLine, endCol, err2 := v.editor.LineCol(max(selection.Start, selection.End))
+		selStart, selEnd = [2]int{startLine, startCol}, [2]int{endLine, endCol}
+		hasSelection = err1 == nil && err2 == nil
+	}
 
-	// Get the current selection range
-	// selection, _ := v.editor.Selection()
-
-	highlights, err := v.editor.GetHighlights()
+	lineHighlights, err := v.editor.HighlightsByLine()
 	if err != nil {
 		return
 	}
 
-	type HighlightRange struct {
-		StartCol int
-		EndCol   int
-		Style    tcell.Style
+	// cursors other than the primary one, by line and column
+	cursors := map[[2]int]bool{}
+	if selections, primary, err := v.editor.Selections(); err == nil {
+		for i, selection := range selections {
+			if line, col, err := v.editor.LineCol(selection.End); err == nil && i != primary {
+				cursors[[2]int{line, col}] = true
+			}
+		}
 	}
 
-	lineHighlightMap := make(map[int][]HighlightRange)
-	for _, h := range highlights {
-		startLine := int(h.Start.Row)
-		startCol := int(h.Start.Column)
-		endLine := int(h.End.Row)
-		endCol := int(h.End.Column)
-		style := h.Style
-
-		for line := startLine; line <= endLine; line++ {
-			lineStartCol := 0
-			lineEndCol := -1
-			if line == startLine {
-				lineStartCol = startCol
-			}
-			if line == endLine {
-				lineEndCol = endCol
+	cursorLine := bufferOption(v.editor, buffer.OptionCursorLine, v.cfg.Editor.CursorLine)
+	cursorLineStyle := tcell.StyleDefault.Background(tcell.ColorDarkSlateGray)
+
+	wrapWidth := v.viewport.WrapWidth()
+	tabs := tabWidth(v.editor)
+	var runes []rune
+	var cols []int
+	var styles []tcell.Style
+	prevLine := -1
+
+	rows := v.viewport.scrollRows(screenRows(v.editor, start, v.height, total, wrapWidth))
+	for i, row := range rows {
+		lineIdx := row.line
+		if lineIdx != prevLine {
+			line, err := v.editor.GetLine(lineIdx)
+			if err != nil {
+				continue
 			}
+			prevLine = lineIdx
+			runes = []rune(line)
+			cols = lineColumns(runes, tabs)
+			styles = lineStyles(lineIdx, runes, lineHighlights[lineIdx], searchPattern, wholeWord)
+		}
+
+		end := row.startCol + v.width
+		if wrapWidth > 0 {
+			end = min(end, row.startCol+wrapWidth)
+		}
 
-			lineRanges, exists := lineHighlightMap[line]
-			if !exists {
-				lineRanges = []HighlightRange{}
+		highlightRow := cursorLine && lineIdx == currLine
+		if highlightRow {
+			for x := 0; x < v.width; x++ {
+				screen.SetContent(v.x+x, v.y+i, ' ', nil, cursorLineStyle)
 			}
+		}
 
-			lineRanges = append(lineRanges, HighlightRange{
-				StartCol: lineStartCol,
-				EndCol:   lineEndCol,
-				Style:    style,
-			})
+		for x := runeAtColumn(cols, row.startCol); x < len(runes) && cols[x] < end; x++ {
+			style := styles[x]
+			if highlightRow {
+				style = style.Background(tcell.ColorDarkSlateGray)
+			}
 
-			lineHighlightMap[line] = lineRanges
-		}
-	}
+			if hasSelection && inRange([2]int{lineIdx, x}, selStart, selEnd) {
+				style = style.Background(treesitter.ColorBgSelection)
+			}
 
-	for i := 0; i < v.height; i++ {
-		lineIdx := start + i
-		if lineIdx >= end {
-			break
-		}
+			// emphasize the bracket matching the one at the cursor
+			if hasMatch && lineIdx == matchLine && x == matchCol {
+				style = style.Bold(true).Underline(true)
+			}
 
-		line, err := v.editor.GetLine(lineIdx)
-		if err != nil {
-			continue
-		}
+			// a tab fills the cells up to the next tab stop, possibly split across rows
+			first, last := max(cols[x], row.startCol), min(cols[x+1], end)
 
-		runes := []rune(line)
-		styles := make([]tcell.Style, len(runes))
-		for j := range styles {
-			styles[j] = tcell.StyleDefault
-		}
+			// apply cursor style if this is the cursor position
+			cellStyle := style
+			if lineIdx == currLine && x == currCol && cols[x] >= row.startCol {
+				cursorX, cursorY = v.x+first-row.startCol, v.y+i
+				cellStyle = v.cursorCellStyle(style, mode, cursorShape)
+			} else if cursors[[2]int{lineIdx, x}] && cols[x] >= row.startCol {
+				cellStyle = style.Reverse(true)
+			}
 
-		if lineRanges, exists := lineHighlightMap[lineIdx]; exists {
-			for _, r := range lineRanges {
-				startCol := r.StartCol
-				endCol := r.EndCol
-				if endCol == -1 || endCol > len(styles) {
-					endCol = len(styles)
+			if runes[x] == '\t' {
+				for col := first; col < last; col++ {
+					screen.SetContent(v.x+col-row.startCol, v.y+i, ' ', nil, cellStyle)
+					cellStyle = style
 				}
-				if startCol < 0 {
-					startCol = 0
-				}
-				for j := startCol; j < endCol && j < len(styles); j++ {
-					styles[j] = r.Style
+			} else if first < last && cols[x] >= row.startCol {
+				// the runes combined with this one take no columns and are drawn with it;
+				// a wide character fills its second cell itself
+				next := x + 1
+				for next < len(runes) && cols[next] == cols[next+1] {
+					next++
 				}
+				screen.SetContent(v.x+first-row.startCol, v.y+i, runes[x], runes[x+1:next], cellStyle)
 			}
 		}
 
-		for x := range runes {
-			style := styles[x]
+		// Handle cursor at end of line, drawn on the line's last row
+		if width := cols[len(runes)]; lineIdx == currLine && currCol >= len(runes) && width >= row.startCol &&
+			width <= row.startCol+v.width && (wrapWidth == 0 || width-row.startCol < wrapWidth) {
+			cursorX, cursorY = v.x+width-row.startCol, v.y+i
+			style := v.cursorCellStyle(tcell.StyleDefault, mode, cursorShape)
+			screen.SetContent(cursorX, cursorY, ' ', nil, style)
+		} else if width := cols[len(runes)]; cursors[[2]int{lineIdx, len(runes)}] && width >= row.startCol &&
+			width < row.startCol+v.width && (wrapWidth == 0 || width-row.startCol < wrapWidth) {
+			screen.SetContent(v.x+width-row.startCol, v.y+i, ' ', nil, tcell.StyleDefault.Reverse(true))
+		}
+	}
 
-			// apply cursor style if this is the cursor position
-			if lineIdx == currLine && x == currCol {
-				if mode == state.Normal {
-					style = v.getCursorStyle(cursorShape)
-				} else {
-					style = style.Reverse(true)
-				}
-			}
+	// A blinking cursor needs the terminal's own cursor
+	if v.cfg.Editor.CursorBlink && cursorX >= 0 {
+		screen.SetCursorStyle(blinkingCursorStyle(cursorShape))
+		screen.ShowCursor(cursorX, cursorY)
+	} else {
+		screen.HideCursor()
+	}
 
-			screen.SetContent(v.x+x, v.y+i, runes[x], nil, style)
+	// Mark the end of the buffer when it's on screen
+	if marker := []rune(v.cfg.Editor.EOFMarker.Document); len(rows) < v.height && len(marker) > 0 {
+		style := tcell.StyleDefault.Foreground(tcell.GetColor(v.cfg.Editor.EOFMarker.Color)).Dim(true)
+		for x := 0; x < v.width; x++ {
+			screen.SetContent(v.x+x, v.y+len(rows), marker[x%len(marker)], nil, style)
 		}
+	}
 
-		// Handle cursor at end of line
-		if lineIdx == currLine && currCol >= len(runes) {
-			style := tcell.StyleDefault
-			if mode == state.Normal {
-				style = v.getCursorStyle(cursorShape)
-			} else {
-				style = style.Reverse(true)
-			}
-			screen.SetContent(v.x+len(runes), v.y+i, ' ', nil, style)
+	v.whichKey.Draw(screen, v.height)
+}
+
+// lineStyles computes the style of each rune on a line from its syntax highlights
+// and the matches of the active search pattern.
+func lineStyles(lineIdx int, runes []rune, highlights []treesitter.Highlight, searchPattern []rune, wholeWord bool) []tcell.Style {
+	styles := make([]tcell.Style, len(runes))
+	for j := range styles {
+		styles[j] = tcell.StyleDefault
+	}
+
+	for _, h := range highlights {
+		startCol, endCol := 0, len(styles)
+		if int(h.Start.Row) == lineIdx {
+			startCol = runeColumn(runes, int(h.Start.Column))
+		}
+		if int(h.End.Row) == lineIdx {
+			endCol = runeColumn(runes, int(h.End.Column))
+		}
+		for j := startCol; j < endCol; j++ {
+			styles[j] = h.Style
 		}
 	}
 
-	v.goToMenu.Draw(screen, v.height)
+	// highlight matches of the active search pattern
+	for _, col := range findAll(runes, searchPattern, wholeWord) {
+		for j := col; j < col+len(searchPattern); j++ {
+			styles[j] = styles[j].Background(tcell.ColorOlive).Foreground(tcell.ColorBlack)
+		}
+	}
+
+	return styles
+}
+
+// runeColumn converts a byte column on a line, as tree-sitter counts them, to the
+// index of the rune starting there.
+func runeColumn(runes []rune, byteCol int) int {
+	offset := 0
+	for i, r := range runes {
+		if offset >= byteCol {
+			return i
+		}
+		offset += utf8.RuneLen(r)
+	}
+	return len(runes)
+}
+
+// Resize implements view resizing, updates the soft-wrap width and keeps the
+// cursor visible in the new height.
+func (v *DocumentView) Resize(x, y, width, height int) {
+	v.BaseView.Resize(x, y, width, height)
+	v.updateWrapWidth()
+
+	if currLine, _, err := v.editor.GetCurrentPosition(); err == nil {
+		total, _ := v.editor.GetLineCount()
+		v.viewport.Clamp(currLine, height, total)
+	}
+}
+
+// updateWrapWidth wraps lines at the view width when soft-wrap is on for the current buffer.
+func (v *DocumentView) updateWrapWidth() {
+	if bufferOption(v.editor, buffer.OptionWrap, v.cfg.Editor.SoftWrap) {
+		v.viewport.SetWrapWidth(v.width)
+	} else {
+		v.viewport.SetWrapWidth(0)
+	}
+}
+
+// bufferOption returns the current buffer's local value for an option set with :set,
+// falling back to the editor config.
+func bufferOption(e *editor.Editor, name string, global bool) bool {
+	if value, ok := e.BufferOption(name); ok {
+		return value
+	}
+	return global
 }
 
 func (v *DocumentView) HandleEvent(ev tcell.Event) bool {
 	switch ev := ev.(type) {
+	case *tcell.EventMouse:
+		return v.handleMouse(ev)
 	case *tcell.EventKey:
+		// edits may shift brackets without moving the cursor
+		v.bracketCursor = -1
+
+		if v.cfg.Editor.GuiClipboard && v.handleClipboardKey(ev) {
+			return true
+		}
+		v.mouseSelection = false
+
+		// the key after f/t/F/T is the target character, not a command
+		if v.pendingTarget != "" {
+			action := v.pendingTarget
+			v.pendingTarget = ""
+			if ev.Key() == tcell.KeyRune {
+				v.completeTarget(action, string(ev.Rune()))
+			}
+			return true
+		}
+
+		// the key after <c-v> is inserted literally
+		if v.literal != nil && v.handleLiteral(ev) {
+			return true
+		}
+
 		key := getKeyString(ev)
 		mode := v.editor.GetMode()
 		var keymap map[string]config.KeyAction
@@ -167,39 +334,53 @@ func (v *DocumentView) HandleEvent(ev tcell.Event) bool {
 		switch mode {
 		case state.Normal:
 			keymap = v.cfg.Keymap.Normal
-		case state.Insert:
+		case state.Insert, state.Replace:
+			// replace mode types over text but is otherwise edited like insert mode
 			keymap = v.cfg.Keymap.Insert
+		case state.Visual:
+			keymap = v.cfg.Keymap.Visual
 		}
 
 		// Handle numeric prefixes (digits)
-		if isDigit(key) && mode == state.Normal {
+		if isDigit(key) && (mode == state.Normal || mode == state.Visual) {
 			v.numericPrefix += key
 			return true
 		}
 
-		v.keyBuffer += key
+		// <esc> cancels a pending sequence, whatever it's bound to
+		if key == "<esc>" && len(v.keyBuffer) > 0 {
+			v.whichKey.Hide()
+			v.numericPrefix = ""
+			v.keyBuffer = nil
+			return true
+		}
+
+		v.keyBuffer = append(v.keyBuffer, key)
 
 		action, partial, matched := v.matchKeySequence(keymap)
 		if matched {
-			v.keyBuffer = ""
+			v.keyBuffer = nil
+			v.whichKey.Hide()
 			return v.executeAction(action)
 		} else if partial {
-			if v.keyBuffer[0] == 'g' && !v.goToMenu.visible {
-				v.goToMenu.Show()
-			}
-
-			if key == "<esc>" {
-				v.goToMenu.Hide()
-				v.numericPrefix = ""
-				v.keyBuffer = ""
-				return false
+			v.whichKey.SetKeys(strings.Join(v.keyBuffer, ""), continuations(keymap, v.keyBuffer))
+			if !v.whichKey.Visible() {
+				v.whichKey.Schedule()
 			}
-
 			return true
 		} else {
-			v.keyBuffer = ""
+			v.keyBuffer = nil
+			v.whichKey.Hide()
+			if ev.Key() == tcell.KeyRune && mode == state.Replace {
+				_ = v.editor.OverwriteText(string(ev.Rune()))
+				return true
+			}
 			if ev.Key() == tcell.KeyRune && mode == state.Insert {
-				_ = v.editor.InsertText(string(ev.Rune()))
+				if v.cfg.Editor.AutoPairs {
+					_ = v.editor.InsertAutoPair(string(ev.Rune()), v.cfg.Editor.AutoPairsContextAwareEnabled())
+				} else {
+					_ = v.editor.InsertText(string(ev.Rune()))
+				}
 				return true
 			}
 		}
@@ -207,84 +388,233 @@ func (v *DocumentView) HandleEvent(ev tcell.Event) bool {
 	return false
 }
 
-func (v *DocumentView) matchKeySequence(keymap config.KeyMap) (string, bool, bool) {
-	if len(v.keyBuffer) == 0 || keymap == nil {
-		return "", false, false
+// HasMouseSelection reports whether a selection made with the mouse is active.
+func (v *DocumentView) HasMouseSelection() bool {
+	return v.mouseSelection && v.editor.HasSelection()
+}
+
+// handleMouse moves the cursor to a clicked cell and extends the selection while dragging.
+func (v *DocumentView) handleMouse(ev *tcell.EventMouse) bool {
+	if !v.cfg.Editor.Mouse {
+		return false
+	}
+
+	switch buttons := ev.Buttons(); {
+	case buttons&tcell.WheelUp != 0:
+		v.scroll(-v.cfg.Editor.ScrollLines, 0)
+		return true
+	case buttons&tcell.WheelDown != 0:
+		v.scroll(v.cfg.Editor.ScrollLines, 0)
+		return true
+	case buttons&tcell.WheelLeft != 0:
+		v.scroll(0, -v.cfg.Editor.ScrollColumns)
+		return true
+	case buttons&tcell.WheelRight != 0:
+		v.scroll(0, v.cfg.Editor.ScrollColumns)
+		return true
+	}
+
+	if ev.Buttons()&tcell.Button1 == 0 {
+		wasDragging := v.dragging
+		v.dragging = false
+		return wasDragging
+	}
+
+	x, y := ev.Position()
+	if x < v.x || x >= v.x+v.width || y < v.y || y >= v.y+v.height {
+		return false
+	}
+
+	total, err := v.editor.GetLineCount()
+	if err != nil {
+		return false
+	}
+	start, _ := v.viewport.VisibleRange(v.height, total)
+	rows := v.viewport.scrollRows(screenRows(v.editor, start, v.height, total, v.viewport.WrapWidth()))
+	if len(rows) == 0 {
+		return false
+	}
+	row := rows[min(y-v.y, len(rows)-1)]
+
+	col := row.startCol + x - v.x
+	if text, err := v.editor.GetLine(row.line); err == nil {
+		col = runeAtColumn(lineColumns([]rune(text), tabWidth(v.editor)), col)
 	}
 
-	if actionVal, exists := keymap[v.keyBuffer]; exists {
-		if actionStr, ok := actionVal.(string); ok {
-			return actionStr, true, true
+	extend := v.dragging
+	if err := v.editor.SetCursor(row.line, col, extend); err != nil {
+		return false
+	}
+	v.dragging = true
+	v.mouseSelection = extend
+	return true
+}
+
+// moveInHistory runs an undo tree move as many times as the numeric prefix asks,
+// showing the error that stops it.
+func (v *DocumentView) moveInHistory(move func() error) {
+	for range v.getNumericPrefixOrDefault(1) {
+		if err := move(); err != nil {
+			v.editor.SetMessage(err.Error())
+			return
 		}
 	}
+}
 
-	firstKey := string(v.keyBuffer[0])
-	actionVal, exists := keymap[firstKey]
-	if !exists {
-		// First key does not exist in keymap.
-		return "", false, false
+// scroll scrolls the view by lines and columns, moving the cursor along when it
+// would otherwise leave the screen.
+func (v *DocumentView) scroll(lines, cols int) {
+	currLine, currCol, err := v.editor.GetCurrentPosition()
+	if err != nil {
+		return
 	}
+	total, _ := v.editor.GetLineCount()
 
-	switch val := actionVal.(type) {
-	case map[string]interface{}:
+	if lines != 0 {
+		v.viewport.ScrollLines(lines, v.height, total)
+		first, last := v.viewport.CursorLineRange(v.height)
+		if line := util.Clamp(currLine, first, min(last, total-1)); line != currLine {
+			_ = v.editor.JumpFromCursor(line-currLine, false)
+		}
+	}
 
-		if len(v.keyBuffer) == 1 {
-			// Only the first key is present; it's a partial match.
-			return "", true, false
+	if cols != 0 {
+		start, _ := v.viewport.VisibleRange(v.height, total)
+		longest := 0
+		for _, line := range visibleLines(v.editor, start, v.height, total) {
+			text, _ := v.editor.GetLine(line)
+			lineCols := lineColumns([]rune(text), tabWidth(v.editor))
+			longest = max(longest, lineCols[len(lineCols)-1])
 		}
+		v.viewport.ScrollColumns(cols, v.width, longest)
 
-		secondKey := string(v.keyBuffer[1])
-		if secondAction, exists := val[secondKey]; exists {
-			if actionStr, ok := secondAction.(string); ok {
-				return actionStr, true, true
-			}
-			// If the secondAction exists but is not a string, it's an unexpected type.
-			return "", false, false
+		left := v.viewport.LeftCol()
+		cursorCol := screenColumn(v.editor, currLine, currCol)
+		if col := util.Clamp(cursorCol, left, left+v.width-1); col != cursorCol {
+			text, _ := v.editor.GetLine(currLine)
+			_ = v.editor.SetCursor(currLine, runeAtColumn(lineColumns([]rune(text), tabWidth(v.editor)), col), false)
 		}
+	}
 
-		return "", true, false
+	// the view was scrolled on purpose, so the cursor's new position must not scroll it back
+	if line, col, err := v.editor.GetCurrentPosition(); err == nil {
+		v.lastCursor = [2]int{line, col}
+	}
+}
 
-	default:
-		// Unsupported type encountered in keymap.
-		return "", false, false
+// scrollPage moves the cursor and the view by the same number of lines, down when
+// lines is positive, so the cursor stays on its screen row like a page flip. Near
+// the ends of the document the view stops and the cursor goes on alone, stopping
+// at the first or last line.
+func (v *DocumentView) scrollPage(lines int, extend bool) {
+	total, err := v.editor.GetLineCount()
+	if err != nil {
+		return
 	}
+	v.viewport.ScrollLines(lines, v.height, total)
+	_ = v.editor.JumpFromCursor(lines, extend)
+}
 
-	// if action, ok := keymap[v.keyBuffer]; ok {
-	// 	if s, isStr := action.(string); isStr {
-	// 		return s, true, true
-	// 	}
-	// }
+// handleClipboardKey copies the mouse selection on <c-c> and pastes on <c-v>.
+func (v *DocumentView) handleClipboardKey(ev *tcell.EventKey) bool {
+	switch getKeyString(ev) {
+	case "<c-c>":
+		if !v.HasMouseSelection() {
+			return false
+		}
+		if err := v.editor.CopySelection(); err != nil {
+			v.editor.SetMessage(fmt.Sprintf("Copy failed: %v", err))
+		}
+		return true
+	case "<c-v>":
+		v.mouseSelection = false
+		if err := v.editor.PasteClipboard(); err != nil {
+			v.editor.SetMessage(fmt.Sprintf("Paste failed: %v", err))
+		}
+		return true
+	}
+	return false
+}
 
-	// key := string(v.keyBuffer[0])
+// matchKeySequence matches the keys typed so far against keymap, returning the
+// action they're bound to, whether they're bound or the start of a binding, and
+// whether they're bound as a whole.
+func (v *DocumentView) matchKeySequence(keymap config.KeyMap) (string, bool, bool) {
+	if len(v.keyBuffer) == 0 || keymap == nil {
+		return "", false, false
+	}
 
-	// action, exists := keymap[key]
-	// if !exists {
-	// 	return "", false, false
-	// }
+	// a sequence bound as a whole, like "gc", wins over the nested bindings it starts
+	if action, ok := keymap[strings.Join(v.keyBuffer, "")].(string); ok {
+		return action, true, true
+	}
+	return matchKeys(keymap, v.keyBuffer)
+}
 
-	// switch val := action.(type) {
-	// case map[string]interface{}:
-	// 	if len(v.keyBuffer) == 1 {
-	// 		// partial, not full
-	// 		return "", true, false
-	// 	}
+// matchKeys walks the nested keymaps under node along keys, like matchKeySequence.
+func matchKeys(node config.KeyAction, keys []string) (string, bool, bool) {
+	next, ok := keymapEntries(node)[keys[0]]
+	if !ok {
+		return "", false, false
+	}
 
-	// 	// We have a second key
-	// 	secondKey := string(v.keyBuffer[1])
-	// 	if secondAction, exists := val[secondKey]; exists {
-	// 		return secondAction.(string), true, true
-	// 	}
+	if action, isAction := next.(string); isAction {
+		if len(keys) > 1 {
+			// the keys go on past an action
+			return "", false, false
+		}
+		return action, true, true
+	}
+	if len(keys) == 1 {
+		return "", true, false
+	}
+	return matchKeys(next, keys[1:])
+}
 
-	// 	return "", true, false
+// keymapEntries returns the bindings of a nested keymap, or nil when node is an
+// action. The nested keymaps are map[string]string in the defaults and
+// map[string]interface{} when read from TOML.
+func keymapEntries(node config.KeyAction) map[string]config.KeyAction {
+	switch keymap := node.(type) {
+	case config.KeyMap:
+		return keymap
+	case map[string]interface{}:
+		entries := make(map[string]config.KeyAction, len(keymap))
+		for key, action := range keymap {
+			entries[key] = action
+		}
+		return entries
+	case map[string]string:
+		entries := make(map[string]config.KeyAction, len(keymap))
+		for key, action := range keymap {
+			entries[key] = action
+		}
+		return entries
+	}
+	return nil
+}
 
-	// case string:
-	// 	if len(v.keyBuffer) == 1 {
-	// 		_ = v.editor.InsertText(fmt.Sprintf("Matching key: %+v %+v\n", key, keymap))
-	// 		return val, true, true
-	// 	}
-	// }
+// continuations returns the bindings that can follow keys in keymap: those of the nested keymap the keys lead to, and the rest of any sequence
+// bound as a whole that the keys start.
+func continuations(keymap config.KeyMap, keys []string) map[string]config.KeyAction {
+	node := config.KeyAction(keymap)
+	for _, key := range keys {
+		node = keymapEntries(node)[key]
+	}
 
-	// return "", false, false
+	entries := map[string]config.KeyAction{}
+	for key, action := range keymapEntries(node) {
+		entries[key] = action
+	}
+	prefix := strings.Join(keys, "")
+	for key, action := range keymap {
+		if rest, ok := strings.CutPrefix(key, prefix); ok && rest != "" {
+			if _, isAction := action.(string); isAction {
+				entries[rest] = action
+			}
+		}
+	}
+	return entries
 }
 
 func (v *DocumentView) getNumericPrefixOrDefault(defaultValue int) int {
@@ -299,49 +629,208 @@ func (v *DocumentView) getNumericPrefixOrDefault(defaultValue int) int {
 }
 
 func (v *DocumentView) executeAction(action string) bool {
+	// motions extend the selection in visual mode
+	extend := v.editor.GetMode() == state.Visual
+
 	switch action {
 	case "enter_insert_mode":
-		v.editor.SetMode(state.Insert)
+		_ = v.editor.BeginInsert(editor.InsertBefore, v.getNumericPrefixOrDefault(1))
+	case "append":
+		_ = v.editor.BeginInsert(editor.InsertAfter, v.getNumericPrefixOrDefault(1))
+	case "append_to_line_end":
+		_ = v.editor.BeginInsert(editor.InsertLineEnd, v.getNumericPrefixOrDefault(1))
+	case "open_line_below":
+		_ = v.editor.BeginInsert(editor.InsertOpenBelow, v.getNumericPrefixOrDefault(1))
+	case "open_line_above":
+		_ = v.editor.BeginInsert(editor.InsertOpenAbove, v.getNumericPrefixOrDefault(1))
+	case "repeat_last_change":
+		_ = v.editor.RepeatLastChange(v.getNumericPrefixOrDefault(0))
 	case "enter_normal_mode":
 		v.editor.SetMode(state.Normal)
+	case "enter_visual_mode":
+		v.editor.SetMode(state.Visual)
+	case "enter_replace_mode":
+		v.editor.SetMode(state.Replace)
+	case "join_lines":
+		_ = v.editor.JoinLines(v.getNumericPrefixOrDefault(1))
+	case "indent_line":
+		_ = v.editor.IndentLines(v.getNumericPrefixOrDefault(1))
+	case "dedent_line":
+		_ = v.editor.DedentLines(v.getNumericPrefixOrDefault(1))
+	case "add_cursor_below":
+		for range v.getNumericPrefixOrDefault(1) {
+			_ = v.editor.AddCursorBelow()
+		}
+	case "keep_primary_cursor":
+		_ = v.editor.KeepPrimaryCursor()
+	case "reselect_visual":
+		_ = v.editor.ReselectVisual()
+	case "enter_command_mode":
+		v.editor.SetMode(state.Command)
+	case "search_forward", "search_backward":
+		_ = v.editor.StartSearch(action == "search_forward")
+	case "search_next", "search_prev":
+		for range v.getNumericPrefixOrDefault(1) {
+			_ = v.editor.SearchNext(action == "search_prev")
+		}
 	case "move_left":
-		_ = v.editor.MoveCursorHorizontal(-1, false)
+		_ = v.editor.MoveCursorHorizontal(-1, extend)
 	case "move_right":
-		_ = v.editor.MoveCursorHorizontal(1, false)
+		_ = v.editor.MoveCursorHorizontal(1, extend)
 	case "move_down":
 		mult := v.getNumericPrefixOrDefault(1)
-		_ = v.editor.JumpFromCursor(mult, false)
+		_ = v.editor.JumpFromCursor(mult, extend)
 		v.centerCursor()
 	case "move_up":
 		mult := v.getNumericPrefixOrDefault(1)
-		_ = v.editor.JumpFromCursor(-mult, false)
+		_ = v.editor.JumpFromCursor(-mult, extend)
 		v.centerCursor()
-	case "move_next_word":
-		_ = v.editor.MoveToNextWord(false)
+	case "move_visual_down":
+		mult := v.getNumericPrefixOrDefault(1)
+		_ = v.editor.MoveVisualLines(mult, v.viewport.WrapWidth(), extend)
+	case "move_visual_up":
+		mult := v.getNumericPrefixOrDefault(1)
+		_ = v.editor.MoveVisualLines(-mult, v.viewport.WrapWidth(), extend)
+	case "move_to_first_non_blank":
+		_ = v.editor.MoveToFirstNonBlank(extend)
+	case "move_to_line_end":
+		_ = v.editor.MoveToLineEnd(v.getNumericPrefixOrDefault(1), extend)
+	case "move_to_last_non_blank":
+		_ = v.editor.MoveToLastNonBlank(v.getNumericPrefixOrDefault(1), extend)
+	case "match_bracket":
+		_ = v.editor.JumpToMatchingBracket(extend)
 		v.centerCursor()
-	case "move_prev_word":
-		_ = v.editor.MoveToPrevWord(false)
+	case "next_same_indent":
+		for range v.getNumericPrefixOrDefault(1) {
+			_ = v.editor.MoveToSameIndent(true, extend)
+		}
+	case "prev_same_indent":
+		for range v.getNumericPrefixOrDefault(1) {
+			_ = v.editor.MoveToSameIndent(false, extend)
+		}
+	case "move_next_word", "move_next_big_word":
+		_ = v.editor.MoveToNextWord(wordKind(action), extend)
+		v.centerCursor()
+	case "move_prev_word", "move_prev_big_word":
+		_ = v.editor.MoveToPrevWord(wordKind(action), extend)
+		v.centerCursor()
+	case "move_word_end", "move_big_word_end":
+		for range v.getNumericPrefixOrDefault(1) {
+			_ = v.editor.MoveToWordEnd(wordKind(action), extend)
+		}
 		v.centerCursor()
 	case "delete_backwards":
-		_ = v.editor.DeleteText(-1)
+		if indentation, err := v.editor.Indentation(); err == nil && !indentation.UseTabs {
+			_ = v.editor.DeleteSoftTab(v.cfg.Editor.SoftTabStop)
+		} else {
+			_ = v.editor.DeleteText(-1)
+		}
+	case "insert_indent":
+		_ = v.editor.InsertIndent()
 	case "delete_forward":
 		_ = v.editor.DeleteText(1)
 	case "new_line":
-		_ = v.editor.InsertText("\n")
+		_ = v.editor.InsertNewline(v.cfg.Editor.AutoIndentEnabled())
+	case "find_char_forward", "find_char_backward", "till_char_forward", "till_char_backward":
+		v.pendingCount = v.getNumericPrefixOrDefault(1)
+		v.pendingTarget = action
+	case "delete_inside", "delete_around", "select_register", "replace_char", "set_mark", "goto_mark":
+		v.pendingTarget = action
+	case "yank":
+		_ = v.editor.Yank()
+		v.leaveVisual()
+	case "yank_line":
+		_ = v.editor.YankLines(v.getNumericPrefixOrDefault(1))
+	case "delete_line":
+		_ = v.editor.DeleteLines(v.getNumericPrefixOrDefault(1))
+		v.centerCursor()
+	case "paste_after", "paste_before":
+		_ = v.editor.Paste(action == "paste_before", v.getNumericPrefixOrDefault(1))
+	case "repeat_find":
+		_ = v.editor.RepeatFind(false, v.getNumericPrefixOrDefault(1), extend)
+	case "repeat_find_reverse":
+		_ = v.editor.RepeatFind(true, v.getNumericPrefixOrDefault(1), extend)
+	case "insert_literal":
+		v.literal = &literalInput{}
+	case "search_word_forward":
+		_ = v.editor.SearchWordUnderCursor(true)
+	case "search_word_backward":
+		_ = v.editor.SearchWordUnderCursor(false)
+	case "toggle_case":
+		_ = v.editor.ToggleCase()
+		v.leaveVisual()
+	case "lowercase":
+		_ = v.editor.Lowercase()
+		v.leaveVisual()
+	case "uppercase":
+		_ = v.editor.Uppercase()
+		v.leaveVisual()
+	case "toggle_comment":
+		if err := v.editor.ToggleComment(); err != nil {
+			v.editor.SetMessage(err.Error())
+		}
+		v.leaveVisual()
+	case "toggle_block_comment":
+		if err := v.editor.ToggleBlockComment(); err != nil {
+			v.editor.SetMessage(err.Error())
+		}
+		v.leaveVisual()
+	case "next_diagnostic":
+		_ = v.editor.NextDiagnostic(v.getNumericPrefixOrDefault(1))
+	case "prev_diagnostic":
+		_ = v.editor.PrevDiagnostic(v.getNumericPrefixOrDefault(1))
+	case "undo":
+		v.moveInHistory(v.editor.Undo)
+	case "redo":
+		v.moveInHistory(v.editor.Redo)
+	case "undo_tree_left":
+		v.moveInHistory(v.editor.UndoTreeLeft)
+	case "undo_tree_right":
+		v.moveInHistory(v.editor.UndoTreeRight)
+	case "open_entry":
+		if !v.editor.IsDirectoryListing() {
+			break
+		}
+		if err := v.editor.OpenEntryUnderCursor(); err != nil {
+			v.editor.SetMessage(err.Error())
+		}
+	case "half_page_down", "half_page_up":
+		lines := max(1, v.height/2) * v.getNumericPrefixOrDefault(1)
+		if action == "half_page_up" {
+			lines = -lines
+		}
+		v.scrollPage(lines, extend)
+	case "page_down", "page_up":
+		lines := max(1, v.height) * v.getNumericPrefixOrDefault(1)
+		if action == "page_up" {
+			lines = -lines
+		}
+		v.scrollPage(lines, extend)
+	case "scroll_left":
+		v.scroll(0, -v.cfg.Editor.ScrollColumns*v.getNumericPrefixOrDefault(1))
+	case "scroll_right":
+		v.scroll(0, v.cfg.Editor.ScrollColumns*v.getNumericPrefixOrDefault(1))
+	case "clear_search_highlight":
+		v.editor.ClearSearchHighlight()
 	case "show_goto_menu":
-		v.goToMenu.Show()
+		v.whichKey.SetKeys("g", continuations(v.cfg.Keymap.Normal, []string{"g"}))
+		v.whichKey.Show()
 	case "go_to_top":
 		lineNum := v.getNumericPrefixOrDefault(1) - 1
 		if lineNum < 0 {
 			lineNum = 0
 		}
-		_ = v.editor.JumpToLine(lineNum, false)
+		_ = v.editor.JumpToLine(lineNum, extend)
 		v.centerCursor()
-		v.goToMenu.Hide()
 	case "go_to_bottom":
-		_ = v.editor.JumpToBottom(false)
+		_ = v.editor.JumpToBottom(extend)
+		v.centerCursor()
+	case "jump_back":
+		_ = v.editor.JumpBack(v.getNumericPrefixOrDefault(1))
+		v.centerCursor()
+	case "jump_forward":
+		_ = v.editor.JumpForward(v.getNumericPrefixOrDefault(1))
 		v.centerCursor()
-		v.goToMenu.Hide()
 	default:
 		return false
 	}
@@ -349,6 +838,132 @@ func (v *DocumentView) executeAction(action string) bool {
 	return true
 }
 
+// leaveVisual returns to normal mode after an operation on a visual selection.
+func (v *DocumentView) leaveVisual() {
+	if v.editor.GetMode() == state.Visual {
+		v.editor.SetMode(state.Normal)
+	}
+}
+
+// literalInput tracks a <c-v> sequence: a single key, or u/U followed by hex digits.
+type literalInput struct {
+	maxDigits int // 4 after u, 8 after U, 0 before either
+	digits    []rune
+}
+
+// handleLiteral consumes a key for a pending insert-literal sequence.
+// It returns false when the key ends a codepoint sequence and should be processed normally.
+func (v *DocumentView) handleLiteral(ev *tcell.EventKey) bool {
+	lit := v.literal
+
+	if lit.maxDigits == 0 {
+		v.literal = nil
+		switch {
+		case ev.Key() == tcell.KeyRune && ev.Rune() == 'u':
+			v.literal = &literalInput{maxDigits: 4}
+		case ev.Key() == tcell.KeyRune && ev.Rune() == 'U':
+			v.literal = &literalInput{maxDigits: 8}
+		case ev.Key() == tcell.KeyRune:
+			_ = v.editor.InsertText(string(ev.Rune()))
+		case ev.Key() < tcell.KeyRune:
+			// control keys (tab, escape, ...) map directly to their character
+			_ = v.editor.InsertText(string(rune(ev.Key())))
+		}
+		return true
+	}
+
+	if ev.Key() == tcell.KeyRune && isHexDigit(ev.Rune()) {
+		lit.digits = append(lit.digits, ev.Rune())
+		if len(lit.digits) == lit.maxDigits {
+			v.insertCodepoint()
+		}
+		return true
+	}
+
+	// any other key ends the sequence early
+	v.insertCodepoint()
+	return false
+}
+
+// insertCodepoint inserts the character for the hex digits typed after <c-v>u.
+func (v *DocumentView) insertCodepoint() {
+	digits := v.literal.digits
+	v.literal = nil
+	if len(digits) == 0 {
+		return
+	}
+	if code, err := strconv.ParseUint(string(digits), 16, 32); err == nil && utf8.ValidRune(rune(code)) {
+		_ = v.editor.InsertText(string(rune(code)))
+	}
+}
+
+func isHexDigit(r rune) bool {
+	return unicode.Is(unicode.ASCII_Hex_Digit, r)
+}
+
+// wordKind returns the kind of word a word motion action moves over.
+func wordKind(action string) buffer.WordKind {
+	if strings.Contains(action, "big_word") {
+		return buffer.BigWord
+	}
+	return buffer.SmallWord
+}
+
+// completeTarget runs a pending action now that its target character is known.
+func (v *DocumentView) completeTarget(action, ch string) {
+	switch action {
+	case "delete_inside", "delete_around":
+		_ = v.editor.DeletePair(ch, action == "delete_inside")
+	case "select_register":
+		v.editor.SelectRegister([]rune(ch)[0])
+	case "replace_char":
+		_ = v.editor.ReplaceChar(ch)
+	case "set_mark":
+		_ = v.editor.SetMark([]rune(ch)[0])
+	case "goto_mark":
+		if err := v.editor.GotoMark([]rune(ch)[0]); err != nil {
+			v.editor.SetMessage(err.Error())
+		}
+		v.centerCursor()
+	default:
+		v.findChar(action, ch)
+	}
+}
+
+// findChar runs a find-char action once its target character is known.
+func (v *DocumentView) findChar(action, ch string) {
+	forward := action == "find_char_forward" || action == "till_char_forward"
+	till := action == "till_char_forward" || action == "till_char_backward"
+	_ = v.editor.FindChar(ch, forward, till, v.pendingCount, v.editor.GetMode() == state.Visual)
+}
+
+// matchingBracket returns the line and column of the bracket matching the cursor,
+// recomputing it only when the cursor has moved.
+func (v *DocumentView) matchingBracket() (int, int, bool) {
+	selection, err := v.editor.Selection()
+	if err != nil {
+		return 0, 0, false
+	}
+
+	if selection.End != v.bracketCursor {
+		v.bracketCursor = selection.End
+		v.bracketMatch = -1
+		adjacent := v.cfg.Editor.MatchBrackets == config.MatchBracketsAlways
+		if match, ok := v.editor.MatchingBracket(adjacent); ok {
+			v.bracketMatch = match
+		}
+	}
+
+	if v.bracketMatch < 0 {
+		return 0, 0, false
+	}
+	line, col, err := v.editor.LineCol(v.bracketMatch)
+	if err != nil {
+		return 0, 0, false
+	}
+	return line, col, true
+}
+
 func (v *DocumentView) centerCursor() {
 	// Get current cursor position
 	if line, _, err := v.editor.GetCurrentPosition(); err == nil {
@@ -366,11 +981,40 @@ func (v *DocumentView) getCursorShape(mode state.EditorMode) config.CursorShape
 	switch mode {
 	case state.Insert:
 		return v.cfg.Editor.CursorShape.Insert
+	case state.Visual:
+		return v.cfg.Editor.CursorShape.Visual
+	case state.Replace:
+		return v.cfg.Editor.CursorShape.Replace
 	default:
 		return v.cfg.Editor.CursorShape.Normal
 	}
 }
 
+// cursorCellStyle returns the style of the cell under the cursor. With cursor-blink
+// the terminal draws the cursor, so the cell keeps its own style.
+func (v *DocumentView) cursorCellStyle(style tcell.Style, mode state.EditorMode, shape config.CursorShape) tcell.Style {
+	switch {
+	case v.cfg.Editor.CursorBlink:
+		return style
+	case mode == state.Normal || mode == state.Visual || mode == state.Replace:
+		return v.getCursorStyle(shape)
+	default:
+		return style.Reverse(true)
+	}
+}
+
+// blinkingCursorStyle maps a cursor shape to the terminal's blinking cursor.
+func blinkingCursorStyle(shape config.CursorShape) tcell.CursorStyle {
+	switch shape {
+	case config.CursorBlock:
+		return tcell.CursorStyleBlinkingBlock
+	case config.CursorUnder:
+		return tcell.CursorStyleBlinkingUnderline
+	default:
+		return tcell.CursorStyleBlinkingBar
+	}
+}
+
 func (v *DocumentView) getCursorStyle(shape config.CursorShape) tcell.Style {
 	style := tcell.StyleDefault
 	switch shape {
@@ -385,81 +1029,201 @@ func (v *DocumentView) getCursorStyle(shape config.CursorShape) tcell.Style {
 	}
 }
 
+// getKeyString returns the keymap token for a key event, e.g. "x", "<esc>", "<a-k>" or
+// "<c-s-left>". Modifiers come in the order c-, a-, s-.
 func getKeyString(ev *tcell.EventKey) string {
-	if ev.Modifiers()&tcell.ModCtrl != 0 && ev.Key() == tcell.KeyRune {
-		return fmt.Sprintf("<c-%c>", ev.Rune())
-	}
-
-	switch ev.Key() {
-	case tcell.KeyEscape:
-		return "<esc>"
-	case tcell.KeyEnter:
-		return "<cr>"
-	case tcell.KeyBackspace, tcell.KeyBackspace2:
-		return "<bs>"
-	case tcell.KeyDelete:
-		return "<del>"
-	case tcell.KeyTab:
-		return "<tab>"
-	case tcell.KeyLeft:
-		return "<left>"
-	case tcell.KeyRight:
-		return "<right>"
-	case tcell.KeyUp:
-		return "<up>"
-	case tcell.KeyDown:
-		return "<down>"
+	mods := ev.Modifiers()
+	var name string
+	switch key := ev.Key(); key {
 	case tcell.KeyRune:
-		return string(ev.Rune())
+		// shift is already part of the rune, e.g. K
+		mods &^= tcell.ModShift
+		name = string(ev.Rune())
+		if mods&(tcell.ModCtrl|tcell.ModAlt) == 0 {
+			return name
+		}
+	case tcell.KeyBacktab:
+		mods |= tcell.ModShift
+		name = "tab"
 	default:
+		if named, ok := keyNames[key]; ok {
+			name = named
+			break
+		}
+		// Control characters arrive as their own keys rather than runes
+		if key >= tcell.KeyCtrlA && key <= tcell.KeyCtrlZ {
+			mods |= tcell.ModCtrl
+			name = string('a' + rune(key-tcell.KeyCtrlA))
+			break
+		}
 		return ev.Name()
 	}
+	return "<" + modifierPrefix(mods) + name + ">"
+}
+
+// keyNames maps the keys with names in key tokens to those names.
+var keyNames = map[tcell.Key]string{
+	tcell.KeyEscape:     "esc",
+	tcell.KeyEnter:      "cr",
+	tcell.KeyBackspace:  "bs",
+	tcell.KeyBackspace2: "bs",
+	tcell.KeyDelete:     "del",
+	tcell.KeyTab:        "tab",
+	tcell.KeyLeft:       "left",
+	tcell.KeyRight:      "right",
+	tcell.KeyUp:         "up",
+	tcell.KeyDown:       "down",
+	tcell.KeyHome:       "home",
+	tcell.KeyEnd:        "end",
+	tcell.KeyPgUp:       "pageup",
+	tcell.KeyPgDn:       "pagedown",
+}
+
+// modifierPrefix returns the modifiers of a key token in their canonical order,
+// e.g. "c-a-" for Ctrl+Alt.
+func modifierPrefix(mods tcell.ModMask) string {
+	var prefix strings.Builder
+	if mods&tcell.ModCtrl != 0 {
+		prefix.WriteString("c-")
+	}
+	if mods&tcell.ModAlt != 0 {
+		prefix.WriteString("a-")
+	}
+	if mods&tcell.ModShift != 0 {
+		prefix.WriteString("s-")
+	}
+	return prefix.String()
+}
+
+// inRange reports whether a line and column fall within [start, end).
+func inRange(pos, start, end [2]int) bool {
+	afterStart := pos[0] > start[0] || pos[0] == start[0] && pos[1] >= start[1]
+	beforeEnd := pos[0] < end[0] || pos[0] == end[0] && pos[1] < end[1]
+	return afterStart && beforeEnd
+}
+
+// findAll returns the start column of every non-overlapping occurrence of pattern in line.
+// With wholeWord, occurrences that are part of a longer word are skipped.
+func findAll(line, pattern []rune, wholeWord bool) []int {
+	if len(pattern) == 0 {
+		return nil
+	}
+
+	var cols []int
+	for i := 0; i+len(pattern) <= len(line); i++ {
+		match := true
+		for j, r := range pattern {
+			if line[i+j] != r {
+				match = false
+				break
+			}
+		}
+		if match && wholeWord {
+			end := i + len(pattern)
+			match = (i == 0 || !isWordRune(line[i-1])) && (end == len(line) || !isWordRune(line[end]))
+		}
+		if match {
+			cols = append(cols, i)
+			i += len(pattern) - 1
+		}
+	}
+	return cols
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
 }
 
 func isDigit(key string) bool {
 	return len(key) == 1 && unicode.IsDigit(rune(key[0]))
 }
 
-// GoToMenu represents the menu overlay for goto commands
-type GoToMenu struct {
+// WhichKeyMenu is the overlay listing the keys that can follow a pending key
+// prefix, and the actions they're bound to.
+type WhichKeyMenu struct {
 	visible bool
 	x, y    int // Position of the menu
 	width   int // Width of the menu
 	options []string
+
+	delay   time.Duration    // how long a prefix is pending before the menu shows
+	pending time.Time        // when the pending prefix was typed, zero when none is
+	timer   *time.Timer      // wakes the event loop once the delay elapses
+	wake    func()           // redraws the screen from the timer, nil to not redraw
+	now     func() time.Time // clock, replaced in tests
 }
 
-func NewGoToMenu(cfg *config.Config) *GoToMenu {
-	options := []string{"[g] → goto commands"}
-	if gotoMappings, ok := cfg.Keymap.Normal["g"].(map[string]interface{}); ok {
-		for key, action := range gotoMappings {
-			if key != "default" {
-				option := fmt.Sprintf("  g%s → %s", key, action)
-				options = append(options, option)
-			}
+func NewWhichKeyMenu(cfg *config.Config) *WhichKeyMenu {
+	return &WhichKeyMenu{
+		width: 25,
+		delay: time.Duration(cfg.Editor.WhichKeyDelay) * time.Millisecond,
+		now:   time.Now,
+	}
+}
+
+// SetKeys lists the keys of keymap, the bindings that can follow prefix, sorted by
+// key. Keys leading to a further nested keymap are listed as +prefix.
+func (m *WhichKeyMenu) SetKeys(prefix string, keymap map[string]config.KeyAction) {
+	keys := make([]string, 0, len(keymap))
+	for key := range keymap {
+		if key != "default" {
+			keys = append(keys, key)
 		}
 	}
-	return &GoToMenu{
-		options: options,
-		width:   25,
+	sort.Strings(keys)
+
+	m.options = []string{"[" + prefix + "]"}
+	m.width = 25
+	for _, key := range keys {
+		action, ok := keymap[key].(string)
+		if !ok {
+			action = "+prefix"
+		}
+		option := fmt.Sprintf("  %s%s → %s", prefix, key, action)
+		m.options = append(m.options, option)
+		m.width = max(m.width, len([]rune(option)))
 	}
 }
 
 // Show makes the menu visible
-func (m *GoToMenu) Show() {
+func (m *WhichKeyMenu) Show() {
 	m.visible = true
 }
 
-// Hide makes the menu invisible
-func (m *GoToMenu) Hide() {
+// Schedule shows the menu once the which-key delay elapses, restarting the delay
+// when called again before; without a delay the menu shows right away.
+func (m *WhichKeyMenu) Schedule() {
+	if m.delay <= 0 {
+		m.Show()
+		return
+	}
+	m.pending = m.now()
+	if m.timer != nil {
+		m.timer.Stop()
+	}
+	if m.wake != nil {
+		m.timer = time.AfterFunc(m.delay, m.wake)
+	}
+}
+
+// Hide makes the menu invisible, cancelling a scheduled show
+func (m *WhichKeyMenu) Hide() {
 	m.visible = false
+	m.pending = time.Time{}
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
 }
 
-func (m *GoToMenu) Visible() bool {
-	return m.visible
+// Visible reports whether the menu is shown, either directly or because a scheduled
+// show's delay has elapsed.
+func (m *WhichKeyMenu) Visible() bool {
+	return m.visible || !m.pending.IsZero() && m.now().Sub(m.pending) >= m.delay
 }
 
-func (m *GoToMenu) Draw(screen tcell.Screen, viewHeight int) {
-	if !m.visible {
+func (m *WhichKeyMenu) Draw(screen tcell.Screen, viewHeight int) {
+	if !m.Visible() {
 		return
 	}
 
@@ -0,0 +1,729 @@
+package ui
+
+import (
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/lg2m/athena/internal/athena/config"
+	"github.com/lg2m/athena/internal/editor"
+	"github.com/lg2m/athena/internal/editor/state"
+	"github.com/lg2m/athena/internal/editor/treesitter"
+	"github.com/lg2m/athena/internal/util"
+)
+
+// newTestDocumentView creates a document view over a writable scratch buffer using the default config.
+func newTestDocumentView(t *testing.T, content string) (*DocumentView, *editor.Editor) {
+	t.Helper()
+	missing := filepath.Join(t.TempDir(), "config.toml")
+	cfg, errs := config.LoadConfig(&missing)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected config errors: %v", errs)
+	}
+
+	e := editor.NewEditor()
+	e.NewScratchBuffer("*test*", content).SetReadOnly(false)
+
+	v := NewDocumentView(e, cfg, NewViewport(cfg.Editor.ScrollPadding))
+	v.Resize(0, 0, 80, 24)
+	return v, e
+}
+
+// typeKeys feeds key events to the view; runes are typed as-is.
+func typeKeys(v *DocumentView, keys ...interface{}) {
+	for _, k := range keys {
+		switch k := k.(type) {
+		case tcell.Key:
+			v.HandleEvent(tcell.NewEventKey(k, 0, tcell.ModNone))
+		case string:
+			for _, r := range k {
+				v.HandleEvent(tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone))
+			}
+		}
+	}
+}
+
+func bufferText(t *testing.T, e *editor.Editor) string {
+	t.Helper()
+	line, err := e.GetLine(0)
+	if err != nil {
+		t.Fatalf("GetLine failed: %v", err)
+	}
+	return line
+}
+
+func TestLineStyles(t *testing.T) {
+	keyword := tcell.StyleDefault.Foreground(tcell.ColorRed)
+	str := tcell.StyleDefault.Foreground(tcell.ColorGreen)
+	runes := []rune(`let é = "ü" ok`)
+
+	// columns count bytes, so the highlights after é and ü start later than their runes
+	styles := lineStyles(1, runes, []treesitter.Highlight{
+		{Start: treesitter.Position{Row: 1, Column: 0}, End: treesitter.Position{Row: 1, Column: 3}, Style: keyword},
+		{Start: treesitter.Position{Row: 1, Column: 9}, End: treesitter.Position{Row: 1, Column: 13}, Style: str},
+		{Start: treesitter.Position{Row: 0, Column: 4}, End: treesitter.Position{Row: 1, Column: 0}, Style: str},
+	}, nil, false)
+
+	for i, r := range runes {
+		want := tcell.StyleDefault
+		switch {
+		case i < 3:
+			want = keyword
+		case i >= 8 && i < 11:
+			want = str
+		}
+		if styles[i] != want {
+			t.Errorf("rune %d (%q): expected style %v, got %v", i, r, want, styles[i])
+		}
+	}
+}
+
+func TestInsertLiteral(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []interface{}
+		expected string
+	}{
+		{"literal tab", []interface{}{tcell.KeyCtrlV, tcell.KeyTab}, "\t"},
+		{"literal escape stays in insert mode", []interface{}{tcell.KeyCtrlV, tcell.KeyEscape, "x"}, "\x1bx"},
+		{"codepoint", []interface{}{tcell.KeyCtrlV, "u00e9"}, "é"},
+		{"short codepoint ended by another key", []interface{}{tcell.KeyCtrlV, "ue9", " "}, "é "},
+		{"long codepoint", []interface{}{tcell.KeyCtrlV, "U0001F44B"}, "👋"},
+		{"bound key inserted literally", []interface{}{tcell.KeyCtrlV, tcell.KeyCtrlV}, "\x16"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, e := newTestDocumentView(t, "")
+			e.SetMode(state.Insert)
+			typeKeys(v, tt.keys...)
+
+			if got := bufferText(t, e); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if e.GetMode() != state.Insert {
+				t.Errorf("expected to remain in insert mode")
+			}
+		})
+	}
+}
+
+func TestGetKeyString(t *testing.T) {
+	tests := []struct {
+		name     string
+		ev       *tcell.EventKey
+		expected string
+	}{
+		{"rune", tcell.NewEventKey(tcell.KeyRune, 'x', tcell.ModNone), "x"},
+		{"shifted rune", tcell.NewEventKey(tcell.KeyRune, 'K', tcell.ModShift), "K"},
+		{"ctrl rune", tcell.NewEventKey(tcell.KeyCtrlL, 0, tcell.ModCtrl), "<c-l>"},
+		{"alt rune", tcell.NewEventKey(tcell.KeyRune, 'k', tcell.ModAlt), "<a-k>"},
+		{"alt shifted rune", tcell.NewEventKey(tcell.KeyRune, 'K', tcell.ModAlt|tcell.ModShift), "<a-K>"},
+		{"ctrl alt rune", tcell.NewEventKey(tcell.KeyCtrlX, 0, tcell.ModCtrl|tcell.ModAlt), "<c-a-x>"},
+		{"named key", tcell.NewEventKey(tcell.KeyEscape, 0, tcell.ModNone), "<esc>"},
+		{"ctrl arrow", tcell.NewEventKey(tcell.KeyLeft, 0, tcell.ModCtrl), "<c-left>"},
+		{"shift arrow", tcell.NewEventKey(tcell.KeyRight, 0, tcell.ModShift), "<s-right>"},
+		{"ctrl shift arrow", tcell.NewEventKey(tcell.KeyUp, 0, tcell.ModCtrl|tcell.ModShift), "<c-s-up>"},
+		{"alt enter", tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModAlt), "<a-cr>"},
+		{"shift tab", tcell.NewEventKey(tcell.KeyBacktab, 0, tcell.ModNone), "<s-tab>"},
+		{"ctrl home", tcell.NewEventKey(tcell.KeyHome, 0, tcell.ModCtrl), "<c-home>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getKeyString(tt.ev); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestMatchKeySequence(t *testing.T) {
+	// nested keymaps as TOML decodes them, next to the defaults' map[string]string
+	keymap := config.KeyMap{
+		"x": "delete_char",
+		"g": map[string]interface{}{
+			"g": "go_to_top",
+			"c": map[string]interface{}{
+				"c": "toggle_comment",
+				"<c-b>": map[string]interface{}{
+					"b": "toggle_block_comment",
+				},
+			},
+		},
+		"d":  map[string]string{"d": "delete_line"},
+		"zc": "close_fold",
+		"z": map[string]interface{}{
+			"c": map[string]interface{}{"c": "close_all_folds"},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		keys    []string
+		action  string
+		partial bool
+		matched bool
+	}{
+		{"single key", []string{"x"}, "delete_char", true, true},
+		{"unbound key", []string{"q"}, "", false, false},
+		{"prefix", []string{"g"}, "", true, false},
+		{"two keys", []string{"g", "g"}, "go_to_top", true, true},
+		{"two keys in the defaults", []string{"d", "d"}, "delete_line", true, true},
+		{"unbound second key", []string{"d", "x"}, "", false, false},
+		{"two-key prefix", []string{"g", "c"}, "", true, false},
+		{"three keys", []string{"g", "c", "c"}, "toggle_comment", true, true},
+		{"named key in a sequence", []string{"g", "c", "<c-b>", "b"}, "toggle_block_comment", true, true},
+		{"keys past an action", []string{"g", "g", "g"}, "", false, false},
+		{"bound as a whole and as a prefix", []string{"z", "c"}, "close_fold", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &DocumentView{keyBuffer: tt.keys}
+			action, partial, matched := v.matchKeySequence(keymap)
+			if action != tt.action || partial != tt.partial || matched != tt.matched {
+				t.Errorf("expected (%q, %v, %v), got (%q, %v, %v)", tt.action, tt.partial, tt.matched, action, partial, matched)
+			}
+		})
+	}
+}
+
+func TestThreeKeySequence(t *testing.T) {
+	v, e := newTestDocumentView(t, "one\ntwo")
+	v.cfg.Keymap.Normal["g"] = map[string]interface{}{
+		"c": map[string]interface{}{"j": "move_down"},
+	}
+
+	typeKeys(v, "gc")
+	if line, _, _ := e.GetCurrentPosition(); line != 0 {
+		t.Fatalf("expected the sequence to be pending, got the cursor on line %d", line)
+	}
+	typeKeys(v, "j")
+	if line, _, _ := e.GetCurrentPosition(); line != 1 {
+		t.Errorf("expected gcj to move down, got the cursor on line %d", line)
+	}
+
+	// <esc> cancels the sequence, so the next key starts a new one
+	typeKeys(v, "gc", tcell.KeyEscape, "k")
+	if line, _, _ := e.GetCurrentPosition(); line != 0 {
+		t.Errorf("expected k to move up after <esc>, got the cursor on line %d", line)
+	}
+}
+
+func TestWhichKeyDelay(t *testing.T) {
+	v, _ := newTestDocumentView(t, "text")
+	now := time.Now()
+	v.whichKey.now = func() time.Time { return now }
+	v.whichKey.delay = 500 * time.Millisecond
+
+	typeKeys(v, "g")
+	if v.whichKey.Visible() {
+		t.Fatalf("expected the menu to wait for the delay")
+	}
+	now = now.Add(499 * time.Millisecond)
+	if v.whichKey.Visible() {
+		t.Fatalf("expected the menu to stay hidden before the delay")
+	}
+	now = now.Add(time.Millisecond)
+	if !v.whichKey.Visible() {
+		t.Fatalf("expected the menu once the delay elapsed")
+	}
+
+	// completing the sequence hides it
+	typeKeys(v, "g")
+	if v.whichKey.Visible() {
+		t.Errorf("expected the menu to hide after gg")
+	}
+
+	// a sequence finished before the delay never shows it
+	typeKeys(v, "g")
+	now = now.Add(100 * time.Millisecond)
+	typeKeys(v, "g")
+	now = now.Add(time.Second)
+	if v.whichKey.Visible() {
+		t.Errorf("expected no menu for a sequence typed quickly")
+	}
+
+	// <esc> cancels a pending prefix
+	typeKeys(v, "g", tcell.KeyEscape)
+	now = now.Add(time.Second)
+	if v.whichKey.Visible() {
+		t.Errorf("expected <esc> to cancel the menu")
+	}
+
+	// without a delay the menu shows right away
+	v.whichKey.delay = 0
+	typeKeys(v, "g")
+	if !v.whichKey.Visible() {
+		t.Errorf("expected the menu right away without a delay")
+	}
+}
+
+func TestWhichKeyMenu(t *testing.T) {
+	v, _ := newTestDocumentView(t, "one\ntwo")
+	v.whichKey.delay = 0
+	v.cfg.Keymap.Normal["\\"] = map[string]interface{}{
+		"f": "move_down",
+		"x": map[string]interface{}{"y": "move_up"},
+	}
+	v.cfg.Keymap.Normal["\\w"] = "move_next_word"
+
+	tests := []struct {
+		keys     string
+		expected []string
+	}{
+		{"\\", []string{"[\\]", "  \\f → move_down", "  \\w → move_next_word", "  \\x → +prefix"}},
+		{"x", []string{"[\\x]", "  \\xy → move_up"}},
+	}
+	for _, tt := range tests {
+		typeKeys(v, tt.keys)
+		if !v.whichKey.Visible() {
+			t.Fatalf("expected the menu after %q", tt.keys)
+		}
+		if !reflect.DeepEqual(v.whichKey.options, tt.expected) {
+			t.Errorf("after %q expected %q, got %q", tt.keys, tt.expected, v.whichKey.options)
+		}
+	}
+
+	typeKeys(v, "y")
+	if v.whichKey.Visible() {
+		t.Errorf("expected the menu to hide once the sequence matched")
+	}
+}
+
+func TestEOFMarker(t *testing.T) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("failed to init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(10, 5)
+
+	v, _ := newTestDocumentView(t, "a\nb")
+	v.cfg.Editor.EOFMarker.Document = "─"
+	v.Resize(0, 0, 10, 5)
+	v.Draw(screen)
+
+	for x := 0; x < 10; x++ {
+		if ch, _, _, _ := screen.GetContent(x, 2); ch != '─' {
+			t.Fatalf("expected marker at %d on the first row past the end, got %q", x, ch)
+		}
+	}
+	if ch, _, _, _ := screen.GetContent(0, 3); ch == '─' {
+		t.Errorf("expected marker only on the first row past the end")
+	}
+}
+
+func TestDrawTabs(t *testing.T) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("failed to init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(10, 5)
+
+	v, e := newTestDocumentView(t, "\tx\nab\tc")
+	v.cfg.Editor.Mouse = true
+	v.cfg.Editor.CursorBlink = true
+	v.Resize(0, 0, 10, 5)
+	v.Draw(screen)
+
+	for y, want := range []string{"    x", "ab  c"} {
+		for x, r := range want {
+			if ch, _, _, _ := screen.GetContent(x, y); ch != r {
+				t.Errorf("row %d col %d: expected %q, got %q", y, x, r, ch)
+			}
+		}
+	}
+
+	// clicking inside a tab puts the cursor on it, and past it on the next rune
+	for _, tt := range []struct{ x, col int }{{2, 0}, {4, 1}} {
+		v.HandleEvent(tcell.NewEventMouse(tt.x, 0, tcell.Button1, tcell.ModNone))
+		v.HandleEvent(tcell.NewEventMouse(tt.x, 0, tcell.ButtonNone, tcell.ModNone))
+		if _, col, _ := e.GetCurrentPosition(); col != tt.col {
+			t.Errorf("click at %d: expected column %d, got %d", tt.x, tt.col, col)
+		}
+	}
+
+	v.Draw(screen)
+	if x, y, visible := screen.GetCursor(); !visible || x != 4 || y != 0 {
+		t.Errorf("expected the cursor drawn at (4, 0), got (%d, %d)", x, y)
+	}
+}
+
+func TestDrawWideCharacters(t *testing.T) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("failed to init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(10, 5)
+
+	v, e := newTestDocumentView(t, "中\tx\ne\u0301z")
+	v.cfg.Editor.CursorBlink = true
+	v.Resize(0, 0, 10, 5)
+	_ = e.MoveCursorHorizontal(2, false)
+	v.Draw(screen)
+
+	// the wide character takes two columns, so the tab stops two short of a full tab
+	for _, tt := range []struct {
+		x, y  int
+		ch    rune
+		combc []rune
+	}{
+		{0, 0, '中', nil},
+		{4, 0, 'x', nil},
+		{0, 1, 'e', []rune{'\u0301'}},
+		{1, 1, 'z', nil},
+	} {
+		if ch, combc, _, _ := screen.GetContent(tt.x, tt.y); ch != tt.ch || !slices.Equal(combc, tt.combc) {
+			t.Errorf("(%d, %d): expected %q%q, got %q%q", tt.x, tt.y, tt.ch, tt.combc, ch, combc)
+		}
+	}
+
+	// the status bar's virtual column is where the cursor is drawn
+	col, err := e.VirtualColumn()
+	if err != nil {
+		t.Fatalf("VirtualColumn failed: %v", err)
+	}
+	if x, _, visible := screen.GetCursor(); !visible || x != col {
+		t.Errorf("expected the cursor drawn at column %d, got %d", col, x)
+	}
+}
+
+func TestDrawSecondaryCursors(t *testing.T) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("failed to init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(10, 5)
+
+	v, e := newTestDocumentView(t, "ab\nc\nde")
+	v.Resize(0, 0, 10, 5)
+	if err := e.MoveCursorHorizontal(1, false); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := e.AddCursorBelow(); err != nil {
+			t.Fatalf("AddCursorBelow failed: %v", err)
+		}
+	}
+	v.Draw(screen)
+
+	reversed := func(x, y int) bool {
+		_, _, style, _ := screen.GetContent(x, y)
+		_, _, attrs := style.Decompose()
+		return attrs&tcell.AttrReverse != 0
+	}
+	// the cursor past the end of the short line is drawn as well
+	for _, cell := range [][2]int{{1, 0}, {1, 1}} {
+		if !reversed(cell[0], cell[1]) {
+			t.Errorf("expected a cursor drawn at %v", cell)
+		}
+	}
+	if reversed(0, 0) {
+		t.Error("expected no cursor at (0, 0)")
+	}
+}
+
+func TestVisualSelectionDrawn(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []interface{}
+		cursor   [2]int   // the cursor's cell, drawn in the cursor style instead
+		selected [][2]int // cells drawn with the selection background
+	}{
+		{"forward on one line", []interface{}{"vll"}, [2]int{2, 0}, [][2]int{{0, 0}, {1, 0}}},
+		{"backward", []interface{}{"$vhh"}, [2]int{1, 0}, [][2]int{{2, 0}}},
+		{"across lines", []interface{}{"lvj"}, [2]int{1, 1}, [][2]int{{1, 0}, {2, 0}, {3, 0}, {0, 1}}},
+		{"collapsed on escape", []interface{}{"vll", tcell.KeyEscape}, [2]int{2, 0}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			screen := tcell.NewSimulationScreen("")
+			if err := screen.Init(); err != nil {
+				t.Fatalf("failed to init screen: %v", err)
+			}
+			defer screen.Fini()
+			screen.SetSize(10, 5)
+
+			v, _ := newTestDocumentView(t, "abcd\nefgh")
+			v.Resize(0, 0, 10, 5)
+			typeKeys(v, tt.keys...)
+			v.Draw(screen)
+
+			want := make(map[[2]int]bool)
+			for _, cell := range tt.selected {
+				want[cell] = true
+			}
+			for y := 0; y < 2; y++ {
+				for x := 0; x < 4; x++ {
+					if [2]int{x, y} == tt.cursor {
+						continue
+					}
+					_, _, style, _ := screen.GetContent(x, y)
+					_, bg, _ := style.Decompose()
+					if got := bg == treesitter.ColorBgSelection; got != want[[2]int{x, y}] {
+						t.Errorf("cell %d,%d: expected selected %v, got %v", x, y, want[[2]int{x, y}], got)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCursorBlink(t *testing.T) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("failed to init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(10, 5)
+
+	v, e := newTestDocumentView(t, "abc")
+	_ = e.MoveCursorHorizontal(1, false)
+
+	v.Draw(screen)
+	if _, _, visible := screen.GetCursor(); visible {
+		t.Errorf("expected the terminal cursor to be hidden without cursor-blink")
+	}
+	if _, _, style, _ := screen.GetContent(1, 0); style != v.getCursorStyle(v.cfg.Editor.CursorShape.Normal) {
+		t.Errorf("expected the cursor cell to use the normal cursor style")
+	}
+
+	v.cfg.Editor.CursorBlink = true
+	v.Draw(screen)
+	if x, y, visible := screen.GetCursor(); !visible || x != 1 || y != 0 {
+		t.Errorf("expected the terminal cursor at 1,0, got %d,%d (visible %v)", x, y, visible)
+	}
+	if _, _, style, _ := screen.GetContent(1, 0); style != tcell.StyleDefault {
+		t.Errorf("expected the cursor cell to keep its own style with cursor-blink")
+	}
+}
+
+func TestGuiClipboard(t *testing.T) {
+	v, e := newTestDocumentView(t, "hello world")
+	v.cfg.Editor.Mouse = true
+	v.cfg.Editor.GuiClipboard = true
+	clipboard := &util.MemoryClipboard{}
+	e.SetClipboard(clipboard)
+
+	// drag across "hello"
+	v.HandleEvent(tcell.NewEventMouse(0, 0, tcell.Button1, tcell.ModNone))
+	v.HandleEvent(tcell.NewEventMouse(5, 0, tcell.Button1, tcell.ModNone))
+	v.HandleEvent(tcell.NewEventMouse(5, 0, tcell.ButtonNone, tcell.ModNone))
+	if !v.HasMouseSelection() {
+		t.Fatalf("expected a mouse selection after dragging")
+	}
+
+	typeKeys(v, tcell.KeyCtrlC)
+	if got, _ := clipboard.Read(); got != "hello" {
+		t.Errorf("expected %q to be copied, got %q", "hello", got)
+	}
+
+	// paste at the end of the line
+	v.HandleEvent(tcell.NewEventMouse(11, 0, tcell.Button1, tcell.ModNone))
+	v.HandleEvent(tcell.NewEventMouse(11, 0, tcell.ButtonNone, tcell.ModNone))
+	typeKeys(v, tcell.KeyCtrlV)
+	if got := bufferText(t, e); got != "hello worldhello" {
+		t.Errorf("expected %q, got %q", "hello worldhello", got)
+	}
+
+	// without the option <c-c> is left alone
+	v.cfg.Editor.GuiClipboard = false
+	_ = clipboard.Write("")
+	v.HandleEvent(tcell.NewEventMouse(0, 0, tcell.Button1, tcell.ModNone))
+	v.HandleEvent(tcell.NewEventMouse(5, 0, tcell.Button1, tcell.ModNone))
+	typeKeys(v, tcell.KeyCtrlC)
+	if got, _ := clipboard.Read(); got != "" {
+		t.Errorf("expected nothing copied with gui-clipboard off, got %q", got)
+	}
+}
+
+func TestResizeKeepsCursorVisible(t *testing.T) {
+	v, e := newTestDocumentView(t, strings.Repeat("line\n", 99)+"line")
+	if err := e.JumpToLine(60, false); err != nil {
+		t.Fatalf("JumpToLine failed: %v", err)
+	}
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("failed to init screen: %v", err)
+	}
+	defer screen.Fini()
+
+	tests := []struct {
+		height int
+	}{
+		{height: 24},
+		{height: 10},
+		{height: 3},
+		{height: 1},
+		{height: 60},
+		{height: 200},
+	}
+
+	for _, tt := range tests {
+		v.Resize(0, 0, 80, tt.height)
+		v.Draw(screen)
+
+		line, _, _ := e.GetCurrentPosition()
+		start, end := v.viewport.VisibleRange(tt.height, 100)
+		if line < start || line >= end {
+			t.Errorf("height %d: expected cursor line %d within [%d, %d)", tt.height, line, start, end)
+		}
+		if rows := end - start; rows < min(tt.height, 100) && start > 0 {
+			t.Errorf("height %d: expected no blank rows past the end, got %d rows from %d", tt.height, rows, start)
+		}
+	}
+}
+
+func TestMouseWheelScroll(t *testing.T) {
+	v, e := newTestDocumentView(t, strings.Repeat("line\n", 49)+strings.Repeat("x", 100))
+	v.cfg.Editor.Mouse = true
+	v.cfg.Editor.ScrollLines = 4
+	v.cfg.Editor.ScrollColumns = 30
+	v.Resize(0, 0, 80, 20)
+
+	wheel := func(button tcell.ButtonMask) {
+		t.Helper()
+		if !v.HandleEvent(tcell.NewEventMouse(10, 10, button, tcell.ModNone)) {
+			t.Fatalf("expected the wheel event to be handled")
+		}
+	}
+
+	tests := []struct {
+		button  tcell.ButtonMask
+		offset  int
+		leftCol int
+	}{
+		{tcell.WheelDown, 4, 0},
+		{tcell.WheelDown, 8, 0},
+		{tcell.WheelUp, 4, 0},
+		{tcell.WheelUp, 0, 0},
+		{tcell.WheelUp, 0, 0}, // clamped at the top
+	}
+	for i, tt := range tests {
+		wheel(tt.button)
+		if v.viewport.offset != tt.offset {
+			t.Errorf("step %d: expected offset %d, got %d", i, tt.offset, v.viewport.offset)
+		}
+	}
+
+	// clamped once the last line is at the bottom
+	for range 20 {
+		wheel(tcell.WheelDown)
+	}
+	if v.viewport.offset != 30 {
+		t.Errorf("expected offset clamped at 30, got %d", v.viewport.offset)
+	}
+
+	// the cursor is dragged along and drawing doesn't scroll back to it
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("failed to init screen: %v", err)
+	}
+	defer screen.Fini()
+	v.Draw(screen)
+	if line, _, _ := e.GetCurrentPosition(); line < 30 || v.viewport.offset != 30 {
+		t.Errorf("expected the cursor below line 30 with offset 30, got line %d offset %d", line, v.viewport.offset)
+	}
+
+	// horizontal scrolling stops once the longest line's end is at the right edge
+	wheel(tcell.WheelRight)
+	if got := v.viewport.LeftCol(); got != 21 {
+		t.Errorf("expected left column 21, got %d", got)
+	}
+	wheel(tcell.WheelLeft)
+	if got := v.viewport.LeftCol(); got != 0 {
+		t.Errorf("expected left column 0, got %d", got)
+	}
+
+	v.cfg.Editor.Mouse = false
+	if v.HandleEvent(tcell.NewEventMouse(10, 10, tcell.WheelDown, tcell.ModNone)) {
+		t.Errorf("expected wheel events to be ignored without the mouse option")
+	}
+}
+
+func TestPageScroll(t *testing.T) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("failed to init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(80, 10)
+
+	v, e := newTestDocumentView(t, strings.Repeat("line\n", 49)+"last")
+	v.Resize(0, 0, 80, 10)
+	_ = e.JumpToLine(5, false)
+	v.Draw(screen)
+
+	tests := []struct {
+		key    tcell.Key
+		offset int
+		line   int
+	}{
+		{tcell.KeyCtrlD, 5, 10},
+		{tcell.KeyCtrlD, 10, 15},
+		{tcell.KeyCtrlF, 20, 25},
+		{tcell.KeyCtrlU, 15, 20},
+		{tcell.KeyCtrlB, 5, 10},
+		{tcell.KeyPgUp, 0, 0},  // the view stops at the top, the cursor goes on
+		{tcell.KeyPgDn, 6, 10}, // the padding keeps the cursor off the top row
+	}
+	for i, tt := range tests {
+		typeKeys(v, tt.key)
+		v.Draw(screen)
+		line, _, _ := e.GetCurrentPosition()
+		if v.viewport.offset != tt.offset || line != tt.line {
+			t.Errorf("step %d: expected offset %d and line %d, got %d and %d", i, tt.offset, tt.line, v.viewport.offset, line)
+		}
+	}
+
+	// paging past the end stops at the last line
+	typeKeys(v, tcell.KeyCtrlF, tcell.KeyCtrlF, tcell.KeyCtrlF, tcell.KeyCtrlF, tcell.KeyCtrlF)
+	if line, _, _ := e.GetCurrentPosition(); line != 49 {
+		t.Errorf("expected the cursor on the last line, got %d", line)
+	}
+}
+
+func TestOpenLineScrollsIntoView(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []interface{}
+	}{
+		{"below the last line", []interface{}{"ge", "oX"}},
+		{"above the first visible line", []interface{}{"ge", "kkkkk", "OX"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			screen := tcell.NewSimulationScreen("")
+			if err := screen.Init(); err != nil {
+				t.Fatalf("failed to init screen: %v", err)
+			}
+			defer screen.Fini()
+			screen.SetSize(10, 3)
+
+			v, _ := newTestDocumentView(t, "1\n2\n3\n4\n5\n6")
+			v.Resize(0, 0, 10, 3)
+			for _, keys := range tt.keys {
+				typeKeys(v, keys)
+				v.Draw(screen)
+			}
+
+			for y := 0; y < 3; y++ {
+				if ch, _, _, _ := screen.GetContent(0, y); ch == 'X' {
+					return
+				}
+			}
+			t.Error("expected the opened line to be scrolled into view")
+		})
+	}
+}
@@ -2,10 +2,14 @@ package ui
 
 import (
 	"fmt"
+	"slices"
+	"strconv"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/lg2m/athena/internal/athena/config"
 	"github.com/lg2m/athena/internal/editor"
+	"github.com/lg2m/athena/internal/editor/buffer"
+	"github.com/lg2m/athena/internal/editor/state"
 )
 
 // GuttersView represents the line numbers view.
@@ -20,31 +24,128 @@ func NewGuttersView(e *editor.Editor, cfg *config.Config, v *Viewport) *GuttersV
 	return &GuttersView{editor: e, cfg: cfg, viewport: v}
 }
 
+// Width returns the columns the gutter needs: the diff markers when configured,
+// a leading spacer, the line numbers and a trailing column for fold markers.
+func (v *GuttersView) Width() int {
+	width := 2
+	if v.showNumbers() {
+		total, _ := v.editor.GetLineCount()
+		width += v.numberWidth(total)
+	}
+	if v.showDiff() {
+		width++
+	}
+	return width
+}
+
+// showDiff reports whether the diff column is one of the configured gutters.
+func (v *GuttersView) showDiff() bool {
+	return slices.Contains(v.cfg.Editor.Gutters, config.GutterDiff)
+}
+
+// lineChanges returns how each changed line differs from the file on disk, empty
+// when the diff column is off or the buffer has no file.
+func (v *GuttersView) lineChanges() map[int]buffer.ChangeKind {
+	if !v.showDiff() {
+		return nil
+	}
+	changes, err := v.editor.LineChanges()
+	if err != nil {
+		return nil
+	}
+	kinds := make(map[int]buffer.ChangeKind, len(changes))
+	for _, change := range changes {
+		kinds[change.Line] = change.Kind
+	}
+	return kinds
+}
+
+// diffMarkers are the marker and color drawn for each kind of changed line.
+var diffMarkers = map[buffer.ChangeKind]struct {
+	marker rune
+	color  tcell.Color
+}{
+	buffer.LineAdded:    {'+', tcell.ColorGreen},
+	buffer.LineModified: {'~', tcell.ColorYellow},
+	buffer.LineDeleted:  {'-', tcell.ColorRed},
+}
+
+// showNumbers reports whether line numbers are shown, which :set nonumber turns off
+// for a single buffer.
+func (v *GuttersView) showNumbers() bool {
+	return bufferOption(v.editor, buffer.OptionNumber, true)
+}
+
+// numberWidth returns the columns line numbers take, enough for the largest one.
+func (v *GuttersView) numberWidth(total int) int {
+	return max(v.cfg.Editor.NumberWidth, len(strconv.Itoa(total)))
+}
+
+// alignNumber pads s to the number width on the configured side.
+func (v *GuttersView) alignNumber(s string, width int) string {
+	if v.cfg.Editor.NumberAlign == config.LineNumberAlignLeft {
+		return fmt.Sprintf(" %-*s", width, s)
+	}
+	return fmt.Sprintf(" %*s", width, s)
+}
+
+// lineNumberMode resolves hybrid numbering to relative numbers in normal mode
+// and absolute numbers in every other mode.
+func (v *GuttersView) lineNumberMode() config.LineNumberOption {
+	if v.cfg.Editor.LineNumber != config.LineNumberHybrid {
+		return v.cfg.Editor.LineNumber
+	}
+	if v.editor.GetMode() == state.Normal {
+		return config.LineNumberRelative
+	}
+	return config.LineNumberAbsolute
+}
+
 // Draw implements the gutter view.
 func (v *GuttersView) Draw(screen tcell.Screen) {
 	currLine, _, _ := v.editor.GetCurrentPosition()
 	total, _ := v.editor.GetLineCount()
 
 	start, _ := v.viewport.VisibleRange(v.height, total)
+	rows := screenRows(v.editor, start, v.height, total, v.viewport.WrapWidth())
 
 	style := tcell.StyleDefault.Foreground(tcell.ColorPurple)
 	currStyle := tcell.StyleDefault.Foreground(tcell.ColorWhite)
+	eofStyle := tcell.StyleDefault.Foreground(tcell.GetColor(v.cfg.Editor.EOFMarker.Color))
+	width := v.numberWidth(total)
+	lineNumber := v.lineNumberMode()
+	numbers := v.showNumbers()
+	changes := v.lineChanges()
+
+	// the diff markers take the first column, ahead of the line numbers
+	left := 0
+	if v.showDiff() {
+		left = 1
+	}
 
 	for i := 0; i < v.height; i++ {
-		lineNum := start + i + 1
+		lineNum := total + 1
+		if i < len(rows) {
+			// continuation rows of a wrapped line are left blank
+			if rows[i].startCol > 0 {
+				continue
+			}
+			lineNum = rows[i].line + 1
+		}
 		y := i
 
 		var numStr string
 		lineStyle := style
 
 		if lineNum > total {
-			// Draw '~' for lines beyond the end of the file (EOF).
-			numStr = fmt.Sprintf("%*s", v.width-1, "~")
+			// Draw the EOF marker for lines beyond the end of the file.
+			numStr = v.alignNumber(v.cfg.Editor.EOFMarker.Gutter, width)
+			lineStyle = eofStyle
 		} else {
-			switch v.cfg.Editor.LineNumber {
+			switch lineNumber {
 			case config.LineNumberAbsolute:
 				// Absolute numbering: display the actual line number.
-				numStr = fmt.Sprintf("%*d", v.width-1, lineNum)
+				numStr = v.alignNumber(strconv.Itoa(lineNum), width)
 				if lineNum == currLine+1 {
 					// Highlight the current line number.
 					lineStyle = currStyle
@@ -52,7 +153,7 @@ func (v *GuttersView) Draw(screen tcell.Screen) {
 			case config.LineNumberRelative:
 				if lineNum == currLine+1 {
 					// Current line: display absolute number with a distinct style.
-					numStr = fmt.Sprintf("%*d", v.width-1, lineNum)
+					numStr = v.alignNumber(strconv.Itoa(lineNum), width)
 					lineStyle = currStyle
 				} else {
 					// Relative numbering: display the distance from the current line.
@@ -60,16 +161,58 @@ func (v *GuttersView) Draw(screen tcell.Screen) {
 					if distance < 0 {
 						distance = -distance
 					}
-					numStr = fmt.Sprintf("%*d", v.width-1, distance)
+					numStr = v.alignNumber(strconv.Itoa(distance), width)
 				}
 			default:
 				numStr = ""
 			}
 		}
 
+		// :set nonumber leaves only the fold column
+		if !numbers {
+			numStr = ""
+		}
+
+		if kind, changed := changes[lineNum-1]; changed {
+			diff := diffMarkers[kind]
+			screen.SetContent(v.x, v.y+y, diff.marker, nil, tcell.StyleDefault.Foreground(diff.color))
+		}
+
 		// Render the line number string on the screen.
 		for x, ch := range numStr {
-			screen.SetContent(v.x+x, v.y+y, ch, nil, lineStyle)
+			screen.SetContent(v.x+left+x, v.y+y, ch, nil, lineStyle)
+		}
+
+		// Mark closed folds in the trailing column
+		if _, folded := v.editor.FoldAt(lineNum - 1); folded && lineNum <= total {
+			screen.SetContent(v.x+v.width-1, v.y+y, '▸', nil, currStyle)
 		}
 	}
 }
+
+// HandleEvent toggles the fold starting at a clicked gutter row.
+func (v *GuttersView) HandleEvent(ev tcell.Event) bool {
+	mouseEv, ok := ev.(*tcell.EventMouse)
+	if !ok || mouseEv.Buttons()&tcell.Button1 == 0 {
+		return false
+	}
+
+	x, y := mouseEv.Position()
+	if x < v.x || x >= v.x+v.width || y < v.y || y >= v.y+v.height {
+		return false
+	}
+
+	total, err := v.editor.GetLineCount()
+	if err != nil {
+		return false
+	}
+	start, _ := v.viewport.VisibleRange(v.height, total)
+	rows := screenRows(v.editor, start, v.height, total, v.viewport.WrapWidth())
+
+	row := y - v.y
+	if row >= len(rows) {
+		return false
+	}
+	_ = v.editor.ToggleFold(rows[row].line)
+	return true
+}
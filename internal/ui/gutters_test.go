@@ -0,0 +1,254 @@
+package ui
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/lg2m/athena/internal/athena/config"
+	"github.com/lg2m/athena/internal/editor/state"
+)
+
+// gutterRow returns the text drawn on a row of the screen.
+func gutterRow(screen tcell.Screen, y, width int) string {
+	row := make([]rune, width)
+	for x := range row {
+		row[x], _, _, _ = screen.GetContent(x, y)
+	}
+	return string(row)
+}
+
+func TestGutterNumberAlignment(t *testing.T) {
+	tests := []struct {
+		name     string
+		align    config.LineNumberAlignOption
+		minWidth int
+		content  string
+		expected []string
+	}{
+		{
+			name:     "right aligned",
+			align:    config.LineNumberAlignRight,
+			minWidth: 3,
+			content:  "a\nb",
+			expected: []string{"   1 ", "   2 ", "   ~ "},
+		},
+		{
+			name:     "left aligned wider than the digits",
+			align:    config.LineNumberAlignLeft,
+			minWidth: 5,
+			content:  "a\nb",
+			expected: []string{" 1     ", " 2     ", " ~     "},
+		},
+		{
+			name:     "digits wider than the minimum",
+			align:    config.LineNumberAlignLeft,
+			minWidth: 1,
+			content:  "a\nb\nc\nd\ne\nf\ng\nh\ni\nj",
+			expected: []string{" 1  ", " 2  "},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			screen := tcell.NewSimulationScreen("")
+			if err := screen.Init(); err != nil {
+				t.Fatalf("failed to init screen: %v", err)
+			}
+			defer screen.Fini()
+			screen.SetSize(20, 3)
+
+			v, e := newTestDocumentView(t, tt.content)
+			v.cfg.Editor.LineNumber = config.LineNumberAbsolute
+			v.cfg.Editor.NumberAlign = tt.align
+			v.cfg.Editor.NumberWidth = tt.minWidth
+
+			g := NewGuttersView(e, v.cfg, v.viewport)
+			width := g.Width()
+			if width != len(tt.expected[0]) {
+				t.Fatalf("expected width %d, got %d", len(tt.expected[0]), width)
+			}
+			g.Resize(0, 0, width, 3)
+			g.Draw(screen)
+
+			for y, want := range tt.expected {
+				if got := gutterRow(screen, y, width); got != want {
+					t.Errorf("row %d: expected %q, got %q", y, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestGutterHybridNumbers(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     state.EditorMode
+		expected []string
+	}{
+		{"relative in normal mode", state.Normal, []string{"    1 ", "    2 ", "    1 "}},
+		{"absolute in insert mode", state.Insert, []string{"    1 ", "    2 ", "    3 "}},
+		{"absolute in command mode", state.Command, []string{"    1 ", "    2 ", "    3 "}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			screen := tcell.NewSimulationScreen("")
+			if err := screen.Init(); err != nil {
+				t.Fatalf("failed to init screen: %v", err)
+			}
+			defer screen.Fini()
+			screen.SetSize(20, 3)
+
+			v, e := newTestDocumentView(t, "a\nb\nc")
+			v.cfg.Editor.LineNumber = config.LineNumberHybrid
+			if err := e.JumpToLine(1, false); err != nil {
+				t.Fatalf("JumpToLine failed: %v", err)
+			}
+			e.SetMode(tt.mode)
+
+			g := NewGuttersView(e, v.cfg, v.viewport)
+			g.Resize(0, 0, g.Width(), 3)
+			g.Draw(screen)
+
+			for y, want := range tt.expected {
+				if got := gutterRow(screen, y, g.Width()); got != want {
+					t.Errorf("row %d: expected %q, got %q", y, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestGutterDiff(t *testing.T) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("failed to init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(20, 5)
+
+	path := filepath.Join(t.TempDir(), "diff.txt")
+	if err := os.WriteFile(path, []byte("a\nb\nc\nd\ne"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	v, e := newTestDocumentView(t, "")
+	diffed := make(chan struct{}, 1)
+	e.SetRedraw(func() {
+		select {
+		case diffed <- struct{}{}:
+		default:
+		}
+	})
+	if err := e.OpenFile(path); err != nil {
+		t.Fatalf("OpenFile failed: %v", err)
+	}
+	v.cfg.Editor.LineNumber = config.LineNumberAbsolute
+	v.cfg.Editor.NumberWidth = 1
+	v.cfg.Editor.Gutters = []config.GutterOption{config.GutterDiff, config.GutterLineNumbers}
+
+	g := NewGuttersView(e, v.cfg, v.viewport)
+	draw := func() []string {
+		screen.Clear()
+		g.Resize(0, 0, g.Width(), 5)
+		g.Draw(screen)
+		rows := make([]string, 5)
+		for y := range rows {
+			rows[y] = gutterRow(screen, y, g.Width())
+		}
+		return rows
+	}
+
+	// an unchanged file leaves the diff column blank
+	if got, want := draw(), []string{"  1 ", "  2 ", "  3 ", "  4 ", "  5 "}; !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// change b, delete d and add a line after e
+	typeKeys(v, "jxiB", tcell.KeyEscape, "jjddox", tcell.KeyEscape)
+	// the diff runs once the edits settle
+	select {
+	case <-diffed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the diff")
+	}
+	if got, want := draw(), []string{"  1 ", "~ 2 ", "  3 ", "- 4 ", "+ 5 "}; !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	if err := e.SaveCurrentBuffer(); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if got, want := draw(), []string{"  1 ", "  2 ", "  3 ", "  4 ", "  5 "}; !slices.Equal(got, want) {
+		t.Errorf("expected a blank column after saving, got %q", got)
+	}
+}
+
+func TestGutterClickFold(t *testing.T) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("failed to init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(20, 6)
+
+	v, e := newTestDocumentView(t, "a {\n\tb\n\tc\n}\nd")
+	v.cfg.Editor.LineNumber = config.LineNumberAbsolute
+	v.cfg.Editor.NumberWidth = 1
+	v.cfg.Editor.Gutters = []config.GutterOption{config.GutterLineNumbers}
+
+	g := NewGuttersView(e, v.cfg, v.viewport)
+	g.Resize(0, 0, g.Width(), 6)
+	draw := func() []string {
+		screen.Clear()
+		g.Draw(screen)
+		rows := make([]string, 3)
+		for y := range rows {
+			rows[y] = gutterRow(screen, y, g.Width())
+		}
+		return rows
+	}
+	click := func(x, y int) bool {
+		return g.HandleEvent(tcell.NewEventMouse(x, y, tcell.Button1, tcell.ModNone))
+	}
+
+	// clicking the first line of a block folds it, hiding the lines after it
+	if !click(0, 0) {
+		t.Fatalf("expected the click to be handled")
+	}
+	if end, ok := e.FoldAt(0); !ok || end != 2 {
+		t.Errorf("expected fold 0..2, got %d (%v)", end, ok)
+	}
+	if got, want := draw(), []string{" 1▸", " 4 ", " 5 "}; !slices.Equal(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// the rows below a fold map to the lines after it
+	if !click(0, 1) {
+		t.Fatalf("expected the click to be handled")
+	}
+	if _, ok := e.FoldAt(3); ok {
+		t.Errorf("expected no fold at the block's closing line")
+	}
+
+	// clicking the fold again opens it
+	click(0, 0)
+	if _, ok := e.FoldAt(0); ok {
+		t.Errorf("expected fold at 0 to be open")
+	}
+
+	// clicks outside the gutter or past the last line are left to other views
+	if click(g.Width(), 0) {
+		t.Errorf("expected a click right of the gutter not to be handled")
+	}
+	if click(0, 5) {
+		t.Errorf("expected a click past the last line not to be handled")
+	}
+	if moves := tcell.NewEventMouse(0, 0, tcell.ButtonNone, tcell.ModNone); g.HandleEvent(moves) {
+		t.Errorf("expected mouse motion not to be handled")
+	}
+}
@@ -0,0 +1,145 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/lg2m/athena/internal/athena/config"
+	"github.com/lg2m/athena/internal/editor"
+)
+
+// Headless drives the editor with key tokens the same way the UI does,
+// but without a screen. It is meant for scripting and integration tests.
+type Headless struct {
+	editor      *editor.Editor
+	document    *DocumentView
+	commandLine *CommandLineView
+}
+
+// NewHeadless creates a headless driver for e using the keymap and options from cfg.
+func NewHeadless(e *editor.Editor, cfg *config.Config) *Headless {
+	h := &Headless{
+		editor:      e,
+		document:    NewDocumentView(e, cfg, NewViewport(cfg.Editor.ScrollPadding)),
+		commandLine: NewCommandLineView(e),
+	}
+	h.Resize(80, 24)
+	return h
+}
+
+// Resize sets the size of the virtual screen, which affects scrolling and soft-wrap.
+func (h *Headless) Resize(width, height int) {
+	h.document.Resize(0, 0, width, height-1)
+	h.commandLine.Resize(0, height-1, width, 1)
+}
+
+// Editor returns the driven editor.
+func (h *Headless) Editor() *editor.Editor {
+	return h.editor
+}
+
+// Feed sends keys to the view handling the current mode. Keys use the same
+// tokens as the keymap, e.g. "iHello<esc>" or "<c-l>"; a '<' that doesn't
+// start a known token is typed literally.
+func (h *Headless) Feed(keys string) {
+	for _, ev := range ParseKeys(keys) {
+		if h.commandLine.Open() {
+			h.commandLine.HandleEvent(ev)
+			continue
+		}
+		h.document.HandleEvent(ev)
+	}
+}
+
+// Text returns the content of the current buffer.
+func (h *Headless) Text() string {
+	text, _ := h.editor.Text()
+	return text
+}
+
+// Cursor returns the cursor's line and column.
+func (h *Headless) Cursor() (int, int) {
+	selection, _ := h.editor.Selection()
+	line, col, _ := h.editor.LineCol(selection.End)
+	return line, col
+}
+
+// namedKeys maps key names to the keys getKeyString names them for.
+var namedKeys = map[string]tcell.Key{
+	"esc":      tcell.KeyEscape,
+	"cr":       tcell.KeyEnter,
+	"bs":       tcell.KeyBackspace2,
+	"del":      tcell.KeyDelete,
+	"tab":      tcell.KeyTab,
+	"left":     tcell.KeyLeft,
+	"right":    tcell.KeyRight,
+	"up":       tcell.KeyUp,
+	"down":     tcell.KeyDown,
+	"home":     tcell.KeyHome,
+	"end":      tcell.KeyEnd,
+	"pageup":   tcell.KeyPgUp,
+	"pagedown": tcell.KeyPgDn,
+}
+
+// modifierKeys maps the modifier prefixes of key tokens to their masks.
+var modifierKeys = map[string]tcell.ModMask{
+	"c-": tcell.ModCtrl,
+	"a-": tcell.ModAlt,
+	"s-": tcell.ModShift,
+}
+
+// ParseKeys converts a string of key tokens into key events; it is the inverse of getKeyString.
+func ParseKeys(keys string) []*tcell.EventKey {
+	var events []*tcell.EventKey
+	for len(keys) > 0 {
+		if keys[0] == '<' {
+			// the token ends at the first '>', unless that '>' is the key itself as in <a->>
+			if end := strings.IndexByte(keys[1:], '>') + 1; end > 1 {
+				if end+1 < len(keys) && keys[end+1] == '>' && keys[end-1] == '-' {
+					end++
+				}
+				if ev := parseKeyToken(keys[1:end]); ev != nil {
+					events = append(events, ev)
+					keys = keys[end+1:]
+					continue
+				}
+			}
+		}
+
+		r := []rune(keys)[0]
+		events = append(events, tcell.NewEventKey(tcell.KeyRune, r, tcell.ModNone))
+		keys = keys[len(string(r)):]
+	}
+	return events
+}
+
+// parseKeyToken converts the inside of a key token such as "c-a-x" or "s-tab" into a
+// key event, or returns nil when it isn't a token getKeyString produces.
+func parseKeyToken(token string) *tcell.EventKey {
+	mods := tcell.ModNone
+	for len(token) > 2 {
+		mod, ok := modifierKeys[strings.ToLower(token[:2])]
+		if !ok {
+			break
+		}
+		mods |= mod
+		token = token[2:]
+	}
+
+	if key, ok := namedKeys[strings.ToLower(token)]; ok {
+		if key == tcell.KeyTab && mods&tcell.ModShift != 0 {
+			return tcell.NewEventKey(tcell.KeyBacktab, 0, mods)
+		}
+		return tcell.NewEventKey(key, 0, mods)
+	}
+
+	r := []rune(token)
+	if len(r) != 1 || mods&(tcell.ModCtrl|tcell.ModAlt) == 0 {
+		return nil
+	}
+	if mods&tcell.ModCtrl != 0 && r[0] >= 'a' && r[0] <= 'z' {
+		// terminals send Ctrl+letter as a control character
+		return tcell.NewEventKey(tcell.KeyCtrlA+tcell.Key(r[0]-'a'), 0, mods)
+	}
+	return tcell.NewEventKey(tcell.KeyRune, r[0], mods)
+}
@@ -0,0 +1,240 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lg2m/athena/internal/athena/config"
+	"github.com/lg2m/athena/internal/editor"
+	"github.com/lg2m/athena/internal/editor/buffer"
+	"github.com/lg2m/athena/internal/editor/state"
+)
+
+// newTestHeadless creates a headless driver over a writable scratch buffer using the default config.
+func newTestHeadless(t *testing.T, content string) *Headless {
+	t.Helper()
+	v, e := newTestDocumentView(t, content)
+	return NewHeadless(e, v.cfg)
+}
+
+func TestHeadlessFeed(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		keys     string
+		expected string
+		line     int
+		col      int
+	}{
+		{"insert text", "", "iHello<esc>", "Hello", 0, 5},
+		{"insert after moving left", "", "iHello<esc>hhix<esc>", "Helxlo", 0, 4},
+		{"backspace", "", "iab<bs>c<esc>", "ac", 0, 2},
+		{"new line", "", "ifoo<cr>bar<esc>", "foo\nbar", 1, 3},
+		{"word motion", "one two", "wix<esc>", "onex two", 0, 4},
+		{"counted motion", "a\nb\nc\nd", "2jiX<esc>", "a\nb\nXc\nd", 2, 1},
+		{"find char", "a,b,c", "2f,i-<esc>", "a,b-,c", 0, 4},
+		{"literal angle bracket", "", "i<>x<esc>", "<>x", 0, 3},
+		{"command mode returns to normal", "", ":noh<cr>ix<esc>", "x", 0, 1},
+		{"delete inside nested parens", "f(a, g(b), c)", "llllllldi(", "f(a, g(), c)", 0, 7},
+		{"delete around quotes", `say "hi" now`, "lllllda\"", "say  now", 0, 4},
+		{"delete inside tag", "<b>bold</b>", "llllldit", "<b></b>", 0, 3},
+		{"counted insert", "", "3ihi<esc>", "hihihi", 0, 6},
+		{"counted insert after backspace", "", "3iab<bs><esc>", "aaa", 0, 3},
+		{"counted append", "x\ny", "3A!<esc>", "x!!!\ny", 0, 4},
+		{"counted open below", "x", "3oab<esc>", "x\nab\nab\nab", 3, 2},
+		{"open above", "x", "Oa<esc>", "a\nx", 0, 1},
+		{"append after cursor", "xy", "a-<esc>", "x-y", 0, 2},
+		{"repeat insert", "", "ihi<esc>.", "hihi", 0, 4},
+		{"repeat with a count", "x", "A-<esc>3.", "x----", 0, 5},
+		{"repeat keeps the count", "x", "2oa<esc>.", "x\na\na\na\na", 4, 1},
+		{"undo insert session", "", "ihello<esc>u", "", 0, 0},
+		{"undo counted open below", "x", "3oab<esc>u", "x", 0, 0},
+		{"counted undo", "", "ia<esc>ab<esc>2u", "", 0, 0},
+		{"redo", "", "ihi<esc>uU", "hi", 0, 0},
+		{"switch undo branch", "", "ia<esc>uib<esc>g-", "a", 0, 0},
+		{"switch back to newer branch", "", "ia<esc>uib<esc>g-g+", "b", 0, 0},
+		{"first non-blank", "  foo", "$^ix<esc>", "  xfoo", 0, 3},
+		{"line end", "foo  ", "$ax<esc>", "foo  x", 0, 6},
+		{"counted line end", "a\nbc\nd", "2$ax<esc>", "a\nbcx\nd", 1, 3},
+		{"last non-blank", " foo  \n", "g_ax<esc>", " foox  \n", 0, 5},
+		{"same indentation", "a\n  b\nc", "]pix<esc>", "a\n  b\nxc", 2, 1},
+		{"big word end", "x = foo.bar() y", "wwEax<esc>", "x = foo.bar()x y", 0, 14},
+		{"word end with a count", "one two three", "2eax<esc>", "one twox three", 0, 8},
+		{"matching bracket", "f(a, (b)) c", "l%ax<esc>", "f(a, (b))x c", 0, 10},
+		{"yank and paste", "abc", "vly$p", "abca", 0, 3},
+		{"auto-indent", "\tif x {", "A<cr>y<esc>", "\tif x {\n\ty", 1, 2},
+		{"delete and paste a line", "a\nb\nc", "ddp", "b\na\nc", 1, 0},
+		{"replace a character", "abc", "lrX", "aXc", 0, 1},
+		{"replace on an empty line", "\nb", "rX", "\nb", 0, 0},
+		{"replace mode", "abcd", "lRxy<esc>", "axyd", 0, 3},
+		{"replace mode past the line end", "ab\nc", "lRxyz<esc>", "axyz\nc", 0, 4},
+		{"replace mode undone at once", "abcd", "Rxyz<esc>u", "abcd", 0, 0},
+		{"cursors below type on every line", "ab\ncd\nef", "lCCiX<esc>", "aXb\ncXd\neXf", 2, 2},
+		{"backspace at every cursor", "ab\ncd", "lCi<bs><esc>", "b\nd", 1, 0},
+		{"cursors move down together", "ab\ncd\nef", "lCjiX<esc>", "ab\ncXd\neXf", 2, 2},
+		{"escape keeps the primary cursor", "ab\ncd", "C<esc>iX<esc>", "ab\nXcd", 1, 1},
+		{"typing with cursors undone at once", "ab\ncd", "CiXY<esc>u", "ab\ncd", 1, 0},
+		{"repeat an insert", "ab", "ihello<esc>.", "hellohelloab", 0, 10},
+		{"repeat a line delete", "1\n2\n3\n4", "dd.", "3\n4", 0, 0},
+		{"repeat a line delete with a count", "1\n2\n3\n4\n5", "dd2.", "4\n5", 0, 0},
+		{"counted paste", "ab", "vly3p", "abaaa", 0, 4},
+		{"repeat a counted paste", "ab", "vly2p.", "abaaaa", 0, 5},
+		{"counted paste undone at once", "ab", "vly3pu", "ab", 0, 1},
+		{"repeat a replaced character", "abc", "rxl.", "xxc", 0, 1},
+		{"motions aren't repeated", "abc\nabc", "rxj.", "xbc\nxbc", 1, 0},
+		{"repeat undone at once", "ab", "ihi<esc>.u", "hiab", 0, 2},
+		{"toggle case under the cursor", "abc", "~", "Abc", 0, 0},
+		{"toggle case of a selection", "abc def", "vll~", "ABc def", 0, 2},
+		{"uppercase a selection", "éte", "vllgU", "ÉTe", 0, 2},
+		{"lowercase a selection", "ABC", "vlgu", "aBC", 0, 1},
+		{"repeat a case toggle", "abc", "~l.", "ABc", 0, 1},
+		{"indent a line", "foo\nbar", ">>", "\tfoo\nbar", 0, 1},
+		{"indent lines with a count", "a\nb\nc", "2>>", "\ta\n\tb\nc", 0, 1},
+		{"dedent a line", "\t\tfoo", "<<", "\tfoo", 0, 0},
+		{"undo an indent with a count", "a\nb", "2>>u", "a\nb", 0, 0},
+		{"repeat an indent", "foo", ">>.", "\t\tfoo", 0, 2},
+		{"join lines", "foo\n    bar\nbaz", "J", "foo bar\nbaz", 0, 3},
+		{"join lines with a count", "a\nb\nc\nd", "3J", "a b c\nd", 0, 3},
+		{"join on the last line", "a\nb", "jJ", "a\nb", 1, 0},
+		{"repeat a join", "a\nb\nc", "J.", "a b c", 0, 3},
+		{"jump to a mark", "one\ntwo\nthree", "jlmagg`a", "one\ntwo\nthree", 1, 1},
+		{"mark shifts with an edit before it", "one\ntwo", "jlmaggiXY<esc>`a", "oXYne\ntwo", 1, 1},
+		{"unset mark stays put", "one\ntwo", "l`b", "one\ntwo", 0, 1},
+		{"jump back from a mark", "one\ntwo\nthree", "jjlmagg`a<c-o>", "one\ntwo\nthree", 0, 1},
+		{"yank lines with a count", "a\nb\nc", "2yygep", "a\nb\nc\na\nb", 3, 0},
+		{"delete lines with a count", "a\nb\nc", "j5dd", "a", 0, 0},
+		{"yank into a named register", "ab", "\"avly\"aP", "aab", 0, 1},
+		{"search", "ab cd ab", "/ab<cr>ix<esc>", "ab cd xab", 0, 7},
+		{"search then next", "ab cd ab cd", "/cd<cr>nix<esc>", "ab cd ab xcd", 0, 10},
+		{"search backward", "ab cd ab", "$?b<cr>Nix<esc>", "ab cd axb", 0, 8},
+		{"cancelled search", "ab cd", "/cd<esc>ix<esc>", "xab cd", 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHeadless(t, tt.content)
+			h.Feed(tt.keys)
+
+			if got := h.Text(); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+			if line, col := h.Cursor(); line != tt.line || col != tt.col {
+				t.Errorf("expected cursor %d:%d, got %d:%d", tt.line, tt.col, line, col)
+			}
+			if mode := h.Editor().GetMode(); mode != state.Normal {
+				t.Errorf("expected normal mode, got %v", mode)
+			}
+		})
+	}
+}
+
+func TestHeadlessReselectVisual(t *testing.T) {
+	h := newTestHeadless(t, "one two three")
+	h.Feed("wvll<esc>")
+	if mode := h.Editor().GetMode(); mode != state.Normal {
+		t.Fatalf("expected normal mode after <esc>, got %v", mode)
+	}
+
+	h.Feed("gggv")
+	selection, err := h.Editor().Selection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selection != (state.Selection{Start: 3, End: 5}) {
+		t.Errorf("expected gv to restore 3-5, got %+v", selection)
+	}
+	if mode := h.Editor().GetMode(); mode != state.Visual {
+		t.Errorf("expected visual mode, got %v", mode)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		keys     string
+		expected []string
+	}{
+		{"iHi<esc>", []string{"i", "H", "i", "<esc>"}},
+		{"<c-l><CR>", []string{"<c-l>", "<cr>"}},
+		{"<bs><del><tab>", []string{"<bs>", "<del>", "<tab>"}},
+		{"a<b>", []string{"a", "<", "b", ">"}},
+		{"é<", []string{"é", "<"}},
+		{"<a-k><A-J>", []string{"<a-k>", "<a-J>"}},
+		{"<c-a-x><c-left>", []string{"<c-a-x>", "<c-left>"}},
+		{"<s-tab><c-s-up>", []string{"<s-tab>", "<c-s-up>"}},
+		{"<a-->x<a->>", []string{"<a-->", "x", "<a->>"}},
+		{"<s-x>", []string{"<", "s", "-", "x", ">"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.keys, func(t *testing.T) {
+			var got []string
+			for _, ev := range ParseKeys(tt.keys) {
+				got = append(got, getKeyString(ev))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func ExampleHeadless() {
+	missing := filepath.Join(os.TempDir(), "athena-example", "config.toml")
+	cfg, _ := config.LoadConfig(&missing)
+
+	e := editor.NewEditor()
+	e.NewScratchBuffer("*example*", "").SetReadOnly(false)
+
+	h := NewHeadless(e, cfg)
+	h.Feed("iworld<esc>hhhhhiHello, <esc>")
+
+	line, col := h.Cursor()
+	fmt.Printf("%q %d:%d\n", h.Text(), line, col)
+	// Output: "Hello, world" 0:7
+}
+
+func TestSetBufferOptions(t *testing.T) {
+	h := newTestHeadless(t, strings.Repeat("x", 200))
+	e := h.Editor()
+	first, _ := e.FileName()
+	e.NewScratchBuffer("*other*", "other").SetReadOnly(false)
+
+	tests := []struct {
+		name       string
+		keys       string
+		option     string
+		value, set bool
+		message    string
+	}{
+		{"turn on", ":set wrap<cr>", buffer.OptionWrap, true, true, ""},
+		{"turn off", ":set nonumber<cr>", buffer.OptionNumber, false, true, ""},
+		{"several at once", ":set cursorline nowrap<cr>", buffer.OptionWrap, false, true, ""},
+		{"unknown option", ":set bogus<cr>", "bogus", false, false, "Unknown option: bogus"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e.SetMessage("")
+			h.Feed(tt.keys)
+			if value, set := e.BufferOption(tt.option); value != tt.value || set != tt.set {
+				t.Errorf("expected %s=%v (set %v), got %v (set %v)", tt.option, tt.value, tt.set, value, set)
+			}
+			if got := e.Message(); got != tt.message {
+				t.Errorf("expected message %q, got %q", tt.message, got)
+			}
+		})
+	}
+
+	// the overrides stay with the buffer they were set in
+	if err := e.SwitchBuffer(first); err != nil {
+		t.Fatalf("SwitchBuffer failed: %v", err)
+	}
+	for _, option := range []string{buffer.OptionWrap, buffer.OptionNumber, buffer.OptionCursorLine} {
+		if _, set := e.BufferOption(option); set {
+			t.Errorf("expected %s to be unset in %s", option, first)
+		}
+	}
+}
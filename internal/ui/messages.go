@@ -0,0 +1,98 @@
+package ui
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/lg2m/athena/internal/editor"
+	"github.com/lg2m/athena/internal/util"
+)
+
+// defaultMessageRows is how many messages the panel shows until it's resized.
+const defaultMessageRows = 8
+
+// MessagesView is the bottom panel listing the editor's message log, newest last.
+// Dragging its title row resizes it.
+type MessagesView struct {
+	BaseView
+	editor *editor.Editor
+	rows   int  // message rows requested by the user
+	drag   bool // title row held down with the mouse
+
+	titleStyle tcell.Style
+	timeStyle  tcell.Style
+}
+
+func NewMessagesView(e *editor.Editor) *MessagesView {
+	return &MessagesView{
+		editor:     e,
+		rows:       defaultMessageRows,
+		titleStyle: tcell.StyleDefault.Background(tcell.ColorDarkSlateGray).Foreground(tcell.ColorWhite),
+		timeStyle:  tcell.StyleDefault.Foreground(tcell.ColorGray),
+	}
+}
+
+// Height returns the height of the panel, title row included, on a screen of the
+// given height. The panel never takes more than half the screen.
+func (v *MessagesView) Height(screenHeight int) int {
+	return util.Clamp(v.rows+1, 2, max(screenHeight/2, 2))
+}
+
+// Draw implements the messages view.
+func (v *MessagesView) Draw(screen tcell.Screen) {
+	messages := v.editor.Messages()
+
+	title := fmt.Sprintf(" Messages (%d) ", len(messages))
+	v.drawRow(screen, v.y, []string{title}, []tcell.Style{v.titleStyle})
+
+	// show the newest messages that fit, oldest at the top
+	rows := v.height - 1
+	messages = messages[max(len(messages)-rows, 0):]
+	for i, msg := range messages {
+		v.drawRow(screen, v.y+1+i,
+			[]string{msg.Time.Format("15:04:05 "), msg.Text},
+			[]tcell.Style{v.timeStyle, tcell.StyleDefault})
+	}
+}
+
+// drawRow fills a row with the given parts, each in its own style. The row takes
+// the style of the first part and is truncated at the view's width.
+func (v *MessagesView) drawRow(screen tcell.Screen, y int, parts []string, styles []tcell.Style) {
+	for x := v.x; x < v.x+v.width; x++ {
+		screen.SetContent(x, y, ' ', nil, styles[0])
+	}
+
+	x := v.x
+	for i, part := range parts {
+		for _, ch := range part {
+			if x >= v.x+v.width {
+				return
+			}
+			screen.SetContent(x, y, ch, nil, styles[i])
+			x++
+		}
+	}
+}
+
+// HandleEvent resizes the panel when its title row is dragged. The panel's
+// bottom edge stays put, so the size follows the row the mouse is on.
+func (v *MessagesView) HandleEvent(ev tcell.Event) bool {
+	mouseEv, ok := ev.(*tcell.EventMouse)
+	if !ok {
+		return false
+	}
+
+	_, y := mouseEv.Position()
+	if mouseEv.Buttons()&tcell.Button1 == 0 {
+		wasDragging := v.drag
+		v.drag = false
+		return wasDragging
+	}
+	if !v.drag && y != v.y {
+		return false
+	}
+
+	v.drag = true
+	v.rows = max(v.y+v.height-y-1, 1)
+	return true
+}
@@ -0,0 +1,66 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/lg2m/athena/internal/editor"
+)
+
+func TestMessagesView(t *testing.T) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("failed to init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(40, 20)
+
+	e := editor.NewEditor()
+	for _, msg := range []string{"one", "two", "three"} {
+		e.SetMessage(msg)
+	}
+
+	v := NewMessagesView(e)
+	v.Resize(0, 17, 40, 3)
+	v.Draw(screen)
+
+	row := func(y int) string {
+		var b strings.Builder
+		for x := 0; x < 40; x++ {
+			r, _, _, _ := screen.GetContent(x, y)
+			b.WriteRune(r)
+		}
+		return strings.TrimSpace(b.String())
+	}
+	if got := row(17); got != "Messages (3)" {
+		t.Errorf("expected the title row, got %q", got)
+	}
+	// only the newest messages fit
+	if got := row(18); !strings.HasSuffix(got, " two") {
+		t.Errorf("expected %q on the first row, got %q", "two", got)
+	}
+	if got := row(19); !strings.HasSuffix(got, " three") {
+		t.Errorf("expected %q on the last row, got %q", "three", got)
+	}
+
+	// dragging the title up grows the panel, capped at half the screen
+	if v.HandleEvent(tcell.NewEventMouse(5, 10, tcell.Button1, tcell.ModNone)) {
+		t.Errorf("expected presses outside the title row to be ignored")
+	}
+	if !v.HandleEvent(tcell.NewEventMouse(5, 17, tcell.Button1, tcell.ModNone)) {
+		t.Fatalf("expected a press on the title row to start resizing")
+	}
+	if !v.HandleEvent(tcell.NewEventMouse(5, 14, tcell.Button1, tcell.ModNone)) {
+		t.Fatalf("expected dragging to be handled")
+	}
+	if !v.HandleEvent(tcell.NewEventMouse(5, 14, tcell.ButtonNone, tcell.ModNone)) {
+		t.Errorf("expected the release to end resizing")
+	}
+	if got := v.Height(20); got != 6 {
+		t.Errorf("expected height 6 after dragging, got %d", got)
+	}
+	if got := v.Height(8); got != 4 {
+		t.Errorf("expected height capped at 4, got %d", got)
+	}
+}
@@ -3,11 +3,13 @@ package ui
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 
 	"github.com/lg2m/athena/internal/athena/config"
 	"github.com/lg2m/athena/internal/editor"
+	"github.com/lg2m/athena/internal/editor/buffer"
 	"github.com/lg2m/athena/internal/editor/state"
 	"github.com/lg2m/athena/internal/util"
 )
@@ -31,14 +33,21 @@ type StatusBarView struct {
 	right      string
 	truncated  bool
 	maxLengths statusBarMaxLengths
+
+	percentOffsets [3]int // offset of the cursor-percentage option in the left, center and right sections, -1 when absent
+	percentStart   int    // screen column range the cursor-percentage option was drawn in
+	percentEnd     int
+	scrubbing      bool // mouse button held down after clicking the cursor-percentage option
 }
 
 func NewStatusBarView(e *editor.Editor, cfg *config.EditorConfig) *StatusBarView {
 	style := tcell.StyleDefault.Background(tcell.ColorDarkSlateGray).Foreground(tcell.ColorWhite)
 	return &StatusBarView{
-		editor: e,
-		cfg:    cfg,
-		style:  style,
+		editor:       e,
+		cfg:          cfg,
+		style:        style,
+		percentStart: -1,
+		percentEnd:   -1,
 	}
 }
 
@@ -50,18 +59,29 @@ func (v *StatusBarView) Draw(screen tcell.Screen) {
 
 // buildStatusSections constructs the left, center, and right sections.
 func (v *StatusBarView) buildStatusSections() {
-	v.left = v.buildSection(v.cfg.StatusBar.Left)
-	v.center = v.buildSection(v.cfg.StatusBar.Center)
-	v.right = v.buildSection(v.cfg.StatusBar.Right)
+	v.left, v.percentOffsets[0] = v.buildSection(v.cfg.StatusBar.Left)
+	v.center, v.percentOffsets[1] = v.buildSection(v.cfg.StatusBar.Center)
+	v.right, v.percentOffsets[2] = v.buildSection(v.cfg.StatusBar.Right)
+
+	// A pending message takes the place of the center section
+	if msg := v.editor.Message(); msg != "" {
+		v.center = fmt.Sprintf(" %s ", msg)
+		v.percentOffsets[1] = -1
+	}
 }
 
-// buildSection builds a single section based on the provided options.
-func (v *StatusBarView) buildSection(options []config.StatusBarOption) string {
+// buildSection builds a single section based on the provided options, along with
+// the offset of the cursor-percentage option in it or -1 when it has none.
+func (v *StatusBarView) buildSection(options []config.StatusBarOption) (string, int) {
 	var builder strings.Builder
+	percentOffset := -1
 	for _, opt := range options {
+		if opt == config.SectionCursorPercentage {
+			percentOffset = builder.Len()
+		}
 		builder.WriteString(v.getOptionString(opt))
 	}
-	return builder.String()
+	return builder.String(), percentOffset
 }
 
 // getOptionString returns the string representation for a given status bar option.
@@ -73,6 +93,8 @@ func (v *StatusBarView) getOptionString(opt config.StatusBarOption) string {
 			return fmt.Sprintf(" %s ", v.cfg.StatusBar.Mode.Normal)
 		case state.Insert:
 			return fmt.Sprintf(" %s ", v.cfg.StatusBar.Mode.Insert)
+		case state.Replace:
+			return fmt.Sprintf(" %s ", v.cfg.StatusBar.Mode.Replace)
 		default:
 			return " UNK "
 		}
@@ -84,8 +106,24 @@ func (v *StatusBarView) getOptionString(opt config.StatusBarOption) string {
 		if filePath, err := v.editor.FilePath(); err == nil && filePath != "" {
 			return fmt.Sprintf(" %s ", filePath)
 		}
-	// case config.SectionFileModified:
-	// case config.SectionFileEncoding:
+	case config.SectionFileModified:
+		modified := v.editor.ModifiedDuration()
+		if modified == 0 {
+			break
+		}
+		if warnAfter := time.Duration(v.cfg.UnsavedWarning) * time.Minute; warnAfter > 0 && modified >= warnAfter {
+			return fmt.Sprintf(" [+] unsaved for %s ", formatMinutes(modified))
+		}
+		return " [+] "
+	case config.SectionFileEncoding:
+		encoding, format, err := v.editor.FileEncoding()
+		if err != nil {
+			break
+		}
+		if format != buffer.FormatUnix {
+			return fmt.Sprintf(" %s [%s] ", encoding, format)
+		}
+		return fmt.Sprintf(" %s ", encoding)
 	case config.SectionFileType:
 		if ext, err := v.editor.FileType(); err == nil && ext != "" {
 			return fmt.Sprintf(" %s ", ext)
@@ -94,6 +132,13 @@ func (v *StatusBarView) getOptionString(opt config.StatusBarOption) string {
 	case config.SectionCursorPos:
 		currLine, currCol, _ := v.editor.GetCurrentPosition()
 		return fmt.Sprintf(" %d:%d ", currLine+1, currCol+1)
+	case config.SectionVirtualColumn:
+		currLine, _, _ := v.editor.GetCurrentPosition()
+		col, err := v.editor.VirtualColumn()
+		if err != nil {
+			return ""
+		}
+		return fmt.Sprintf(" %d:%d ", currLine+1, col+1)
 	case config.SectionLineCount:
 		total, _ := v.editor.GetLineCount()
 		return fmt.Sprintf(" %d ", total)
@@ -102,6 +147,10 @@ func (v *StatusBarView) getOptionString(opt config.StatusBarOption) string {
 		currLine, _, _ := v.editor.GetCurrentPosition()
 		scrollPercent := util.CalcProgress(total, currLine+1)
 		return fmt.Sprintf(" %d%% ", scrollPercent)
+	case config.SectionSelectionInfo:
+		if chars, lines := v.editor.SelectionInfo(); chars > 0 {
+			return fmt.Sprintf(" %s, %s ", plural(chars, "char"), plural(lines, "line"))
+		}
 	case config.SectionSpacer:
 		return " "
 	default:
@@ -110,6 +159,23 @@ func (v *StatusBarView) getOptionString(opt config.StatusBarOption) string {
 	return ""
 }
 
+// formatMinutes formats a duration in whole minutes, as 7m or 1h05m.
+func formatMinutes(d time.Duration) string {
+	minutes := int(d / time.Minute)
+	if minutes < 60 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dh%02dm", minutes/60, minutes%60)
+}
+
+// plural formats a count followed by a noun, adding an s unless the count is 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
 // handleOverflow manages the truncation of sections if the total length exceeds available width.
 func (v *StatusBarView) handleOverflow() {
 	totalLen := len(v.left) + len(v.center) + len(v.right)
@@ -167,6 +233,53 @@ func (v *StatusBarView) render(screen tcell.Screen) {
 	v.renderString(screen, v.left, leftX)
 	v.renderString(screen, v.center, centerX)
 	v.renderString(screen, v.right, rightX)
+
+	// Remember where the cursor percentage ended up for mouse clicks
+	v.percentStart, v.percentEnd = -1, -1
+	sections := [3]string{v.left, v.center, v.right}
+	for i, x := range [3]int{leftX, centerX, rightX} {
+		if offset := v.percentOffsets[i]; offset >= 0 && offset < len(sections[i]) {
+			percent := v.getOptionString(config.SectionCursorPercentage)
+			v.percentStart = x + offset
+			v.percentEnd = x + min(offset+len(percent), len(sections[i]))
+		}
+	}
+}
+
+// HandleEvent jumps through the file when the cursor percentage is clicked: the
+// column clicked within the percentage picks how far through the file to jump, from
+// the top at its first column to the end at its last, and dragging scrubs.
+func (v *StatusBarView) HandleEvent(ev tcell.Event) bool {
+	mouseEv, ok := ev.(*tcell.EventMouse)
+	if !ok || !v.cfg.Mouse {
+		return false
+	}
+
+	if mouseEv.Buttons()&tcell.Button1 == 0 {
+		wasScrubbing := v.scrubbing
+		v.scrubbing = false
+		return wasScrubbing
+	}
+
+	x, y := mouseEv.Position()
+	if !v.scrubbing {
+		if y != v.y || x < v.percentStart || x >= v.percentEnd {
+			return false
+		}
+		v.scrubbing = true
+	}
+
+	_ = v.editor.JumpToPercent(v.percentAtColumn(x), false)
+	return true
+}
+
+// percentAtColumn maps a screen column across the cursor percentage as last drawn
+// to a percentage, clamping columns dragged past either side of it.
+func (v *StatusBarView) percentAtColumn(x int) int {
+	if v.percentEnd-v.percentStart <= 1 {
+		return 100
+	}
+	return util.Clamp((x-v.percentStart)*100/(v.percentEnd-v.percentStart-1), 0, 100)
 }
 
 // renderString draws a string on the screen starting at the specified x position.
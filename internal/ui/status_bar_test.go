@@ -0,0 +1,114 @@
+package ui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/lg2m/athena/internal/athena/config"
+)
+
+func TestStatusBarPercentClick(t *testing.T) {
+	screen := tcell.NewSimulationScreen("")
+	if err := screen.Init(); err != nil {
+		t.Fatalf("failed to init screen: %v", err)
+	}
+	defer screen.Fini()
+	screen.SetSize(101, 1)
+
+	v, e := newTestDocumentView(t, strings.Repeat("line\n", 199)+"line")
+	v.cfg.Editor.StatusBar.Right = []config.StatusBarOption{config.SectionCursorPercentage}
+	bar := NewStatusBarView(e, &v.cfg.Editor)
+	bar.Resize(0, 0, 101, 1)
+	bar.Draw(screen)
+
+	// " 1% " is drawn at the right edge
+	press := tcell.NewEventMouse(99, 0, tcell.Button1, tcell.ModNone)
+	if bar.HandleEvent(press) {
+		t.Fatalf("expected clicks to be ignored without the mouse option")
+	}
+
+	v.cfg.Editor.Mouse = true
+	if bar.HandleEvent(tcell.NewEventMouse(10, 0, tcell.Button1, tcell.ModNone)) {
+		t.Errorf("expected clicks outside the percentage to be ignored")
+	}
+
+	// the four columns of the percentage span the file; dragging past them clamps
+	tests := []struct {
+		x, line int
+	}{
+		{100, 199},
+		{98, 65}, // 33% of 200 lines
+		{99, 131},
+		{97, 0},
+		{60, 0},
+	}
+	for _, tt := range tests {
+		if !bar.HandleEvent(tcell.NewEventMouse(tt.x, 0, tcell.Button1, tcell.ModNone)) {
+			t.Fatalf("expected the click at %d to be handled", tt.x)
+		}
+		if line, _, _ := e.GetCurrentPosition(); line != tt.line {
+			t.Errorf("column %d: expected line %d, got %d", tt.x, tt.line, line)
+		}
+	}
+
+	if !bar.HandleEvent(tcell.NewEventMouse(0, 0, tcell.ButtonNone, tcell.ModNone)) {
+		t.Errorf("expected the release to end scrubbing")
+	}
+	if bar.HandleEvent(tcell.NewEventMouse(50, 0, tcell.Button1, tcell.ModNone)) {
+		t.Errorf("expected clicks after scrubbing to need the percentage again")
+	}
+}
+
+func TestFileModifiedSection(t *testing.T) {
+	v, e := newTestDocumentView(t, "text")
+	bar := NewStatusBarView(e, &v.cfg.Editor)
+
+	if got := bar.getOptionString(config.SectionFileModified); got != "" {
+		t.Errorf("expected nothing for an unmodified buffer, got %q", got)
+	}
+
+	typeKeys(v, "ix<esc>")
+	if got := bar.getOptionString(config.SectionFileModified); got != " [+] " {
+		t.Errorf("expected the modified marker, got %q", got)
+	}
+
+	// a threshold the buffer can't have reached yet keeps the plain marker
+	v.cfg.Editor.UnsavedWarning = 10
+	if got := bar.getOptionString(config.SectionFileModified); got != " [+] " {
+		t.Errorf("expected no warning before the threshold, got %q", got)
+	}
+}
+
+func TestVirtualColumnSection(t *testing.T) {
+	v, e := newTestDocumentView(t, "\tab")
+	bar := NewStatusBarView(e, &v.cfg.Editor)
+	_ = e.MoveCursorHorizontal(2, false)
+
+	// the grapheme column stays available next to the virtual one
+	if got := bar.getOptionString(config.SectionCursorPos); got != " 1:3 " {
+		t.Errorf("expected the grapheme column, got %q", got)
+	}
+	if got := bar.getOptionString(config.SectionVirtualColumn); got != " 1:6 " {
+		t.Errorf("expected the virtual column, got %q", got)
+	}
+}
+
+func TestFormatMinutes(t *testing.T) {
+	tests := []struct {
+		d        time.Duration
+		expected string
+	}{
+		{30 * time.Second, "0m"},
+		{7*time.Minute + 59*time.Second, "7m"},
+		{65 * time.Minute, "1h05m"},
+		{26 * time.Hour, "26h00m"},
+	}
+
+	for _, tt := range tests {
+		if got := formatMinutes(tt.d); got != tt.expected {
+			t.Errorf("formatMinutes(%v): expected %q, got %q", tt.d, tt.expected, got)
+		}
+	}
+}
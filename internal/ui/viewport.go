@@ -1,9 +1,19 @@
 package ui
 
+import (
+	"github.com/rivo/uniseg"
+
+	"github.com/lg2m/athena/internal/editor"
+	"github.com/lg2m/athena/internal/editor/buffer"
+	"github.com/lg2m/athena/internal/util"
+)
+
 // Viewport handles scrolling and visible area management.
 type Viewport struct {
-	offset  int // lines scrolled from top
-	padding int // lines to keep visible above/below cursor
+	offset    int // lines scrolled from top
+	leftCol   int // columns scrolled from the left, 0 when wrapping is on
+	padding   int // lines to keep visible above/below cursor
+	wrapWidth int // columns at which lines soft-wrap, 0 when wrapping is off
 }
 
 func NewViewport(padding int) *Viewport {
@@ -14,12 +24,97 @@ func NewViewport(padding int) *Viewport {
 
 // Update adjusts viewport position to keep cursor visible.
 func (v *Viewport) Update(currLine, viewHeight int) {
-	if currLine-v.offset < v.padding {
+	// views shorter than both paddings can't honor them
+	padding := max(0, min(v.padding, (viewHeight-1)/2))
+	if currLine-v.offset < padding {
 		// cursor too close to top
-		v.offset = max(0, currLine-v.padding)
-	} else if currLine-v.offset > viewHeight-v.padding {
+		v.offset = max(0, currLine-padding)
+	} else if currLine-v.offset > viewHeight-padding {
 		// cursor too close to bottom
-		v.offset = currLine - (viewHeight - v.padding)
+		v.offset = currLine - (viewHeight - padding)
+	}
+}
+
+// Clamp keeps the cursor line on screen after the view height changed and scrolls
+// back up when the view grew past the end of the buffer.
+func (v *Viewport) Clamp(currLine, viewHeight, totalLines int) {
+	v.Update(currLine, viewHeight)
+	v.offset = min(v.offset, max(0, totalLines-viewHeight))
+	v.offset = max(v.offset, currLine-viewHeight+1, 0)
+}
+
+// ScrollLines scrolls the view by n lines, down when n is positive, stopping at the
+// top and once the last line is at the bottom of the view.
+func (v *Viewport) ScrollLines(n, viewHeight, totalLines int) {
+	v.offset = util.Clamp(v.offset+n, 0, max(0, totalLines-viewHeight))
+}
+
+// ScrollColumns scrolls unwrapped lines by n columns, right when n is positive,
+// stopping once the end of the longest line is at the right edge of the view.
+func (v *Viewport) ScrollColumns(n, viewWidth, longest int) {
+	if v.wrapWidth > 0 {
+		return
+	}
+	v.leftCol = util.Clamp(v.leftCol+n, 0, max(0, longest-viewWidth+1))
+}
+
+// CursorLineRange returns the lines the cursor can be on without Update scrolling
+// the view, honoring the padding except at the top of the document.
+func (v *Viewport) CursorLineRange(viewHeight int) (int, int) {
+	padding := max(0, min(v.padding, (viewHeight-1)/2))
+	first := v.offset + padding
+	if v.offset == 0 {
+		first = 0
+	}
+	return first, max(first, v.offset+viewHeight-1-padding)
+}
+
+// UpdateColumn scrolls horizontally to keep the cursor column visible.
+func (v *Viewport) UpdateColumn(currCol, viewWidth int) {
+	if currCol < v.leftCol {
+		v.leftCol = currCol
+	} else if currCol >= v.leftCol+viewWidth {
+		v.leftCol = currCol - viewWidth + 1
+	}
+}
+
+// LeftCol returns the number of columns unwrapped lines are scrolled from the left.
+func (v *Viewport) LeftCol() int {
+	return v.leftCol
+}
+
+// SetWrapWidth sets the column at which lines soft-wrap; 0 disables wrapping.
+// Wrapped lines are always shown from their first column.
+func (v *Viewport) SetWrapWidth(width int) {
+	v.wrapWidth = max(0, width)
+	if v.wrapWidth > 0 {
+		v.leftCol = 0
+	}
+}
+
+// WrapWidth returns the column at which lines soft-wrap, or 0 when wrapping is off.
+func (v *Viewport) WrapWidth() int {
+	return v.wrapWidth
+}
+
+// ScrollToCursor scrolls down until the screen row holding the cursor is on screen.
+// Update only accounts for buffer lines, so this is needed once lines wrap.
+func (v *Viewport) ScrollToCursor(e *editor.Editor, currLine, currCol, viewHeight, totalLines int) {
+	if v.wrapWidth == 0 {
+		return
+	}
+	for v.offset < currLine {
+		rows := screenRows(e, v.offset, viewHeight, totalLines, v.wrapWidth)
+		for _, row := range rows {
+			if row.line == currLine && currCol < row.startCol+v.wrapWidth {
+				return
+			}
+		}
+		if end, ok := e.FoldAt(v.offset); ok {
+			v.offset = end + 1
+		} else {
+			v.offset++
+		}
 	}
 }
 
@@ -29,3 +124,99 @@ func (v *Viewport) VisibleRange(viewHeight, totalLines int) (start, end int) {
 	end = min(totalLines, v.offset+viewHeight)
 	return start, end
 }
+
+// visibleLines returns the buffer lines shown on screen starting at the given line,
+// skipping the lines hidden by closed folds.
+func visibleLines(e *editor.Editor, start, viewHeight, totalLines int) []int {
+	lines := make([]int, 0, viewHeight)
+	for line := start; line < totalLines && len(lines) < viewHeight; line++ {
+		lines = append(lines, line)
+		if end, ok := e.FoldAt(line); ok {
+			line = end
+		}
+	}
+	return lines
+}
+
+// screenRow is a single row of text on screen: the part of a buffer line
+// starting at screen column startCol. Unwrapped lines always start at column 0.
+type screenRow struct {
+	line     int
+	startCol int
+}
+
+// scrollRows shifts unwrapped rows to start at the horizontal scroll position.
+func (v *Viewport) scrollRows(rows []screenRow) []screenRow {
+	if v.wrapWidth == 0 {
+		for i := range rows {
+			rows[i].startCol = v.leftCol
+		}
+	}
+	return rows
+}
+
+// screenRows lays out the visible lines starting at the given line into screen rows,
+// splitting lines longer than wrapWidth across several rows when wrapping is on.
+func screenRows(e *editor.Editor, start, viewHeight, totalLines, wrapWidth int) []screenRow {
+	rows := make([]screenRow, 0, viewHeight)
+	for _, line := range visibleLines(e, start, viewHeight, totalLines) {
+		count := 1
+		if _, folded := e.FoldAt(line); wrapWidth > 0 && !folded {
+			text, _ := e.GetLine(line)
+			cols := lineColumns([]rune(text), tabWidth(e))
+			count = max(1, (cols[len(cols)-1]+wrapWidth-1)/wrapWidth)
+		}
+		for r := 0; r < count && len(rows) < viewHeight; r++ {
+			rows = append(rows, screenRow{line: line, startCol: r * wrapWidth})
+		}
+	}
+	return rows
+}
+
+// tabWidth returns the tab width of the current buffer.
+func tabWidth(e *editor.Editor) int {
+	indentation, _ := e.Indentation()
+	return indentation.TabWidth
+}
+
+// lineColumns returns the screen column each rune of a line starts at, followed by
+// the width of the whole line. A grapheme cluster's width goes to its first rune, and
+// the runes combined with it take no columns of their own.
+func lineColumns(runes []rune, tabWidth int) []int {
+	cols := make([]int, len(runes)+1)
+	i := 0
+	gr := uniseg.NewGraphemes(string(runes))
+	for gr.Next() {
+		end := buffer.AdvanceColumn(cols[i], gr.Str(), tabWidth)
+		for range gr.Runes() {
+			i++
+			cols[i] = end
+		}
+	}
+	return cols
+}
+
+// runeAtColumn returns the rune drawn at a screen column, or the end of the line
+// when the column is past it.
+func runeAtColumn(cols []int, col int) int {
+	for i := 0; i < len(cols)-1; i++ {
+		if col < cols[i+1] {
+			return i
+		}
+	}
+	return len(cols) - 1
+}
+
+// screenColumn returns the screen column a rune of the given line starts at.
+func screenColumn(e *editor.Editor, line, col int) int {
+	text, err := e.GetLine(line)
+	if err != nil {
+		return col
+	}
+	runes := []rune(text)
+	cols := lineColumns(runes, tabWidth(e))
+	if col > len(runes) {
+		return cols[len(runes)] + col - len(runes)
+	}
+	return cols[max(0, col)]
+}
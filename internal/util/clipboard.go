@@ -0,0 +1,92 @@
+package util
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+var ErrNoClipboard = errors.New("clipboard: no clipboard tool found")
+
+// Clipboard interface defines the clipboard operations we need.
+type Clipboard interface {
+	Read() (string, error)
+	Write(text string) error
+}
+
+// MemoryClipboard implements Clipboard in memory, for when no system clipboard is available.
+type MemoryClipboard struct {
+	text string
+	mu   sync.Mutex
+}
+
+func (c *MemoryClipboard) Read() (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.text, nil
+}
+
+func (c *MemoryClipboard) Write(text string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.text = text
+	return nil
+}
+
+// clipboardTool is a pair of commands copying to and pasting from the system clipboard.
+type clipboardTool struct {
+	copy  []string
+	paste []string
+}
+
+// clipboardTools lists the supported tools in order of preference.
+var clipboardTools = []clipboardTool{
+	{copy: []string{"pbcopy"}, paste: []string{"pbpaste"}},
+	{copy: []string{"wl-copy"}, paste: []string{"wl-paste", "--no-newline"}},
+	{copy: []string{"xclip", "-selection", "clipboard"}, paste: []string{"xclip", "-selection", "clipboard", "-o"}},
+	{copy: []string{"xsel", "--clipboard", "--input"}, paste: []string{"xsel", "--clipboard", "--output"}},
+}
+
+// SystemClipboard implements Clipboard by running the platform's clipboard tools.
+type SystemClipboard struct {
+	tool clipboardTool
+}
+
+// NewSystemClipboard finds an installed clipboard tool.
+func NewSystemClipboard() (*SystemClipboard, error) {
+	for _, tool := range clipboardTools {
+		if _, err := exec.LookPath(tool.copy[0]); err != nil {
+			continue
+		}
+		if _, err := exec.LookPath(tool.paste[0]); err != nil {
+			continue
+		}
+		return &SystemClipboard{tool: tool}, nil
+	}
+	return nil, ErrNoClipboard
+}
+
+func (c *SystemClipboard) Read() (string, error) {
+	out, err := exec.Command(c.tool.paste[0], c.tool.paste[1:]...).Output()
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func (c *SystemClipboard) Write(text string) error {
+	cmd := exec.Command(c.tool.copy[0], c.tool.copy[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+// NewClipboard returns the system clipboard when available, otherwise an in-memory one.
+func NewClipboard() Clipboard {
+	if c, err := NewSystemClipboard(); err == nil {
+		return c
+	}
+	return &MemoryClipboard{}
+}
@@ -0,0 +1,33 @@
+package util
+
+import "testing"
+
+func TestMemoryClipboard(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{name: "empty", want: ""},
+		{name: "single write", writes: []string{"hello"}, want: "hello"},
+		{name: "last write wins", writes: []string{"one", "two\n"}, want: "two\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &MemoryClipboard{}
+			for _, text := range tt.writes {
+				if err := c.Write(text); err != nil {
+					t.Fatalf("Write failed: %v", err)
+				}
+			}
+			got, err := c.Read()
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
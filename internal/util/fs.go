@@ -1,6 +1,7 @@
 package util
 
 import (
+	"os"
 	"path/filepath"
 	"strings"
 )
@@ -49,3 +50,45 @@ func (fu *FileUtil) GetFileExt(filePath string) string {
 	ext := fu.fs.Ext(filePath)
 	return strings.TrimPrefix(ext, ".")
 }
+
+// writeData writes data to the temporary file; tests replace it to make writes fail.
+var writeData = func(f *os.File, data []byte) error {
+	_, err := f.Write(data)
+	return err
+}
+
+// WriteFileAtomic writes data to a temporary file next to path and renames it over
+// path, so readers see either the old content or the new one, never a partial write.
+// A symlink is followed so it keeps pointing at the file written. An existing file
+// keeps its permissions; a new one is created with perm.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	// the rename consumes the temporary file on success
+	defer os.Remove(tmp.Name())
+
+	if err := writeData(tmp, data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -1,6 +1,11 @@
 package util
 
-import "testing"
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
 
 // MockFileSystem is a mock implementation of FileSystem
 type MockFileSystem struct {
@@ -62,3 +67,78 @@ func TestFileUtilWithMocks(t *testing.T) {
 		}
 	})
 }
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.txt")
+
+	if err := WriteFileAtomic(path, []byte("first"), 0600); err != nil {
+		t.Fatalf("WriteFileAtomic failed: %v", err)
+	}
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatalf("failed to chmod: %v", err)
+	}
+	if err := WriteFileAtomic(path, []byte("second"), 0600); err != nil {
+		t.Fatalf("WriteFileAtomic failed: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	if string(content) != "second" {
+		t.Errorf("expected %q, got %q", "second", content)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0640 {
+		t.Errorf("expected the existing permissions to be kept, got %v", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected no temporary files to be left behind, got %d entries", len(entries))
+	}
+}
+
+func TestWriteFileAtomicFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	write := writeData
+	defer func() { writeData = write }()
+	writeData = func(f *os.File, data []byte) error {
+		_, _ = f.Write(data[:len(data)/2])
+		return errors.New("disk full")
+	}
+
+	if err := WriteFileAtomic(path, []byte("replacement"), 0644); err == nil || err.Error() != "disk full" {
+		t.Fatalf("expected the write error, got %v", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "original" {
+		t.Errorf("expected the original file untouched, got %q", content)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("expected no temporary files to be left behind, got %d entries", len(entries))
+	}
+}
+
+func TestWriteFileAtomicSymlink(t *testing.T) {
+	dir := t.TempDir()
+	path, link := filepath.Join(dir, "target.txt"), filepath.Join(dir, "link.txt")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.Symlink(path, link); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	if err := WriteFileAtomic(link, []byte("new"), 0644); err != nil {
+		t.Fatalf("WriteFileAtomic failed: %v", err)
+	}
+	if info, _ := os.Lstat(link); info.Mode()&os.ModeSymlink == 0 {
+		t.Error("expected the symlink to be kept")
+	}
+	if content, _ := os.ReadFile(path); string(content) != "new" {
+		t.Errorf("expected the target written, got %q", content)
+	}
+}
@@ -8,6 +8,16 @@ func CalcProgress(tot, curr int) int {
 	return int(((float64(curr) / float64(tot)) * 100) + 0.5)
 }
 
+// LineAtPercent returns the 0-based line found at a percentage of tot lines,
+// rounding up like vim's N%.
+func LineAtPercent(tot, percent int) int {
+	if tot == 0 {
+		return 0
+	}
+	percent = Clamp(percent, 0, 100)
+	return Clamp((percent*tot+99)/100-1, 0, tot-1)
+}
+
 // Clamp clamps a value within a range.
 func Clamp(value, min, max int) int {
 	if value < min {
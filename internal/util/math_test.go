@@ -63,3 +63,29 @@ func TestClamp(t *testing.T) {
 		}
 	}
 }
+
+func TestLineAtPercent(t *testing.T) {
+	tests := []struct {
+		name    string
+		tot     int
+		percent int
+		want    int
+	}{
+		{"empty buffer", 0, 50, 0},
+		{"start", 100, 0, 0},
+		{"half", 100, 50, 49},
+		{"end", 100, 100, 99},
+		{"rounds up", 3, 50, 1},
+		{"single line", 1, 75, 0},
+		{"below range", 10, -5, 0},
+		{"above range", 10, 150, 9},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LineAtPercent(tt.tot, tt.percent); got != tt.want {
+				t.Errorf("LineAtPercent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}